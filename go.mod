@@ -5,4 +5,7 @@ go 1.21
 require (
 	github.com/esimov/pigo v1.4.6
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	golang.org/x/image v0.15.0
 )
+
+require golang.org/x/text v0.14.0 // indirect
@@ -0,0 +1,62 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// Default -alpha-background: cut-outs are placed on white like a passport backdrop
+const DEFAULT_ALPHA_BACKGROUND = "white"
+
+// namedColors are the color names accepted by -alpha-background besides #RRGGBB
+var namedColors = map[string]color.RGBA{
+	"white": {255, 255, 255, 255},
+	"gray":  {128, 128, 128, 255},
+	"black": {0, 0, 0, 255},
+}
+
+// parseColor parses a color name (white, gray, black) or a hex color (#RRGGBB)
+func parseColor(value string) (color.RGBA, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	if c, ok := namedColors[text]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(text, "#")
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s' (white, gray, black, or #RRGGBB)", value)
+	}
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 255}, nil
+}
+
+// flattenAlpha composites an image with transparency (e.g. a cut-out PNG from a
+// background removal app) onto an opaque background. Semi-transparent edge pixels
+// are blended with the background; otherwise resizing would average transparent
+// pixels in and the JPEG encode would turn them into dark fringes. Opaque images
+// are returned unchanged.
+func flattenAlpha(img image.Image, background color.Color) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	logInfo("🫥 Transparent areas filled with the background color")
+	return compositeOver(img, background)
+}
+
+// isOpaque reports whether every pixel of img is fully opaque
+func isOpaque(img image.Image) bool {
+	opaque, ok := img.(interface{ Opaque() bool })
+	return ok && opaque.Opaque()
+}
+
+// compositeOver blends img over an opaque background color
+func compositeOver(img image.Image, background color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Over)
+	return canvas
+}
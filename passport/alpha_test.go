@@ -0,0 +1,136 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cutOutPortrait returns a cut-out like background removal apps produce: a gray
+// head on fully transparent pixels whose color is black, with a soft edge of
+// semi-transparent pixels around the head
+func cutOutPortrait(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	cx, cy := float64(width)/2, float64(height)*0.45
+	rx, ry := float64(width)*0.2, float64(height)*0.25
+	const edge = 0.15 // Width of the soft edge relative to the radius
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r := math.Hypot((float64(x)-cx)/rx, (float64(y)-cy)/ry)
+			alpha := math.Max(0, math.Min(1, (1+edge-r)/edge))
+			if alpha > 0 {
+				img.SetNRGBA(x, y, color.NRGBA{120, 120, 120, uint8(math.Round(alpha * 255))})
+			}
+		}
+	}
+	return img
+}
+
+// The transparent surroundings come out in the background color and the soft edge
+// blends from the head into it, with no dark halo from the black under the alpha
+func TestTransparentInputHasNoHalo(t *testing.T) {
+	for _, background := range []color.RGBA{{255, 255, 255, 255}, {200, 220, 240, 255}} {
+		result, err := Generate(cutOutPortrait(600, 800), WithStrategy(STRATEGY_CENTER), WithAlphaBackground(background))
+		if err != nil {
+			t.Fatal(err)
+		}
+		photo := result.Photo
+		bounds := photo.Bounds()
+		border := bounds.Dx() / 20
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := photo.At(x, y).RGBA()
+				c := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255}
+				// Nothing is darker than the head itself
+				if min(c.R, c.G, c.B) < 115 {
+					t.Fatalf("background %v: pixel (%d,%d) is %v, darker than the head", background, x, y, c)
+				}
+				inBorder := x < bounds.Min.X+border || x >= bounds.Max.X-border || y < bounds.Min.Y+border
+				if inBorder && colorDistance([3]float64{float64(c.R), float64(c.G), float64(c.B)},
+					[3]float64{float64(background.R), float64(background.G), float64(background.B)}) > 3 {
+					t.Fatalf("background %v: border pixel (%d,%d) is %v", background, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+// JPEG has no alpha: transparent pixels are written as white paper and
+// semi-transparent ones blended with it, never as the black their color holds
+func TestEncodeTransparentPixelsOverWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 16; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 128})
+		}
+	}
+	data, err := encodeImage(img, SaveOptions{Metadata: METADATA_NONE, Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		at   image.Point
+		want uint8
+	}{
+		{"transparent", image.Pt(8, 8), 255},
+		{"half transparent black", image.Pt(24, 8), 127},
+	} {
+		r, g, b, _ := decoded.At(tt.at.X, tt.at.Y).RGBA()
+		for _, v := range []uint32{r >> 8, g >> 8, b >> 8} {
+			if d := int(v) - int(tt.want); d < -3 || d > 3 {
+				t.Errorf("%s pixel written as (%d,%d,%d), want %d", tt.name, r>>8, g>>8, b>>8, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// A PNG sheet with transparent paper is blank white paper: every slot is free and
+// the gaps stay white
+func TestAppendToTransparentSheet(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := lookupPrintFormat(SHEET_10X15, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rectangle{Max: format.SheetSize()})); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "transparent.png")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	photo := image.NewRGBA(image.Rect(0, 0, spec.WidthPX, spec.HeightPX))
+	draw.Draw(photo, photo.Bounds(), &image.Uniform{color.RGBA{120, 120, 120, 255}}, image.Point{}, draw.Src)
+	sheet, err := appendToSheet(path, photo, []PrintFormat{format}, spec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slots := gridSlots(calculateGridLayout(format), format)
+	canvas := sheet.Image.(*image.RGBA)
+	for _, slot := range slots {
+		if c := canvas.RGBAAt(slot.Min.X+slot.Dx()/2, slot.Min.Y+slot.Dy()/2); c.R != 120 {
+			t.Errorf("slot %v holds %v, want the appended photo", slot, c)
+		}
+	}
+	if c := canvas.RGBAAt(1, 1); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("sheet corner is %v, want white paper", c)
+	}
+}
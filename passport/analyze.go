@@ -0,0 +1,79 @@
+package passport
+
+import (
+	"image"
+)
+
+// FaceAnalysis describes one face found by AnalyzeFaces, in the pixel coordinates
+// of the analyzed image. Unlike the passport pipeline nothing is cropped or resized.
+type FaceAnalysis struct {
+	Box      image.Rectangle // Face box of the detector
+	Score    float32         // Detection score
+	Center   image.Point     // Horizontal face center at eye level
+	Eyes     [2]image.Point  // Left and right eye as seen in the image
+	Located  bool            // Eyes were located by the pupil cascade; false when estimated from Box
+	SkullTop int             // Estimated top of the skull
+	HairTop  int             // Top of the hair; SkullTop when no hair above it was found
+	Chin     int             // Estimated chin
+	Head     image.Rectangle // Box from the hair top to the chin, as wide as Box
+}
+
+// DefaultDetectionOptions returns the detection settings of the CLI defaults, as a
+// starting point for AnalyzeFaces
+func DefaultDetectionOptions() DetectionOptions {
+	return defaultConfig().Detection
+}
+
+// AnalyzeFaces finds every face in img, best first, with the landmarks the passport
+// crop is built on: located or estimated eyes, skull top, hair top and chin. It
+// loads the cascades from FACE_CASCADE_PATH; use FaceDetector.Analyze to reuse them
+// for many images. It fails when no face passes the confidence threshold.
+//
+// See the example for drawing the results on a copy of the image with the debug
+// overlay.
+func AnalyzeFaces(img image.Image, opts DetectionOptions) ([]FaceAnalysis, error) {
+	if err := validateDetectionOptions(opts); err != nil {
+		return nil, err
+	}
+	detector, err := NewFaceDetector(FACE_CASCADE_PATH, opts)
+	if err != nil {
+		return nil, err
+	}
+	return detector.Analyze(img)
+}
+
+// Analyze is AnalyzeFaces with the cascades and options of d
+func (d *FaceDetector) Analyze(img image.Image) ([]FaceAnalysis, error) {
+	detections, err := d.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	faces := make([]FaceAnalysis, len(detections))
+	for i := range detections {
+		faces[i] = analyzeFace(img, &detections[i])
+	}
+	return faces, nil
+}
+
+// analyzeFace derives the landmarks of one detection the same way the passport crop
+// does, see estimateHeadLandmarks and estimateHairTop
+func analyzeFace(img image.Image, face *FaceDetection) FaceAnalysis {
+	centerX, eyeY, skullTop, chin := estimateHeadLandmarks(face)
+	analysis := FaceAnalysis{
+		Box:      image.Rect(face.X-face.Size/2, face.Y-face.Size/2, face.X+face.Size/2, face.Y+face.Size/2),
+		Score:    face.Score,
+		Center:   image.Pt(centerX, eyeY),
+		SkullTop: skullTop,
+		HairTop:  min(skullTop, estimateHairTop(img, face, skullTop)),
+		Chin:     chin,
+	}
+	if face.Pupils != nil {
+		analysis.Eyes = [2]image.Point{face.Pupils.Left, face.Pupils.Right}
+		analysis.Located = true
+	} else {
+		offset := int(PUPIL_SEARCH_COL_OFFSET * float64(face.Size))
+		analysis.Eyes = [2]image.Point{image.Pt(face.X-offset, eyeY), image.Pt(face.X+offset, eyeY)}
+	}
+	analysis.Head = image.Rect(analysis.Box.Min.X, analysis.HairTop, analysis.Box.Max.X, chin)
+	return analysis
+}
@@ -0,0 +1,52 @@
+package passport
+
+import (
+	"image"
+	"testing"
+)
+
+func TestAnalyzeFacesOnSample(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces, err := AnalyzeFaces(source.Image, DefaultDetectionOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := faces[0]
+	if !face.Located {
+		t.Error("pupils weren't located on the sample portrait")
+	}
+	if face.Eyes[0].X >= face.Eyes[1].X {
+		t.Errorf("left eye %v isn't left of the right eye %v", face.Eyes[0], face.Eyes[1])
+	}
+	for _, eye := range face.Eyes {
+		if !eye.In(face.Box) {
+			t.Errorf("eye %v outside the face box %v", eye, face.Box)
+		}
+		if !(face.HairTop <= face.SkullTop && face.SkullTop < eye.Y && eye.Y < face.Chin) {
+			t.Errorf("hair top %d, skull top %d, eye %d, chin %d out of order", face.HairTop, face.SkullTop, eye.Y, face.Chin)
+		}
+	}
+	if face.Head.Min.Y != face.HairTop || face.Head.Max.Y != face.Chin {
+		t.Errorf("head box %v doesn't span hair top %d to chin %d", face.Head, face.HairTop, face.Chin)
+	}
+}
+
+func TestAnalyzeFacesWithoutFace(t *testing.T) {
+	requireCascade(t)
+	blank := image.NewGray(image.Rect(0, 0, 400, 500))
+	if faces, err := AnalyzeFaces(blank, DefaultDetectionOptions()); err == nil {
+		t.Errorf("AnalyzeFaces on a blank image = %d faces, want an error", len(faces))
+	}
+}
+
+func TestAnalyzeFacesRejectsInvalidOptions(t *testing.T) {
+	opts := DefaultDetectionOptions()
+	opts.ClusterIoU = 2
+	if _, err := AnalyzeFaces(image.NewGray(image.Rect(0, 0, 10, 10)), opts); err == nil {
+		t.Error("AnalyzeFaces accepted a cluster IoU of 2")
+	}
+}
@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// A grid slot of an existing sheet is free when it is near-uniform white: mean
+	// luminance (0-1) at least this bright and a standard deviation below the limit,
+	// which leaves room for JPEG noise but not for any photo
+	APPEND_BLANK_MIN_LUMINANCE = 0.95
+	APPEND_BLANK_MAX_STDDEV    = 0.02
+)
+
+// matchSheetFormat finds the print format an existing sheet was laid out with: one
+// of the selected formats, or else any format known for the spec, with the sheet's
+// exact pixel size
+func matchSheetFormat(size image.Point, selected []PrintFormat, spec PhotoSpec) (PrintFormat, error) {
+	candidates := append([]PrintFormat{}, selected...)
+	candidates = append(candidates, getPredefinedFormats(spec)...)
+	candidates = append(candidates, createStripFormat(spec))
+	for _, format := range candidates {
+		if format.SheetSize() == size {
+			return format, nil
+		}
+	}
+	return PrintFormat{}, fmt.Errorf("sheet is %dx%d pixels, which matches no print format for %gx%gmm photos at %d DPI",
+		size.X, size.Y, spec.WidthMM, spec.HeightMM, spec.DPI)
+}
+
+// isBlankSlot reports whether a slot of the sheet is still empty paper
+func isBlankSlot(sheet image.Image, slot image.Rectangle) bool {
+	bounds := sheet.Bounds()
+	var sum, sumSq float64
+	count := 0
+	for y := slot.Min.Y; y < slot.Max.Y; y++ {
+		for x := slot.Min.X; x < slot.Max.X; x++ {
+			r, g, b, _ := sheet.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 65535
+			sum += lum
+			sumSq += lum * lum
+			count++
+		}
+	}
+	mean := sum / float64(count)
+	stddev := math.Sqrt(math.Max(0, sumSq/float64(count)-mean*mean))
+	return mean >= APPEND_BLANK_MIN_LUMINANCE && stddev <= APPEND_BLANK_MAX_STDDEV
+}
+
+// appendToSheet places the photo into every free slot of an existing sheet, or into
+// the first count of them when count is above 0. The slots come from the same grid
+// math as createPrintLayout, so they line up with the photos already printed. Fails
+// when the sheet matches no known format or has no free slot left.
+func appendToSheet(path string, photo image.Image, formats []PrintFormat, spec PhotoSpec, count int) (Sheet, error) {
+	source, err := loadImage(path)
+	if err != nil {
+		return Sheet{}, fmt.Errorf("error loading sheet to append to: %v", err)
+	}
+	// Transparent areas of a PNG sheet are blank paper, not black
+	sheet := source.Image
+	if !isOpaque(sheet) {
+		sheet = compositeOver(sheet, color.White)
+	}
+	bounds := sheet.Bounds()
+	format, err := matchSheetFormat(bounds.Size(), formats, spec)
+	if err != nil {
+		return Sheet{}, err
+	}
+
+	// The grid is laid out on the nominal format, inside any bleed
+	var slots []image.Rectangle
+	for _, slot := range gridSlots(calculateGridLayout(format), format) {
+		slots = append(slots, slot.Add(format.TrimBox().Min))
+	}
+	var free []image.Rectangle
+	for _, slot := range slots {
+		if isBlankSlot(sheet, slot) {
+			free = append(free, slot)
+		}
+	}
+	if len(free) == 0 {
+		return Sheet{}, fmt.Errorf("no free slots left on %s (%s, all %d photos placed)", path, format.Key, len(slots))
+	}
+
+	used := len(slots) - len(free)
+	if count > 0 && count < len(free) {
+		free = free[:count]
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), sheet, bounds.Min, draw.Src)
+	fitted := make(map[image.Point]image.Image)
+	for _, slot := range free {
+		slotPhoto := fitPhotoToSlot(photo, slot.Size(), fitted)
+		draw.Draw(canvas, slot, slotPhoto, slotPhoto.Bounds().Min, draw.Src)
+	}
+	logInfo("📎 Appended %d photo(s) to %s (%s), %d of %d slots were already used",
+		len(free), path, format.Key, used, len(slots))
+	return Sheet{Format: format, Image: canvas, Path: path}, nil
+}
@@ -0,0 +1,61 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// Rotated retries run on a copy downscaled to at most this many pixels on the long side
+	AUTO_ROTATE_DETECTION_SIZE = 800
+
+	// A face found on a rotated copy must score at least this high before the rotation
+	// is applied, since a sideways photo is unusual enough that a weak hit is likely wrong
+	AUTO_ROTATE_MIN_CONFIDENCE = 5.0
+)
+
+// detectRotatedFace retries face detection on 90°, 180°, and 270° rotations of a
+// downscaled copy of img. It is used when no face was found upright, e.g. for photos
+// that were physically rotated without an EXIF orientation tag. Returns the rotation
+// (degrees clockwise, as understood by rotateImage) and the face in the coordinates of
+// the full image rotated by that amount, or an error when no rotation yields a confident face.
+func (d *FaceDetector) detectRotatedFace(img image.Image) (int, *FaceDetection, error) {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(AUTO_ROTATE_DETECTION_SIZE)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := img
+	if scale < 1 {
+		small = resizeImage(img, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+	}
+
+	rotatedOpts := d.Options
+	rotatedOpts.MinConfidence = math.Max(rotatedOpts.MinConfidence, AUTO_ROTATE_MIN_CONFIDENCE)
+	rotatedOpts.RotateSearch = false // tilted passes on every quarter turn would be too slow
+	rotated := d.withOptions(rotatedOpts)
+
+	var bestFace *FaceDetection
+	bestDegrees := 0
+	for _, degrees := range []int{90, 180, 270} {
+		face, err := rotated.detectBest(rotateImage(small, degrees))
+		if err != nil {
+			continue
+		}
+		if bestFace == nil || face.Score > bestFace.Score {
+			bestFace = face
+			bestDegrees = degrees
+		}
+	}
+	if bestFace == nil {
+		return 0, nil, fmt.Errorf("no faces detected in any orientation")
+	}
+
+	// Map the face from the rotated small copy back to the rotated full image.
+	// Width and height swap together, so one factor covers both axes.
+	factor := float64(bounds.Dx()) / float64(small.Bounds().Dx())
+	return bestDegrees, &FaceDetection{
+		X:     int(float64(bestFace.X) * factor),
+		Y:     int(float64(bestFace.Y) * factor),
+		Size:  int(float64(bestFace.Size) * factor),
+		Score: bestFace.Score,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package passport
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A portrait stored sideways without an EXIF orientation tag is turned upright
+// before cropping, and the photo comes out as from the upright original
+func TestGenerateTurnsSidewaysPhotoUpright(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upright, err := Generate(source.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, degrees := range []int{90, 270} {
+		// Written by the stdlib encoder, so the fixture carries no EXIF at all
+		path := filepath.Join(t.TempDir(), "sideways.jpg")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = jpeg.Encode(file, rotateImage(source.Image, degrees), &jpeg.Options{Quality: 95})
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sideways, err := loadImage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := Generate(sideways.Image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.FaceFound || result.Crop.DetectionPass != DETECTION_PASS_ROTATED {
+			t.Errorf("turned %d°: face found %v by the %q pass, want the rotated pass", degrees, result.FaceFound, result.Crop.DetectionPass)
+			continue
+		}
+		if want := 360 - degrees; result.Crop.Rotation != want {
+			t.Errorf("turned %d°: rotated back by %d°, want %d°", degrees, result.Crop.Rotation, want)
+		}
+		if size := result.Photo.Bounds().Size(); size != upright.Photo.Bounds().Size() {
+			t.Errorf("turned %d°: photo of %v pixels, want %v", degrees, size, upright.Photo.Bounds().Size())
+		}
+		// The crop is computed on the upright image, so it lands where the upright
+		// original's does, give or take the detector's jitter on the re-encoded copy
+		tolerance := upright.Crop.Rect.Dx() / 20
+		for _, corner := range [][2]image.Point{{result.Crop.Rect.Min, upright.Crop.Rect.Min}, {result.Crop.Rect.Max, upright.Crop.Rect.Max}} {
+			if d := corner[0].Sub(corner[1]); max(d.X, -d.X) > tolerance || max(d.Y, -d.Y) > tolerance {
+				t.Errorf("turned %d°: crop %v, upright %v", degrees, result.Crop.Rect, upright.Crop.Rect)
+				break
+			}
+		}
+	}
+}
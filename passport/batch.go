@@ -0,0 +1,225 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+)
+
+const (
+	// Overview contact sheet written into the batch directory
+	OVERVIEW_IMAGE_NAME = "passport_overview.jpg"
+
+	// Thumbnail width in the overview; the height follows the photo spec
+	OVERVIEW_THUMB_WIDTH_PX = 240
+
+	// Gap between thumbnails and around the overview edge
+	OVERVIEW_SPACING_PX = 16
+
+	// Filename label size in points (rendered at DPI)
+	OVERVIEW_LABEL_PT = 4.0
+)
+
+// Image extensions picked up by -batch
+var batchExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+var overviewColorFailed = color.RGBA{220, 0, 0, 255}
+
+// BatchEntry is one processed input of a batch run
+type BatchEntry struct {
+	Name   string
+	Photo  image.Image // nil when the input could not be processed at all
+	Failed bool
+}
+
+// listBatchInputs returns the images in dir, skipping files this program wrote
+func listBatchInputs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !batchExtensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		// Outputs numbered by availableOutputPath (e.g. overview_2.jpg) are skipped like the originals
+		unnumbered := numberedOutputSuffix.ReplaceAllString(name, "$1")
+		if strings.Contains(unnumbered, "_passport_photo") || strings.HasSuffix(unnumbered, "_native_crop.jpg") || unnumbered == OVERVIEW_IMAGE_NAME {
+			continue
+		}
+		if strings.Contains(unnumbered, "_preview_") || strings.HasSuffix(unnumbered, "_"+DEBUG_IMAGE_PATH) || strings.HasSuffix(unnumbered, "_"+DEBUG_FIELD_IMAGE_PATH) {
+			continue // kept with -keep-artifacts
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// runBatch processes every image in config.BatchDir with the same settings and writes
+// an overview of all passport photos. config.Jobs workers share the face detector;
+// the overview and summary keep the sorted input order whatever finishes first.
+// Returns false when any input failed.
+func runBatch(config Config) bool {
+	paths, err := listBatchInputs(config.BatchDir)
+	if err != nil {
+		logError("❌ Error reading batch directory: %v", err)
+		return false
+	}
+	if len(paths) == 0 {
+		logError("❌ No images found in %s", config.BatchDir)
+		return false
+	}
+
+	// Prompts (manual crop, comparison) need one image at a time
+	jobs := max(1, min(config.Jobs, len(paths)))
+	if config.Prompt != nil && jobs > 1 {
+		logInfo("🧵 Prompting for each image, processing them one at a time")
+		jobs = 1
+	}
+
+	// Each worker fills in the entries of the indices it takes from the queue
+	entries := make([]BatchEntry, len(paths))
+	queue := make(chan int)
+	var workers sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range queue {
+				entries[i] = processBatchItem(paths[i], config, i, len(paths))
+			}
+		}()
+	}
+	for i := range paths {
+		queue <- i
+	}
+	close(queue)
+	workers.Wait()
+
+	failures := 0
+	for _, entry := range entries {
+		if entry.Failed {
+			failures++
+		}
+	}
+
+	overviewPath := availableOutputPath(filepath.Join(config.BatchDir, OVERVIEW_IMAGE_NAME))
+	overview, err := createOverviewMontage(entries, config.Spec)
+	if err == nil {
+		_, _, err = saveImage(overview, overviewPath, SaveOptions{Metadata: METADATA_NONE})
+	}
+	if err != nil {
+		logWarn("⚠️  Could not write overview: %v", err)
+	} else {
+		fmt.Print(msg("batch.overview", overviewPath))
+	}
+
+	fmt.Print(msg("batch.summary", len(entries), failures))
+	return failures == 0
+}
+
+// processBatchItem runs the pipeline on the nth (from 0) of total batch inputs
+func processBatchItem(path string, config Config, n, total int) BatchEntry {
+	logInfo("\n📂 [%d/%d] %s", n+1, total, filepath.Base(path))
+	entry := BatchEntry{Name: filepath.Base(path)}
+
+	fileConfig := config
+	fileConfig.InputPath = path
+	result, err := generateOutputs(fileConfig)
+	switch {
+	case err != nil:
+		logError("❌ %s: %v", entry.Name, err)
+		entry.Failed = true
+	case (!result.FaceFound && result.Strategy != STRATEGY_GRID_ONLY) || !result.Background.Passed:
+		entry.Photo = result.Photo
+		entry.Failed = true
+	default:
+		entry.Photo = result.Photo
+	}
+	return entry
+}
+
+// createOverviewMontage tiles the passport photos of a batch as thumbnails with
+// their filenames underneath. Failed entries get a red frame and label.
+func createOverviewMontage(entries []BatchEntry, spec PhotoSpec) (image.Image, error) {
+	face, err := newLabelFace(OVERVIEW_LABEL_PT, DPI)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	thumbW := OVERVIEW_THUMB_WIDTH_PX
+	thumbH := int(math.Round(float64(thumbW) * float64(spec.HeightPX) / float64(spec.WidthPX)))
+	labelH := (face.Metrics().Ascent + face.Metrics().Descent).Ceil()
+
+	cols := int(math.Ceil(math.Sqrt(float64(len(entries)))))
+	rows := (len(entries) + cols - 1) / cols
+	cellW, cellH := thumbW+OVERVIEW_SPACING_PX, thumbH+labelH+OVERVIEW_SPACING_PX
+
+	width := cols*cellW + OVERVIEW_SPACING_PX
+	height := rows*cellH + OVERVIEW_SPACING_PX
+	overview := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(overview, overview.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	for i, entry := range entries {
+		x, y := OVERVIEW_SPACING_PX+(i%cols)*cellW, OVERVIEW_SPACING_PX+(i/cols)*cellH
+		thumbRect := image.Rect(x, y, x+thumbW, y+thumbH)
+
+		if entry.Photo != nil {
+			thumb := resizeImage(entry.Photo, thumbW, thumbH)
+			draw.Draw(overview, thumbRect, thumb, thumb.Bounds().Min, draw.Src)
+		} else {
+			draw.Draw(overview, thumbRect, &image.Uniform{color.Gray{200}}, image.Point{}, draw.Src)
+		}
+
+		labelColor := color.RGBA{0, 0, 0, 255}
+		if entry.Failed {
+			labelColor = overviewColorFailed
+			drawFrame(overview, thumbRect, overviewColorFailed, 3)
+		}
+
+		mask := renderTextMask(fitLabel(entry.Name, face, thumbW), face)
+		labelX := x + (thumbW-mask.Bounds().Dx())/2
+		target := image.Rect(labelX, y+thumbH, labelX+mask.Bounds().Dx(), y+thumbH+mask.Bounds().Dy())
+		draw.DrawMask(overview, target, &image.Uniform{labelColor}, image.Point{}, mask, image.Point{}, draw.Over)
+	}
+
+	return overview, nil
+}
+
+// fitLabel shortens text with "..." until it fits into maxWidth pixels
+func fitLabel(text string, face font.Face, maxWidth int) string {
+	if font.MeasureString(face, text).Ceil() <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := string(runes) + "..."
+		if font.MeasureString(face, candidate).Ceil() <= maxWidth {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// drawFrame outlines r with the given color and thickness
+func drawFrame(img *image.RGBA, r image.Rectangle, c color.RGBA, thickness int) {
+	fill := &image.Uniform{c}
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness), fill, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y), fill, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y), fill, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y), fill, image.Point{}, draw.Src)
+}
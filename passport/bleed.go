@@ -0,0 +1,57 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// MAX_BLEED_MM is the largest bleed accepted per side. Borderless prints enlarge the
+// image by a few percent (about 2mm per side on 10x15cm), so more only wastes paper.
+const MAX_BLEED_MM = 10.0
+
+// validateBleed checks a bleed margin per side in millimeters
+func validateBleed(mm float64) error {
+	if math.IsNaN(mm) || mm < 0 || mm > MAX_BLEED_MM {
+		return fmt.Errorf("invalid bleed %gmm (0-%gmm per side)", mm, MAX_BLEED_MM)
+	}
+	return nil
+}
+
+// withBleed returns the format with a plain white bleed margin of mm on every side
+// beyond its nominal size; the layout itself stays within the nominal trim box
+func (f PrintFormat) withBleed(mm float64) PrintFormat {
+	f.BleedMM = mm
+	f.BleedPX = mmToPX(mm, f.DPI)
+	return f
+}
+
+// SheetSize is the pixel size of the rendered sheet: the nominal format plus the
+// bleed on every side
+func (f PrintFormat) SheetSize() image.Point {
+	return image.Pt(f.WidthPX+2*f.BleedPX, f.HeightPX+2*f.BleedPX)
+}
+
+// TrimBox is the nominal format within the rendered sheet; photos, cut marks, ruler
+// and label are positioned relative to it
+func (f PrintFormat) TrimBox() image.Rectangle {
+	return image.Rect(f.BleedPX, f.BleedPX, f.BleedPX+f.WidthPX, f.BleedPX+f.HeightPX)
+}
+
+// addBleed places a laid out sheet of the nominal size into the trim box of a white
+// canvas that is larger by the format's bleed, so a borderless print that enlarges
+// and crops the image only loses the bleed
+func addBleed(sheet image.Image, format PrintFormat) image.Image {
+	if format.BleedPX == 0 {
+		return sheet
+	}
+	size := format.SheetSize()
+	canvas := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, format.TrimBox(), sheet, sheet.Bounds().Min, draw.Src)
+	logInfo("🖨️  Added %s bleed per side: %dx%d pixels (%s) around the nominal %dx%d pixels (%s)",
+		formatLength(format.BleedMM, -1), size.X, size.Y, formatPhysicalSize(pxToMM(size.X, format.DPI), pxToMM(size.Y, format.DPI), 1),
+		format.WidthPX, format.HeightPX, formatPhysicalSize(format.WidthMM, format.HeightMM, -1))
+	return canvas
+}
@@ -0,0 +1,37 @@
+package passport
+
+import "image"
+
+// laplacianVariance measures sharpness as the variance of the 4-neighbour Laplacian
+// of the luminance inside rect (image-relative coordinates). Blurred images have
+// weak edges and score low; the value only compares crops of the same content.
+func laplacianVariance(img image.Image, rect image.Rectangle) float64 {
+	bounds := img.Bounds()
+	rect = rect.Intersect(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	if rect.Dx() < 3 || rect.Dy() < 3 {
+		return 0
+	}
+
+	width, height := rect.Dx(), rect.Dy()
+	luminance := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+rect.Min.X+x, bounds.Min.Y+rect.Min.Y+y).RGBA()
+			luminance[y*width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+
+	var sum, sumSq float64
+	count := 0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			laplacian := 4*luminance[i] - luminance[i-1] - luminance[i+1] - luminance[i-width] - luminance[i+width]
+			sum += laplacian
+			sumSq += laplacian * laplacian
+			count++
+		}
+	}
+	mean := sum / float64(count)
+	return sumSq/float64(count) - mean*mean
+}
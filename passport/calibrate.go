@@ -0,0 +1,198 @@
+package passport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Calibration is stored in the user's config directory under this name
+	CALIBRATION_DIR_NAME  = "passport-photo-generator"
+	CALIBRATION_FILE_NAME = "calibration.json"
+)
+
+// Calibration is the systematic offset between the detector's face center / eye
+// level and the true midpoint of the pupils, as a fraction of the detected face
+// size so it carries over to photos of any resolution. The zero value applies no
+// correction.
+type Calibration struct {
+	OffsetX float64 `json:"offset_x"` // Positive moves the face center right
+	OffsetY float64 `json:"offset_y"` // Positive moves the eye level down
+	Samples int     `json:"samples"`  // Calibration images averaged into the offset
+}
+
+// defaultCalibrationPath returns where the calibrate subcommand stores its result
+func defaultCalibrationPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return CALIBRATION_FILE_NAME
+	}
+	return filepath.Join(dir, CALIBRATION_DIR_NAME, CALIBRATION_FILE_NAME)
+}
+
+// loadCalibration reads a stored calibration; a missing file means no correction
+func loadCalibration(path string) (Calibration, error) {
+	var calibration Calibration
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return calibration, nil
+	}
+	if err != nil {
+		return calibration, fmt.Errorf("error reading calibration: %v", err)
+	}
+	if err := json.Unmarshal(data, &calibration); err != nil {
+		return calibration, fmt.Errorf("invalid calibration file %s: %v", path, err)
+	}
+	return calibration, nil
+}
+
+// saveCalibration writes the calibration, creating its directory if needed
+func saveCalibration(path string, calibration Calibration) error {
+	data, err := json.MarshalIndent(calibration, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating calibration directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing calibration: %v", err)
+	}
+	return nil
+}
+
+// Correction returns the pixel offset the calibration applies to a face of the given size
+func (c Calibration) Correction(faceSize int) image.Point {
+	return image.Pt(
+		int(math.Round(c.OffsetX*float64(faceSize))),
+		int(math.Round(c.OffsetY*float64(faceSize))))
+}
+
+// Apply moves the detected face by the calibrated offset and returns the corrected
+// face with the applied correction in pixels
+func (c Calibration) Apply(face *FaceDetection) (*FaceDetection, image.Point) {
+	correction := c.Correction(face.Size)
+	if c.Samples == 0 {
+		logInfo("🎯 No calibration stored, no correction applied")
+		return face, correction
+	}
+	corrected := *face
+	corrected.X += correction.X
+	corrected.Y += correction.Y
+	logInfo("🎯 Calibration correction: %+d,%+d pixels (%+.1f%%, %+.1f%% of the face size, %d sample(s))",
+		correction.X, correction.Y, c.OffsetX*100, c.OffsetY*100, c.Samples)
+	return &corrected, correction
+}
+
+// parsePupils parses "leftX,leftY,rightX,rightY" into the two pupil centers
+func parsePupils(value string) (image.Point, image.Point, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return image.Point{}, image.Point{}, fmt.Errorf("invalid pupils '%s' (expected leftX,leftY,rightX,rightY)", value)
+	}
+	var coords [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return image.Point{}, image.Point{}, fmt.Errorf("invalid pupils '%s' (expected leftX,leftY,rightX,rightY)", value)
+		}
+		coords[i] = n
+	}
+	return image.Pt(coords[0], coords[1]), image.Pt(coords[2], coords[3]), nil
+}
+
+// readPupils asks for the pupil centers until the answer parses
+func readPupils(prompt Prompter, size image.Point) (image.Point, image.Point, error) {
+	fmt.Print(msg("calibrate.instructions", size.X, size.Y))
+	for {
+		answer, err := prompt.Ask(msg("prompt.pupils"))
+		if err != nil {
+			return image.Point{}, image.Point{}, err
+		}
+		left, right, err := parsePupils(answer)
+		if err == nil {
+			return left, right, nil
+		}
+		fmt.Println(err)
+	}
+}
+
+// runCalibration detects the face in a calibration image, compares it with the true
+// pupil centers (given as leftX,leftY,rightX,rightY in the image as displayed, or
+// asked for when empty), and folds the offset into the stored calibration
+func runCalibration(inputPath, pupils, calibrationPath string, opts DetectionOptions, prompt Prompter) error {
+	source, err := loadImage(inputPath)
+	if err != nil {
+		return fmt.Errorf("error loading image: %v", err)
+	}
+	img := source.Image
+	bounds := img.Bounds()
+
+	var left, right image.Point
+	if pupils != "" {
+		left, right, err = parsePupils(pupils)
+		if err != nil {
+			return err
+		}
+	} else if canPrompt(prompt) {
+		left, right, err = readPupils(prompt, bounds.Size())
+		if err != nil {
+			return err
+		}
+	} else {
+		return errors.New(missingOptionsMessage([]string{"the pupil centers (-pupils)"}))
+	}
+	for _, p := range []image.Point{left, right} {
+		if !p.In(image.Rect(0, 0, bounds.Dx(), bounds.Dy())) {
+			return fmt.Errorf("pupil (%d,%d) is outside the %dx%d image", p.X, p.Y, bounds.Dx(), bounds.Dy())
+		}
+	}
+
+	detector, err := NewFaceDetector(FACE_CASCADE_PATH, opts)
+	if err != nil {
+		return err
+	}
+	face, err := detector.detectBest(img)
+	if err != nil {
+		return err
+	}
+
+	// Where the pipeline puts the eyes without correction, in image coordinates
+	detectedX := float64(face.X)
+	detectedY := float64(face.Y-face.Size/2) + float64(face.Size)*EYE_LEVEL_IN_FACE_RATIO
+	trueX := float64(left.X+right.X) / 2
+	trueY := float64(left.Y+right.Y) / 2
+	offsetX := (trueX - detectedX) / float64(face.Size)
+	offsetY := (trueY - detectedY) / float64(face.Size)
+	logInfo("📍 Detected eye center (%.0f,%.0f), true pupil midpoint (%.0f,%.0f): offset %+.1f%%, %+.1f%% of the face size",
+		detectedX, detectedY, trueX, trueY, offsetX*100, offsetY*100)
+
+	// Average with earlier calibration images so a single photo doesn't dominate
+	calibration, err := loadCalibration(calibrationPath)
+	if err != nil {
+		return err
+	}
+	n := float64(calibration.Samples)
+	calibration.OffsetX = (calibration.OffsetX*n + offsetX) / (n + 1)
+	calibration.OffsetY = (calibration.OffsetY*n + offsetY) / (n + 1)
+	calibration.Samples++
+
+	if err := saveCalibration(calibrationPath, calibration); err != nil {
+		return err
+	}
+	signed := func(v float64) string {
+		if v >= 0 {
+			return "+" + formatDecimal(v, 1)
+		}
+		return formatDecimal(v, 1)
+	}
+	fmt.Print(msg("calibrate.saved", calibrationPath, signed(calibration.OffsetX*100), signed(calibration.OffsetY*100), calibration.Samples))
+	return nil
+}
@@ -0,0 +1,278 @@
+package passport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// Frame rate requested from the camera while looking for a face
+	CAPTURE_FPS = 5
+
+	// Width of the downscaled frame used for live face detection
+	CAPTURE_DETECTION_WIDTH = 640
+
+	// Face must stay within this fraction of the frame width from the
+	// horizontal center, and move less than CAPTURE_MAX_MOVEMENT_RATIO
+	// between frames, for CAPTURE_STABLE_DURATION before the shot is taken
+	CAPTURE_MAX_OFFCENTER_RATIO = 0.10
+	CAPTURE_MAX_MOVEMENT_RATIO  = 0.03
+	CAPTURE_STABLE_DURATION     = time.Second
+
+	// Give up when the camera doesn't deliver a frame within this time
+	CAPTURE_FIRST_FRAME_TIMEOUT = 10 * time.Second
+)
+
+// defaultCaptureDevice returns the platform's usual first camera
+func defaultCaptureDevice() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "0"
+	case "windows":
+		return "video=Integrated Camera"
+	default:
+		return "/dev/video0"
+	}
+}
+
+// ffmpegInputFormat returns the ffmpeg capture backend for the current platform
+func ffmpegInputFormat() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "avfoundation"
+	case "windows":
+		return "dshow"
+	default:
+		return "v4l2"
+	}
+}
+
+// captureFromCamera streams frames from a camera via ffmpeg, waits until a face is
+// detected, centered, and stable, then saves the full-resolution frame into outputDir.
+// Space forces a capture, q quits. Returns the path of the saved frame.
+func captureFromCamera(device, outputDir string, opts DetectionOptions) (string, error) {
+	// Every frame runs the detector, so the cascade is loaded once up front
+	detector, err := NewFaceDetector(FACE_CASCADE_PATH, opts)
+	if err != nil {
+		return "", err
+	}
+
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("camera capture needs ffmpeg, which was not found in PATH - please install ffmpeg")
+	}
+
+	cmd := exec.Command(ffmpegPath,
+		"-loglevel", "error",
+		"-f", ffmpegInputFormat(),
+		"-i", device,
+		"-vf", fmt.Sprintf("fps=%d", CAPTURE_FPS),
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"-q:v", "2",
+		"-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Don't hang on shutdown if a backend child process keeps the pipes open
+	cmd.WaitDelay = 2 * time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("error starting ffmpeg: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("error starting ffmpeg: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// Frames are decoded in the background so a silent camera can time out
+	frames := make(chan []byte)
+	go readMJPEGFrames(stdout, frames)
+
+	keys, restoreTerminal := readCaptureKeys()
+	defer restoreTerminal()
+
+	logInfo("📷 Capturing from %s (%s) - look into the camera", device, ffmpegInputFormat())
+	fmt.Print(msg("capture.keys"))
+
+	var lastFace *FaceDetection
+	var lastFrame []byte
+	var stableSince time.Time
+	timeout := time.After(CAPTURE_FIRST_FRAME_TIMEOUT)
+
+	for {
+		select {
+		case <-timeout:
+			if lastFrame == nil {
+				return "", fmt.Errorf("no frames received from camera %s: %s", device, strings.TrimSpace(stderr.String()))
+			}
+		case key := <-keys:
+			switch key {
+			case 'q', 'Q':
+				return "", fmt.Errorf("capture cancelled")
+			case ' ':
+				if lastFrame != nil {
+					fmt.Print(msg("capture.forced"))
+					return saveCapturedFrame(lastFrame, outputDir)
+				}
+			}
+		case frame, ok := <-frames:
+			if !ok {
+				return "", fmt.Errorf("camera stream ended: %s", strings.TrimSpace(stderr.String()))
+			}
+			lastFrame = frame
+
+			img, err := jpeg.Decode(bytes.NewReader(frame))
+			if err != nil {
+				continue
+			}
+
+			face := detectCaptureFace(img, detector)
+			if face == nil || !isFaceCentered(face, img.Bounds()) {
+				stableSince = time.Time{}
+				lastFace = face
+				fmt.Print(msg("capture.waiting"))
+				continue
+			}
+
+			if lastFace == nil || faceMovement(face, lastFace, img.Bounds()) > CAPTURE_MAX_MOVEMENT_RATIO || stableSince.IsZero() {
+				stableSince = time.Now()
+			}
+			lastFace = face
+
+			if time.Since(stableSince) >= CAPTURE_STABLE_DURATION {
+				fmt.Print(msg("capture.stable"))
+				return saveCapturedFrame(frame, outputDir)
+			}
+			fmt.Print(msg("capture.hold_still"))
+		}
+	}
+}
+
+// readMJPEGFrames splits an MJPEG stream into individual JPEG frames (SOI..EOI)
+func readMJPEGFrames(r io.Reader, frames chan<- []byte) {
+	defer close(frames)
+	reader := bufio.NewReaderSize(r, 1<<20)
+
+	var frame []byte
+	var prev byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if frame == nil {
+			// Wait for the start-of-image marker
+			if prev == 0xFF && b == 0xD8 {
+				frame = []byte{0xFF, 0xD8}
+			}
+			prev = b
+			continue
+		}
+		frame = append(frame, b)
+		if prev == 0xFF && b == 0xD9 {
+			frames <- frame
+			frame = nil
+			b = 0
+		}
+		prev = b
+	}
+}
+
+// detectCaptureFace runs face detection on a downscaled frame and maps the result back
+func detectCaptureFace(img image.Image, detector *FaceDetector) *FaceDetection {
+	bounds := img.Bounds()
+	scale := 1.0
+	detectionImg := img
+	if bounds.Dx() > CAPTURE_DETECTION_WIDTH {
+		scale = float64(CAPTURE_DETECTION_WIDTH) / float64(bounds.Dx())
+		detectionImg = resizeImage(img, CAPTURE_DETECTION_WIDTH, int(float64(bounds.Dy())*scale))
+	}
+
+	face, err := detector.detectBest(detectionImg)
+	if err != nil {
+		return nil
+	}
+	return &FaceDetection{
+		X:     int(float64(face.X) / scale),
+		Y:     int(float64(face.Y) / scale),
+		Size:  int(float64(face.Size) / scale),
+		Score: face.Score,
+	}
+}
+
+// isFaceCentered reports whether the face is horizontally centered in the frame
+func isFaceCentered(face *FaceDetection, bounds image.Rectangle) bool {
+	centerX := float64(bounds.Min.X) + float64(bounds.Dx())/2
+	return math.Abs(float64(face.X)-centerX) <= float64(bounds.Dx())*CAPTURE_MAX_OFFCENTER_RATIO
+}
+
+// faceMovement returns how far the face moved between frames as a fraction of the frame width
+func faceMovement(a, b *FaceDetection, bounds image.Rectangle) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y)) / float64(bounds.Dx())
+}
+
+// saveCapturedFrame writes the raw JPEG frame into outputDir with a timestamped name
+func saveCapturedFrame(frame []byte, outputDir string) (string, error) {
+	path := availableOutputPath(filepath.Join(outputDir, fmt.Sprintf("capture_%s.jpg", time.Now().Format("20060102_150405"))))
+	if err := os.WriteFile(path, frame, 0644); err != nil {
+		return "", fmt.Errorf("error saving captured frame: %v", err)
+	}
+	logInfo("💾 Captured frame saved to: %s", path)
+	return path, nil
+}
+
+// readCaptureKeys switches the terminal to unbuffered input and delivers single key presses.
+// The returned function restores the terminal. Without a terminal no keys are delivered.
+func readCaptureKeys() (<-chan byte, func()) {
+	keys := make(chan byte)
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		logInfo("ℹ️  No terminal available, keyboard controls disabled")
+		return keys, func() {}
+	}
+
+	saved, _ := runStty(tty, "-g")
+	runStty(tty, "cbreak", "-echo")
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := tty.Read(buf); err != nil {
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	return keys, func() {
+		if saved != "" {
+			runStty(tty, saved)
+		} else {
+			runStty(tty, "-cbreak", "echo")
+		}
+		tty.Close()
+	}
+}
+
+// runStty runs stty against the given terminal and returns its output
+func runStty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,101 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Placement modes of the center-weighted crop accepted by -center-weight
+const (
+	CENTER_WEIGHT_SALIENCY = "saliency" // Center the crop on the visual center of mass (default)
+	CENTER_WEIGHT_FIXED    = "fixed"    // Always the upper middle of the image
+)
+
+var centerWeightModes = []string{CENTER_WEIGHT_SALIENCY, CENTER_WEIGHT_FIXED}
+
+const (
+	// The saliency map is computed on a copy downscaled to this many pixels on the long side
+	CENTER_WEIGHT_ANALYSIS_SIZE = 200
+
+	// Blur (sigma as fraction of the long side) applied before comparing with the mean
+	// color, so texture and noise don't count as salient
+	CENTER_WEIGHT_BLUR_RATIO = 0.01
+
+	// Below this mean saliency (RGB distance from the mean color, 0-255) nothing
+	// stands out and the fixed position is used
+	CENTER_WEIGHT_MIN_SALIENCY = 8.0
+)
+
+// validateCenterWeight checks a -center-weight value
+func validateCenterWeight(mode string) error {
+	for _, m := range centerWeightModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid center weight mode '%s' (available: %s)", mode, strings.Join(centerWeightModes, ", "))
+}
+
+// salientCenter returns the saliency-weighted centroid of img as fractions of its
+// width and height. Saliency is the distance of the blurred color from the image's
+// mean color (frequency-tuned saliency), squared so the subject outweighs mildly
+// different background areas. Reports false when nothing stands out.
+func salientCenter(img image.Image) (float64, float64, bool) {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(CENTER_WEIGHT_ANALYSIS_SIZE)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := image.NewRGBA(image.Rect(0, 0, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))))
+	if scale < 1 {
+		draw.Draw(small, small.Bounds(), resizeImage(img, small.Bounds().Dx(), small.Bounds().Dy()), image.Point{}, draw.Src)
+	} else {
+		draw.Draw(small, small.Bounds(), img, bounds.Min, draw.Src)
+	}
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+	blurred := gaussianBlur(small, math.Max(0.5, float64(max(width, height))*CENTER_WEIGHT_BLUR_RATIO))
+
+	mean := averageColor(blurred, blurred.Bounds())
+	var total, sumX, sumY float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := blurred.PixOffset(x, y)
+			pixel := [3]float64{float64(blurred.Pix[i]), float64(blurred.Pix[i+1]), float64(blurred.Pix[i+2])}
+			distance := colorDistance(pixel, mean)
+			weight := distance * distance
+			total += weight
+			sumX += weight * (float64(x) + 0.5)
+			sumY += weight * (float64(y) + 0.5)
+		}
+	}
+	if total == 0 || math.Sqrt(total/float64(width*height)) < CENTER_WEIGHT_MIN_SALIENCY {
+		return 0.5, 0.5, false
+	}
+	return sumX / total / float64(width), sumY / total / float64(height), true
+}
+
+// centerWeightedPosition returns where the center-weighted crop goes, as the
+// positions createPassportPhotoFallback takes: centered on the salient center of
+// img, or the fixed upper middle when nothing stands out or the mode is fixed
+func centerWeightedPosition(img image.Image, spec PhotoSpec, mode string) (float64, float64) {
+	if mode == CENTER_WEIGHT_FIXED {
+		return CENTER_CROP_HORIZONTAL_POSITION, CENTER_CROP_VERTICAL_POSITION
+	}
+	cx, cy, ok := salientCenter(img)
+	if !ok {
+		logInfo("🎯 Nothing stands out in the image, using the upper middle")
+		return CENTER_CROP_HORIZONTAL_POSITION, CENTER_CROP_VERTICAL_POSITION
+	}
+
+	// Put the salient center in the middle of the crop, within the image
+	bounds := img.Bounds()
+	cropWidth, cropHeight := largestCropSize(bounds.Dx(), bounds.Dy(), spec)
+	position := func(center float64, size, cropSize int) float64 {
+		if size <= cropSize {
+			return 0.5
+		}
+		return math.Max(0, math.Min(1, (center*float64(size)-float64(cropSize)/2)/float64(size-cropSize)))
+	}
+	logInfo("🎯 Visual center of mass at %.0f%%, %.0f%% of the image", cx*100, cy*100)
+	return position(cx, bounds.Dx(), cropWidth), position(cy, bounds.Dy(), cropHeight)
+}
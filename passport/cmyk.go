@@ -0,0 +1,27 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+)
+
+// convertToCMYK converts img with the naive RGB→CMYK transform of image/color: the
+// black channel takes the darkest share of each pixel and the colored inks the rest.
+// There is no press profile or ink limit behind it, so print shops that require a
+// specific CMYK profile should convert the RGB output themselves.
+func convertToCMYK(img image.Image) *image.CMYK {
+	bounds := img.Bounds()
+	cmyk := image.NewCMYK(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			c, m, ye, k := color.RGBToCMYK(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			i := cmyk.PixOffset(x, y)
+			cmyk.Pix[i+0] = c
+			cmyk.Pix[i+1] = m
+			cmyk.Pix[i+2] = ye
+			cmyk.Pix[i+3] = k
+		}
+	}
+	return cmyk
+}
@@ -0,0 +1,199 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// A background is tinted when the chroma of its mean color (max channel - min
+	// channel, 0-1) reaches this value; per-pixel noise averages out in the mean
+	COLOR_CAST_MIN_CHROMA = 0.03
+
+	// Pixels closer than this to the mean background color (euclidean RGB, 0-255)
+	// count as background; between half of it and all of it the shift fades out so
+	// the subject's outline gets no seam
+	COLOR_CAST_BACKGROUND_DISTANCE = 60.0
+
+	// Inside the face box, which also covers some background beside the cheeks, only
+	// pixels this close count as background, so skin tones near a beige or pink wall
+	// keep their color
+	COLOR_CAST_FACE_DISTANCE = 25.0
+
+	// Head width as fraction of the head height, for the subject mask of crops made
+	// without a face
+	COLOR_CAST_HEAD_WIDTH_RATIO = 0.75
+)
+
+// ColorCast is the tint of the mean background color
+type ColorCast struct {
+	Mean     [3]float64 // Mean background color (0-1 per channel)
+	Hue      float64    // Hue of the mean color in degrees (0 red, 120 green, 240 blue)
+	Chroma   float64    // Max minus min channel of the mean color (0-1)
+	Detected bool       // Chroma of at least COLOR_CAST_MIN_CHROMA
+}
+
+// measureColorCast describes the tint of a mean background color (0-1 per channel)
+func measureColorCast(mean [3]float64) ColorCast {
+	cast := ColorCast{Mean: mean}
+	hi := math.Max(mean[0], math.Max(mean[1], mean[2]))
+	lo := math.Min(mean[0], math.Min(mean[1], mean[2]))
+	cast.Chroma = hi - lo
+	if cast.Chroma > 0 {
+		switch hi {
+		case mean[0]:
+			cast.Hue = 60 * math.Mod((mean[1]-mean[2])/cast.Chroma+6, 6)
+		case mean[1]:
+			cast.Hue = 60 * ((mean[2]-mean[0])/cast.Chroma + 2)
+		default:
+			cast.Hue = 60 * ((mean[0]-mean[1])/cast.Chroma + 4)
+		}
+	}
+	cast.Detected = cast.Chroma >= COLOR_CAST_MIN_CHROMA
+	return cast
+}
+
+// Name returns the color name of the cast's hue
+func (c ColorCast) Name() string {
+	names := []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "magenta", "red"}
+	limits := []float64{15, 45, 70, 165, 195, 255, 285, 345, 360}
+	for i, limit := range limits {
+		if c.Hue < limit {
+			return names[i]
+		}
+	}
+	return names[0]
+}
+
+// String describes the cast for the logs and reports
+func (c ColorCast) String() string {
+	if !c.Detected {
+		return fmt.Sprintf("neutral (chroma %.3f)", c.Chroma)
+	}
+	return fmt.Sprintf("%s cast (hue %.0f°, chroma %.3f)", c.Name(), c.Hue, c.Chroma)
+}
+
+// faceMask returns the face box mapped from the crop into the passport photo. Crops
+// made without a face use the head position the spec prescribes instead.
+func faceMask(crop CropGeometry, spec PhotoSpec, size image.Point) image.Rectangle {
+	var face image.Rectangle
+	if !crop.Face.Empty() && !crop.Rect.Empty() {
+		scale := float64(size.X) / float64(crop.Rect.Dx())
+		at := func(p image.Point) image.Point {
+			p = p.Sub(crop.Rect.Min)
+			return image.Pt(int(float64(p.X)*scale), int(float64(p.Y)*scale))
+		}
+		face = image.Rectangle{Min: at(crop.Face.Min), Max: at(crop.Face.Max)}
+	} else {
+		headTop := int(float64(size.Y) * spec.HeadspaceRatio)
+		headHeight := int(float64(size.Y) * spec.HeadHeightRatio)
+		headWidth := int(float64(headHeight) * COLOR_CAST_HEAD_WIDTH_RATIO)
+		face = image.Rect(size.X/2-headWidth/2, headTop, size.X/2+headWidth/2, headTop+headHeight)
+	}
+	return face
+}
+
+// neutralizeBackgroundCast shifts a color cast of the background toward a neutral
+// gray of the same luminance. The cast is measured on the border region
+// checkBackground samples, outside face. The shift then applies to the background:
+// pixels close to the mean background color connected to the border, with a much
+// tighter limit inside face, so the face, hair and clothing keep their colors.
+// Returns the photo unchanged when the background is already neutral.
+func neutralizeBackgroundCast(photo image.Image, face image.Rectangle) image.Image {
+	bounds := photo.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*width+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+
+	borderX := int(math.Max(1, float64(width)*BACKGROUND_BORDER_RATIO))
+	borderY := int(math.Max(1, float64(height)*BACKGROUND_BORDER_RATIO))
+	var mean [3]float64
+	count := 0
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width; x++ {
+			if (y >= borderY && x >= borderX && x < width-borderX) || image.Pt(x, y).In(face) {
+				continue
+			}
+			for ch := range mean {
+				mean[ch] += pixels[y*width+x][ch]
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return photo
+	}
+	for ch := range mean {
+		mean[ch] /= float64(count)
+	}
+	cast := measureColorCast([3]float64{mean[0] / 255, mean[1] / 255, mean[2] / 255})
+	if !cast.Detected {
+		logInfo("🎨 Background is neutral (chroma %.3f), not neutralized", cast.Chroma)
+		return photo
+	}
+
+	// Per-channel gains that turn the mean background color into gray
+	luminance := 0.299*mean[0] + 0.587*mean[1] + 0.114*mean[2]
+	var gains [3]float64
+	for ch := range gains {
+		gains[ch] = luminance / math.Max(1, mean[ch])
+	}
+
+	// Background: flood fill from the border through pixels close to the mean color
+	limit := func(i int) float64 {
+		if image.Pt(i%width, i/width).In(face) {
+			return COLOR_CAST_FACE_DISTANCE
+		}
+		return COLOR_CAST_BACKGROUND_DISTANCE
+	}
+	isBackground := func(i int) bool {
+		return colorDistance(pixels[i], mean) < limit(i)
+	}
+	background := make([]bool, len(pixels))
+	var queue []int
+	for i := range pixels {
+		x, y := i%width, i/width
+		if (x == 0 || y == 0 || x == width-1) && isBackground(i) {
+			background[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%width, i/width
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= width || n[1] >= height {
+				continue
+			}
+			j := n[1]*width + n[0]
+			if !background[j] && isBackground(j) {
+				background[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	neutral := image.NewRGBA(image.Rect(0, 0, width, height))
+	shifted := 0
+	for i, pixel := range pixels {
+		weight := 0.0
+		if background[i] {
+			weight = math.Max(0, math.Min(1, (limit(i)-colorDistance(pixel, mean))/(limit(i)/2)))
+			shifted++
+		}
+		for ch := 0; ch < 3; ch++ {
+			value := pixel[ch] * (1 - weight + gains[ch]*weight)
+			neutral.Pix[i*4+ch] = uint8(math.Max(0, math.Min(255, math.Round(value))))
+		}
+		neutral.Pix[i*4+3] = 255
+	}
+	logInfo("🎨 Background %s neutralized (%.0f%% of the photo)", cast, float64(shifted)*100/float64(len(pixels)))
+	return neutral
+}
@@ -0,0 +1,153 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Candidates of the comparison image are scaled to this height in pixels
+	COMPARISON_PHOTO_HEIGHT = 480
+
+	// Space around and between the candidates, and the label height below each,
+	// as fractions of the photo height
+	COMPARISON_SPACING_RATIO = 0.05
+	COMPARISON_LABEL_RATIO   = 0.08
+)
+
+// ComparisonCandidate is one crop shown in a comparison image
+type ComparisonCandidate struct {
+	Label string
+	Photo image.Image
+}
+
+// ComposeComparison lays out the candidate photos side by side on white, scaled to
+// photoHeight pixels, each numbered from 1 and labeled below. It only needs the
+// photos, so any front end can show the same picture the -compare prompt refers to.
+func ComposeComparison(candidates []ComparisonCandidate, photoHeight int) (*image.RGBA, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to compare")
+	}
+	spacing := max(1, int(float64(photoHeight)*COMPARISON_SPACING_RATIO))
+	labelHeight := max(1, int(float64(photoHeight)*COMPARISON_LABEL_RATIO))
+
+	scaled := make([]image.Image, len(candidates))
+	width := spacing
+	for i, candidate := range candidates {
+		bounds := candidate.Photo.Bounds()
+		photoWidth := max(1, bounds.Dx()*photoHeight/max(1, bounds.Dy()))
+		scaled[i] = resizeImage(candidate.Photo, photoWidth, photoHeight)
+		width += photoWidth + spacing
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, spacing+photoHeight+labelHeight+spacing))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// The label font is sized in pixels: points at 72 DPI
+	face, err := newLabelFace(float64(labelHeight)*0.6, 72)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	x := spacing
+	for i, photo := range scaled {
+		rect := photo.Bounds().Sub(photo.Bounds().Min).Add(image.Pt(x, spacing))
+		draw.Draw(canvas, rect, photo, photo.Bounds().Min, draw.Src)
+
+		// Center the label below the photo; labels wider than the photo are cut off
+		mask := renderTextMask(fmt.Sprintf("%d: %s", i+1, candidates[i].Label), face)
+		at := image.Pt(x+max(0, (rect.Dx()-mask.Bounds().Dx())/2), rect.Max.Y+(labelHeight-mask.Bounds().Dy())/2)
+		target := mask.Bounds().Add(at).Intersect(image.Rect(x, rect.Max.Y, rect.Max.X, rect.Max.Y+labelHeight))
+		draw.DrawMask(canvas, target, &image.Uniform{color.Black}, image.Point{}, mask, target.Min.Sub(at), draw.Over)
+		x = rect.Max.X + spacing
+	}
+	return canvas, nil
+}
+
+// parseEyeLines parses the comma-separated eye lines of -compare, e.g. 0.55,0.57,0.6
+func parseEyeLines(value string) ([]float64, error) {
+	var eyeLines []float64
+	for _, part := range strings.Split(value, ",") {
+		eyeLine, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid eye line '%s' in -compare (expected fractions like 0.55,0.6)", part)
+		}
+		if err := validateEyeLine(eyeLine); err != nil {
+			return nil, err
+		}
+		eyeLines = append(eyeLines, eyeLine)
+	}
+	return eyeLines, nil
+}
+
+// buildComparisonPath names the comparison image after the input
+func buildComparisonPath(inputPath string) string {
+	inputDir, inputName := splitInputPath(inputPath)
+	return filepath.Join(inputDir, fmt.Sprintf("%s_compare.jpg", inputName))
+}
+
+// compareCrops crops img again with each eye line of config.CompareEyes next to
+// the automatic crop, writes the comparison image to config.ComparePath and returns
+// the candidate picked by config.ComparePick, or asked for with config.Prompt.
+// Without either the automatic crop is kept.
+func compareCrops(img image.Image, auto *PassportCrop, config Config) (*PassportCrop, error) {
+	crops := []*PassportCrop{auto}
+	candidates := []ComparisonCandidate{{
+		Label: fmt.Sprintf("auto (%s, eyes %.0f%%)", auto.Strategy, (1-config.Spec.EyePositionFromTopRatio)*100),
+		Photo: auto.Photo,
+	}}
+	for _, eyeLine := range config.CompareEyes {
+		candidateConfig := config
+		candidateConfig.Spec = config.Spec.WithEyeLine(eyeLine)
+		candidateConfig.Strategy = STRATEGY_FACE
+		logInfo("🆚 Cropping the comparison candidate with the eyes at %.0f%%", eyeLine*100)
+		crop, err := createPassportPhoto(img, candidateConfig)
+		if err != nil {
+			logWarn("⚠️  No candidate with the eyes at %.0f%%: %v", eyeLine*100, err)
+			continue
+		}
+		crops = append(crops, crop)
+		candidates = append(candidates, ComparisonCandidate{Label: fmt.Sprintf("eyes %.0f%%", eyeLine*100), Photo: crop.Photo})
+	}
+
+	comparison, err := ComposeComparison(candidates, COMPARISON_PHOTO_HEIGHT)
+	if err != nil {
+		return nil, err
+	}
+	if config.ComparePath != "" {
+		path := availableOutputPath(config.ComparePath)
+		if _, _, err := saveImage(comparison, path, SaveOptions{Metadata: METADATA_NONE}); err != nil {
+			return nil, fmt.Errorf("error saving comparison image: %v", err)
+		}
+		fmt.Print(msg("compare.saved", len(candidates), path))
+	}
+
+	choice := 0
+	switch {
+	case config.ComparePick > 0:
+		if config.ComparePick > len(crops) {
+			return nil, fmt.Errorf("-pick %d is out of range, the comparison has %d candidates", config.ComparePick, len(crops))
+		}
+		choice = config.ComparePick - 1
+	case config.Prompt != nil:
+		if config.ComparePath != "" {
+			if err := openImage(config.ComparePath); err != nil {
+				logWarn("⚠️  Could not open %s: %v", config.ComparePath, err)
+			}
+		}
+		labels := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			labels[i] = candidate.Label
+		}
+		if choice, err = config.Prompt.Choose(msg("prompt.compare"), labels); err != nil {
+			return nil, err
+		}
+	}
+	logInfo("✅ Using crop %d: %s", choice+1, candidates[choice].Label)
+	return crops[choice], nil
+}
@@ -0,0 +1,266 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// Border region sampled as background: top band plus side strips in the
+	// upper half of the photo (below that the shoulders usually reach the edge)
+	BACKGROUND_BORDER_RATIO = 0.08
+
+	// A background is uniform when the luminance standard deviation of the
+	// border region stays below this value (0..1 scale)
+	BACKGROUND_MAX_STDDEV = 0.06
+
+	// A background is white when the mean luminance is at least this bright
+	// and the average chroma (max channel - min channel) stays below the limit
+	BACKGROUND_MIN_WHITE_LUMINANCE = 0.85
+	BACKGROUND_MAX_WHITE_CHROMA    = 0.08
+
+	// The face is lit unevenly when the mean skin luminance of its brighter left or
+	// right half exceeds the darker one by this factor (side light casting a shadow
+	// across half the face), or of the forehead band against the chin band
+	LIGHTING_MAX_SIDE_RATIO     = 1.3
+	LIGHTING_MAX_VERTICAL_RATIO = 1.3
+
+	// Forehead and chin band as fractions of the face box height from its top; the
+	// forehead band ends above the eyes, the chin band starts below the nose
+	LIGHTING_FOREHEAD_TOP    = 0.05
+	LIGHTING_FOREHEAD_BOTTOM = 0.30
+	LIGHTING_CHIN_TOP        = 0.75
+
+	// Each measured region needs at least this fraction of skin samples
+	LIGHTING_MIN_SKIN = 0.15
+
+	// Skin samples darker than this maximum channel value (0-255) are too dark to
+	// tell from hair and shadows
+	LIGHTING_MIN_LEVEL = 30
+)
+
+// BackgroundCheck holds the measured background statistics of a passport photo
+type BackgroundCheck struct {
+	MeanLuminance float64
+	StdDev        float64
+	MeanChroma    float64
+	Uniform       bool
+	White         bool
+	Cast          ColorCast // Tint of the mean border color
+	Required      bool      // spec requires a plain white background
+	Passed        bool
+}
+
+// checkBackground measures uniformity and whiteness of the photo border region
+// and fails the check when the spec requires white and the background isn't
+func checkBackground(photo image.Image, spec PhotoSpec) BackgroundCheck {
+	bounds := photo.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	borderX := int(math.Max(1, float64(width)*BACKGROUND_BORDER_RATIO))
+	borderY := int(math.Max(1, float64(height)*BACKGROUND_BORDER_RATIO))
+
+	var sum, sumSq, chromaSum float64
+	var colorSum [3]float64
+	count := 0
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width; x++ {
+			if y >= borderY && x >= borderX && x < width-borderX {
+				continue
+			}
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			rf := float64(r) / 65535.0
+			gf := float64(g) / 65535.0
+			bf := float64(b) / 65535.0
+
+			lum := 0.299*rf + 0.587*gf + 0.114*bf
+			sum += lum
+			sumSq += lum * lum
+			chromaSum += math.Max(rf, math.Max(gf, bf)) - math.Min(rf, math.Min(gf, bf))
+			colorSum[0] += rf
+			colorSum[1] += gf
+			colorSum[2] += bf
+			count++
+		}
+	}
+
+	result := BackgroundCheck{Required: spec.RequireWhiteBackground}
+	if count == 0 {
+		result.Passed = !spec.RequireWhiteBackground
+		return result
+	}
+
+	result.MeanLuminance = sum / float64(count)
+	result.StdDev = math.Sqrt(math.Max(0, sumSq/float64(count)-result.MeanLuminance*result.MeanLuminance))
+	result.MeanChroma = chromaSum / float64(count)
+	result.Cast = measureColorCast([3]float64{colorSum[0] / float64(count), colorSum[1] / float64(count), colorSum[2] / float64(count)})
+	result.Uniform = result.StdDev <= BACKGROUND_MAX_STDDEV
+	result.White = result.MeanLuminance >= BACKGROUND_MIN_WHITE_LUMINANCE &&
+		result.MeanChroma <= BACKGROUND_MAX_WHITE_CHROMA
+	result.Passed = !spec.RequireWhiteBackground || (result.Uniform && result.White)
+
+	return result
+}
+
+// printBackgroundCheck prints the background measurements
+func printBackgroundCheck(check BackgroundCheck) {
+	logInfo("🎨 Background: luminance %.2f, stddev %.3f, chroma %.3f",
+		check.MeanLuminance, check.StdDev, check.MeanChroma)
+	if check.Cast.Detected {
+		logWarn("⚠️  Background has a %s (use -neutralize-background)", check.Cast)
+	}
+
+	if !check.Required {
+		if !check.Uniform {
+			logWarn("⚠️  Background does not look uniform")
+		}
+		return
+	}
+
+	if check.Passed {
+		logInfo("✅ Plain white background requirement met")
+		return
+	}
+	if !check.Uniform {
+		logError("❌ Background is not uniform (stddev %.3f > %.3f)", check.StdDev, BACKGROUND_MAX_STDDEV)
+	}
+	if !check.White {
+		logError("❌ Background is not white (luminance %.2f, chroma %.3f)", check.MeanLuminance, check.MeanChroma)
+	}
+}
+
+// LightingCheck is the result of comparing the skin luminance of the face halves
+// and of the forehead against the chin
+type LightingCheck struct {
+	Halves        [2]image.Rectangle `json:"-"`                  // Left and right face half in image coordinates
+	Left          float64            `json:"left_luminance"`     // Mean skin luminance of the left half (0-1)
+	Right         float64            `json:"right_luminance"`    // ... of the right half
+	Forehead      float64            `json:"forehead_luminance"` // ... of the forehead band
+	Chin          float64            `json:"chin_luminance"`     // ... of the chin band
+	SideRatio     float64            `json:"side_ratio"`         // Brighter half over darker half, 1 when even
+	VerticalRatio float64            `json:"vertical_ratio"`     // Brighter band over darker band; 0 when not measured
+	Checked       bool               `json:"checked"`            // False when too little skin was found in the halves
+	Uneven        bool               `json:"uneven"`             // One of the ratios exceeds its limit
+}
+
+// isSkinTone reports whether a pixel has the hue of skin at any brightness above
+// LIGHTING_MIN_LEVEL, so skin in shadow counts too: it is scaled to a bright level
+// and classified by isSkin
+func isSkinTone(r, g, b uint32) bool {
+	maxC := max(r, g, b)
+	if maxC < LIGHTING_MIN_LEVEL {
+		return false
+	}
+	return isSkin(r*220/maxC, g*220/maxC, b*220/maxC)
+}
+
+// checkLighting measures the mean luminance of the skin in the left and right half
+// of the face box and in its forehead and chin bands. Strong side light leaves one
+// half in shadow; light from above or below darkens the chin or the forehead.
+func checkLighting(img image.Image, face *FaceDetection) LightingCheck {
+	bounds := img.Bounds()
+	box := image.Rect(face.X-face.Size/2, face.Y-face.Size/2, face.X+face.Size/2, face.Y+face.Size/2).
+		Intersect(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	check := LightingCheck{}
+	if box.Dx() < 2 || box.Dy() < 2 {
+		return check
+	}
+	center := box.Min.X + box.Dx()/2
+	check.Halves = [2]image.Rectangle{
+		image.Rect(box.Min.X, box.Min.Y, center, box.Max.Y),
+		image.Rect(center, box.Min.Y, box.Max.X, box.Max.Y),
+	}
+
+	// Sums over the skin samples of each region: left, right, forehead, chin
+	var sums [4]float64
+	var counts [4]int
+	samples := YAW_SAMPLE_SIZE * YAW_SAMPLE_SIZE
+	for y := 0; y < YAW_SAMPLE_SIZE; y++ {
+		for x := 0; x < YAW_SAMPLE_SIZE; x++ {
+			sx := box.Min.X + (2*x+1)*box.Dx()/(2*YAW_SAMPLE_SIZE)
+			sy := box.Min.Y + (2*y+1)*box.Dy()/(2*YAW_SAMPLE_SIZE)
+			r, g, b, _ := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			if !isSkinTone(r, g, b) {
+				continue
+			}
+			lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 255
+			regions := []int{0}
+			if x >= YAW_SAMPLE_SIZE/2 {
+				regions[0] = 1
+			}
+			fy := (float64(y) + 0.5) / YAW_SAMPLE_SIZE
+			if fy >= LIGHTING_FOREHEAD_TOP && fy < LIGHTING_FOREHEAD_BOTTOM {
+				regions = append(regions, 2)
+			} else if fy >= LIGHTING_CHIN_TOP {
+				regions = append(regions, 3)
+			}
+			for _, region := range regions {
+				sums[region] += lum
+				counts[region]++
+			}
+		}
+	}
+	mean := func(region int, share float64) (float64, bool) {
+		if float64(counts[region]) < float64(samples)*share*LIGHTING_MIN_SKIN || sums[region] == 0 {
+			return 0, false
+		}
+		return sums[region] / float64(counts[region]), true
+	}
+	ratio := func(a, b float64) float64 {
+		return math.Max(a, b) / math.Min(a, b)
+	}
+
+	var leftOK, rightOK bool
+	check.Left, leftOK = mean(0, 0.5)
+	check.Right, rightOK = mean(1, 0.5)
+	if !leftOK || !rightOK {
+		return check
+	}
+	check.Checked = true
+	check.SideRatio = ratio(check.Left, check.Right)
+	check.Uneven = check.SideRatio > LIGHTING_MAX_SIDE_RATIO
+
+	forehead, foreheadOK := mean(2, LIGHTING_FOREHEAD_BOTTOM-LIGHTING_FOREHEAD_TOP)
+	chin, chinOK := mean(3, 1-LIGHTING_CHIN_TOP)
+	if foreheadOK && chinOK {
+		check.Forehead, check.Chin = forehead, chin
+		check.VerticalRatio = ratio(forehead, chin)
+		check.Uneven = check.Uneven || check.VerticalRatio > LIGHTING_MAX_VERTICAL_RATIO
+	}
+	return check
+}
+
+// printLightingCheck reports uneven face lighting as a compliance warning
+func printLightingCheck(check LightingCheck) {
+	if !check.Checked {
+		logInfo("ℹ️  Face lighting not checked (too little skin visible in the face box)")
+		return
+	}
+	vertical := "not measured"
+	if check.VerticalRatio > 0 {
+		vertical = fmt.Sprintf("%.2fx", check.VerticalRatio)
+	}
+	if !check.Uneven {
+		logInfo("💡 Even face lighting (left/right %.2fx, forehead/chin %s)", check.SideRatio, vertical)
+		return
+	}
+	if check.SideRatio > LIGHTING_MAX_SIDE_RATIO {
+		darker := "left"
+		if check.Right < check.Left {
+			darker = "right"
+		}
+		logWarn("⚠️  The %s half of the face is in shadow (brighter half %.2fx the darker, limit %.1fx) - light the face evenly from the front",
+			darker, check.SideRatio, LIGHTING_MAX_SIDE_RATIO)
+	}
+	if check.VerticalRatio > LIGHTING_MAX_VERTICAL_RATIO {
+		darker := "chin"
+		if check.Forehead < check.Chin {
+			darker = "forehead"
+		}
+		logWarn("⚠️  The %s is in shadow (forehead/chin %.2fx, limit %.1fx) - light the face evenly from the front",
+			darker, check.VerticalRatio, LIGHTING_MAX_VERTICAL_RATIO)
+	}
+}
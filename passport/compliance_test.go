@@ -0,0 +1,117 @@
+package passport
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+// litFace fills a face box of size pixels with skin lit by light(fx, fy), the
+// brightness factor at a position given in fractions of the box from its top-left
+func litFace(size int, light func(fx, fy float64) float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			f := light((float64(x)+0.5)/float64(size), (float64(y)+0.5)/float64(size))
+			img.SetRGBA(x, y, color.RGBA{uint8(224 * f), uint8(172 * f), uint8(140 * f), 255})
+		}
+	}
+	return img
+}
+
+// meanLight averages light over fx in [x0, x1) and fy in [y0, y1)
+func meanLight(light func(fx, fy float64) float64, x0, x1, y0, y1 float64) float64 {
+	const steps = 200
+	sum := 0.0
+	for i := 0; i < steps; i++ {
+		for j := 0; j < steps; j++ {
+			sum += light(x0+(x1-x0)*(float64(i)+0.5)/steps, y0+(y1-y0)*(float64(j)+0.5)/steps)
+		}
+	}
+	return sum / steps / steps
+}
+
+func TestCheckLightingOnGradients(t *testing.T) {
+	const size = 160
+	face := &FaceDetection{X: size / 2, Y: size / 2, Size: size}
+	tests := []struct {
+		name       string
+		light      func(fx, fy float64) float64
+		wantUneven bool
+	}{
+		{"even", func(fx, fy float64) float64 { return 1 }, false},
+		{"soft side light", func(fx, fy float64) float64 { return 1 - 0.15*fx }, false},
+		{"side light from the left", func(fx, fy float64) float64 { return 1 - 0.5*fx }, true},
+		{"side light from the right", func(fx, fy float64) float64 { return 0.5 + 0.5*fx }, true},
+		{"hard shadow on the right half", func(fx, fy float64) float64 {
+			if fx >= 0.5 {
+				return 0.55
+			}
+			return 1
+		}, true},
+		{"light from above", func(fx, fy float64) float64 { return 1 - 0.5*fy }, true},
+		{"soft light from above", func(fx, fy float64) float64 { return 1 - 0.15*fy }, false},
+	}
+	ratio := func(a, b float64) float64 { return math.Max(a, b) / math.Min(a, b) }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkLighting(litFace(size, tt.light), face)
+			if !check.Checked {
+				t.Fatal("lighting not checked")
+			}
+			// Luminance is proportional to the light on the same skin
+			wantSide := ratio(meanLight(tt.light, 0, 0.5, 0, 1), meanLight(tt.light, 0.5, 1, 0, 1))
+			wantVertical := ratio(meanLight(tt.light, 0, 1, LIGHTING_FOREHEAD_TOP, LIGHTING_FOREHEAD_BOTTOM), meanLight(tt.light, 0, 1, LIGHTING_CHIN_TOP, 1))
+			if math.Abs(check.SideRatio-wantSide) > 0.03 || math.Abs(check.VerticalRatio-wantVertical) > 0.03 {
+				t.Errorf("side ratio %.3f, vertical %.3f; want %.3f, %.3f", check.SideRatio, check.VerticalRatio, wantSide, wantVertical)
+			}
+			if check.Uneven != tt.wantUneven {
+				t.Errorf("uneven %v, want %v (side %.2f, vertical %.2f)", check.Uneven, tt.wantUneven, check.SideRatio, check.VerticalRatio)
+			}
+			if check.Halves[0] != image.Rect(0, 0, size/2, size) || check.Halves[1] != image.Rect(size/2, 0, size, size) {
+				t.Errorf("halves %v", check.Halves)
+			}
+		})
+	}
+}
+
+func TestCheckLightingWithoutSkin(t *testing.T) {
+	face := &FaceDetection{X: 300, Y: 320, Size: 160}
+	if check := checkLighting(syntheticPhoto(600, 800), face); check.Checked || check.Uneven {
+		t.Errorf("face without skin: checked %v, uneven %v", check.Checked, check.Uneven)
+	}
+	// Outside the image
+	if check := checkLighting(litFace(100, func(fx, fy float64) float64 { return 1 }), &FaceDetection{X: 500, Y: 500, Size: 100}); check.Checked {
+		t.Error("face box outside the image was checked")
+	}
+}
+
+// The measured luminances and ratios are what the report carries
+func TestLightingReport(t *testing.T) {
+	check := checkLighting(litFace(160, func(fx, fy float64) float64 { return 1 - 0.5*fx }), &FaceDetection{X: 80, Y: 80, Size: 160})
+	data, err := json.Marshal(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"left_luminance", "right_luminance", "forehead_luminance", "chin_luminance", "side_ratio", "vertical_ratio", "checked", "uneven"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("report lacks %s: %s", key, data)
+		}
+	}
+	if fields["uneven"] != true || math.Abs(fields["side_ratio"].(float64)-check.SideRatio) > 1e-9 {
+		t.Errorf("report %s doesn't match the check %+v", data, check)
+	}
+
+	// The warning names the half in shadow
+	log := captureDebugLog(t, func() { printLightingCheck(check) })
+	if !strings.Contains(log, "right half of the face is in shadow") {
+		t.Errorf("warning doesn't name the right half:\n%s", log)
+	}
+}
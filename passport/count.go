@@ -0,0 +1,21 @@
+package passport
+
+// withPhotoCount returns the format holding only count photos (-count). The count
+// is clamped to what fits on the sheet, and the grid shrinks to the fewest rows and
+// then the fewest columns that hold the photos, so the margins center the reduced
+// set. A count of 0 keeps the format as it is.
+func withPhotoCount(format PrintFormat, count int) PrintFormat {
+	if count <= 0 || count == format.PhotosPerSheet {
+		return format
+	}
+	if count > format.PhotosPerSheet {
+		logWarn("⚠️  Only %d photos fit on %s, placing %d instead of %d", format.PhotosPerSheet, format.Name, format.PhotosPerSheet, count)
+		return format
+	}
+
+	rows := (count + format.Columns - 1) / format.Columns
+	format.Columns = (count + rows - 1) / rows
+	format.Rows = rows
+	format.PhotosPerSheet = count
+	return format
+}
@@ -0,0 +1,307 @@
+package passport
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CropGeometry is where the passport photo was cut from the image given to the pipeline
+type CropGeometry struct {
+	Rect       image.Rectangle // Crop in the input image after Rotation, relative to its top-left corner
+	Rotation   int             // Clockwise turn (0, 90, 180, 270) applied by auto-rotation before cropping
+	Correction image.Point     // Calibration offset applied to the detected face, in pixels
+
+	DetectionPass string          // Face detection pass that found the face (DETECTION_PASS_*); empty for fallbacks
+	Face          image.Rectangle // Detected face box in the input image after Rotation; empty for fallbacks
+
+	HeadCovering HeadCoveringCheck // Hat heuristic above the detected face; not checked for fallbacks
+	Occlusion    OcclusionCheck    // Hair or objects over the eyes; not checked for fallbacks
+	Shoulders    ShoulderCheck     // Whether the top of the shoulders is in the crop; not checked for fallbacks
+	Lighting     LightingCheck     // Luminance balance of the face halves and bands; not checked for fallbacks
+}
+
+// SourceCrop is the crop expressed in the input file's own pixels, before EXIF
+// orientation and auto-rotation, so external editors can apply the same crop
+type SourceCrop struct {
+	Rect        image.Rectangle // Crop in the stored pixels of the file
+	Size        image.Point     // Stored size of the file in pixels
+	Orientation int             // EXIF orientation (1-8) turning Rect upright: the file's tag plus auto-rotation
+	Displayed   image.Rectangle // Crop in the image as viewers show it (EXIF orientation applied)
+	Rotation    int             // Clockwise turn applied on top of the EXIF orientation
+}
+
+// orientationMatrix is the linear part of an EXIF orientation, mapping stored pixel
+// coordinates to upright ones: (x, y) -> (m[0]*x + m[1]*y, m[2]*x + m[3]*y).
+// The y axis points down, so {0, -1, 1, 0} is a clockwise quarter turn.
+type orientationMatrix [4]int
+
+var exifOrientationMatrices = map[int]orientationMatrix{
+	1: {1, 0, 0, 1},   // upright
+	2: {-1, 0, 0, 1},  // mirrored
+	3: {-1, 0, 0, -1}, // 180°
+	4: {1, 0, 0, -1},  // mirrored and upside down
+	5: {0, 1, 1, 0},   // transposed
+	6: {0, -1, 1, 0},  // 90° clockwise
+	7: {0, -1, -1, 0}, // transversed
+	8: {0, 1, -1, 0},  // 270° clockwise
+}
+
+// rotationOrientations maps the clockwise turns of rotateImage to EXIF orientations
+var rotationOrientations = map[int]int{0: 1, 90: 6, 180: 3, 270: 8}
+
+// then returns the orientation that applies m first and n afterwards
+func (m orientationMatrix) then(n orientationMatrix) orientationMatrix {
+	return orientationMatrix{
+		n[0]*m[0] + n[1]*m[2], n[0]*m[1] + n[1]*m[3],
+		n[2]*m[0] + n[3]*m[2], n[2]*m[1] + n[3]*m[3],
+	}
+}
+
+func (m orientationMatrix) apply(p image.Point) image.Point {
+	return image.Pt(m[0]*p.X+m[1]*p.Y, m[2]*p.X+m[3]*p.Y)
+}
+
+// exifOrientation returns the EXIF code of m
+func (m orientationMatrix) exifOrientation() int {
+	for code, matrix := range exifOrientationMatrices {
+		if matrix == m {
+			return code
+		}
+	}
+	return 1
+}
+
+// mapBack maps a rectangle of an image that was oriented with m back to the
+// unoriented image of the given size. Rectangle edges are mapped as continuous
+// coordinates, so the result covers exactly the same pixels.
+func (m orientationMatrix) mapBack(rect image.Rectangle, size image.Point) image.Rectangle {
+	// The oriented image starts at the smallest transformed corner of the source
+	var offset image.Point
+	for _, corner := range []image.Point{{size.X, 0}, {0, size.Y}, size} {
+		p := m.apply(corner)
+		offset = image.Pt(min(offset.X, p.X), min(offset.Y, p.Y))
+	}
+
+	// Orientation matrices are orthogonal, so the transpose inverts them
+	inverse := orientationMatrix{m[0], m[2], m[1], m[3]}
+	a := inverse.apply(rect.Min.Add(offset))
+	b := inverse.apply(rect.Max.Add(offset))
+	return image.Rect(a.X, a.Y, b.X, b.Y) // image.Rect sorts the corners
+}
+
+// InSource maps the crop back to the stored pixels of a file with the given EXIF
+// orientation; orientedSize is the size of the image after that orientation was applied
+func (c CropGeometry) InSource(orientation int, orientedSize image.Point) SourceCrop {
+	exifMatrix, ok := exifOrientationMatrices[orientation]
+	if !ok {
+		exifMatrix, orientation = exifOrientationMatrices[1], 1
+	}
+	rotationMatrix := exifOrientationMatrices[rotationOrientations[c.Rotation]]
+
+	storedSize := orientedSize
+	if orientation >= 5 {
+		storedSize = image.Pt(orientedSize.Y, orientedSize.X)
+	}
+
+	displayed := rotationMatrix.mapBack(c.Rect, orientedSize)
+	return SourceCrop{
+		Rect:        exifMatrix.mapBack(displayed, storedSize),
+		Size:        storedSize,
+		Orientation: exifMatrix.then(rotationMatrix).exifOrientation(),
+		Displayed:   displayed,
+		Rotation:    c.Rotation,
+	}
+}
+
+// printSourceCrop reports the crop in file pixels
+func printSourceCrop(crop SourceCrop) {
+	logInfo("🗺️  Crop in source file pixels: %dx%d at (%d,%d), orientation %d",
+		crop.Rect.Dx(), crop.Rect.Dy(), crop.Rect.Min.X, crop.Rect.Min.Y, crop.Orientation)
+	if crop.Displayed != crop.Rect {
+		logInfo("   - As displayed (EXIF orientation applied): %dx%d at (%d,%d), then turned %d° clockwise",
+			crop.Displayed.Dx(), crop.Displayed.Dy(), crop.Displayed.Min.X, crop.Displayed.Min.Y, crop.Rotation)
+	}
+}
+
+// cropRect is a rectangle in the JSON crop report
+type cropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func newCropRect(r image.Rectangle) cropRect {
+	return cropRect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// cropReport is the JSON written by -crop-report
+type cropReport struct {
+	Version       string             `json:"tool_version"` // See toolVersion
+	Source        string             `json:"source"`
+	SourceWidth   int                `json:"source_width"`
+	SourceHeight  int                `json:"source_height"`
+	Crop          cropRect           `json:"crop"`        // Stored file pixels
+	Orientation   int                `json:"orientation"` // EXIF orientation to apply to the cropped pixels
+	DisplayedCrop cropRect           `json:"displayed_crop"`
+	Rotation      int                `json:"rotation"` // Clockwise turn after the EXIF orientation
+	Angle         float64            `json:"angle"`    // Roll correction; the pipeline never straightens
+	FaceFound     bool               `json:"face_found"`
+	DetectionPass string             `json:"detection_pass,omitempty"` // "relaxed" is a best-effort detection
+	Strategy      string             `json:"strategy"`                 // Crop strategy that placed the crop
+	Attempts      []StrategyAttempt  `json:"attempts"`
+	Correction    cropOffset         `json:"calibration_correction"`     // Applied to the detected face
+	CropScale     float64            `json:"crop_scale,omitempty"`       // Crop pixels per photo pixel, below 1 enlarged
+	HeadCovering  *HeadCoveringCheck `json:"head_covering,omitempty"`    // Warning only; absent when no face was checked
+	Occlusion     *OcclusionCheck    `json:"eye_occlusion,omitempty"`    // Warning only; absent when the eyes weren't checked
+	Shoulders     *ShoulderCheck     `json:"shoulders,omitempty"`        // Warning only; absent when the framing wasn't checked
+	Lighting      *LightingCheck     `json:"lighting,omitempty"`         // Warning only; absent when the face lighting wasn't checked
+	Resolution    *ResolutionCheck   `json:"input_resolution,omitempty"` // Absent when the input declares no DPI
+	SafeArea      *SafeAreaCheck     `json:"safe_area,omitempty"`        // Absent without -safe-margin
+	Stripped      metadataStripped   `json:"metadata_stripped"`          // Outputs sanitized by -strip-metadata
+	Sheets        []sheetReport      `json:"sheets"`
+	Candidates    []CandidateScore   `json:"candidates,omitempty"` // -pick-best ranking, best first
+}
+
+// sheetReport is the size of a print sheet in the JSON crop report: the nominal
+// format the photos are laid out on, and the image including any bleed around it
+type sheetReport struct {
+	Format          string  `json:"format"`
+	NominalWidthMM  int     `json:"nominal_width_mm"`
+	NominalHeightMM int     `json:"nominal_height_mm"`
+	NominalWidthPX  int     `json:"nominal_width_px"`
+	NominalHeightPX int     `json:"nominal_height_px"`
+	BleedMM         float64 `json:"bleed_mm"` // Per side
+	WidthPX         int     `json:"width_px"` // Sheet image with bleed
+	HeightPX        int     `json:"height_px"`
+	DPI             int     `json:"dpi"`
+
+	MaxPlacementDeviationPX float64 `json:"max_placement_deviation_px"` // Drawn photo edges vs the millimeter layout
+}
+
+func newSheetReport(format PrintFormat) sheetReport {
+	size := format.SheetSize()
+	return sheetReport{
+		Format:          format.Key,
+		NominalWidthMM:  int(math.Round(format.WidthMM)),
+		NominalHeightMM: int(math.Round(format.HeightMM)),
+		NominalWidthPX:  format.WidthPX,
+		NominalHeightPX: format.HeightPX,
+		BleedMM:         format.BleedMM,
+		WidthPX:         size.X,
+		HeightPX:        size.Y,
+		DPI:             format.DPI,
+
+		MaxPlacementDeviationPX: maxPlacementDeviation(auditGridLayout(calculateGridLayout(format), format)),
+	}
+}
+
+// metadataStripped tells which outputs hold no metadata beyond JFIF density and a kept ICC profile
+type metadataStripped struct {
+	Sheet bool `json:"sheet"`
+	Photo bool `json:"photo"`
+}
+
+// cropOffset is a pixel offset in the JSON crop report
+type cropOffset struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// writeCropReports writes the JSON report and XMP sidecar next to the input when requested
+func writeCropReports(config Config, crop SourceCrop, result *Result) error {
+	inputDir, inputName := splitInputPath(config.InputPath)
+
+	if config.CropReport {
+		report := cropReport{
+			Version:       toolVersion(),
+			Source:        filepath.Base(config.InputPath),
+			SourceWidth:   crop.Size.X,
+			SourceHeight:  crop.Size.Y,
+			Crop:          newCropRect(crop.Rect),
+			Orientation:   crop.Orientation,
+			DisplayedCrop: newCropRect(crop.Displayed),
+			Rotation:      crop.Rotation,
+			FaceFound:     result.FaceFound,
+			DetectionPass: result.Crop.DetectionPass,
+			Strategy:      result.Strategy,
+			Attempts:      result.Attempts,
+			Correction:    cropOffset{X: result.Crop.Correction.X, Y: result.Crop.Correction.Y},
+			CropScale:     result.CropScale,
+			Stripped:      metadataStripped{Sheet: config.Save.Strip, Photo: config.SavePhoto && config.PhotoSave.Strip},
+		}
+		if result.Crop.HeadCovering.Checked {
+			report.HeadCovering = &result.Crop.HeadCovering
+		}
+		if result.Crop.Occlusion.Checked {
+			report.Occlusion = &result.Crop.Occlusion
+		}
+		if result.Crop.Shoulders.Checked {
+			report.Shoulders = &result.Crop.Shoulders
+		}
+		if result.Crop.Lighting.Checked {
+			report.Lighting = &result.Crop.Lighting
+		}
+		if result.Resolution.InputDPI > 0 {
+			report.Resolution = &result.Resolution
+		}
+		if config.SafeMargin > 0 {
+			report.SafeArea = &result.SafeArea
+		}
+		for _, sheet := range result.Sheets {
+			report.Sheets = append(report.Sheets, newSheetReport(sheet.Format))
+		}
+		report.Candidates = config.Ranking
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		reportDir, _ := outputLocation(config.InputPath, config.OutputDir)
+		path := availableOutputPath(filepath.Join(reportDir, inputName+"_crop.json"))
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("error writing crop report: %v", err)
+		}
+		logInfo("🗺️  Crop report saved to: %s", path)
+	}
+
+	// Editors only pick up a sidecar named like the image, so it is replaced, not numbered
+	if config.XMPSidecar {
+		path := filepath.Join(inputDir, inputName+".xmp")
+		if err := os.WriteFile(path, []byte(buildCropXMP(crop)), 0644); err != nil {
+			return fmt.Errorf("error writing XMP sidecar: %v", err)
+		}
+		logInfo("🗺️  XMP sidecar saved to: %s", path)
+	}
+	return nil
+}
+
+// buildCropXMP returns an XMP packet with the crop as Camera Raw / Lightroom settings.
+// Camera Raw crop edges are fractions of the stored (unoriented) image, and the
+// orientation including auto-rotation goes into tiff:Orientation.
+func buildCropXMP(crop SourceCrop) string {
+	fraction := func(value, size int) string {
+		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.6f", float64(value)/float64(size)), "0"), ".")
+	}
+
+	var b strings.Builder
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:tiff=\"http://ns.adobe.com/tiff/1.0/\"\n")
+	b.WriteString("    xmlns:crs=\"http://ns.adobe.com/camera-raw-settings/1.0/\"\n")
+	fmt.Fprintf(&b, "   tiff:Orientation=\"%d\"\n", crop.Orientation)
+	b.WriteString("   crs:HasCrop=\"True\"\n")
+	fmt.Fprintf(&b, "   crs:CropTop=\"%s\"\n", fraction(crop.Rect.Min.Y, crop.Size.Y))
+	fmt.Fprintf(&b, "   crs:CropLeft=\"%s\"\n", fraction(crop.Rect.Min.X, crop.Size.X))
+	fmt.Fprintf(&b, "   crs:CropBottom=\"%s\"\n", fraction(crop.Rect.Max.Y, crop.Size.Y))
+	fmt.Fprintf(&b, "   crs:CropRight=\"%s\"\n", fraction(crop.Rect.Max.X, crop.Size.X))
+	b.WriteString("   crs:CropAngle=\"0\"/>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+// The crop reported in file pixels, re-applied by hand to the stored pixels and
+// turned by the reported orientation, gives exactly the pixels the tool cropped from
+// the upright image, for every EXIF orientation and auto-rotation
+func TestSourceCropRoundTrip(t *testing.T) {
+	// Every pixel of the stored image is unique, so any mapping error shows up
+	stored := coordinateImage(image.Rect(0, 0, 60, 40))
+	for orientation := 1; orientation <= 8; orientation++ {
+		for _, rotation := range []int{0, 90, 180, 270} {
+			t.Run(fmt.Sprintf("orientation %d, turned %d", orientation, rotation), func(t *testing.T) {
+				oriented := correctOrientation(stored, orientation)
+				upright := rotateImage(oriented, rotation)
+				size := upright.Bounds().Size()
+				crop := CropGeometry{Rect: image.Rect(size.X/5, size.Y/4, size.X*3/5, size.Y*7/8), Rotation: rotation}
+				want, err := cropImage(upright, crop.Rect)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				source := crop.InSource(orientation, oriented.Bounds().Size())
+				if source.Size != stored.Bounds().Size() {
+					t.Fatalf("stored size %v, want %v", source.Size, stored.Bounds().Size())
+				}
+				cut, err := cropImage(stored, source.Rect)
+				if err != nil {
+					t.Fatalf("crop %v in file pixels: %v", source.Rect, err)
+				}
+				got := toRGBA(correctOrientation(cut, source.Orientation))
+				if got.Bounds() != want.Bounds() {
+					t.Fatalf("re-applied crop is %v, the tool's %v", got.Bounds(), want.Bounds())
+				}
+				for y := 0; y < want.Bounds().Dy(); y++ {
+					for x := 0; x < want.Bounds().Dx(); x++ {
+						if got.RGBAAt(x, y) != want.RGBAAt(x, y) {
+							t.Fatalf("pixel (%d,%d) is %v, the tool cropped %v", x, y, got.RGBAAt(x, y), want.RGBAAt(x, y))
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// toRGBA copies img to an RGBA image with its origin at (0,0)
+func toRGBA(img image.Image) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,139 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+)
+
+// Debug overlay file written when -debug is set
+const DEBUG_IMAGE_PATH = "debug_face_detection.jpg"
+
+// debugImagePath returns where the debug image with the fixed name is written: the
+// working directory, or with -keep-artifacts next to the outputs with the input's
+// name in front, so the debug images of a batch don't overwrite each other
+func debugImagePath(fixedName string, config Config) string {
+	if !config.KeepArtifacts || config.InputPath == "" {
+		return fixedName
+	}
+	dir, name := outputLocation(config.InputPath, config.OutputDir)
+	return filepath.Join(dir, name+"_"+fixedName)
+}
+
+// Overlay colors, also for drawing AnalyzeFaces results
+var (
+	DebugColorFace = color.RGBA{0, 255, 0, 255}   // detected face box
+	DebugColorHead = color.RGBA{255, 0, 255, 255} // estimated head box including hair
+	DebugColorCrop = color.RGBA{255, 0, 0, 255}   // final crop rectangle
+
+	DebugColorShoulder = color.RGBA{255, 200, 0, 255}   // band sampled for the shoulder check
+	DebugColorYaw      = color.RGBA{0, 200, 255, 255}   // arrow showing which way the head is turned
+	DebugColorHat      = color.RGBA{255, 120, 0, 255}   // region suspected to be a hat or head covering
+	DebugColorEyes     = color.RGBA{0, 120, 255, 255}   // eye bands measured for occlusion, with the covered fraction
+	DebugColorPupils   = color.RGBA{255, 255, 0, 255}   // located pupil centers
+	DebugColorLighting = color.RGBA{255, 255, 255, 255} // face halves compared for side lighting, with their skin luminance
+)
+
+// DebugOverlay is a copy of the source image that the pipeline annotates with
+// detection results. A nil *DebugOverlay is valid and ignores all drawing calls,
+// so callers don't need to check whether debugging is enabled.
+type DebugOverlay struct {
+	img *image.RGBA
+}
+
+// NewDebugOverlay copies the source image into a drawable overlay
+func NewDebugOverlay(src image.Image) *DebugOverlay {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+	return &DebugOverlay{img: img}
+}
+
+// lineThickness scales outlines with the image so they stay visible on large photos
+func (d *DebugOverlay) lineThickness() int {
+	thickness := d.img.Bounds().Dx() / 400
+	if thickness < 1 {
+		thickness = 1
+	}
+	return thickness
+}
+
+// DrawRect outlines a rectangle in image coordinates
+func (d *DebugOverlay) DrawRect(r image.Rectangle, c color.RGBA) {
+	if d == nil {
+		return
+	}
+	t := d.lineThickness()
+	fill := &image.Uniform{c}
+	r = r.Intersect(d.img.Bounds())
+	if r.Empty() {
+		return
+	}
+	draw.Draw(d.img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+t), fill, image.Point{}, draw.Src)
+	draw.Draw(d.img, image.Rect(r.Min.X, r.Max.Y-t, r.Max.X, r.Max.Y), fill, image.Point{}, draw.Src)
+	draw.Draw(d.img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+t, r.Max.Y), fill, image.Point{}, draw.Src)
+	draw.Draw(d.img, image.Rect(r.Max.X-t, r.Min.Y, r.Max.X, r.Max.Y), fill, image.Point{}, draw.Src)
+}
+
+// DrawArrow draws a horizontal arrow of the given length starting at from; a negative
+// length points left
+func (d *DebugOverlay) DrawArrow(from image.Point, length int, c color.RGBA) {
+	if d == nil || length == 0 {
+		return
+	}
+	t := d.lineThickness()
+	fill := &image.Uniform{c}
+	tip := from.Add(image.Pt(length, 0))
+	shaft := image.Rect(min(from.X, tip.X), from.Y-t, max(from.X, tip.X), from.Y+t)
+	draw.Draw(d.img, shaft.Intersect(d.img.Bounds()), fill, image.Point{}, draw.Src)
+
+	// Arrow head: vertical strokes shrinking towards the tip
+	direction := 1
+	if length < 0 {
+		direction = -1
+	}
+	headLength := max(length*direction/4, 3*t)
+	for i := 0; i < headLength; i++ {
+		x := tip.X - direction*i
+		half := i / 2
+		stroke := image.Rect(x, from.Y-half-t, x+1, from.Y+half+t)
+		draw.Draw(d.img, stroke.Intersect(d.img.Bounds()), fill, image.Point{}, draw.Src)
+	}
+}
+
+// DrawText writes text with its top-left corner at the given point, sized with the
+// image like the outlines
+func (d *DebugOverlay) DrawText(at image.Point, text string, c color.RGBA) {
+	if d == nil {
+		return
+	}
+	face, err := newLabelFace(float64(d.lineThickness()*12), 72)
+	if err != nil {
+		return
+	}
+	defer face.Close()
+	mask := renderTextMask(text, face)
+	target := mask.Bounds().Add(at).Intersect(d.img.Bounds())
+	draw.DrawMask(d.img, target, &image.Uniform{c}, image.Point{}, mask, target.Min.Sub(at), draw.Over)
+}
+
+// Image returns the annotated copy, e.g. to encode it another way than Save
+func (d *DebugOverlay) Image() image.Image {
+	if d == nil {
+		return nil
+	}
+	return d.img
+}
+
+// Save writes the overlay as JPEG
+func (d *DebugOverlay) Save(path string) error {
+	if d == nil {
+		return nil
+	}
+	if _, _, err := saveImage(d.img, path, SaveOptions{Metadata: METADATA_NONE}); err != nil {
+		return err
+	}
+	logInfo("🐞 Debug image saved to: %s", path)
+	return nil
+}
@@ -0,0 +1,219 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// FACE_CASCADE_PATH is the pigo face cascade, resolved relative to the working directory
+const FACE_CASCADE_PATH = "facefinder"
+
+// Images are downscaled to at most this many pixels on the long side for detection
+const DETECTION_MAX_DIMENSION = 1200
+
+// FaceDetector holds the unpacked face cascade so it is read and unpacked only once,
+// then reused for every image of a batch, a camera capture, or a server
+type FaceDetector struct {
+	classifier *pigo.Pigo
+	pupils     *pupilCascade // Optional, see PUPIL_CASCADE_NAME
+	Options    DetectionOptions
+}
+
+// NewFaceDetector loads the pigo face cascade from cascadePath, and the pupil
+// cascade next to it when present; without it the detector works in reduced
+// accuracy mode instead of failing
+func NewFaceDetector(cascadePath string, opts DetectionOptions) (*FaceDetector, error) {
+	cascadeFile, err := os.ReadFile(cascadePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("face detection model not found - please download with: curl -L https://github.com/esimov/pigo/raw/master/cascade/facefinder -o %s", cascadePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cascade file: %v", err)
+	}
+
+	classifier, err := pigo.NewPigo().Unpack(cascadeFile)
+	if err != nil {
+		return nil, fmt.Errorf("error unpacking cascade file: %v", err)
+	}
+	return &FaceDetector{classifier: classifier, pupils: loadPupilCascade(cascadePath), Options: opts}, nil
+}
+
+// withOptions returns a detector sharing the cascades but using other options
+func (d *FaceDetector) withOptions(opts DetectionOptions) *FaceDetector {
+	return &FaceDetector{classifier: d.classifier, pupils: d.pupils, Options: opts}
+}
+
+// Detect finds the faces in img, best first (largest and most confident), in the
+// coordinates of img. It fails when no face passes the confidence threshold.
+func (d *FaceDetector) Detect(img image.Image) ([]FaceDetection, error) {
+	opts := d.Options
+	bounds := img.Bounds()
+	origWidth := bounds.Dx()
+	origHeight := bounds.Dy()
+
+	// Resize image for face detection if too large
+	var resizedImg image.Image
+	var scaleFactor float64 = 1.0
+
+	if origWidth > DETECTION_MAX_DIMENSION || origHeight > DETECTION_MAX_DIMENSION {
+		if origWidth > origHeight {
+			scaleFactor = float64(DETECTION_MAX_DIMENSION) / float64(origWidth)
+		} else {
+			scaleFactor = float64(DETECTION_MAX_DIMENSION) / float64(origHeight)
+		}
+
+		newWidth := max(1, int(float64(origWidth)*scaleFactor))
+		newHeight := max(1, int(float64(origHeight)*scaleFactor))
+		resizedImg = resizeImage(img, newWidth, newHeight)
+	} else {
+		resizedImg = img
+	}
+
+	// Convert to grayscale for face detection
+	gray := imageToGrayscale(resizedImg)
+	grayBounds := gray.Bounds()
+	width := grayBounds.Dx()
+	height := grayBounds.Dy()
+
+	// Convert to Pigo format
+	pixels := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			grayColor := gray.GrayAt(x, y)
+			pixels[y*width+x] = grayColor.Y
+		}
+	}
+
+	// Face detection parameters: the face size range follows the buffer resolution
+	minRatio, maxRatio := opts.faceSizeRange()
+	shortSide := float64(min(width, height))
+	minSize := max(DETECTION_MIN_WINDOW_PX, int(shortSide*minRatio))
+	maxSize := max(minSize, int(shortSide*maxRatio))
+	logDebug("   🔬 Detection buffer %dx%d, face size %d-%d px", width, height, minSize, maxSize)
+
+	runCascade := func(pixels []uint8) []pigo.Detection {
+		cParams := pigo.CascadeParams{
+			MinSize:     minSize,
+			MaxSize:     maxSize,
+			ShiftFactor: 0.1,
+			ScaleFactor: 1.1,
+			ImageParams: pigo.ImageParams{
+				Pixels: pixels,
+				Rows:   height,
+				Cols:   width,
+				Dim:    width,
+			},
+		}
+
+		faces := d.classifier.RunCascade(cParams, 0.0)
+		faces = d.classifier.ClusterDetections(faces, opts.ClusterIoU)
+
+		// Drop detections below the confidence threshold
+		confidentFaces := faces[:0]
+		for _, face := range faces {
+			if float64(face.Q) >= opts.MinConfidence {
+				confidentFaces = append(confidentFaces, face)
+			}
+		}
+		if len(confidentFaces) < len(faces) {
+			logInfo("🔎 Ignored %d detection(s) below confidence %.1f", len(faces)-len(confidentFaces), opts.MinConfidence)
+		}
+		return confidentFaces
+	}
+
+	faces := runCascade(pixels)
+	logDetectionPass("upright", len(faces))
+
+	// Passes that found anything, to tell duplicates across passes from overlapping
+	// detections within the upright pass
+	contributingPasses := 0
+	if len(faces) > 0 {
+		contributingPasses++
+	}
+
+	// Backlit or low-contrast photos: retry on a locally equalized copy. The copy
+	// only feeds the detector, the output photo is cropped from the original.
+	detectionPixels := pixels
+	if !hasConfidentFace(faces) {
+		if low, high := luminanceRange(pixels); high-low < LOW_CONTRAST_RANGE {
+			detectionPixels = equalizeLocalContrast(pixels, width, height)
+			equalizedFaces := runCascade(detectionPixels)
+			logDetectionPass(fmt.Sprintf("equalized (contrast range %d)", high-low), len(equalizedFaces))
+			faces = append(faces, equalizedFaces...)
+			if len(equalizedFaces) > 0 {
+				contributingPasses++
+			}
+		}
+	}
+
+	// Optionally retry on tilted copies for heads the upright cascade misses
+	// or only finds weakly; the best detection of all passes wins below
+	if opts.RotateSearch && !hasConfidentFace(faces) {
+		tiltedFaces := searchTiltedFaces(detectionPixels, width, height, runCascade)
+		logDetectionPass(fmt.Sprintf("tilted ±%.0f°", ROTATE_SEARCH_ANGLE), len(tiltedFaces))
+		faces = append(faces, tiltedFaces...)
+		if len(tiltedFaces) > 0 {
+			contributingPasses++
+		}
+	}
+
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("no faces detected")
+	}
+
+	// Several passes can find the same face; keep only its most confident detection
+	faces, merged := SuppressDuplicateFaces(faces, opts.ClusterIoU)
+	if merged > 0 && contributingPasses > 1 {
+		logInfo("🔎 Merged %d duplicate detection(s) across %d passes", merged, contributingPasses)
+	} else if merged > 0 {
+		logInfo("🔎 Merged %d overlapping detection(s)", merged)
+	}
+
+	// Best face first (largest and most confident)
+	score := func(face pigo.Detection) float64 {
+		return float64(face.Scale) + float64(face.Q)*100
+	}
+	sort.SliceStable(faces, func(i, j int) bool { return score(faces[i]) > score(faces[j]) })
+
+	// Scale coordinates back to original image size; each eye of a face is located
+	// on its own when the pupil cascade is loaded
+	imgParams := pigo.ImageParams{Pixels: pixels, Rows: height, Cols: width, Dim: width}
+	detections := make([]FaceDetection, len(faces))
+	for i, face := range faces {
+		detections[i] = FaceDetection{
+			X:      int(float64(face.Col) / scaleFactor),
+			Y:      int(float64(face.Row) / scaleFactor),
+			Size:   int(float64(face.Scale) / scaleFactor),
+			Score:  face.Q,
+			Pupils: locatePupils(d.pupils, face, imgParams).scaled(scaleFactor),
+		}
+	}
+	return detections, nil
+}
+
+// detectBest returns the best face of Detect
+func (d *FaceDetector) detectBest(img image.Image) (*FaceDetection, error) {
+	faces, err := d.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	return &faces[0], nil
+}
+
+// cropWithDetector is the face strategy of the chain. It reuses the cascade of
+// config.Detector, or loads it when none was given, and always detects with
+// config.Detection.
+func cropWithDetector(img image.Image, config Config) (image.Image, CropGeometry, error) {
+	if config.Detector == nil {
+		detector, err := NewFaceDetector(FACE_CASCADE_PATH, config.Detection)
+		if err != nil {
+			return nil, CropGeometry{}, err
+		}
+		return detector.cropWithFaceDetection(img, config)
+	}
+	return config.Detector.withOptions(config.Detection).cropWithFaceDetection(img, config)
+}
@@ -0,0 +1,110 @@
+package passport
+
+import (
+	"math"
+)
+
+const (
+	// The detection buffer counts as low contrast when the 5th to 95th percentile
+	// luminance range is narrower than this (0-255), e.g. backlit or foggy photos
+	LOW_CONTRAST_RANGE = 80
+
+	// Local equalization: the buffer is split into a grid of tiles, each tile gets its
+	// own histogram equalization, and bins are clipped at this multiple of the mean
+	// bin count so flat areas (background) aren't blown up into noise
+	EQUALIZE_TILES      = 8
+	EQUALIZE_CLIP_LIMIT = 3.0
+)
+
+// luminanceRange returns the 5th and 95th percentile of a grayscale buffer
+func luminanceRange(pixels []uint8) (low, high int) {
+	var histogram [256]int
+	for _, p := range pixels {
+		histogram[p]++
+	}
+
+	lowCount := len(pixels) * 5 / 100
+	highCount := len(pixels) * 95 / 100
+	low, high = -1, 255
+	cumulative := 0
+	for value, count := range histogram {
+		cumulative += count
+		if low < 0 && cumulative > lowCount {
+			low = value
+		}
+		if cumulative > highCount {
+			high = value
+			break
+		}
+	}
+	return max(low, 0), high
+}
+
+// equalizeLocalContrast applies contrast-limited adaptive histogram equalization
+// (CLAHE) to a row-major grayscale buffer and returns a new buffer. Tile mappings
+// are interpolated bilinearly so tile borders don't show up as edges.
+func equalizeLocalContrast(pixels []uint8, width, height int) []uint8 {
+	tilesX := min(EQUALIZE_TILES, width)
+	tilesY := min(EQUALIZE_TILES, height)
+	tileW := float64(width) / float64(tilesX)
+	tileH := float64(height) / float64(tilesY)
+
+	// Build a clipped, equalized lookup table per tile
+	luts := make([][256]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, x1 := int(float64(tx)*tileW), int(float64(tx+1)*tileW)
+			y0, y1 := int(float64(ty)*tileH), int(float64(ty+1)*tileH)
+
+			var histogram [256]float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					histogram[pixels[y*width+x]]++
+				}
+			}
+			count := float64((x1 - x0) * (y1 - y0))
+
+			// Clip the histogram and spread the excess evenly over all bins
+			limit := math.Max(1, EQUALIZE_CLIP_LIMIT*count/256)
+			excess := 0.0
+			for i := range histogram {
+				if histogram[i] > limit {
+					excess += histogram[i] - limit
+					histogram[i] = limit
+				}
+			}
+			cumulative := 0.0
+			lut := &luts[ty*tilesX+tx]
+			for i := range histogram {
+				cumulative += histogram[i] + excess/256
+				lut[i] = uint8(math.Min(255, math.Round(cumulative/count*255)))
+			}
+		}
+	}
+
+	// Interpolate between the four nearest tile centers
+	equalized := make([]uint8, len(pixels))
+	for y := 0; y < height; y++ {
+		fy := math.Max(0, math.Min(float64(tilesY-1), (float64(y)+0.5)/tileH-0.5))
+		ty0 := int(fy)
+		ty1 := min(ty0+1, tilesY-1)
+		wy := fy - float64(ty0)
+		for x := 0; x < width; x++ {
+			fx := math.Max(0, math.Min(float64(tilesX-1), (float64(x)+0.5)/tileW-0.5))
+			tx0 := int(fx)
+			tx1 := min(tx0+1, tilesX-1)
+			wx := fx - float64(tx0)
+
+			p := pixels[y*width+x]
+			top := float64(luts[ty0*tilesX+tx0][p])*(1-wx) + float64(luts[ty0*tilesX+tx1][p])*wx
+			bottom := float64(luts[ty1*tilesX+tx0][p])*(1-wx) + float64(luts[ty1*tilesX+tx1][p])*wx
+			equalized[y*width+x] = uint8(math.Round(top*(1-wy) + bottom*wy))
+		}
+	}
+	return equalized
+}
+
+// logDetectionPass logs one detection strategy and its result at debug level (-verbose)
+func logDetectionPass(strategy string, faces int) {
+	logDebug("   🔬 Detection pass '%s': %d face(s)", strategy, faces)
+}
@@ -0,0 +1,119 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// backlitPhoto returns img squeezed into a narrow band of dark tones with a light
+// falloff from left to right, like a face against a bright window: the luminance
+// spans about 40 levels
+func backlitPhoto(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	backlit := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			falloff := 100 + 40*(x-bounds.Min.X)/bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			squeeze := func(v uint32) uint8 { return uint8(falloff + int(v>>8)/16) }
+			backlit.SetRGBA(x, y, color.RGBA{squeeze(r), squeeze(g), squeeze(b), 255})
+		}
+	}
+	return backlit
+}
+
+// captureDebugLog runs fn with the debug messages going to the returned buffer
+func captureDebugLog(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := logger
+	logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { logger = saved }()
+	fn()
+	return buf.String()
+}
+
+// The upright cascade finds nothing on the backlit sample; the pass on the locally
+// equalized buffer does
+func TestDetectEqualizedPassOnLowContrast(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := NewFaceDetector(FACE_CASCADE_PATH, DefaultDetectionOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backlit := backlitPhoto(source.Image)
+
+	var faces []FaceDetection
+	log := captureDebugLog(t, func() { faces, err = detector.Detect(backlit) })
+	if err != nil {
+		t.Fatalf("no face on the backlit sample: %v\n%s", err, log)
+	}
+	if !strings.Contains(log, "Detection pass 'upright': 0 face(s)") {
+		t.Errorf("the upright pass found a face, the fixture no longer needs equalizing:\n%s", log)
+	}
+	if !strings.Contains(log, "Detection pass 'equalized") {
+		t.Errorf("no equalized pass:\n%s", log)
+	}
+	if upright, err := detector.Detect(source.Image); err == nil && len(faces) > 0 {
+		want, got := upright[0], faces[0]
+		if d := image.Pt(got.X-want.X, got.Y-want.Y); max(d.X, -d.X, d.Y, -d.Y) > want.Size/10 {
+			t.Errorf("face at (%d,%d) on the backlit sample, at (%d,%d) on the original", got.X, got.Y, want.X, want.Y)
+		}
+	}
+}
+
+// Equalization only feeds the detector: the photo is cut from the backlit pixels
+func TestEqualizationLeavesPhotoAlone(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Generate(backlitPhoto(source.Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.FaceFound {
+		t.Fatalf("strategy %s, want a face crop", result.Strategy)
+	}
+	if low, high := luminanceRange(imageToGrayscale(result.Photo).Pix); high-low >= LOW_CONTRAST_RANGE {
+		t.Errorf("photo luminance spans %d-%d, the equalized detection buffer leaked into it", low, high)
+	}
+}
+
+func TestEqualizeLocalContrastWidensRange(t *testing.T) {
+	const width, height = 64, 64
+	pixels := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels[y*width+x] = uint8(110 + (x+y)%20)
+		}
+	}
+	low, high := luminanceRange(pixels)
+	if high-low >= LOW_CONTRAST_RANGE {
+		t.Fatalf("fixture range %d-%d isn't low contrast", low, high)
+	}
+	equalized := equalizeLocalContrast(pixels, width, height)
+	if eqLow, eqHigh := luminanceRange(equalized); eqHigh-eqLow <= 2*(high-low) {
+		t.Errorf("range %d-%d after equalizing, %d-%d before", eqLow, eqHigh, low, high)
+	}
+}
+
+func TestLuminanceRange(t *testing.T) {
+	pixels := make([]uint8, 100)
+	for i := range pixels {
+		pixels[i] = uint8(i * 2)
+	}
+	// 5th and 95th percentile of 0, 2, ..., 198
+	if low, high := luminanceRange(pixels); low != 10 || high != 190 {
+		t.Errorf("luminanceRange = %d, %d, want 10, 190", low, high)
+	}
+}
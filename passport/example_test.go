@@ -0,0 +1,41 @@
+package passport_test
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"log"
+	"os"
+
+	"passport-photo-generator/passport"
+)
+
+// Marks every face of a photo with its landmarks and writes the marked copy
+func ExampleAnalyzeFaces() {
+	file, err := os.Open("photo.jpg")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	faces, err := passport.AnalyzeFaces(img, passport.DefaultDetectionOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	overlay := passport.NewDebugOverlay(img)
+	for _, face := range faces {
+		overlay.DrawRect(face.Box, passport.DebugColorFace)
+		overlay.DrawRect(face.Head, passport.DebugColorHead)
+		for _, eye := range face.Eyes {
+			overlay.DrawRect(image.Rect(eye.X-3, eye.Y-3, eye.X+3, eye.Y+3), passport.DebugColorPupils)
+		}
+		overlay.DrawText(face.Box.Min, fmt.Sprintf("%.0f", face.Score), passport.DebugColorFace)
+	}
+	if err := overlay.Save("faces.jpg"); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// fileSizeUnits are the suffixes accepted by -max-file-size, longest first so "KB"
+// isn't read as "B"
+var fileSizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+	{"B", 1},
+}
+
+// parseFileSize parses a byte budget such as "3MB", "500KB", "2.5M" or "800000"
+func parseFileSize(value string) (int, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range fileSizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid file size '%s' (e.g. 3MB, 500KB or a number of bytes)", value)
+	}
+	return int(number * multiplier), nil
+}
+
+// encodeWithinBudget encodes img like encodeImage and, when opts.MaxBytes is set,
+// lowers the JPEG quality until the file fits. File size grows with quality, so a
+// binary search finds the highest quality that fits in a few encodes. Returns the
+// data and the quality used; when even quality 1 is too large it warns and returns
+// the quality 1 encode.
+func encodeWithinBudget(img image.Image, opts SaveOptions) ([]byte, int, error) {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DEFAULT_JPEG_QUALITY
+	}
+	encodeAt := func(q int) ([]byte, error) {
+		o := opts
+		o.Quality = q
+		return encodeImage(img, o)
+	}
+
+	data, err := encodeAt(quality)
+	if err != nil || opts.MaxBytes <= 0 || len(data) <= opts.MaxBytes {
+		return data, quality, err
+	}
+
+	// Highest quality in [low, high] that fits; best holds the smallest encode seen
+	// so far, which is the fallback when nothing fits
+	low, high := 1, quality-1
+	var best []byte
+	bestQuality := 0
+	for low <= high {
+		q := (low + high) / 2
+		candidate, err := encodeAt(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(candidate) <= opts.MaxBytes {
+			best, bestQuality = candidate, q
+			low = q + 1
+		} else {
+			high = q - 1
+		}
+	}
+	if best != nil {
+		return best, bestQuality, nil
+	}
+
+	data, err = encodeAt(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	logWarn("⚠️  %s at %dx%d pixels exceeds the %s limit even at JPEG quality 1 - reduce the dimensions (e.g. a smaller print format)",
+		formatFileSize(len(data)), img.Bounds().Dx(), img.Bounds().Dy(), formatFileSize(opts.MaxBytes))
+	return data, 1, nil
+}
+
+// formatFileSize formats a byte count as KB or MB
+func formatFileSize(sizeBytes int) string {
+	if sizeBytes >= 1024*1024 {
+		return formatDecimal(float64(sizeBytes)/(1024*1024), 2) + " MB"
+	}
+	return formatDecimal(float64(sizeBytes)/1024, 1) + " KB"
+}
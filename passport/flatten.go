@@ -0,0 +1,256 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// Debug image of the fitted illumination field, written with -debug
+	DEBUG_FIELD_IMAGE_PATH = "debug_background_field.jpg"
+
+	// Flattening is skipped when the fitted field's luminance varies by less than
+	// this across the photo (0-1): the background is already even
+	FLATTEN_MIN_FIELD_RANGE = 0.04
+
+	// Pixels closer than this to the fitted field (euclidean RGB, 0-255) count as
+	// background; between half of it and all of it the correction fades out so the
+	// subject's outline gets no seam
+	FLATTEN_BACKGROUND_DISTANCE = 40.0
+)
+
+// illuminationField is a quadratic surface per color channel over the photo,
+// in coordinates normalized to 0-1
+type illuminationField [3][6]float64
+
+// at returns the field color (0-255) at normalized coordinates
+func (f *illuminationField) at(u, v float64) [3]float64 {
+	terms := fieldTerms(u, v)
+	var c [3]float64
+	for ch := range c {
+		for i, term := range terms {
+			c[ch] += f[ch][i] * term
+		}
+	}
+	return c
+}
+
+// fieldTerms are the basis functions of the quadratic surface
+func fieldTerms(u, v float64) [6]float64 {
+	return [6]float64{1, u, v, u * u, u * v, v * v}
+}
+
+// flattenBackground evens out a lighting gradient on the background of the photo.
+// The illumination field is fitted to the border of the photo: a plane first, then
+// a quadratic surface through the border pixels close to that plane, so hair and
+// clothing reaching the edge don't pull it off. Only background connected to the
+// border and close to the field is divided by the field and lifted to its brightest
+// level; the subject inside the outline is left untouched. Returns the photo
+// unchanged when the field is already flat. With debugPath set, the fitted field is
+// written there.
+func flattenBackground(photo image.Image, debugPath string) image.Image {
+	bounds := photo.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 2 || height < 2 {
+		return photo
+	}
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*width+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+	coords := func(i int) (float64, float64) {
+		return float64(i%width) / float64(width-1), float64(i/width) / float64(height-1)
+	}
+
+	// The border region checkBackground samples, and the side strips below it
+	borderX := int(math.Max(1, float64(width)*BACKGROUND_BORDER_RATIO))
+	borderY := int(math.Max(1, float64(height)*BACKGROUND_BORDER_RATIO))
+	var border, sides []int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < borderX || x >= width-borderX || y < borderY {
+				if y < height/2 {
+					border = append(border, y*width+x)
+				}
+				sides = append(sides, y*width+x)
+			}
+		}
+	}
+	plane, ok := fitField(pixels, border, coords, 3)
+	if !ok {
+		return photo
+	}
+	var inliers []int
+	for _, i := range sides {
+		if colorDistance(pixels[i], plane.at(coords(i))) < FLATTEN_BACKGROUND_DISTANCE {
+			inliers = append(inliers, i)
+		}
+	}
+	field, ok := fitField(pixels, inliers, coords, 6)
+	if !ok {
+		return photo
+	}
+
+	// Background: flood fill from the border through pixels close to the field
+	fieldColors := make([][3]float64, len(pixels))
+	background := make([]bool, len(pixels))
+	var queue []int
+	for i := range pixels {
+		fieldColors[i] = field.at(coords(i))
+		x, y := i%width, i/width
+		if (x == 0 || y == 0 || x == width-1) && colorDistance(pixels[i], fieldColors[i]) < FLATTEN_BACKGROUND_DISTANCE {
+			background[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%width, i/width
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= width || n[1] >= height {
+				continue
+			}
+			j := n[1]*width + n[0]
+			if !background[j] && colorDistance(pixels[j], fieldColors[j]) < FLATTEN_BACKGROUND_DISTANCE {
+				background[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	// Target level: the brightest part of the background, so a white wall ends up
+	// as white as its best lit part instead of a uniform gray
+	var target [3]float64
+	count := 0
+	minLum, maxLum := math.Inf(1), math.Inf(-1)
+	for i, isBackground := range background {
+		if !isBackground {
+			continue
+		}
+		c := fieldColors[i]
+		count++
+		lum := (0.299*c[0] + 0.587*c[1] + 0.114*c[2]) / 255
+		if lum > maxLum {
+			target = c
+		}
+		minLum, maxLum = math.Min(minLum, lum), math.Max(maxLum, lum)
+	}
+	if debugPath != "" {
+		if err := saveFieldImage(&field, width, height, debugPath); err != nil {
+			logWarn("⚠️  Could not save background field image: %v", err)
+		}
+	}
+	if count == 0 || maxLum-minLum < FLATTEN_MIN_FIELD_RANGE {
+		logInfo("🧱 Background lighting already even (field range %.3f), not flattened", math.Max(0, maxLum-minLum))
+		return photo
+	}
+
+	flattened := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, pixel := range pixels {
+		c := fieldColors[i]
+		weight := 0.0
+		if background[i] {
+			weight = math.Max(0, math.Min(1, (FLATTEN_BACKGROUND_DISTANCE-colorDistance(pixel, c))/(FLATTEN_BACKGROUND_DISTANCE/2)))
+		}
+		var out [3]uint8
+		for ch := range out {
+			value := pixel[ch]
+			if weight > 0 && c[ch] > 1 {
+				value = pixel[ch]*(1-weight) + pixel[ch]*target[ch]/c[ch]*weight
+			}
+			out[ch] = uint8(math.Max(0, math.Min(255, math.Round(value))))
+		}
+		flattened.Pix[i*4], flattened.Pix[i*4+1], flattened.Pix[i*4+2], flattened.Pix[i*4+3] = out[0], out[1], out[2], 255
+	}
+	logInfo("🧱 Background lighting flattened (field range %.3f, %.0f%% of the photo is background)",
+		maxLum-minLum, float64(count)*100/float64(len(pixels)))
+	return flattened
+}
+
+// fitField fits a surface with the first n basis terms (3: plane, 6: quadratic) to
+// the given pixels by least squares. It reports false when the pixels don't
+// determine the surface, e.g. because there are too few of them.
+func fitField(pixels [][3]float64, indices []int, coords func(int) (float64, float64), n int) (illuminationField, bool) {
+	var field illuminationField
+	if len(indices) < n*10 {
+		return field, false
+	}
+	var normal [6][6]float64
+	var rhs [3][6]float64
+	for _, i := range indices {
+		terms := fieldTerms(coords(i))
+		for a := 0; a < n; a++ {
+			for b := 0; b < n; b++ {
+				normal[a][b] += terms[a] * terms[b]
+			}
+			for ch := 0; ch < 3; ch++ {
+				rhs[ch][a] += terms[a] * pixels[i][ch]
+			}
+		}
+	}
+	for ch := 0; ch < 3; ch++ {
+		solution, ok := solveLinear(normal, rhs[ch], n)
+		if !ok {
+			return field, false
+		}
+		field[ch] = solution
+	}
+	return field, true
+}
+
+// solveLinear solves the first n equations of a x = b by Gaussian elimination with
+// partial pivoting
+func solveLinear(a [6][6]float64, b [6]float64, n int) ([6]float64, bool) {
+	var x [6]float64
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-9 {
+			return x, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, true
+}
+
+// saveFieldImage renders the fitted field as an image
+func saveFieldImage(field *illuminationField, width, height int, path string) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := field.at(float64(x)/float64(width-1), float64(y)/float64(height-1))
+			img.Set(x, y, color.RGBA{
+				uint8(math.Max(0, math.Min(255, c[0]))),
+				uint8(math.Max(0, math.Min(255, c[1]))),
+				uint8(math.Max(0, math.Min(255, c[2]))),
+				255,
+			})
+		}
+	}
+	_, _, err := saveImage(img, path, SaveOptions{Metadata: METADATA_NONE})
+	return err
+}
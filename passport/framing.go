@@ -0,0 +1,109 @@
+package passport
+
+import (
+	"image"
+)
+
+const (
+	// Height of the band at the bottom of the crop that should show the shoulders,
+	// as fraction of the crop height
+	SHOULDER_BAND_RATIO = 0.20
+
+	// Minimum fraction of the band that must differ from the background; a bare
+	// neck covers roughly a quarter of the width, shoulders most of it
+	SHOULDER_MIN_COVERAGE = 0.50
+
+	// Color distance (0-255 RGB) above which a pixel counts as subject. Lower than
+	// HAIR_COLOR_DISTANCE because light clothing is often close to a white background.
+	SHOULDER_COLOR_DISTANCE = 20.0
+
+	// A crop with less than this fraction of its height below the chin is moved down
+	// into the image to show the shoulders, giving up at most half of the headspace
+	SHOULDER_MIN_ROOM_RATIO      = 0.12
+	SHOULDER_MAX_HEADSPACE_TRADE = 0.5
+)
+
+// ShoulderCheck is the result of checking that a crop shows the top of the shoulders
+type ShoulderCheck struct {
+	Band       image.Rectangle `json:"-"`            // Sampled band in source image coordinates
+	Coverage   float64         `json:"coverage"`     // Fraction of the band that differs from the background
+	Checked    bool            `json:"checked"`      // False when the background was too uneven to measure
+	HeadOnly   bool            `json:"head_only"`    // Framing looks like a floating head
+	ChinAtEdge bool            `json:"chin_at_edge"` // The chin is too close to the bottom edge to measure a band
+	SourceEnds bool            `json:"source_ends"`  // The source image ends at the bottom of the crop
+	ShiftedPX  int             `json:"shifted_px"`   // How far makeShoulderRoom moved the crop down, in source pixels
+}
+
+// makeShoulderRoom moves a crop that ends too close below the chin down into the
+// image, so the top of the shoulders is in the photo. It only uses image content
+// below the crop and keeps at least half of the spec's headspace above the crown;
+// the eyes move up by the same amount. Returns the crop and the shift in pixels.
+func makeShoulderRoom(crop image.Rectangle, imgHeight, crown, chin int, spec PhotoSpec) (image.Rectangle, int) {
+	missing := int(float64(crop.Dy())*SHOULDER_MIN_ROOM_RATIO) - (crop.Max.Y - chin)
+	headspace := int(float64(crop.Dy()) * spec.HeadspaceRatio * SHOULDER_MAX_HEADSPACE_TRADE)
+	shift := min(missing, imgHeight-crop.Max.Y, crown-headspace-crop.Min.Y)
+	if shift <= 0 {
+		return crop, 0
+	}
+	return crop.Add(image.Pt(0, shift)), shift
+}
+
+// checkShoulders measures how much non-background content fills the bottom band of
+// the crop below the chin. crop is in image-relative coordinates.
+func checkShoulders(img image.Image, crop image.Rectangle, chin int) ShoulderCheck {
+	bounds := img.Bounds()
+	check := ShoulderCheck{SourceEnds: crop.Max.Y >= bounds.Dy()}
+
+	bandHeight := int(float64(crop.Dy()) * SHOULDER_BAND_RATIO)
+	bandTop := max(crop.Max.Y-bandHeight, chin)
+	check.Band = image.Rect(crop.Min.X, bandTop, crop.Max.X, crop.Max.Y).Intersect(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	if check.Band.Dy() < bandHeight/2 {
+		// The chin sits (almost) at the bottom edge, too little of the torso is visible
+		check.Checked = true
+		check.HeadOnly = true
+		check.ChinAtEdge = true
+		return check
+	}
+
+	background, ok := sampleBackgroundColor(img)
+	if !ok {
+		return check
+	}
+	check.Checked = true
+
+	subject := 0
+	for y := check.Band.Min.Y; y < check.Band.Max.Y; y++ {
+		for x := check.Band.Min.X; x < check.Band.Max.X; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixel := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+			if colorDistance(pixel, background) > SHOULDER_COLOR_DISTANCE {
+				subject++
+			}
+		}
+	}
+	check.Coverage = float64(subject) / float64(check.Band.Dx()*check.Band.Dy())
+	check.HeadOnly = check.Coverage < SHOULDER_MIN_COVERAGE
+	return check
+}
+
+// printShoulderCheck reports the shoulder framing result
+func printShoulderCheck(check ShoulderCheck) {
+	if !check.Checked {
+		logInfo("ℹ️  Shoulder framing not checked (background too uneven)")
+		return
+	}
+	if check.ChinAtEdge {
+		logInfo("👕 Shoulder coverage: none (chin is at the bottom edge of the crop)")
+	} else {
+		logInfo("👕 Shoulder coverage: %.0f%% of the bottom band", check.Coverage*100)
+	}
+	if !check.HeadOnly {
+		logInfo("👕 Shoulders are likely included")
+		return
+	}
+	if check.SourceEnds {
+		logWarn("⚠️  The photo ends below the chin and does not show the shoulders - retake photo from further away")
+	} else {
+		logWarn("⚠️  Framing looks like a head-only crop - the top of the shoulders should be visible")
+	}
+}
@@ -0,0 +1,754 @@
+package passport
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Print sheet keys accepted by WithSheet and -format
+const (
+	SHEET_10X15 = "10x15"
+	SHEET_13X18 = "13x18"
+	SHEET_4X6   = "4x6in" // US print services (Walgreens, CVS), 1800x1200 pixels
+	SHEET_5X7   = "5x7in"
+	SHEET_8X10  = "8x10in"
+	SHEET_STRIP = "strip" // Photo booth strip, see createStripFormat
+)
+
+// Result holds everything produced for one input photo
+type Result struct {
+	Photo      image.Image       // Single passport photo at spec resolution
+	FaceFound  bool              // False when Photo comes from a fallback strategy without face alignment
+	Strategy   string            // Crop strategy that produced Photo, e.g. STRATEGY_FACE
+	Attempts   []StrategyAttempt // Every strategy tried, in order
+	Crop       CropGeometry      // Where Photo was cut from the input image
+	CropScale  float64           // Crop pixels per photo pixel, below 1 Photo is enlarged; 0 with WithGridOnly
+	Sheets     []Sheet           // One print sheet per requested format
+	Background BackgroundCheck   // Background compliance of Photo
+	SafeArea   SafeAreaCheck     // Head clearance from the cut edges; only with WithSafeMargin
+	Resolution ResolutionCheck   // Crop against the input's declared DPI; only filled by the command line tool
+}
+
+// Sheet is a rendered print layout
+type Sheet struct {
+	Format PrintFormat
+	Image  image.Image
+	Path   string // Where the command line tool saved the sheet; empty for Generate
+}
+
+// Option configures Generate. Options validate their arguments and return an
+// error for out-of-range values instead of clamping them.
+type Option func(*generateOptions) error
+
+// generateOptions collects options; sheets are resolved once the spec is known
+// because the layout depends on the photo size
+type generateOptions struct {
+	config Config
+	sheets []string
+	bleed  float64 // Bleed of every sheet in millimeters per side
+}
+
+// WithSpec selects a registered photo standard, e.g. "austria" or "us-visa"
+func WithSpec(key string) Option {
+	return func(o *generateOptions) error {
+		spec, err := lookupPhotoSpec(key)
+		if err != nil {
+			return err
+		}
+		o.config.Spec = spec
+		return nil
+	}
+}
+
+// WithCustomSpec uses a photo standard that isn't registered, e.g. to tune the
+// head height, eye position, or headspace ratios
+func WithCustomSpec(spec PhotoSpec) Option {
+	return func(o *generateOptions) error {
+		if err := validatePhotoSpec(spec); err != nil {
+			return err
+		}
+		if spec.DPI == 0 {
+			spec.DPI = DPI
+		}
+		o.config.Spec = spec
+		return nil
+	}
+}
+
+// WithEyeLine overrides the eye height above the bottom edge (fraction of the
+// photo height) of the spec selected so far; give it after WithSpec
+func WithEyeLine(eyeLine float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateEyeLine(eyeLine); err != nil {
+			return err
+		}
+		o.config.Spec = o.config.Spec.WithEyeLine(eyeLine)
+		return nil
+	}
+}
+
+// WithHeadMargin places the crown this fraction of the photo height below the top
+// edge instead of aligning the eye line of the spec selected so far; give it after
+// WithSpec. A later WithEyeLine switches back to the eye line.
+func WithHeadMargin(margin float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateHeadMargin(margin, o.config.Spec); err != nil {
+			return err
+		}
+		o.config.Spec = o.config.Spec.WithHeadMargin(margin)
+		return nil
+	}
+}
+
+// WithDPI renders the photo and sheets of the spec selected so far at another print
+// resolution, e.g. 600 for high-resolution printers; give it after WithSpec
+func WithDPI(dpi int) Option {
+	return func(o *generateOptions) error {
+		if err := validateDPI(dpi); err != nil {
+			return err
+		}
+		o.config.Spec = o.config.Spec.WithDPI(dpi)
+		return nil
+	}
+}
+
+// WithPhotoSize changes the physical photo size of the spec selected so far, e.g.
+// 40x50mm; give it after WithSpec
+func WithPhotoSize(widthMM, heightMM float64) Option {
+	return func(o *generateOptions) error {
+		if err := validatePhotoSize(widthMM, heightMM); err != nil {
+			return err
+		}
+		o.config.Spec = o.config.Spec.WithSize(widthMM, heightMM)
+		return nil
+	}
+}
+
+// WithSheet adds a print sheet (SHEET_10X15, SHEET_13X18, SHEET_4X6, ...). May be given more than once.
+func WithSheet(key string) Option {
+	return func(o *generateOptions) error {
+		if _, err := lookupPrintFormat(key, o.config.Spec); err != nil {
+			return err
+		}
+		o.sheets = append(o.sheets, key)
+		return nil
+	}
+}
+
+// WithBleed adds a white margin of mm (0-MAX_BLEED_MM) on every side of every sheet
+// for borderless printing; the photos stay placed on the nominal format
+func WithBleed(mm float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateBleed(mm); err != nil {
+			return err
+		}
+		o.bleed = mm
+		return nil
+	}
+}
+
+// WithSharpening enables the unsharp mask with the given strength and the default radius
+func WithSharpening(amount float64) Option {
+	return WithSharpeningRadius(amount, DEFAULT_SHARPEN_RADIUS)
+}
+
+// WithSharpeningRadius enables the unsharp mask with the given strength and blur radius
+func WithSharpeningRadius(amount, radius float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateSharpenOptions(amount, radius); err != nil {
+			return err
+		}
+		o.config.Sharpen = SharpenOptions{Enabled: true, Amount: amount, Radius: radius}
+		return nil
+	}
+}
+
+// WithDetection tunes the face detector
+func WithDetection(minConfidence, clusterIoU float64) Option {
+	return func(o *generateOptions) error {
+		opts := DetectionOptions{MinConfidence: minConfidence, ClusterIoU: clusterIoU}
+		if err := validateDetectionOptions(opts); err != nil {
+			return err
+		}
+		o.config.Detection = opts
+		return nil
+	}
+}
+
+// WithFaceSizeRange sets the smallest and largest face searched for, as fractions
+// of the image's shorter side; give it after WithDetection
+func WithFaceSizeRange(minRatio, maxRatio float64) Option {
+	return func(o *generateOptions) error {
+		opts := o.config.Detection
+		opts.MinFaceRatio, opts.MaxFaceRatio = minRatio, maxRatio
+		if err := validateDetectionOptions(opts); err != nil {
+			return err
+		}
+		o.config.Detection = opts
+		return nil
+	}
+}
+
+// WithFaceDetector reuses a detector from NewFaceDetector instead of loading the
+// face cascade on every call, e.g. when a server generates photos for many requests.
+// Detection settings still come from WithDetection and WithFaceSizeRange.
+func WithFaceDetector(detector *FaceDetector) Option {
+	return func(o *generateOptions) error {
+		if detector == nil {
+			return fmt.Errorf("face detector is nil")
+		}
+		o.config.Detector = detector
+		return nil
+	}
+}
+
+// WithPhotoCount places only count photos on each sheet, centered (0 fills the sheet)
+func WithPhotoCount(count int) Option {
+	return func(o *generateOptions) error {
+		if count < 0 {
+			return fmt.Errorf("invalid photo count %d", count)
+		}
+		o.config.PhotoCount = count
+		return nil
+	}
+}
+
+// WithFlattenBackground evens out a lighting gradient on the photo's background
+func WithFlattenBackground() Option {
+	return func(o *generateOptions) error {
+		o.config.Flatten = true
+		return nil
+	}
+}
+
+// WithAutoLevels brings the median luminance of the face toward AUTO_LEVELS_TARGET with
+// a capped gain and gamma applied to the whole photo
+func WithAutoLevels() Option {
+	return func(o *generateOptions) error {
+		o.config.AutoLevels = true
+		return nil
+	}
+}
+
+// WithWhiteBalance corrects the color of the light toward daylight: for a light of
+// kelvin (e.g. 3200 for tungsten) or, with 0, for the gray world estimate of the photo
+func WithWhiteBalance(kelvin int) Option {
+	return func(o *generateOptions) error {
+		if err := validateWhiteBalanceKelvin(kelvin); err != nil {
+			return err
+		}
+		o.config.WhiteBalance = true
+		o.config.LightKelvin = kelvin
+		return nil
+	}
+}
+
+// WithNeutralizeBackground shifts a color cast of the photo's background toward neutral gray
+func WithNeutralizeBackground() Option {
+	return func(o *generateOptions) error {
+		o.config.Neutralize = true
+		return nil
+	}
+}
+
+// WithMirror flips the finished passport photo horizontally before the layout
+func WithMirror() Option {
+	return func(o *generateOptions) error {
+		o.config.Mirror = true
+		return nil
+	}
+}
+
+// WithOvalMask fades the passport photo into white outside an oval around the head
+func WithOvalMask() Option {
+	return func(o *generateOptions) error {
+		o.config.Oval = true
+		return nil
+	}
+}
+
+// WithLabel draws a proof label or watermark on every sheet
+func WithLabel(text, position string) Option {
+	return func(o *generateOptions) error {
+		if err := validateLabelPosition(position); err != nil {
+			return err
+		}
+		o.config.LabelText = text
+		o.config.LabelPosition = position
+		return nil
+	}
+}
+
+// WithDebug writes DEBUG_IMAGE_PATH showing the detection and crop boxes
+func WithDebug() Option {
+	return func(o *generateOptions) error {
+		o.config.Debug = true
+		return nil
+	}
+}
+
+// WithStrategy forces one crop strategy ("face", "saliency", "center") instead of
+// the fallback chain. "manual" fails unless a prompter is given with WithPrompter.
+func WithStrategy(name string) Option {
+	return func(o *generateOptions) error {
+		if err := validateStrategy(name); err != nil {
+			return err
+		}
+		o.config.Strategy = name
+		return nil
+	}
+}
+
+// WithPrompter lets the manual crop ask for the crop position, e.g. with a
+// ScriptedPrompter; without it Generate never prompts
+func WithPrompter(prompter Prompter) Option {
+	return func(o *generateOptions) error {
+		o.config.Prompt = prompter
+		return nil
+	}
+}
+
+// WithCalibration corrects face detection by an offset measured with the calibrate
+// subcommand (see loadCalibration); without it no correction is applied
+func WithCalibration(calibration Calibration) Option {
+	return func(o *generateOptions) error {
+		o.config.Calibration = calibration
+		return nil
+	}
+}
+
+// WithPadding keeps the face centered when the crop reaches past the image edge and
+// fills the missing area (PAD_WHITE, PAD_REPLICATE, PAD_MIRROR) instead of moving the
+// crop back inside the image (PAD_SNAP, the default)
+func WithPadding(mode string) Option {
+	return func(o *generateOptions) error {
+		if err := validatePadMode(mode); err != nil {
+			return err
+		}
+		o.config.Pad = mode
+		return nil
+	}
+}
+
+// WithCenterWeight sets how the center-weighted fallback crop is placed:
+// CENTER_WEIGHT_SALIENCY (default) or CENTER_WEIGHT_FIXED
+func WithCenterWeight(mode string) Option {
+	return func(o *generateOptions) error {
+		if err := validateCenterWeight(mode); err != nil {
+			return err
+		}
+		o.config.CenterWeight = mode
+		return nil
+	}
+}
+
+// WithSizeMode sets how the head is sized: SIZE_MODE_IPD (default) from the
+// interpupillary distance when the pupils are located, or SIZE_MODE_FACEBOX
+func WithSizeMode(mode string) Option {
+	return func(o *generateOptions) error {
+		if err := validateSizeMode(mode); err != nil {
+			return err
+		}
+		o.config.SizeMode = mode
+		return nil
+	}
+}
+
+// WithEyeOcclusionThreshold sets the covered fraction (0-1) of an eye and eyebrow
+// band above which hair or an object over the eyes is reported; default
+// DEFAULT_MAX_EYE_OCCLUSION
+func WithEyeOcclusionThreshold(threshold float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateEyeOcclusion(threshold); err != nil {
+			return err
+		}
+		o.config.EyeOcclusion = threshold
+		return nil
+	}
+}
+
+// WithMaxMegapixels downscales larger inputs to this many million pixels before
+// anything else runs; Result.Crop still refers to the pixels of the input. 0 (the
+// default) keeps the full resolution.
+func WithMaxMegapixels(megapixels float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateMaxMegapixels(megapixels); err != nil {
+			return err
+		}
+		o.config.MaxMegapixels = megapixels
+		return nil
+	}
+}
+
+// WithMinCropScale sets the crop pixels per photo pixel (0-1) below which Generate
+// refuses to enlarge the crop, e.g. for a small face in a group photo
+func WithMinCropScale(scale float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateMinCropScale(scale); err != nil {
+			return err
+		}
+		o.config.MinCropScale = scale
+		return nil
+	}
+}
+
+// WithSafeMargin checks that the head stays this many millimeters clear of the
+// photo's cut edges and warns otherwise; give it after WithSpec and WithPhotoSize
+func WithSafeMargin(marginMM float64) Option {
+	return func(o *generateOptions) error {
+		if err := validateSafeMargin(marginMM, o.config.Spec); err != nil {
+			return err
+		}
+		o.config.SafeMargin = marginMM
+		return nil
+	}
+}
+
+// WithGridOnly treats the input as a finished passport photo and only tiles it onto
+// the sheets, without face detection or cropping. With force, an input whose aspect
+// ratio doesn't match the spec is center-cropped instead of rejected.
+func WithGridOnly(force bool) Option {
+	return func(o *generateOptions) error {
+		o.config.GridOnly = true
+		o.config.Force = force
+		return nil
+	}
+}
+
+// WithAlphaBackground sets the color transparent inputs are composited onto (white by default)
+func WithAlphaBackground(background color.Color) Option {
+	return func(o *generateOptions) error {
+		o.config.AlphaColor = color.RGBAModel.Convert(background).(color.RGBA)
+		return nil
+	}
+}
+
+// WithContext stops Generate at the next pipeline stage once ctx is done, e.g. when
+// the request it serves timed out; Generate then returns an error wrapping ctx.Err()
+func WithContext(ctx context.Context) Option {
+	return func(o *generateOptions) error {
+		if ctx == nil {
+			return fmt.Errorf("context is nil")
+		}
+		o.config.Context = ctx
+		return nil
+	}
+}
+
+// defaultConfig returns the settings the CLI uses when no flags are given
+func defaultConfig() Config {
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	return Config{
+		Spec: spec,
+		Detection: DetectionOptions{
+			MinConfidence: DEFAULT_MIN_CONFIDENCE,
+			ClusterIoU:    DEFAULT_CLUSTER_IOU,
+			MinFaceRatio:  DEFAULT_MIN_FACE_RATIO,
+			MaxFaceRatio:  DEFAULT_MAX_FACE_RATIO,
+		},
+		LabelPosition: "bottom-right",
+		Save: SaveOptions{
+			Metadata:     METADATA_DPI,
+			Quality:      DEFAULT_JPEG_QUALITY,
+			MaxDimension: DEFAULT_MAX_OUTPUT_DIMENSION,
+		},
+		// Like -strip-metadata photo: the single photo is the file that gets uploaded
+		PhotoSave: SaveOptions{
+			Metadata:     METADATA_DPI,
+			Quality:      DEFAULT_JPEG_QUALITY,
+			MaxDimension: DEFAULT_MAX_OUTPUT_DIMENSION,
+			Strip:        true,
+		},
+		Sharpen: SharpenOptions{
+			Amount: DEFAULT_SHARPEN_AMOUNT,
+			Radius: DEFAULT_SHARPEN_RADIUS,
+		},
+		ColorProfile: COLOR_PROFILE_SRGB,
+		Strategy:     STRATEGY_AUTO,
+		Pad:          PAD_SNAP,
+		CenterWeight: CENTER_WEIGHT_SALIENCY,
+		SizeMode:     SIZE_MODE_IPD,
+		EyeOcclusion: DEFAULT_MAX_EYE_OCCLUSION,
+		MinCropScale: DEFAULT_MIN_CROP_SCALE,
+		AlphaColor:   namedColors[DEFAULT_ALPHA_BACKGROUND],
+	}
+}
+
+// Generate creates the passport photo and print sheets for an already decoded
+// image without any prompts or file output. Without options it produces the same
+// result as the CLI defaults (Austrian spec on a 10x15cm sheet).
+func Generate(img image.Image, opts ...Option) (*Result, error) {
+	o := generateOptions{config: defaultConfig()}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.sheets) == 0 {
+		o.sheets = []string{SHEET_10X15}
+	}
+	for _, key := range o.sheets {
+		format, err := lookupPrintFormat(key, o.config.Spec)
+		if err != nil {
+			return nil, err
+		}
+		o.config.PrintFormats = append(o.config.PrintFormats, format.withBleed(o.bleed))
+	}
+
+	if err := stopped(o.config); err != nil {
+		return nil, err
+	}
+	capped := capMegapixels(img, o.config.MaxMegapixels)
+	result, err := processPhoto(capped, o.config)
+	if err != nil {
+		return nil, err
+	}
+	result.Crop = scaleCropGeometry(result.Crop, capped.Bounds().Size(), img.Bounds().Size())
+	return result, nil
+}
+
+// processPhoto runs the pipeline shared by the CLI and Generate: alpha flattening, face alignment,
+// optional sharpening, the background check, and the print layouts
+func processPhoto(img image.Image, config Config) (*Result, error) {
+	// Black-and-white scans and paletted files are read as RGBA from here on;
+	// cut-outs with transparency are placed on an opaque background before anything else
+	img, config.Grayscale = normalizeInput(img)
+	img = flattenAlpha(img, config.AlphaColor)
+	if err := stopped(config); err != nil {
+		return nil, err
+	}
+
+	// Too few pixels for the photo can only give a blown-up smear
+	if err := checkSourceResolution(img, config.Spec, !config.GridOnly); err != nil {
+		return nil, err
+	}
+
+	// Create passport photo with automatic face detection and alignment, or the
+	// first fallback strategy that works (done once and reused for every print format).
+	// -grid-only skips this and only tiles the input.
+	// Huge inputs are analyzed on a smaller working copy; the crop found there is
+	// cut from the full image once at the end.
+	var passportCrop *PassportCrop
+	var err error
+	working, scale := img, 1.0
+	if config.GridOnly {
+		passportCrop, err = useFinishedPhoto(img, config.Spec, config.Force)
+	} else {
+		if working, scale = workingCopy(img); scale < 1 {
+			logInfo("🔎 Analyzing a %dx%d working copy of the %dx%d image", working.Bounds().Dx(), working.Bounds().Dy(), img.Bounds().Dx(), img.Bounds().Dy())
+		}
+		passportCrop, err = createPassportPhoto(working, config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating passport photo: %w", err)
+	}
+	if err := stopped(config); err != nil {
+		return nil, err
+	}
+
+	// Optional side-by-side comparison with crops at other eye lines
+	if len(config.CompareEyes) > 0 && !config.GridOnly {
+		if passportCrop, err = compareCrops(working, passportCrop, config); err != nil {
+			return nil, err
+		}
+	}
+	if scale < 1 {
+		passportCrop.Crop = scaleCropGeometry(passportCrop.Crop, working.Bounds().Size(), img.Bounds().Size())
+		if passportCrop.Photo, err = renderCrop(img, passportCrop.Crop, config.Spec, config.Pad); err != nil {
+			return nil, fmt.Errorf("error creating passport photo: %w", err)
+		}
+	}
+	photo := passportCrop.Photo
+	if err := stopped(config); err != nil {
+		return nil, err
+	}
+
+	// A crop with fewer pixels than the photo is enlarged; too few give a blurry mess
+	cropScale := 0.0
+	if !config.GridOnly {
+		cropScale, err = checkCropScale(passportCrop.Crop.Rect, config.Spec, passportCrop.Strategy == STRATEGY_FACE, config.MinCropScale)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Optional white balance, before the exposure is measured; a black-and-white photo has no tint
+	if config.WhiteBalance && !config.Grayscale {
+		photo = whiteBalance(photo, config.LightKelvin)
+	}
+
+	// Optional exposure correction measured on the face, before the background steps
+	if config.AutoLevels {
+		photo, _ = autoLevels(photo, faceMask(passportCrop.Crop, config.Spec, photo.Bounds().Size()))
+	}
+
+	// Optional even background lighting, before sharpening amplifies any noise
+	if config.Flatten {
+		fieldPath := ""
+		if config.Debug {
+			fieldPath = availableOutputPath(debugImagePath(DEBUG_FIELD_IMAGE_PATH, config))
+		}
+		photo = flattenBackground(photo, fieldPath)
+	}
+
+	// Optional neutral background; a black-and-white photo has no cast
+	if config.Neutralize && !config.Grayscale {
+		photo = neutralizeBackgroundCast(photo, faceMask(passportCrop.Crop, config.Spec, photo.Bounds().Size()))
+	}
+
+	// Optional unsharp mask to restore detail lost in the downscale
+	if config.Sharpen.Enabled {
+		photo = unsharpMask(photo, config.Sharpen.Amount, config.Sharpen.Radius)
+	}
+
+	// A black-and-white input gives a black-and-white photo, without any tint
+	if config.Grayscale {
+		photo = desaturate(photo)
+	}
+
+	// Mirroring comes after detection and all checks of the crop, so the debug
+	// overlay and reports still match the source
+	if config.Mirror {
+		photo = flipImageHorizontal(photo)
+		logInfo("🪞 Photo mirrored horizontally")
+	}
+
+	if err := stopped(config); err != nil {
+		return nil, err
+	}
+
+	// Check background requirements of the selected spec
+	result := &Result{
+		Photo:      photo,
+		FaceFound:  passportCrop.Strategy == STRATEGY_FACE,
+		Strategy:   passportCrop.Strategy,
+		Attempts:   passportCrop.Attempts,
+		Crop:       passportCrop.Crop,
+		CropScale:  cropScale,
+		Background: checkBackground(photo, config.Spec),
+	}
+	printBackgroundCheck(result.Background)
+
+	// Optional clearance of the head from the cut edges
+	if config.SafeMargin > 0 {
+		result.SafeArea = checkSafeArea(photo, faceMask(passportCrop.Crop, config.Spec, photo.Bounds().Size()), config.Spec, config.SafeMargin)
+		printSafeAreaCheck(result.SafeArea)
+	}
+
+	// Optional oval vignette, after the background and safe area were checked on
+	// the whole photo; the face box follows the mirroring
+	if config.Oval {
+		size := photo.Bounds().Size()
+		face := faceMask(passportCrop.Crop, config.Spec, size)
+		if config.Mirror {
+			face = image.Rect(size.X-face.Max.X, face.Min.Y, size.X-face.Min.X, face.Max.Y)
+		}
+		photo = applyOvalMask(photo, face, config.Spec)
+		result.Photo = photo
+	}
+
+	for _, format := range config.PrintFormats {
+		if err := stopped(config); err != nil {
+			return nil, err
+		}
+		format = withPhotoCount(format, config.PhotoCount)
+		sheet := createPrintLayout(photo, format)
+
+		// Optional proof label / watermark
+		if config.LabelText != "" {
+			sheet, err = drawLabel(sheet, config.LabelText, config.LabelPosition, format.DPI)
+			if err != nil {
+				return nil, fmt.Errorf("error drawing label: %v", err)
+			}
+		}
+
+		// The bleed goes around the finished layout, so nothing is placed in it
+		sheet = addBleed(sheet, format)
+		result.Sheets = append(result.Sheets, Sheet{Format: format, Image: sheet})
+	}
+
+	return result, nil
+}
+
+// stopped returns an error wrapping the error of config.Context once it is done, so
+// the pipeline can give up between stages
+func stopped(config Config) error {
+	if config.Context == nil {
+		return nil
+	}
+	if err := config.Context.Err(); err != nil {
+		return fmt.Errorf("processing stopped: %w", err)
+	}
+	return nil
+}
+
+// lookupPrintFormat resolves a sheet key for the given spec: a format key such as
+// "10x15cm" or "4x6in" (the unit may be left out), its number in the interactive
+// list ("1", "2", ...), or "strip"
+func lookupPrintFormat(key string, spec PhotoSpec) (PrintFormat, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == SHEET_STRIP {
+		return createStripFormat(spec), nil
+	}
+
+	predefinedFormats := getPredefinedFormats(spec)
+	var keys []string
+	for i, format := range predefinedFormats {
+		if key == strconv.Itoa(i+1) || key == format.Key || key+"cm" == format.Key || key+"in" == format.Key {
+			return format, nil
+		}
+		keys = append(keys, format.Key)
+	}
+	keys = append(keys, SHEET_STRIP)
+	return PrintFormat{}, fmt.Errorf("invalid print format '%s' (available: %s)", key, strings.Join(keys, ", "))
+}
+
+// validatePhotoSpec checks that a custom spec describes a usable photo
+func validatePhotoSpec(spec PhotoSpec) error {
+	if spec.WidthPX <= 0 || spec.HeightPX <= 0 || spec.WidthMM <= 0 || spec.HeightMM <= 0 {
+		return fmt.Errorf("invalid photo size %gx%gmm (%dx%dpx)", spec.WidthMM, spec.HeightMM, spec.WidthPX, spec.HeightPX)
+	}
+	for _, ratio := range []struct {
+		name  string
+		value float64
+	}{
+		{"head height ratio", spec.HeadHeightRatio},
+		{"eye position ratio", spec.EyePositionFromTopRatio},
+		{"headspace ratio", spec.HeadspaceRatio},
+	} {
+		if ratio.value <= 0 || ratio.value >= 1 {
+			return fmt.Errorf("invalid %s %g (must be between 0 and 1)", ratio.name, ratio.value)
+		}
+	}
+	if spec.HeadHeightMinMM < 0 || spec.HeadHeightMaxMM < spec.HeadHeightMinMM || spec.HeadHeightMaxMM > spec.HeightMM {
+		return fmt.Errorf("invalid head height band %g-%gmm", spec.HeadHeightMinMM, spec.HeadHeightMaxMM)
+	}
+	return nil
+}
+
+// validateSharpenOptions checks the unsharp mask strength and radius
+func validateSharpenOptions(amount, radius float64) error {
+	if amount < 0 || amount > 2 {
+		return fmt.Errorf("invalid sharpen amount %g (must be between 0 and 2)", amount)
+	}
+	if radius < 0.3 || radius > 5 {
+		return fmt.Errorf("invalid sharpen radius %g (must be between 0.3 and 5)", radius)
+	}
+	return nil
+}
+
+// validateDetectionOptions checks the face detector settings
+func validateDetectionOptions(opts DetectionOptions) error {
+	if opts.ClusterIoU <= 0 || opts.ClusterIoU > 1 {
+		return fmt.Errorf("invalid cluster IoU %g (must be between 0 exclusive and 1)", opts.ClusterIoU)
+	}
+	if minRatio, maxRatio := opts.faceSizeRange(); minRatio <= 0 || maxRatio > 1 || minRatio >= maxRatio {
+		return fmt.Errorf("invalid face size range %g-%g (fractions of the shorter side, 0 < min < max <= 1)", minRatio, maxRatio)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package passport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"math"
+	"os"
+	"testing"
+)
+
+// The command line tool and Generate run the same pipeline, so with default options
+// the files the tool writes must match Generate's images encoded with the default
+// save options byte for byte
+func TestGenerateMatchesCLI(t *testing.T) {
+	requireCascade(t)
+	dir := t.TempDir()
+	_, stderr, code := runCLI(t, nil, "-metadata", METADATA_NONE, "-save-photo", "-outdir", dir, sampleImagePath, SHEET_10X15)
+	if code != 0 {
+		t.Fatalf("command line tool exited with %d:\n%s", code, stderr)
+	}
+
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Generate(source.Image, WithSheet(SHEET_10X15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := defaultConfig()
+	config.Save.Metadata = METADATA_NONE
+	config.PhotoSave.Metadata = METADATA_NONE
+
+	outputs := []struct {
+		name string
+		path string
+		want []byte
+	}{
+		{"sheet", buildOutputPath(sampleImagePath, dir, "", DEFAULT_SPEC_KEY, result.Sheets[0].Format), mustEncode(t, result.Sheets[0].Image, config.Save)},
+		{"photo", buildPhotoOutputPath(sampleImagePath, dir), mustEncode(t, result.Photo, config.PhotoSave)},
+	}
+	for _, output := range outputs {
+		got, err := os.ReadFile(output.path)
+		if err != nil {
+			t.Fatalf("%s: %v", output.name, err)
+		}
+		if !bytes.Equal(got, output.want) {
+			t.Errorf("%s written by the command line tool (%d bytes) differs from Generate's (%d bytes)", output.name, len(got), len(output.want))
+		}
+	}
+}
+
+// The defaults of Generate are the command line tool's defaults
+func TestDefaultConfigMatchesFlagDefaults(t *testing.T) {
+	config := defaultConfig()
+	if !config.PhotoSave.Strip || config.Save.Strip {
+		t.Errorf("Strip of the photo/sheet = %v/%v, want true/false like -strip-metadata %s", config.PhotoSave.Strip, config.Save.Strip, STRIP_METADATA_PHOTO)
+	}
+	if config.Save.Quality != *jpegQualityFlag || config.PhotoSave.Quality != *photoQualityFlag {
+		t.Errorf("JPEG quality %d/%d, want the flag defaults %d/%d", config.Save.Quality, config.PhotoSave.Quality, *jpegQualityFlag, *photoQualityFlag)
+	}
+	if config.Save.Metadata != *metadataFlag || config.Save.MaxDimension != *maxOutputFlag {
+		t.Errorf("metadata %q, max dimension %d, want %q, %d", config.Save.Metadata, config.Save.MaxDimension, *metadataFlag, *maxOutputFlag)
+	}
+	if config.Spec.Key != *specFlag || config.Strategy != *strategyFlag || config.Pad != *padFlag ||
+		config.CenterWeight != *centerWeightFlag || config.SizeMode != *sizeModeFlag || config.ColorProfile != *colorProfileFlag {
+		t.Errorf("spec %q, strategy %q, pad %q, center weight %q, size mode %q, color profile %q differ from the flag defaults",
+			config.Spec.Key, config.Strategy, config.Pad, config.CenterWeight, config.SizeMode, config.ColorProfile)
+	}
+	if config.Detection.MinConfidence != *minConfidenceFlag || config.Detection.ClusterIoU != *clusterIoUFlag ||
+		config.Detection.MinFaceRatio != *minFaceFlag || config.Detection.MaxFaceRatio != *maxFaceFlag {
+		t.Errorf("detection options %+v differ from the flag defaults", config.Detection)
+	}
+}
+
+// countdownContext is done from the n-th time its Err is asked on, so a test can
+// stop the pipeline at any stage without depending on timing
+type countdownContext struct {
+	context.Context
+	n, calls int
+}
+
+func (c *countdownContext) Err() error {
+	c.calls++
+	if c.calls >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+// Generate gives up at whichever stage it finds its context done, and a context
+// that never ends changes nothing
+func TestGenerateStopsWhenContextIsDone(t *testing.T) {
+	img := syntheticPhoto(600, 800)
+	opts := []Option{WithStrategy(STRATEGY_CENTER), WithSheet(SHEET_10X15), WithSheet(SHEET_13X18)}
+	if _, err := Generate(img, WithContext(nil)); err == nil {
+		t.Error("nil context accepted")
+	}
+
+	live := &countdownContext{Context: context.Background(), n: math.MaxInt}
+	if _, err := Generate(img, append(opts, WithContext(live))...); err != nil {
+		t.Fatal(err)
+	}
+	if live.calls < 5 {
+		t.Fatalf("context checked %d times", live.calls)
+	}
+	for n := 1; n <= live.calls; n++ {
+		result, err := Generate(img, append(opts, WithContext(&countdownContext{Context: context.Background(), n: n}))...)
+		if !errors.Is(err, context.Canceled) || result != nil {
+			t.Errorf("done at check %d of %d: result %v, error %v", n, live.calls, result != nil, err)
+		}
+	}
+}
+
+// mustEncode encodes img like saveImage does
+func mustEncode(t *testing.T, img image.Image, opts SaveOptions) []byte {
+	t.Helper()
+	data, _, err := encodeWithinBudget(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// isGIF reports whether data starts with a GIF signature
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// decodeGIF decodes a GIF, e.g. a photo saved from a messaging app. A single frame
+// smaller than the logical screen is placed on a canvas of the full size. Animated
+// GIFs are composited frame by frame and the sharpest frame is used. GIF has no
+// EXIF, so there is no orientation to apply.
+func decodeGIF(data []byte) (image.Image, error) {
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	screen := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+
+	if len(animation.Image) == 1 {
+		frame := animation.Image[0]
+		if screen.Empty() || frame.Bounds() == screen {
+			return frame, nil
+		}
+		canvas := image.NewRGBA(screen)
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+		return canvas, nil
+	}
+
+	frames := compositeGIFFrames(animation, screen)
+	index, score := sharpestFrame(frames)
+	logInfo("🎞️  Animated GIF with %d frames, using frame %d (sharpest, Laplacian variance %.0f)", len(frames), index+1, score)
+	return frames[index], nil
+}
+
+// compositeGIFFrames renders every frame of an animation as it is shown: partial
+// frames are drawn over the canvas left by the previous one, which is then disposed
+// of as the frame asks (kept, cleared to transparent, or restored), so no parts of
+// earlier frames ghost into later ones
+func compositeGIFFrames(animation *gif.GIF, screen image.Rectangle) []*image.RGBA {
+	if screen.Empty() {
+		screen = animation.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(screen)
+	frames := make([]*image.RGBA, 0, len(animation.Image))
+	for i, frame := range animation.Image {
+		var disposal byte
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		// Transparent pixels of a frame leave the canvas below visible
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, cloneRGBA(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// sharpestFrame returns the index and score of the frame with the highest Laplacian
+// variance in the face region. The face is searched for once, in the first frame
+// that has one; without a face (or a face cascade) the whole frame is scored.
+func sharpestFrame(frames []*image.RGBA) (int, float64) {
+	region := frames[0].Bounds()
+	if detector, err := NewFaceDetector(FACE_CASCADE_PATH, defaultConfig().Detection); err == nil {
+		for _, frame := range frames {
+			if face, err := detector.detectBest(frame); err == nil {
+				region = image.Rect(face.X-face.Size/2, face.Y-face.Size/2, face.X+face.Size/2, face.Y+face.Size/2)
+				break
+			}
+		}
+	}
+
+	best, bestScore := 0, -1.0
+	for i, frame := range frames {
+		if score := laplacianVariance(frame, region); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best, bestScore
+}
+
+// cloneRGBA returns a copy of img
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
@@ -0,0 +1,59 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// isGrayscale reports whether img carries no color: a Gray or Gray16 image, e.g. a
+// black-and-white scan, or a paletted image whose palette holds only neutral colors
+func isGrayscale(img image.Image) bool {
+	switch img := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.Paletted:
+		for _, c := range img.Palette {
+			r, g, b, _ := c.RGBA()
+			if r != g || g != b {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// normalizeInput converts single-channel and paletted inputs to RGBA, so every
+// step after it (skin checks, compositing, resizing) reads the same 8-bit color
+// channels whatever the file stored. Other images are returned unchanged. Also
+// reports whether the input was grayscale.
+func normalizeInput(img image.Image) (image.Image, bool) {
+	grayscale := isGrayscale(img)
+	switch img.(type) {
+	case *image.Gray, *image.Gray16, *image.Paletted:
+	default:
+		return img, false
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	if grayscale {
+		logInfo("⚫ Grayscale input: the photo stays black and white, checks that need skin color are skipped")
+	}
+	return rgba, grayscale
+}
+
+// desaturate removes any color from a photo of a grayscale input, so resampling or
+// background flattening can't leave a tint in the black-and-white output
+func desaturate(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			out.SetRGBA(x, y, color.RGBA{gray.Y, gray.Y, gray.Y, 255})
+		}
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+)
+
+// grayPalette holds 256 gray levels, as a black-and-white GIF or PNG would
+func grayPalette() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.Gray{uint8(i)}
+	}
+	return p
+}
+
+// isNeutral reports whether every pixel of img has equal red, green and blue
+func isNeutral(img image.Image) bool {
+	rgba := toRGBA(img)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		if rgba.Pix[i] != rgba.Pix[i+1] || rgba.Pix[i+1] != rgba.Pix[i+2] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNormalizeInput(t *testing.T) {
+	bounds := image.Rect(5, 5, 25, 35)
+	colorful := image.NewPaletted(bounds, palette.Plan9)
+	colorful.SetColorIndex(10, 10, 1)
+	tests := []struct {
+		name          string
+		img           image.Image
+		wantGrayscale bool
+	}{
+		{"gray", image.NewGray(bounds), true},
+		{"gray16", image.NewGray16(bounds), true},
+		{"gray palette", image.NewPaletted(bounds, grayPalette()), true},
+		{"color palette", colorful, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draw.Draw(tt.img.(draw.Image), image.Rect(8, 8, 12, 12), &image.Uniform{color.Gray{90}}, image.Point{}, draw.Src)
+			got, grayscale := normalizeInput(tt.img)
+			if grayscale != tt.wantGrayscale {
+				t.Errorf("grayscale %v, want %v", grayscale, tt.wantGrayscale)
+			}
+			rgba, ok := got.(*image.RGBA)
+			if !ok || rgba.Bounds() != image.Rect(0, 0, bounds.Dx(), bounds.Dy()) {
+				t.Fatalf("normalized to %T with bounds %v, want RGBA from the origin", got, got.Bounds())
+			}
+			for _, p := range []image.Point{{8, 8}, {5, 5}, {10, 10}} {
+				want := color.RGBAModel.Convert(tt.img.At(p.X, p.Y))
+				if got := rgba.At(p.X-bounds.Min.X, p.Y-bounds.Min.Y); got != want {
+					t.Errorf("pixel %v is %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+
+	rgba := image.NewRGBA(bounds)
+	if got, grayscale := normalizeInput(rgba); got != image.Image(rgba) || grayscale {
+		t.Error("RGBA input was converted")
+	}
+}
+
+// A black-and-white scan goes through the whole pipeline, face detection included,
+// and comes out black and white even with white balancing asked for; a paletted color
+// image is processed like any other
+func TestGenerateGrayscaleAndPalettedInputs(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Matching every pixel to the Plan 9 palette is slow, so the sample is made smaller first
+	size := source.Image.Bounds().Size()
+	small := resizeImage(source.Image, 900, 900*size.Y/size.X)
+	bounds := small.Bounds()
+	gray := image.NewGray(bounds)
+	draw.Draw(gray, bounds, small, bounds.Min, draw.Src)
+	grayPaletted := image.NewPaletted(bounds, grayPalette())
+	draw.Draw(grayPaletted, bounds, gray, bounds.Min, draw.Src)
+	colorPaletted := image.NewPaletted(bounds, palette.Plan9)
+	draw.Draw(colorPaletted, bounds, small, bounds.Min, draw.Src)
+
+	tests := []struct {
+		name        string
+		img         image.Image
+		wantNeutral bool
+	}{
+		{"gray", gray, true},
+		{"gray palette", grayPaletted, true},
+		{"color palette", colorPaletted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Generate(tt.img, WithSheet(SHEET_10X15), WithWhiteBalance(4000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.FaceFound {
+				t.Errorf("no face found, strategy %q", result.Strategy)
+			}
+			if isNeutral(result.Photo) != tt.wantNeutral {
+				t.Errorf("photo neutral %v, want %v", isNeutral(result.Photo), tt.wantNeutral)
+			}
+			if tt.wantNeutral && !isNeutral(result.Sheets[0].Image) {
+				t.Error("sheet of a black-and-white input has color")
+			}
+
+			encoded, err := encodeImage(result.Photo, SaveOptions{Metadata: METADATA_NONE})
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := jpeg.Decode(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("output isn't a valid JPEG: %v", err)
+			}
+			if decoded.Bounds().Size() != result.Photo.Bounds().Size() {
+				t.Errorf("decoded %v, photo %v", decoded.Bounds().Size(), result.Photo.Bounds().Size())
+			}
+		})
+	}
+}
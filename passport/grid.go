@@ -0,0 +1,48 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// Reported as crop strategy when -grid-only takes the input as the finished photo
+	STRATEGY_GRID_ONLY = "grid-only"
+
+	// -grid-only refuses inputs whose aspect ratio differs from the spec by more than
+	// this fraction unless -force is given
+	GRID_ONLY_ASPECT_TOLERANCE = 0.05
+)
+
+// useFinishedPhoto takes an input that already is a passport photo (e.g. from a
+// photo studio) without face detection, only trimmed to the spec's exact aspect
+// ratio around the center and resized to its pixel size. An aspect ratio that is
+// far off is an error unless force accepts the larger center cut.
+func useFinishedPhoto(img image.Image, spec PhotoSpec, force bool) (*PassportCrop, error) {
+	bounds := img.Bounds()
+	inputAspect := float64(bounds.Dx()) / float64(bounds.Dy())
+	specAspect := spec.WidthMM / spec.HeightMM
+	deviation := math.Abs(inputAspect/specAspect - 1)
+
+	if deviation > GRID_ONLY_ASPECT_TOLERANCE {
+		if !force {
+			return nil, fmt.Errorf("input is %dx%d pixels (aspect ratio %.3f), but a %gx%gmm photo has %.3f; "+
+				"crop it first or pass -force to cut the center", bounds.Dx(), bounds.Dy(), inputAspect, spec.WidthMM, spec.HeightMM, specAspect)
+		}
+		logWarn("⚠️  Aspect ratio %.3f is %.0f%% off the spec's %.3f, cutting the center", inputAspect, deviation*100, specAspect)
+	}
+
+	// Trim the few pixels off the exact aspect ratio instead of stretching the photo
+	photo, rect, err := createPassportPhotoFallback(img, spec, 0.5, 0.5)
+	if err != nil {
+		return nil, err
+	}
+	logInfo("🧾 Using the input as finished photo: %dx%d of %dx%d pixels resized to %dx%d",
+		rect.Dx(), rect.Dy(), bounds.Dx(), bounds.Dy(), spec.WidthPX, spec.HeightPX)
+	return &PassportCrop{
+		Photo:    photo,
+		Crop:     CropGeometry{Rect: rect.Sub(bounds.Min)},
+		Strategy: STRATEGY_GRID_ONLY,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// Opacity (0-255) of the preview guides, faint enough to judge the face under them
+	PREVIEW_GUIDES_ALPHA = 160
+
+	// Guide labels are this fraction of the slot height, and left out on slots too
+	// small for PREVIEW_GUIDES_MIN_LABEL_PX pixel text
+	PREVIEW_GUIDES_LABEL_RATIO  = 0.045
+	PREVIEW_GUIDES_MIN_LABEL_PX = 7
+)
+
+// Colors of the -preview-guides lines
+var (
+	GuideColorEyes   = color.RGBA{0, 160, 255, 255} // target eye line
+	GuideColorHead   = color.RGBA{255, 0, 200, 255} // crown and the allowed chin band
+	GuideColorCenter = color.RGBA{0, 200, 120, 255} // vertical center line
+)
+
+// previewGuide is one labeled line across (or down) every photo slot, as a
+// fraction of the slot height (or width)
+type previewGuide struct {
+	label    string
+	ratio    float64
+	vertical bool
+	color    color.RGBA
+}
+
+// specGuides returns the reference lines of a spec: the target eye line, the crown
+// at the headspace, the chin at the allowed head heights (or at the target head
+// height without a band), and the vertical center
+func specGuides(spec PhotoSpec) []previewGuide {
+	guides := []previewGuide{
+		{"eyes", spec.EyePositionFromTopRatio, false, GuideColorEyes},
+		{"crown", spec.HeadspaceRatio, false, GuideColorHead},
+	}
+	if spec.HeadHeightMinMM > 0 && spec.HeadHeightMaxMM > 0 {
+		guides = append(guides,
+			previewGuide{"chin min", spec.HeadspaceRatio + spec.HeadHeightMinMM/spec.HeightMM, false, GuideColorHead},
+			previewGuide{"chin max", spec.HeadspaceRatio + spec.HeadHeightMaxMM/spec.HeightMM, false, GuideColorHead})
+	} else {
+		guides = append(guides, previewGuide{"chin", spec.HeadspaceRatio + spec.HeadHeightRatio, false, GuideColorHead})
+	}
+	return append(guides, previewGuide{"center", 0.5, true, GuideColorCenter})
+}
+
+// drawPreviewGuides returns a copy of preview, a resized sheet, with the spec's
+// reference lines drawn over every photo slot. They are drawn at the preview's
+// own scale so they stay one pixel thin; the sheet itself never gets them.
+func drawPreviewGuides(preview image.Image, sheet Sheet, spec PhotoSpec) image.Image {
+	bounds := preview.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), preview, bounds.Min, draw.Src)
+
+	format := sheet.Format
+	sheetSize := sheet.Image.Bounds().Size()
+	scaleX := float64(bounds.Dx()) / float64(sheetSize.X)
+	scaleY := float64(bounds.Dy()) / float64(sheetSize.Y)
+	offset := format.TrimBox().Min
+	at := func(p image.Point) image.Point {
+		return image.Pt(int(math.Round(float64(p.X)*scaleX)), int(math.Round(float64(p.Y)*scaleY)))
+	}
+
+	guides := specGuides(spec)
+	for _, sheetSlot := range gridSlots(calculateGridLayout(format), format) {
+		sheetSlot = sheetSlot.Add(offset)
+		slot := image.Rectangle{Min: at(sheetSlot.Min), Max: at(sheetSlot.Max)}
+		labelHeight := int(float64(slot.Dy()) * PREVIEW_GUIDES_LABEL_RATIO)
+		for _, guide := range guides {
+			fill := &image.Uniform{color.NRGBA{guide.color.R, guide.color.G, guide.color.B, PREVIEW_GUIDES_ALPHA}}
+			var line image.Rectangle
+			var labelAt image.Point
+			if guide.vertical {
+				x := slot.Min.X + int(float64(slot.Dx())*guide.ratio)
+				line = image.Rect(x, slot.Min.Y, x+1, slot.Max.Y)
+				labelAt = image.Pt(x+2, slot.Max.Y-labelHeight*2)
+			} else {
+				y := slot.Min.Y + int(float64(slot.Dy())*guide.ratio)
+				line = image.Rect(slot.Min.X, y, slot.Max.X, y+1)
+				labelAt = image.Pt(slot.Min.X+2, y-labelHeight*3/2)
+			}
+			draw.Draw(canvas, line.Intersect(slot), fill, image.Point{}, draw.Over)
+			if labelHeight >= PREVIEW_GUIDES_MIN_LABEL_PX {
+				drawGuideLabel(canvas, labelAt, guide.label, labelHeight, fill)
+			}
+		}
+	}
+	return canvas
+}
+
+// drawGuideLabel writes a guide's name with its top-left corner at the given point
+func drawGuideLabel(canvas *image.RGBA, at image.Point, text string, height int, fill image.Image) {
+	face, err := newLabelFace(float64(height), 72)
+	if err != nil {
+		return
+	}
+	defer face.Close()
+	mask := renderTextMask(text, face)
+	target := mask.Bounds().Add(at).Intersect(canvas.Bounds())
+	draw.DrawMask(canvas, target, fill, image.Point{}, mask, target.Min.Sub(at), draw.Over)
+}
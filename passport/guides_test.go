@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// rgbaDistance is the sum of the channel differences of two colors
+func rgbaDistance(a, b color.RGBA) int {
+	abs := func(v int) int { return max(v, -v) }
+	return abs(int(a.R)-int(b.R)) + abs(int(a.G)-int(b.G)) + abs(int(a.B)-int(b.B))
+}
+
+// Every guide crosses every photo slot of the preview in its color, and nothing
+// outside the slots or in the preview it was given changes
+func TestDrawPreviewGuides(t *testing.T) {
+	result, err := Generate(syntheticPhoto(600, 800), WithStrategy(STRATEGY_CENTER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := result.Sheets[0]
+	spec := defaultConfig().Spec
+	size := sheet.Image.Bounds().Size()
+	preview := toRGBA(resizeImage(sheet.Image, size.X/3, size.Y/3))
+	original := bytes.Clone(preview.Pix)
+	guided := toRGBA(drawPreviewGuides(preview, sheet, spec))
+	if !bytes.Equal(preview.Pix, original) {
+		t.Fatal("guides were drawn on the preview passed in")
+	}
+
+	scale := func(v, from, to int) int { return int(math.Round(float64(v) * float64(to) / float64(from))) }
+	inSlot := map[image.Point]bool{}
+	for _, sheetSlot := range gridSlots(calculateGridLayout(sheet.Format), sheet.Format) {
+		slot := image.Rect(scale(sheetSlot.Min.X, size.X, preview.Rect.Dx()), scale(sheetSlot.Min.Y, size.Y, preview.Rect.Dy()),
+			scale(sheetSlot.Max.X, size.X, preview.Rect.Dx()), scale(sheetSlot.Max.Y, size.Y, preview.Rect.Dy()))
+		for y := slot.Min.Y; y < slot.Max.Y; y++ {
+			for x := slot.Min.X; x < slot.Max.X; x++ {
+				inSlot[image.Pt(x, y)] = true
+			}
+		}
+		for _, guide := range specGuides(spec) {
+			// A point on the line away from its label
+			p := image.Pt(slot.Min.X+slot.Dx()*3/4, slot.Min.Y+int(float64(slot.Dy())*guide.ratio))
+			if guide.vertical {
+				p = image.Pt(slot.Min.X+int(float64(slot.Dx())*guide.ratio), slot.Min.Y+slot.Dy()/4)
+			}
+			before, after := preview.RGBAAt(p.X, p.Y), guided.RGBAAt(p.X, p.Y)
+			if rgbaDistance(after, guide.color) >= rgbaDistance(before, guide.color) {
+				t.Errorf("%s guide at %v: %v -> %v, not toward %v", guide.label, p, before, after, guide.color)
+			}
+		}
+	}
+	for y := 0; y < preview.Rect.Dy(); y++ {
+		for x := 0; x < preview.Rect.Dx(); x++ {
+			if !inSlot[image.Pt(x, y)] && guided.RGBAAt(x, y) != preview.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d,%d) outside the photos changed", x, y)
+			}
+		}
+	}
+}
+
+// The guides are on the kept preview only: the saved sheet is byte for byte the one
+// written without them
+func TestSavedSheetHasNoGuides(t *testing.T) {
+	requireCascade(t)
+	// No image viewer to launch
+	t.Setenv("PATH", t.TempDir())
+	config := defaultConfig()
+	format, err := lookupPrintFormat(SHEET_10X15, config.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[bool][2][]byte{}
+	for _, guides := range []bool{false, true} {
+		config := config
+		config.InputPath = sampleImagePath
+		config.OutputDir = t.TempDir()
+		config.PrintFormats = []PrintFormat{format}
+		config.Preview, config.PreviewGuides, config.KeepArtifacts = true, guides, true
+		config.PreviewScale = DEFAULT_PREVIEW_SCALE
+		config.Prompt = &ScriptedPrompter{Answers: []string{"y"}}
+		result, err := generateOutputs(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[guides] = [2][]byte{
+			mustReadFile(t, result.Sheets[0].Path),
+			mustReadFile(t, buildPreviewPath(config.InputPath, config.OutputDir, format)),
+		}
+		if filepath.Dir(result.Sheets[0].Path) != config.OutputDir {
+			t.Errorf("sheet saved to %s", result.Sheets[0].Path)
+		}
+	}
+	if !bytes.Equal(outputs[true][0], outputs[false][0]) {
+		t.Error("sheet saved with -preview-guides differs from the one without")
+	}
+	if bytes.Equal(outputs[true][1], outputs[false][1]) {
+		t.Error("preview has no guides")
+	}
+}
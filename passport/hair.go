@@ -0,0 +1,117 @@
+package passport
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// Size of the corner patches sampled for the background color, as fraction of the image size
+	HAIR_BACKGROUND_SAMPLE_RATIO = 0.05
+
+	// A pixel belongs to the subject when its color differs from the background by more than this
+	// (euclidean RGB distance on a 0-255 scale)
+	HAIR_COLOR_DISTANCE = 40.0
+
+	// A row counts as hair when at least this fraction of the scanned width differs from the background
+	HAIR_ROW_COVERAGE = 0.10
+
+	// Stop scanning after this many consecutive background rows (fraction of face size)
+	HAIR_GAP_TOLERANCE_RATIO = 0.03
+
+	// Never extend the head top more than this fraction of the face size above the estimated skull
+	HAIR_MAX_EXTENSION_RATIO = 0.6
+
+	// Skip the estimate when the two background corners differ by more than this distance
+	HAIR_BACKGROUND_MAX_CORNER_DISTANCE = 40.0
+)
+
+// estimateHairTop scans upward from the estimated skull top for pixels that differ from the
+// sampled background color and returns the topmost row still covered by hair. It returns
+// skullTop unchanged when the background can't be sampled reliably or no hair is found.
+func estimateHairTop(img image.Image, face *FaceDetection, skullTop int) int {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Hair can only be told apart from a plain background
+	background, ok := sampleBackgroundColor(img)
+	if !ok {
+		return skullTop
+	}
+
+	// Scan the columns above the face box
+	x0 := int(math.Max(0, float64(face.X-face.Size/2)))
+	x1 := int(math.Min(float64(width), float64(face.X+face.Size/2)))
+	if x1 <= x0 {
+		return skullTop
+	}
+
+	minRow := int(math.Max(0, float64(skullTop)-float64(face.Size)*HAIR_MAX_EXTENSION_RATIO))
+	gapTolerance := int(math.Max(1, float64(face.Size)*HAIR_GAP_TOLERANCE_RATIO))
+
+	hairTop := skullTop
+	gap := 0
+	for y := skullTop - 1; y >= minRow && y < height; y-- {
+		subject := 0
+		for x := x0; x < x1; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixel := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+			if colorDistance(pixel, background) > HAIR_COLOR_DISTANCE {
+				subject++
+			}
+		}
+
+		if float64(subject) >= float64(x1-x0)*HAIR_ROW_COVERAGE {
+			hairTop = y
+			gap = 0
+		} else {
+			gap++
+			if gap > gapTolerance {
+				break
+			}
+		}
+	}
+
+	return hairTop
+}
+
+// sampleBackgroundColor averages both top corners of the image. It reports false when
+// the corners disagree, i.e. the background is not plain enough to compare against.
+func sampleBackgroundColor(img image.Image) ([3]float64, bool) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	sampleW := int(math.Max(1, float64(width)*HAIR_BACKGROUND_SAMPLE_RATIO))
+	sampleH := int(math.Max(1, float64(height)*HAIR_BACKGROUND_SAMPLE_RATIO))
+	left := averageColor(img, image.Rect(0, 0, sampleW, sampleH))
+	right := averageColor(img, image.Rect(width-sampleW, 0, width, sampleH))
+	if colorDistance(left, right) > HAIR_BACKGROUND_MAX_CORNER_DISTANCE {
+		return [3]float64{}, false
+	}
+	return [3]float64{(left[0] + right[0]) / 2, (left[1] + right[1]) / 2, (left[2] + right[2]) / 2}, true
+}
+
+// averageColor returns the mean RGB (0-255) of a rectangle in image-relative coordinates
+func averageColor(img image.Image, r image.Rectangle) [3]float64 {
+	bounds := img.Bounds()
+	var sum [3]float64
+	count := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			sum[0] += float64(cr >> 8)
+			sum[1] += float64(cg >> 8)
+			sum[2] += float64(cb >> 8)
+			count++
+		}
+	}
+	if count == 0 {
+		return sum
+	}
+	return [3]float64{sum[0] / float64(count), sum[1] / float64(count), sum[2] / float64(count)}
+}
+
+// colorDistance is the euclidean distance between two RGB colors
+func colorDistance(a, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
@@ -0,0 +1,99 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Synthetic portrait for the hair tests: a face of faceSize pixels centered at
+// (faceX, faceY) on a plain light background
+const (
+	hairTestWidth    = 600
+	hairTestHeight   = 800
+	hairTestFaceX    = 300
+	hairTestFaceY    = 420
+	hairTestFaceSize = 160
+)
+
+var (
+	hairTestBackground = color.RGBA{230, 230, 235, 255}
+	hairTestSkin       = color.RGBA{224, 172, 140, 255}
+	hairTestHair       = color.RGBA{40, 30, 25, 255}
+)
+
+// hairTestPortrait draws the face oval and, with afro set, a dark disc of hair
+// reaching well above the skull
+func hairTestPortrait(afro bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, hairTestWidth, hairTestHeight))
+	fillEllipse := func(cx, cy, rx, ry float64, c color.RGBA) {
+		for y := 0; y < hairTestHeight; y++ {
+			for x := 0; x < hairTestWidth; x++ {
+				dx, dy := (float64(x)-cx)/rx, (float64(y)-cy)/ry
+				if dx*dx+dy*dy < 1 {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	fillEllipse(hairTestWidth/2, hairTestHeight/2, hairTestWidth, hairTestHeight, hairTestBackground)
+	if afro {
+		fillEllipse(hairTestFaceX, hairTestFaceY-70, 100, 100, hairTestHair)
+	}
+	fillEllipse(hairTestFaceX, hairTestFaceY, hairTestFaceSize*0.45, hairTestFaceSize*0.62, hairTestSkin)
+	return img
+}
+
+func hairTestFace() *FaceDetection {
+	return &FaceDetection{X: hairTestFaceX, Y: hairTestFaceY, Size: hairTestFaceSize, Score: 10}
+}
+
+func TestEstimateHairTop(t *testing.T) {
+	face := hairTestFace()
+	_, _, skullTop, _ := estimateHeadLandmarks(face)
+
+	if got := estimateHairTop(hairTestPortrait(false), face, skullTop); got != skullTop {
+		t.Errorf("without hair: hair top %d, want the skull top %d", got, skullTop)
+	}
+
+	// The disc reaches y = 420-70-100 = 250, within the maximum extension of 96
+	// pixels above the skull at 420-80-24 = 316
+	got := estimateHairTop(hairTestPortrait(true), face, skullTop)
+	if got < 250 || got > 256 {
+		t.Errorf("with hair: hair top %d, want close below the disc's top at 250 (skull top %d)", got, skullTop)
+	}
+
+	// A background that isn't plain can't be told apart from hair
+	busy := hairTestPortrait(true)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 30; x++ {
+			busy.SetRGBA(x, y, color.RGBA{20, 120, 20, 255})
+		}
+	}
+	if got := estimateHairTop(busy, face, skullTop); got != skullTop {
+		t.Errorf("busy background: hair top %d, want the skull top %d", got, skullTop)
+	}
+}
+
+// The expanded head box sizes the crop: with voluminous hair the head measures
+// taller, so the crop grows to keep the hair inside with its headspace
+func TestAlignFaceGrowsCropForHair(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, plain, _, _, err := alignFaceForPassport(hairTestPortrait(false), hairTestFace(), spec, PAD_WHITE, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, withHair, _, _, err := alignFaceForPassport(hairTestPortrait(true), hairTestFace(), spec, PAD_WHITE, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withHair.Dy() <= plain.Dy() {
+		t.Errorf("crop %v with hair, %v without; want a taller crop", withHair, plain)
+	}
+	if withHair.Min.Y >= 250 {
+		t.Errorf("crop %v with hair starts below the hair top at 250", withHair)
+	}
+}
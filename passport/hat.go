@@ -0,0 +1,182 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// The region checked for a head covering spans this fraction of the face size
+	// above the face box, over the central HAT_REGION_WIDTH_RATIO of its width
+	HAT_REGION_HEIGHT_RATIO = 0.35
+	HAT_REGION_WIDTH_RATIO  = 0.8
+
+	// A region at least this uniform (mean per-channel standard deviation, 0-255)
+	// may be a hat; hair has strands and highlights and measures well above
+	HAT_MAX_STDDEV = 14.0
+
+	// ... and its color must differ from the background corners and the hair at the
+	// temples by at least this distance (euclidean RGB, 0-255)
+	HAT_MIN_COLOR_DISTANCE = 45.0
+
+	// A region with more than this fraction of skin pixels is a bald head, not a hat
+	HAT_MAX_SKIN_FRACTION = 0.3
+)
+
+// HeadCoveringCheck is the result of looking for a hat or cap above the face
+type HeadCoveringCheck struct {
+	Region             image.Rectangle `json:"-"`                   // Checked region in image coordinates
+	StdDev             float64         `json:"stddev"`              // Mean per-channel standard deviation of the region (0-255)
+	BackgroundDistance float64         `json:"background_distance"` // Color distance to the closest image corner
+	HairDistance       float64         `json:"hair_distance"`       // Color distance to the hair at the temples; -1 when none was found
+	SkinFraction       float64         `json:"skin_fraction"`       // Fraction of skin pixels in the region
+	Checked            bool            `json:"checked"`             // False when the region lies outside the image
+	Suspected          bool            `json:"suspected"`           // The region looks like a head covering
+}
+
+// checkHeadCovering measures the region directly above the face box. A hat or cap
+// shows up as a large area of very even color that is neither skin (a bald head),
+// nor the background seen in the image corners, nor the hair found beside the
+// forehead. This is a heuristic for a compliance warning only.
+func checkHeadCovering(img image.Image, face *FaceDetection) HeadCoveringCheck {
+	bounds := img.Bounds()
+	full := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	halfWidth := int(float64(face.Size) * HAT_REGION_WIDTH_RATIO / 2)
+	top := face.Y - face.Size/2
+	region := image.Rect(face.X-halfWidth, top-int(float64(face.Size)*HAT_REGION_HEIGHT_RATIO), face.X+halfWidth, top)
+	check := HeadCoveringCheck{Region: region.Intersect(full), HairDistance: -1}
+	// Most of the region has to be inside the image to say anything about it
+	if check.Region.Dx()*check.Region.Dy()*2 < region.Dx()*region.Dy() || check.Region.Dy() < 2 {
+		return check
+	}
+
+	mean, stddev, skin := regionColorStats(img, check.Region)
+	check.Checked = true
+	check.StdDev = stddev
+	check.SkinFraction = skin
+
+	// Background samples from all four corners; the closest one counts
+	sampleW := max(1, int(float64(full.Dx())*HAIR_BACKGROUND_SAMPLE_RATIO))
+	sampleH := max(1, int(float64(full.Dy())*HAIR_BACKGROUND_SAMPLE_RATIO))
+	corners := []image.Rectangle{
+		image.Rect(0, 0, sampleW, sampleH),
+		image.Rect(full.Dx()-sampleW, 0, full.Dx(), sampleH),
+		image.Rect(0, full.Dy()-sampleH, sampleW, full.Dy()),
+		image.Rect(full.Dx()-sampleW, full.Dy()-sampleH, full.Dx(), full.Dy()),
+	}
+	check.BackgroundDistance = math.Inf(1)
+	var background [][3]float64
+	for _, corner := range corners {
+		sample := averageColor(img, corner)
+		background = append(background, sample)
+		check.BackgroundDistance = math.Min(check.BackgroundDistance, colorDistance(mean, sample))
+	}
+
+	// Hair at the temples: pixels beside the upper face box that are neither skin
+	// nor background
+	temples := []image.Rectangle{
+		image.Rect(face.X-face.Size*7/10, top, face.X-face.Size/2, face.Y),
+		image.Rect(face.X+face.Size/2, top, face.X+face.Size*7/10, face.Y),
+	}
+	if hair, ok := averageHairColor(img, temples, background); ok {
+		check.HairDistance = colorDistance(mean, hair)
+	}
+
+	check.Suspected = check.StdDev <= HAT_MAX_STDDEV &&
+		check.SkinFraction <= HAT_MAX_SKIN_FRACTION &&
+		check.BackgroundDistance >= HAT_MIN_COLOR_DISTANCE &&
+		(check.HairDistance < 0 || check.HairDistance >= HAT_MIN_COLOR_DISTANCE)
+	return check
+}
+
+// regionColorStats returns the mean RGB, the mean per-channel standard deviation
+// and the fraction of skin pixels of a rectangle in image-relative coordinates
+func regionColorStats(img image.Image, r image.Rectangle) ([3]float64, float64, float64) {
+	bounds := img.Bounds()
+	var sum, sumSq [3]float64
+	count, skin := 0, 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixel := [3]float64{float64(cr >> 8), float64(cg >> 8), float64(cb >> 8)}
+			for c := range pixel {
+				sum[c] += pixel[c]
+				sumSq[c] += pixel[c] * pixel[c]
+			}
+			if isSkin(cr>>8, cg>>8, cb>>8) {
+				skin++
+			}
+			count++
+		}
+	}
+	var mean [3]float64
+	var stddev float64
+	for c := range mean {
+		mean[c] = sum[c] / float64(count)
+		stddev += math.Sqrt(math.Max(0, sumSq[c]/float64(count)-mean[c]*mean[c])) / 3
+	}
+	return mean, stddev, float64(skin) / float64(count)
+}
+
+// averageHairColor averages the pixels of the given rectangles that are neither skin
+// nor close to one of the background colors. It reports false when too few are left.
+func averageHairColor(img image.Image, rects []image.Rectangle, background [][3]float64) ([3]float64, bool) {
+	bounds := img.Bounds()
+	full := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	var sum [3]float64
+	count, total := 0, 0
+	for _, r := range rects {
+		r = r.Intersect(full)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				total++
+				cr, cg, cb, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				if isSkin(cr>>8, cg>>8, cb>>8) {
+					continue
+				}
+				pixel := [3]float64{float64(cr >> 8), float64(cg >> 8), float64(cb >> 8)}
+				isBackground := false
+				for _, sample := range background {
+					if colorDistance(pixel, sample) <= HAIR_COLOR_DISTANCE {
+						isBackground = true
+						break
+					}
+				}
+				if isBackground {
+					continue
+				}
+				for c := range sum {
+					sum[c] += pixel[c]
+				}
+				count++
+			}
+		}
+	}
+	if count == 0 || count*10 < total {
+		return [3]float64{}, false
+	}
+	return [3]float64{sum[0] / float64(count), sum[1] / float64(count), sum[2] / float64(count)}, true
+}
+
+// printHeadCoveringCheck reports a suspected head covering as a compliance warning
+func printHeadCoveringCheck(check HeadCoveringCheck) {
+	if !check.Checked {
+		logDebug("🔬 Head covering not checked (region above the face is outside the image)")
+		return
+	}
+	if check.Suspected {
+		logWarn("⚠️  Possible hat or head covering above the face (uniformity: std dev %.1f, limit %.1f; %.0f from background, %s) - only allowed for religious reasons",
+			check.StdDev, HAT_MAX_STDDEV, check.BackgroundDistance, check.hairDescription())
+		return
+	}
+	logDebug("🔬 No head covering (std dev %.1f, %.0f from background, %s, skin %.0f%%)",
+		check.StdDev, check.BackgroundDistance, check.hairDescription(), check.SkinFraction*100)
+}
+
+func (c HeadCoveringCheck) hairDescription() string {
+	if c.HairDistance < 0 {
+		return "no hair at the temples"
+	}
+	return fmt.Sprintf("%.0f from hair", c.HairDistance)
+}
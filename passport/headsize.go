@@ -0,0 +1,78 @@
+package passport
+
+import (
+	"image"
+)
+
+// Re-crops tried before giving up on reaching the spec's head height band
+const HEAD_SIZE_MAX_ITERATIONS = 5
+
+// HeadSizeCheck is the measured head height (chin to crown) of the final crop
+type HeadSizeCheck struct {
+	HeightMM     float64
+	MinMM, MaxMM float64 // Allowed band of the spec
+	Scale        float64 // Output pixels per source pixel of the final crop
+	Iterations   int     // Crops measured
+	Checked      bool    // False when the spec has no head height band
+	Converged    bool    // HeightMM is within the band
+	BoundsHit    bool    // The crop can't grow or shrink any further inside the image
+}
+
+// measureHeadHeightMM returns the head height in the printed photo. Parts of the
+// head cut off by the crop don't count.
+func measureHeadHeightMM(crop image.Rectangle, crown, chin int, spec PhotoSpec) float64 {
+	visible := min(chin, crop.Max.Y) - max(crown, crop.Min.Y)
+	return float64(visible) / float64(crop.Dy()) * spec.HeightMM
+}
+
+// fitHeadSize crops at the given scale, measures the head between the detected crown
+// and chin, and re-crops aiming for the middle of the spec's band until the head
+// height is within it. It stops early when the image edges keep the crop from changing.
+func fitHeadSize(spec PhotoSpec, placeCrop func(scale float64) image.Rectangle, scale float64, crown, chin int) (image.Rectangle, HeadSizeCheck) {
+	check := HeadSizeCheck{
+		MinMM:   spec.HeadHeightMinMM,
+		MaxMM:   spec.HeadHeightMaxMM,
+		Checked: spec.HeadHeightMaxMM > 0,
+	}
+	crop := placeCrop(scale)
+	for {
+		check.Iterations++
+		check.HeightMM = measureHeadHeightMM(crop, crown, chin, spec)
+		check.Scale = float64(spec.HeightPX) / float64(crop.Dy())
+		if !check.Checked || check.HeightMM <= 0 {
+			return crop, check
+		}
+		check.Converged = check.HeightMM >= check.MinMM && check.HeightMM <= check.MaxMM
+		if check.Converged || check.Iterations >= HEAD_SIZE_MAX_ITERATIONS {
+			return crop, check
+		}
+
+		// The head height in mm grows linearly with the scale of the crop
+		target := (check.MinMM + check.MaxMM) / 2
+		next := placeCrop(check.Scale * target / check.HeightMM)
+		if next == crop {
+			check.BoundsHit = true
+			return crop, check
+		}
+		crop = next
+	}
+}
+
+// printHeadSizeCheck reports the head height and whether re-cropping converged
+func printHeadSizeCheck(check HeadSizeCheck) {
+	switch {
+	case !check.Checked:
+		logInfo("📏 Head height: %s", formatLength(check.HeightMM, 1))
+	case check.Converged && check.Iterations == 1:
+		logInfo("✅ Head height %s (allowed %s)", formatLength(check.HeightMM, 1), formatLengthRange(check.MinMM, check.MaxMM, -1))
+	case check.Converged:
+		logInfo("✅ Head height %s (allowed %s) after %d re-crops", formatLength(check.HeightMM, 1),
+			formatLengthRange(check.MinMM, check.MaxMM, -1), check.Iterations-1)
+	case check.BoundsHit:
+		logWarn("⚠️  Head height %s is outside the allowed %s: the crop is limited by the image edges, use a photo with more space around the head",
+			formatLength(check.HeightMM, 1), formatLengthRange(check.MinMM, check.MaxMM, -1))
+	default:
+		logWarn("⚠️  Head height %s is still outside the allowed %s after %d re-crops",
+			formatLength(check.HeightMM, 1), formatLengthRange(check.MinMM, check.MaxMM, -1), check.Iterations-1)
+	}
+}
@@ -0,0 +1,319 @@
+package passport
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Languages of the interactive prompts, the summaries and reports and the errors
+// about the command line, selected with -lang or detected from the environment.
+// Diagnostic log messages stay in English.
+const (
+	LANG_EN = "en"
+	LANG_DE = "de"
+)
+
+var languages = []string{LANG_EN, LANG_DE}
+
+// language is the language every message is looked up in
+var language = LANG_EN
+
+// messages is the catalog of user-facing strings by language and key. Values are
+// fmt formats; numbers with decimals are passed pre-formatted by formatDecimal.
+var messages = map[string]map[string]string{
+	LANG_EN: {
+		"prompt.input_path":       "Enter path to input image: ",
+		"input.not_found":         "❌ File not found: %s\n",
+		"input.tips":              "💡 Tips:\n   - Use tab completion to auto-complete paths\n   - For paths with spaces, you can:\n     • Use quotes: \"/path/with spaces/file.jpg\"\n     • Let tab completion handle escaping\n     • Just type the path normally (spaces are OK)\n\n",
+		"formats.available":       "\nAvailable print formats:\n",
+		"formats.item":            "%d. %s - %d photos (%dx%d grid)\n",
+		"formats.custom":          "%d. Custom size (WxH cm)\n",
+		"prompt.format":           "Select format (1-%d, comma-separated for multiple): ",
+		"error.format_choice":     "invalid format choice '%s'",
+		"prompt.width_cm":         "Enter width in cm: ",
+		"prompt.height_cm":        "Enter height in cm: ",
+		"error.custom_dimensions": "invalid dimensions. Please enter positive integers for width and height in cm",
+		"prompt.yes_no":           " [Y/n]: ",
+		"prompt.choose":           "%s (1-%d): ",
+		"prompt.choose_retry":     "Please enter a number between 1 and %d.\n",
+		"prompt.crop_horizontal":  "Horizontal crop position in %% (0 = left, 100 = right, Enter for %s): ",
+		"prompt.crop_vertical":    "Vertical crop position in %% (0 = top, 100 = bottom, Enter for %s): ",
+		"prompt.percent_retry":    "Please enter a number between 0 and 100.\n",
+		"calibrate.instructions":  "Open the image in a viewer (%dx%d pixels) and read off the centers of both pupils.\n",
+		"prompt.pupils":           "Pupil centers as leftX,leftY,rightX,rightY: ",
+		"calibrate.saved":         "💾 Calibration saved to %s: offset %s%%, %s%% from %d sample(s)\n",
+		"capture.keys":            "   Press space to capture now, q to quit\n",
+		"capture.waiting":         "\r🔍 Waiting for a centered face...   ",
+		"capture.hold_still":      "\r🙂 Face found, hold still...        ",
+		"capture.stable":          "\n📸 Face stable - captured\n",
+		"capture.forced":          "\n📸 Capture forced\n",
+		"preview.sheet":           "👀 Preview of %s: %s\n",
+		"preview.sheet_text":      "👀 %s: %dx%d photos on %s\n",
+		"prompt.save_layout":      "Save the photo and print layout?",
+		"compare.saved":           "🆚 Comparison of %d crops saved to: %s\n",
+		"prompt.compare":          "Which crop should be used?",
+		"prompt.pick_best":        "Use the best candidate %s?",
+		"ranking.title":           "\n🏅 Ranking of %d candidates:\n",
+		"ranking.item":            "%2d. %-24s score %s (confidence %s, sharpness %s, eye contrast %s, face luminance %s, clipped %s%%)\n",
+		"ranking.item_failed":     "%2d. %-24s score %s (%s)\n",
+		"prompt.pick_candidate":   "Which candidate should be used?",
+		"summary.saved":           "\n✅ Success! Passport photo layout saved to: %s\n",
+		"summary.stdout":          "\n✅ Success! Passport photo layout written to stdout\n",
+		"summary.tiles":           "\n✅ Success! Passport photo layout saved as tiles of: %s\n",
+		"summary.tile_saved":      "🧩 Tile %d of %d saved to: %s (%dx%d pixels at %d,%d)\n",
+		"summary.file":            "📦 File: %s\n",
+		"summary.format":          "📐 Format: %s (%d photos in %dx%d grid)\n",
+		"summary.bleed":           "🖨️  Bleed: %s per side, %dx%d pixels around the nominal %s (%dx%d pixels)\n",
+		"summary.strategy":        "🧭 Crop strategy: %s\n",
+		"summary.photo_saved":     "💾 Passport photo saved to: %s (%s)\n",
+		"summary.native_saved":    "💾 Native resolution crop saved to: %s (%dx%d pixels, %s)\n",
+		"summary.separate_saved":  "💾 %d separate passport photos saved: %s ... %s (%s each)\n",
+		"summary.ready":           "🖨️  Ready to print!\n",
+		"summary.background":      "❌ Photo does not meet the background requirements of this spec",
+		"file.quality":            "quality %d",
+		"file.still_over":         " (still over %s)",
+		"file.lowered":            " (lowered from %d to fit %s)",
+		"file.stripped":           ", metadata stripped",
+
+		// Reports of -batch, -validate-only and the selftest subcommand
+		"batch.overview":      "\n🗂️  Overview saved to: %s\n",
+		"batch.summary":       "📊 Batch: %d processed, %d need attention\n",
+		"validate.title":      "\n📋 Compliance with %s (%s):\n",
+		"validate.check":      "%s %-18s %s (allowed: %s)\n",
+		"validate.passed":     "\n✅ PASS: the photo meets every checked requirement\n",
+		"validate.failed":     "\n❌ FAIL: the photo doesn't meet the requirements marked above\n",
+		"selftest.pass":       "✅ PASS %-12s %s\n",
+		"selftest.fail":       "❌ FAIL %-12s %v\n",
+		"selftest.skip":       "➖ SKIP %-12s an earlier stage failed\n",
+		"selftest.setup":      "setup",
+		"selftest.cascade":    "cascade",
+		"selftest.decode":     "decode",
+		"selftest.face":       "face",
+		"selftest.compliance": "compliance",
+		"selftest.layout":     "layout",
+		"selftest.encode":     "encode",
+		"selftest.cascades":   "face and pupil cascades loaded",
+		"selftest.no_pupils":  "face cascade loaded, no pupil cascade (reduced accuracy)",
+		"selftest.decoded":    "%dx%d sample portrait",
+		"selftest.face_found": "face of %d pixels, crop %dx%d",
+		"selftest.compliant":  "%d checks passed for %s",
+		"selftest.photos":     "%d photos on %s",
+		"selftest.round_trip": "%s JPEG at %d DPI decoded back",
+		"selftest.passed":     "\n✅ Self-test passed, the installation works\n",
+		"selftest.failed":     "\n❌ Self-test failed\n",
+
+		// Usage of the subcommands and invalid flags, reported before anything is processed
+		"usage.calibrate":         "Usage: calibrate [-pupils leftX,leftY,rightX,rightY] photo.jpg",
+		"usage.selftest":          "Usage: selftest [-verbose]",
+		"usage.server":            "Usage: server -api [-listen :8080] [-jobs N] [-request-timeout 60s] [-max-megapixels MP]",
+		"usage.watch":             "Usage: watch [-format 10x15] [-jobs N] incoming/ outgoing/",
+		"error.camera":            "Error capturing from camera: %v",
+		"config.photo_size":       "%v - give both -photo-w-mm and -photo-h-mm",
+		"config.eye_line":         "-head-margin and -eye-line both place the head vertically, give only one of them",
+		"config.grid_strategy":    "-grid-only doesn't crop and can't be combined with -strategy.",
+		"config.append_batch":     "-append fills one sheet and can't be combined with -batch.",
+		"config.force":            "-force only applies to -grid-only.",
+		"config.grid_native":      "-grid-only doesn't crop and can't be combined with -native-crop.",
+		"config.compare":          "-compare picks the crop of a single photo and can't be combined with -batch, -grid-only or -validate-only.",
+		"config.pick":             "-pick selects a -compare candidate (1 = automatic crop) and needs -compare.",
+		"config.pick_best":        "-pick-best chooses among the path arguments and can't be combined with -batch, -input, capture, -grid-only, -validate-only or -compare.",
+		"config.pick_best_count":  "-pick-best needs at least two images to choose from.",
+		"config.validate_only":    "-validate-only checks a single photo without writing anything and can't be combined with -batch, -append, -grid-only, -output or -preview.",
+		"config.validate_files":   "-validate-only writes no files and can't be combined with -separate or -no-sheet.",
+		"config.quality":          "Invalid JPEG quality. Please use a value between 1 and 100.",
+		"config.photos":           "Invalid -photos value. Please use a positive number of photos.",
+		"config.photos_format":    "Please use either -photos or -format, not both.",
+		"config.count":            "Invalid -count value. Please use a positive number of photos.",
+		"config.jobs":             "Invalid -jobs value. Please process at least one image at a time.",
+		"config.watch":            "watch processes every new file without asking and can't be combined with -batch, -input, -output, -append, -outdir, -pick-best, -validate-only, -compare, -preview or -strategy manual.",
+		"config.watch_dir":        "Watch directory does not exist: %s",
+		"config.batch":            "-batch processes a whole directory and can't be combined with -input, -output or capture.",
+		"config.batch_dir":        "Batch directory does not exist: %s",
+		"config.no_input":         "No input image given. Use -input or pass the image path as argument.",
+		"config.input_missing":    "Input file does not exist: %s",
+		"config.strip":            "-layout strip always prints a strip of four photos and can't be combined with a print format or -photos.",
+		"config.tile_stdout":      "-tile-output writes several files and can't be combined with -output -.",
+		"config.output_formats":   "-output writes a single sheet. Please select one print format.",
+		"config.template_output":  "-output-template can't be combined with -output.",
+		"config.template_format":  "-output-template needs {format} when several print formats are generated.",
+		"config.template_name":    "-output-template needs {name} to process several images.",
+		"config.no_sheet":         "-no-sheet needs -separate, -save-photo or -native-crop and can't be combined with -output or -append.",
+		"config.compare_pick":     "-compare asks which crop to use; pass -pick N when no terminal is attached.",
+		"config.preview_batch":    "-preview confirms a single photo and can't be combined with -batch.",
+		"config.preview_terminal": "-preview asks before saving and needs a terminal to answer.",
+	},
+	LANG_DE: {
+		"prompt.input_path":       "Pfad zum Eingabebild: ",
+		"input.not_found":         "❌ Datei nicht gefunden: %s\n",
+		"input.tips":              "💡 Tipps:\n   - Mit der Tabulatortaste werden Pfade automatisch ergänzt\n   - Pfade mit Leerzeichen können Sie:\n     • in Anführungszeichen setzen: \"/Pfad/mit Leerzeichen/Foto.jpg\"\n     • von der Tabulatortaste ergänzen lassen\n     • einfach normal eintippen (Leerzeichen sind erlaubt)\n\n",
+		"formats.available":       "\nVerfügbare Druckformate:\n",
+		"formats.item":            "%d. %s - %d Fotos (%dx%d-Raster)\n",
+		"formats.custom":          "%d. Eigene Größe (BxH cm)\n",
+		"prompt.format":           "Format wählen (1-%d, mehrere durch Komma getrennt): ",
+		"error.format_choice":     "ungültige Formatauswahl '%s'",
+		"prompt.width_cm":         "Breite in cm: ",
+		"prompt.height_cm":        "Höhe in cm: ",
+		"error.custom_dimensions": "ungültige Maße. Bitte Breite und Höhe als positive ganze Zahlen in cm eingeben",
+		"prompt.yes_no":           " [J/n]: ",
+		"prompt.choose":           "%s (1-%d): ",
+		"prompt.choose_retry":     "Bitte eine Zahl zwischen 1 und %d eingeben.\n",
+		"prompt.crop_horizontal":  "Horizontale Zuschnittposition in %% (0 = links, 100 = rechts, Enter für %s): ",
+		"prompt.crop_vertical":    "Vertikale Zuschnittposition in %% (0 = oben, 100 = unten, Enter für %s): ",
+		"prompt.percent_retry":    "Bitte eine Zahl zwischen 0 und 100 eingeben.\n",
+		"calibrate.instructions":  "Öffnen Sie das Bild in einem Bildbetrachter (%dx%d Pixel) und lesen Sie die Mitten beider Pupillen ab.\n",
+		"prompt.pupils":           "Pupillenmitten als linksX,linksY,rechtsX,rechtsY: ",
+		"calibrate.saved":         "💾 Kalibrierung gespeichert unter %s: Versatz %s%%, %s%% aus %d Probe(n)\n",
+		"capture.keys":            "   Leertaste für sofortige Aufnahme, q zum Beenden\n",
+		"capture.waiting":         "\r🔍 Warte auf ein mittiges Gesicht...   ",
+		"capture.hold_still":      "\r🙂 Gesicht erkannt, bitte stillhalten... ",
+		"capture.stable":          "\n📸 Gesicht ruhig - aufgenommen\n",
+		"capture.forced":          "\n📸 Aufnahme ausgelöst\n",
+		"preview.sheet":           "👀 Vorschau von %s: %s\n",
+		"preview.sheet_text":      "👀 %s: %dx%d Fotos auf %s\n",
+		"prompt.save_layout":      "Foto und Drucklayout speichern?",
+		"compare.saved":           "🆚 Vergleich von %d Zuschnitten gespeichert unter: %s\n",
+		"prompt.compare":          "Welcher Zuschnitt soll verwendet werden?",
+		"prompt.pick_best":        "Das beste Foto %s verwenden?",
+		"ranking.title":           "\n🏅 Rangfolge von %d Fotos:\n",
+		"ranking.item":            "%2d. %-24s Wertung %s (Konfidenz %s, Schärfe %s, Augenkontrast %s, Gesichtshelligkeit %s, überbelichtet %s%%)\n",
+		"ranking.item_failed":     "%2d. %-24s Wertung %s (%s)\n",
+		"prompt.pick_candidate":   "Welches Foto soll verwendet werden?",
+		"summary.saved":           "\n✅ Fertig! Passfoto-Layout gespeichert unter: %s\n",
+		"summary.stdout":          "\n✅ Fertig! Passfoto-Layout auf die Standardausgabe geschrieben\n",
+		"summary.tiles":           "\n✅ Fertig! Passfoto-Layout in Kacheln gespeichert: %s\n",
+		"summary.tile_saved":      "🧩 Kachel %d von %d gespeichert unter: %s (%dx%d Pixel bei %d,%d)\n",
+		"summary.file":            "📦 Datei: %s\n",
+		"summary.format":          "📐 Format: %s (%d Fotos im %dx%d-Raster)\n",
+		"summary.bleed":           "🖨️  Beschnittzugabe: %s je Seite, %dx%d Pixel um das Nennformat %s (%dx%d Pixel)\n",
+		"summary.strategy":        "🧭 Zuschnitt: %s\n",
+		"summary.photo_saved":     "💾 Passfoto gespeichert unter: %s (%s)\n",
+		"summary.native_saved":    "💾 Zuschnitt in Originalauflösung gespeichert unter: %s (%dx%d Pixel, %s)\n",
+		"summary.separate_saved":  "💾 %d einzelne Passfotos gespeichert: %s ... %s (je %s)\n",
+		"summary.ready":           "🖨️  Bereit zum Drucken!\n",
+		"summary.background":      "❌ Der Hintergrund des Fotos erfüllt die Anforderungen dieser Norm nicht",
+		"file.quality":            "Qualität %d",
+		"file.still_over":         " (immer noch über %s)",
+		"file.lowered":            " (von %d gesenkt, um %s einzuhalten)",
+		"file.stripped":           ", Metadaten entfernt",
+
+		// Reports of -batch, -validate-only and the selftest subcommand
+		"batch.overview":      "\n🗂️  Übersicht gespeichert unter: %s\n",
+		"batch.summary":       "📊 Stapel: %d verarbeitet, %d zu prüfen\n",
+		"validate.title":      "\n📋 Prüfung nach %s (%s):\n",
+		"validate.check":      "%s %-18s %s (erlaubt: %s)\n",
+		"validate.passed":     "\n✅ BESTANDEN: Das Foto erfüllt jede geprüfte Anforderung\n",
+		"validate.failed":     "\n❌ NICHT BESTANDEN: Das Foto erfüllt die oben markierten Anforderungen nicht\n",
+		"selftest.pass":       "✅ OK       %-12s %s\n",
+		"selftest.fail":       "❌ FEHLER   %-12s %v\n",
+		"selftest.skip":       "➖ ENTFÄLLT %-12s ein früherer Schritt ist fehlgeschlagen\n",
+		"selftest.setup":      "Vorbereitung",
+		"selftest.cascade":    "Kaskaden",
+		"selftest.decode":     "Dekodieren",
+		"selftest.face":       "Gesicht",
+		"selftest.compliance": "Konformität",
+		"selftest.layout":     "Layout",
+		"selftest.encode":     "Kodieren",
+		"selftest.cascades":   "Gesichts- und Pupillenkaskade geladen",
+		"selftest.no_pupils":  "Gesichtskaskade geladen, keine Pupillenkaskade (geringere Genauigkeit)",
+		"selftest.decoded":    "%dx%d Beispielporträt",
+		"selftest.face_found": "Gesicht mit %d Pixeln, Zuschnitt %dx%d",
+		"selftest.compliant":  "%d Prüfungen für %s bestanden",
+		"selftest.photos":     "%d Fotos auf %s",
+		"selftest.round_trip": "JPEG (%s, %d DPI) wieder dekodiert",
+		"selftest.passed":     "\n✅ Selbsttest bestanden, die Installation funktioniert\n",
+		"selftest.failed":     "\n❌ Selbsttest fehlgeschlagen\n",
+
+		// Usage of the subcommands and invalid flags, reported before anything is processed
+		"usage.calibrate":         "Aufruf: calibrate [-pupils linksX,linksY,rechtsX,rechtsY] foto.jpg",
+		"usage.selftest":          "Aufruf: selftest [-verbose]",
+		"usage.server":            "Aufruf: server -api [-listen :8080] [-jobs N] [-request-timeout 60s] [-max-megapixels MP]",
+		"usage.watch":             "Aufruf: watch [-format 10x15] [-jobs N] eingang/ ausgang/",
+		"error.camera":            "Fehler bei der Aufnahme mit der Kamera: %v",
+		"config.photo_size":       "%v - bitte -photo-w-mm und -photo-h-mm angeben",
+		"config.eye_line":         "-head-margin und -eye-line legen beide die Kopfhöhe fest, bitte nur eines davon angeben",
+		"config.grid_strategy":    "-grid-only schneidet nicht zu und kann nicht mit -strategy kombiniert werden.",
+		"config.append_batch":     "-append füllt einen Bogen und kann nicht mit -batch kombiniert werden.",
+		"config.force":            "-force gilt nur für -grid-only.",
+		"config.grid_native":      "-grid-only schneidet nicht zu und kann nicht mit -native-crop kombiniert werden.",
+		"config.compare":          "-compare wählt den Zuschnitt eines einzelnen Fotos und kann nicht mit -batch, -grid-only oder -validate-only kombiniert werden.",
+		"config.pick":             "-pick wählt einen Kandidaten von -compare (1 = automatischer Zuschnitt) und braucht -compare.",
+		"config.pick_best":        "-pick-best wählt unter den angegebenen Pfaden und kann nicht mit -batch, -input, capture, -grid-only, -validate-only oder -compare kombiniert werden.",
+		"config.pick_best_count":  "-pick-best braucht mindestens zwei Bilder zur Auswahl.",
+		"config.validate_only":    "-validate-only prüft ein einzelnes Foto, ohne etwas zu schreiben, und kann nicht mit -batch, -append, -grid-only, -output oder -preview kombiniert werden.",
+		"config.validate_files":   "-validate-only schreibt keine Dateien und kann nicht mit -separate oder -no-sheet kombiniert werden.",
+		"config.quality":          "Ungültige JPEG-Qualität. Bitte einen Wert zwischen 1 und 100 angeben.",
+		"config.photos":           "Ungültiger Wert für -photos. Bitte eine positive Anzahl Fotos angeben.",
+		"config.photos_format":    "Bitte entweder -photos oder -format angeben, nicht beides.",
+		"config.count":            "Ungültiger Wert für -count. Bitte eine positive Anzahl Fotos angeben.",
+		"config.jobs":             "Ungültiger Wert für -jobs. Bitte mindestens ein Bild gleichzeitig verarbeiten.",
+		"config.watch":            "watch verarbeitet jede neue Datei ohne Rückfrage und kann nicht mit -batch, -input, -output, -append, -outdir, -pick-best, -validate-only, -compare, -preview oder -strategy manual kombiniert werden.",
+		"config.watch_dir":        "Überwachtes Verzeichnis existiert nicht: %s",
+		"config.batch":            "-batch verarbeitet ein ganzes Verzeichnis und kann nicht mit -input, -output oder capture kombiniert werden.",
+		"config.batch_dir":        "Stapelverzeichnis existiert nicht: %s",
+		"config.no_input":         "Kein Eingabebild angegeben. Bitte -input verwenden oder den Bildpfad als Argument übergeben.",
+		"config.input_missing":    "Eingabedatei existiert nicht: %s",
+		"config.strip":            "-layout strip druckt immer einen Streifen mit vier Fotos und kann nicht mit einem Druckformat oder -photos kombiniert werden.",
+		"config.tile_stdout":      "-tile-output schreibt mehrere Dateien und kann nicht mit -output - kombiniert werden.",
+		"config.output_formats":   "-output schreibt einen einzigen Bogen. Bitte ein Druckformat wählen.",
+		"config.template_output":  "-output-template kann nicht mit -output kombiniert werden.",
+		"config.template_format":  "-output-template braucht {format}, wenn mehrere Druckformate erzeugt werden.",
+		"config.template_name":    "-output-template braucht {name}, um mehrere Bilder zu verarbeiten.",
+		"config.no_sheet":         "-no-sheet braucht -separate, -save-photo oder -native-crop und kann nicht mit -output oder -append kombiniert werden.",
+		"config.compare_pick":     "-compare fragt, welcher Zuschnitt verwendet werden soll; ohne Terminal bitte -pick N angeben.",
+		"config.preview_batch":    "-preview bestätigt ein einzelnes Foto und kann nicht mit -batch kombiniert werden.",
+		"config.preview_terminal": "-preview fragt vor dem Speichern und braucht ein Terminal für die Antwort.",
+	},
+}
+
+// validateLanguage checks a -lang value
+func validateLanguage(lang string) error {
+	for _, l := range languages {
+		if l == lang {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid language '%s' (available: %s)", lang, strings.Join(languages, ", "))
+}
+
+// detectLanguage picks the language from the locale environment variables in the
+// order the C library reads them, e.g. LANG=de_AT.UTF-8 selects German. Locales
+// without a translation fall back to English.
+func detectLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		lang := strings.ToLower(value)
+		if i := strings.IndexAny(lang, "_.@-"); i >= 0 {
+			lang = lang[:i]
+		}
+		if validateLanguage(lang) == nil {
+			return lang
+		}
+		return LANG_EN
+	}
+	return LANG_EN
+}
+
+// msg returns the message for key in the current language, formatted with args.
+// Keys missing from a translation fall back to English.
+func msg(key string, args ...any) string {
+	format, ok := messages[language][key]
+	if !ok {
+		format = messages[LANG_EN][key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// formatDecimal formats a measurement with prec decimals and the decimal separator
+// of the current language (a comma in German)
+func formatDecimal(value float64, prec int) string {
+	text := strconv.FormatFloat(value, 'f', prec, 64)
+	if language == LANG_DE {
+		text = strings.Replace(text, ".", ",", 1)
+	}
+	return text
+}
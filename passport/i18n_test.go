@@ -0,0 +1,207 @@
+package passport
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// formatVerbs matches the fmt verbs of a message
+var formatVerbs = regexp.MustCompile(`%[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+
+// Every message has a translation in every language, taking the same arguments
+func TestMessageCatalogComplete(t *testing.T) {
+	for _, lang := range languages {
+		if _, ok := messages[lang]; !ok {
+			t.Fatalf("no messages for %s", lang)
+		}
+	}
+	for _, lang := range languages {
+		for key, format := range messages[lang] {
+			if strings.TrimSpace(format) == "" {
+				t.Errorf("%s: %s is empty", lang, key)
+			}
+			for _, other := range languages {
+				translation, ok := messages[other][key]
+				if !ok {
+					t.Errorf("%s: %s has no translation", other, key)
+					continue
+				}
+				if got, want := formatVerbs.FindAllString(translation, -1), formatVerbs.FindAllString(format, -1); strings.Join(got, " ") != strings.Join(want, " ") {
+					t.Errorf("%s: %s takes %v, in %s %v", other, key, got, lang, want)
+				}
+			}
+		}
+	}
+}
+
+func TestMsg(t *testing.T) {
+	defer func(saved string) { language = saved }(language)
+
+	language = LANG_DE
+	if got, want := msg("prompt.choose_retry", 3), "Bitte eine Zahl zwischen 1 und 3 eingeben.\n"; got != want {
+		t.Errorf("msg = %q, want %q", got, want)
+	}
+	messages[LANG_EN]["test.untranslated"] = "only in English %d"
+	defer delete(messages[LANG_EN], "test.untranslated")
+	if got, want := msg("test.untranslated", 1), "only in English 1"; got != want {
+		t.Errorf("missing translation gives %q, want %q", got, want)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		lcAll, lcMessages, lang string
+		want                    string
+	}{
+		{"", "", "", LANG_EN},
+		{"", "", "de_AT.UTF-8", LANG_DE},
+		{"", "", "de", LANG_DE},
+		{"", "", "DE_de", LANG_DE},
+		{"", "", "fr_FR.UTF-8", LANG_EN},
+		{"", "en_US.UTF-8", "de_AT.UTF-8", LANG_EN},
+		{"de_CH", "en_US.UTF-8", "en_US.UTF-8", LANG_DE},
+		{"C", "", "de_AT.UTF-8", LANG_EN},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_MESSAGES", tt.lcMessages)
+		t.Setenv("LANG", tt.lang)
+		if got := detectLanguage(); got != tt.want {
+			t.Errorf("LC_ALL=%q LC_MESSAGES=%q LANG=%q: %s, want %s", tt.lcAll, tt.lcMessages, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	defer func(saved string) { language = saved }(language)
+	tests := []struct {
+		lang  string
+		value float64
+		prec  int
+		want  string
+	}{
+		{LANG_EN, 1.25, 2, "1.25"},
+		{LANG_DE, 1.25, 2, "1,25"},
+		{LANG_DE, 1234.5, 1, "1234,5"},
+		{LANG_DE, 42, 0, "42"},
+		{LANG_DE, 37.5, -1, "37,5"},
+	}
+	for _, tt := range tests {
+		language = tt.lang
+		if got := formatDecimal(tt.value, tt.prec); got != tt.want {
+			t.Errorf("%s: formatDecimal(%g, %d) = %q, want %q", tt.lang, tt.value, tt.prec, got, tt.want)
+		}
+	}
+}
+
+// A German locale gives the summary in German with decimal commas; -lang overrides
+// the locale
+func TestSummaryLanguage(t *testing.T) {
+	requireCascade(t)
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_AT.UTF-8")
+	tests := []struct {
+		args []string
+		want *regexp.Regexp
+	}{
+		{nil, regexp.MustCompile(`Fertig!(.|\n)*Datei: \d+,\d+ [KM]B`)},
+		{[]string{"-lang", LANG_EN}, regexp.MustCompile(`Success!(.|\n)*File: \d+\.\d+ [KM]B`)},
+	}
+	for _, tt := range tests {
+		args := append(tt.args, "-outdir", t.TempDir(), sampleImagePath, SHEET_10X15)
+		stdout, stderr, code := runCLI(t, nil, args...)
+		if code != 0 {
+			t.Fatalf("%v: exited with %d:\n%s", tt.args, code, stderr)
+		}
+		if !tt.want.MatchString(stdout) {
+			t.Errorf("%v: summary doesn't match %s:\n%s", tt.args, tt.want, stdout)
+		}
+	}
+}
+
+// Errors about the command line follow the locale and -lang like the summary does
+func TestFlagErrorLanguage(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_AT.UTF-8")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-force", sampleImagePath}, messages[LANG_DE]["config.force"]},
+		{[]string{"-lang", LANG_EN, "-force", sampleImagePath}, messages[LANG_EN]["config.force"]},
+		{[]string{"-batch", "missing"}, fmt.Sprintf(messages[LANG_DE]["config.batch_dir"], "missing")},
+	}
+	for _, tt := range tests {
+		_, stderr, code := runCLI(t, nil, tt.args...)
+		if code == 0 || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: exited with %d, want %q:\n%s", tt.args, code, tt.want, stderr)
+		}
+	}
+}
+
+// catalogExempt lists the files whose output is deliberately English, with the reason
+var catalogExempt = map[string]string{
+	"logging.go": "diagnostic log messages stay in English",
+	"server.go":  "the API answers with JSON whose error codes and messages are part of its contract",
+}
+
+// No file prints anything to the user that isn't looked up in the catalog: every
+// string printed with fmt or log is a message, or a literal that is only fmt verbs
+// and punctuation
+func TestInteractivePathsUseCatalog(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("passport", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range catalogExempt {
+		if _, err := os.Stat(filepath.Join("passport", name)); err != nil {
+			t.Errorf("exempt file %s: %v", name, err)
+		}
+	}
+	words := regexp.MustCompile(`[A-Za-z]{2,}`)
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") || catalogExempt[filepath.Base(name)] != "" {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			pkg, ok := sel.X.(*ast.Ident)
+			if !ok || !(pkg.Name == "fmt" && strings.Contains(sel.Sel.Name, "Print") || pkg.Name == "log") {
+				return true
+			}
+			for _, arg := range call.Args {
+				lit, ok := arg.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				text, _ := strconv.Unquote(lit.Value)
+				if words.MatchString(formatVerbs.ReplaceAllString(text, "")) {
+					t.Errorf("%s: %s.%s prints %s instead of a message", fset.Position(lit.Pos()), pkg.Name, sel.Sel.Name, lit.Value)
+				}
+			}
+			return true
+		})
+	}
+}
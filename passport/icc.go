@@ -0,0 +1,387 @@
+package passport
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// Color profile modes accepted by -color-profile
+const (
+	COLOR_PROFILE_SRGB = "srgb" // Convert non-sRGB sources to sRGB, output carries no profile (default)
+	COLOR_PROFILE_KEEP = "keep" // Leave pixels alone and embed the source profile in the output
+)
+
+var colorProfileModes = []string{COLOR_PROFILE_SRGB, COLOR_PROFILE_KEEP}
+
+// JPEG APP2 segments carrying an ICC profile start with this identifier
+const iccJPEGIdentifier = "ICC_PROFILE\x00"
+
+// Largest profile chunk per APP2 segment (65535 minus length, identifier, and sequence bytes)
+const iccMaxChunkSize = 65519
+
+// XYZ (D50) to linear sRGB, Bradford-adapted as ICC profile connection space values are D50
+var xyzD50ToLinearSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// validateColorProfileMode checks a -color-profile value
+func validateColorProfileMode(mode string) error {
+	for _, m := range colorProfileModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid color profile mode '%s' (available: %s)", mode, strings.Join(colorProfileModes, ", "))
+}
+
+// applyColorProfile handles the ICC profile embedded in the source. It returns the image
+// to process and the profile to embed in the output (nil for plain sRGB output).
+func applyColorProfile(img image.Image, profile []byte, mode string) (image.Image, []byte) {
+	if profile == nil {
+		return img, nil
+	}
+	name := iccDescription(profile)
+	if isSRGBProfile(name) {
+		return img, nil
+	}
+
+	if mode == COLOR_PROFILE_KEEP {
+		logWarn("⚠️  Source uses the '%s' color profile - embedding it in the output.", name)
+		logWarn("   Make sure your print lab honors embedded profiles, or use -color-profile srgb")
+		return img, profile
+	}
+
+	transform, err := parseMatrixShaperProfile(profile)
+	if err != nil {
+		logWarn("⚠️  Source uses the '%s' color profile, which can't be converted to sRGB (%v).", name, err)
+		logWarn("   Embedding it in the output instead - prints may look desaturated if the lab ignores it")
+		return img, profile
+	}
+	logInfo("🎨 Converted colors from the '%s' profile to sRGB", name)
+	return transform.toSRGB(img), nil
+}
+
+// extractICCProfile returns the ICC profile embedded in a JPEG (APP2 segments) or
+// PNG (iCCP chunk), or nil when there is none
+func extractICCProfile(data []byte) []byte {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return extractJPEGICCProfile(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return extractPNGICCProfile(data)
+	}
+	return nil
+}
+
+// extractJPEGICCProfile joins the ICC_PROFILE APP2 chunks found before the image data
+func extractJPEGICCProfile(data []byte) []byte {
+	chunks := map[int][]byte{}
+	count := 0
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // start of scan / end of image: no more metadata
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE2 && len(segment) > len(iccJPEGIdentifier)+2 && string(segment[:len(iccJPEGIdentifier)]) == iccJPEGIdentifier {
+			seq := int(segment[len(iccJPEGIdentifier)])
+			count = int(segment[len(iccJPEGIdentifier)+1])
+			chunks[seq] = segment[len(iccJPEGIdentifier)+2:]
+		}
+		pos = end
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var profile []byte
+	for seq := 1; seq <= count; seq++ {
+		chunk, ok := chunks[seq]
+		if !ok {
+			return nil // incomplete profile
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// extractPNGICCProfile inflates the iCCP chunk of a PNG
+func extractPNGICCProfile(data []byte) []byte {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) || chunkType == "IDAT" {
+			return nil
+		}
+		if chunkType == "iCCP" {
+			chunk := data[pos+8 : pos+8+length]
+			// profile name, NUL, compression method, zlib stream
+			nameEnd := bytes.IndexByte(chunk, 0)
+			if nameEnd < 0 || nameEnd+2 > len(chunk) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(chunk[nameEnd+2:]))
+			if err != nil {
+				return nil
+			}
+			defer reader.Close()
+			profile, err := io.ReadAll(reader)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+// addICCProfile inserts the profile as ICC_PROFILE APP2 segments right after the SOI
+// marker of an encoded JPEG (call before addJFIFDensity so the JFIF header stays first)
+func addICCProfile(data []byte, profile []byte) []byte {
+	if len(profile) == 0 || len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+
+	count := (len(profile) + iccMaxChunkSize - 1) / iccMaxChunkSize
+	var segments bytes.Buffer
+	for i := 0; i < count; i++ {
+		chunk := profile[i*iccMaxChunkSize : min((i+1)*iccMaxChunkSize, len(profile))]
+		segments.Write([]byte{0xFF, 0xE2})
+		binary.Write(&segments, binary.BigEndian, uint16(2+len(iccJPEGIdentifier)+2+len(chunk)))
+		segments.WriteString(iccJPEGIdentifier)
+		segments.Write([]byte{byte(i + 1), byte(count)})
+		segments.Write(chunk)
+	}
+
+	result := make([]byte, 0, len(data)+segments.Len())
+	result = append(result, data[:2]...)
+	result = append(result, segments.Bytes()...)
+	return append(result, data[2:]...)
+}
+
+// iccTag returns the data of a tag from the profile's tag table
+func iccTag(profile []byte, signature string) ([]byte, bool) {
+	if len(profile) < 132 {
+		return nil, false
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(profile) {
+			return nil, false
+		}
+		if string(profile[entry:entry+4]) != signature {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			return nil, false
+		}
+		return profile[offset : offset+size], true
+	}
+	return nil, false
+}
+
+// iccDescription returns the human-readable profile name ("desc" tag, v2 or v4 encoding)
+func iccDescription(profile []byte) string {
+	tag, ok := iccTag(profile, "desc")
+	if !ok || len(tag) < 12 {
+		return "unknown"
+	}
+	switch string(tag[:4]) {
+	case "desc": // v2: ASCII count and string
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+n <= len(tag) {
+			return strings.TrimRight(string(tag[12:12+n]), "\x00")
+		}
+	case "mluc": // v4: first localized UTF-16BE record
+		if len(tag) >= 28 && binary.BigEndian.Uint32(tag[8:]) > 0 {
+			length := int(binary.BigEndian.Uint32(tag[20:]))
+			offset := int(binary.BigEndian.Uint32(tag[24:]))
+			if offset+length <= len(tag) {
+				units := make([]uint16, length/2)
+				for i := range units {
+					units[i] = binary.BigEndian.Uint16(tag[offset+2*i:])
+				}
+				return string(utf16.Decode(units))
+			}
+		}
+	}
+	return "unknown"
+}
+
+// isSRGBProfile reports whether a profile name denotes sRGB (e.g. "sRGB IEC61966-2.1")
+func isSRGBProfile(name string) bool {
+	return strings.Contains(strings.ToLower(name), "srgb")
+}
+
+// matrixShaper is an RGB profile described by per-channel tone curves and a matrix to XYZ
+type matrixShaper struct {
+	toLinear [3][256]float64 // 8-bit channel value to linear light
+	toXYZ    [3][3]float64   // linear RGB to XYZ (D50), columns are the red/green/blue colorants
+}
+
+// parseMatrixShaperProfile reads the colorant and tone curve tags of an RGB profile.
+// LUT-based profiles (e.g. most printer or camera-specific ones) are not supported.
+func parseMatrixShaperProfile(profile []byte) (*matrixShaper, error) {
+	if len(profile) < 128 || string(profile[16:20]) != "RGB " {
+		return nil, fmt.Errorf("not an RGB profile")
+	}
+
+	ms := &matrixShaper{}
+	for channel, prefix := range []string{"r", "g", "b"} {
+		xyz, ok := iccTag(profile, prefix+"XYZ")
+		if !ok || len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil, fmt.Errorf("no matrix/TRC colorants")
+		}
+		for i := 0; i < 3; i++ {
+			ms.toXYZ[i][channel] = s15Fixed16(xyz[8+4*i:])
+		}
+
+		trc, ok := iccTag(profile, prefix+"TRC")
+		if !ok {
+			return nil, fmt.Errorf("no tone curves")
+		}
+		curve, err := parseToneCurve(trc)
+		if err != nil {
+			return nil, err
+		}
+		for v := 0; v < 256; v++ {
+			ms.toLinear[channel][v] = curve(float64(v) / 255)
+		}
+	}
+	return ms, nil
+}
+
+// parseToneCurve returns the function of a "curv" or "para" tag
+func parseToneCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, fmt.Errorf("truncated tone curve")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+2*n {
+			return nil, fmt.Errorf("truncated tone curve")
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(n-1)
+			i := min(int(pos), n-2)
+			frac := pos - float64(i)
+			return table[i]*(1-frac) + table[i+1]*frac
+		}, nil
+	case "para":
+		funcType := int(binary.BigEndian.Uint16(tag[8:]))
+		paramCount := []int{1, 3, 4, 5, 7}
+		if funcType >= len(paramCount) || len(tag) < 12+4*paramCount[funcType] {
+			return nil, fmt.Errorf("unsupported parametric curve")
+		}
+		p := make([]float64, 7)
+		for i := 0; i < paramCount[funcType]; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		return func(x float64) float64 {
+			switch funcType {
+			case 0:
+				return math.Pow(x, g)
+			case 1:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g)
+				}
+				return 0
+			case 2:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g) + c
+				}
+				return c
+			case 3:
+				if x >= d {
+					return math.Pow(a*x+b, g)
+				}
+				return c * x
+			default:
+				if x >= d {
+					return math.Pow(a*x+b, g) + e
+				}
+				return c*x + f
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported tone curve type '%s'", string(tag[:4]))
+}
+
+// s15Fixed16 decodes an ICC signed 15.16 fixed point number
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// toSRGB converts every pixel from the profile's color space to sRGB
+func (ms *matrixShaper) toSRGB(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	// Combined linear source RGB to linear sRGB matrix
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += xyzD50ToLinearSRGB[i][k] * ms.toXYZ[k][j]
+			}
+		}
+	}
+
+	// sRGB encoding via lookup on 4096 linear levels
+	var encode [4097]uint8
+	for i := range encode {
+		v := float64(i) / 4096
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		encode[i] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		r := ms.toLinear[0][src.Pix[i]]
+		g := ms.toLinear[1][src.Pix[i+1]]
+		b := ms.toLinear[2][src.Pix[i+2]]
+		for c := 0; c < 3; c++ {
+			v := m[c][0]*r + m[c][1]*g + m[c][2]*b
+			src.Pix[i+c] = encode[int(math.Round(math.Max(0, math.Min(1, v))*4096))]
+		}
+	}
+	return src
+}
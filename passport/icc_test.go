@@ -0,0 +1,142 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// matrixShaperProfile builds a minimal v2 RGB display profile: a description, the
+// D50 colorants as columns of the matrix to XYZ, and one gamma curve for all channels
+func matrixShaperProfile(description string, colorants [3][3]float64, gamma float64) []byte {
+	fixed := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+	}
+	type tag struct {
+		signature string
+		data      []byte
+	}
+	desc := append([]byte("desc\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(description)+1))...)
+	desc = append(append(desc, description...), 0)
+	curve := append([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x01"), binary.BigEndian.AppendUint16(nil, uint16(math.Round(gamma*256)))...)
+	tags := []tag{{"desc", desc}}
+	for channel, prefix := range []string{"r", "g", "b"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range colorants[channel] {
+			xyz = append(xyz, fixed(v)...)
+		}
+		tags = append(tags, tag{prefix + "XYZ", xyz}, tag{prefix + "TRC", curve})
+	}
+
+	header := make([]byte, 128)
+	copy(header[8:], []byte{2, 0x10, 0, 0})
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	offset := 128 + 4 + 12*len(tags)
+	for _, t := range tags {
+		table = append(table, t.signature...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		data = append(data, t.data...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+// Adobe RGB (1998) with its D50-adapted colorants
+func adobeRGBProfile() []byte {
+	return matrixShaperProfile("Adobe RGB (1998)", [3][3]float64{
+		{0.60974, 0.31111, 0.01947},
+		{0.20528, 0.62567, 0.06087},
+		{0.14919, 0.06322, 0.74457},
+	}, 2.19921875)
+}
+
+func TestICCProfileJPEGRoundTrip(t *testing.T) {
+	encoded, err := encodeImage(image.NewRGBA(image.Rect(0, 0, 8, 8)), SaveOptions{Metadata: METADATA_NONE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Large profiles are split across several APP2 segments
+	large := append(adobeRGBProfile(), make([]byte, 2*iccMaxChunkSize)...)
+	for _, profile := range [][]byte{adobeRGBProfile(), large} {
+		if got := extractICCProfile(addICCProfile(encoded, profile)); !bytes.Equal(got, profile) {
+			t.Errorf("profile of %d bytes came back as %d bytes", len(profile), len(got))
+		}
+	}
+	if got := extractICCProfile(encoded); got != nil {
+		t.Errorf("untagged JPEG has a %d byte profile", len(got))
+	}
+}
+
+func TestApplyColorProfile(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{128, 128, 128, 255})
+	img.SetRGBA(1, 0, color.RGBA{160, 110, 90, 255})
+	adobe := adobeRGBProfile()
+	srgb := matrixShaperProfile("sRGB IEC61966-2.1", [3][3]float64{}, 2.2)
+
+	if out, profile := applyColorProfile(img, nil, COLOR_PROFILE_SRGB); out != image.Image(img) || profile != nil {
+		t.Error("untagged source was changed")
+	}
+	if out, profile := applyColorProfile(img, srgb, COLOR_PROFILE_KEEP); out != image.Image(img) || profile != nil {
+		t.Error("sRGB source was changed or its profile kept")
+	}
+	if out, profile := applyColorProfile(img, adobe, COLOR_PROFILE_KEEP); out != image.Image(img) || !bytes.Equal(profile, adobe) {
+		t.Error("keep didn't pass the Adobe RGB source through with its profile")
+	}
+
+	out, profile := applyColorProfile(img, adobe, COLOR_PROFILE_SRGB)
+	if profile != nil {
+		t.Error("converted output still carries the Adobe RGB profile")
+	}
+	converted := out.(*image.RGBA)
+	// Gray stays gray; the gamma 2.2 curve and the sRGB curve differ by a level at most
+	if gray := converted.RGBAAt(0, 0); max(gray.R, gray.G, gray.B)-min(gray.R, gray.G, gray.B) > 1 || gray.G < 126 || gray.G > 130 {
+		t.Errorf("gray converted to %v", gray)
+	}
+	// Adobe RGB's primaries are wider, so the same values mean a more saturated color in sRGB
+	before, after := img.RGBAAt(1, 0), converted.RGBAAt(1, 0)
+	if spread := int(after.R) - int(after.B); spread <= int(before.R)-int(before.B) {
+		t.Errorf("%v converted to %v, want a more saturated color", before, after)
+	}
+}
+
+// A tagged camera photo: -color-profile keep embeds the profile in the photo even
+// though it is sanitized, srgb converts and writes an untagged photo
+func TestColorProfileOutputs(t *testing.T) {
+	requireCascade(t)
+	sample, err := os.ReadFile(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "adobe.jpg")
+	// The sample carries an sRGB profile of its own, which the Adobe RGB one replaces
+	if err := os.WriteFile(input, addICCProfile(stripJPEGMetadata(sample), adobeRGBProfile()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range colorProfileModes {
+		outdir := filepath.Join(dir, mode)
+		_, stderr, code := runCLI(t, nil, "-color-profile", mode, "-save-photo", "-outdir", outdir, input, SHEET_10X15)
+		if code != 0 {
+			t.Fatalf("-color-profile %s: exited with %d:\n%s", mode, code, stderr)
+		}
+		profile := extractICCProfile(mustReadFile(t, buildPhotoOutputPath(input, outdir)))
+		if want := mode == COLOR_PROFILE_KEEP; want != bytes.Equal(profile, adobeRGBProfile()) {
+			t.Errorf("-color-profile %s: photo carries a %d byte profile, want the Adobe RGB profile: %v", mode, len(profile), want)
+		}
+	}
+}
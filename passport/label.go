@@ -0,0 +1,177 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Corner label font size in points (rendered at the sheet DPI)
+	LABEL_FONT_SIZE_PT = 10.0
+
+	// Distance of a corner label from the sheet edge in millimeters
+	LABEL_MARGIN_MM = 1.5
+
+	// Diagonal watermark: text spans this fraction of the sheet diagonal
+	WATERMARK_DIAGONAL_FILL = 0.7
+
+	// Diagonal watermark opacity (0..1)
+	WATERMARK_OPACITY = 0.3
+)
+
+// Label positions accepted by -label-position
+var labelPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "diagonal"}
+
+// validateLabelPosition checks a -label-position value
+func validateLabelPosition(position string) error {
+	for _, p := range labelPositions {
+		if p == position {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid label position '%s' (available: %s)", position, strings.Join(labelPositions, ", "))
+}
+
+// newLabelFace creates the label font face at the given size in points, rendered at dpi
+func newLabelFace(sizePt float64, dpi int) (font.Face, error) {
+	parsed, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing label font: %v", err)
+	}
+	return opentype.NewFace(parsed, &opentype.FaceOptions{
+		Size:    sizePt,
+		DPI:     float64(dpi),
+		Hinting: font.HintingFull,
+	})
+}
+
+// renderTextMask draws text into an alpha mask sized to fit it exactly
+func renderTextMask(text string, face font.Face) *image.Alpha {
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	drawer.DrawString(text)
+	return mask
+}
+
+// drawLabel renders a text label onto the sheet, either in a corner or as a
+// diagonal watermark across the whole sheet. Returns the labeled image.
+func drawLabel(img image.Image, text, position string, dpi int) (image.Image, error) {
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+
+	if position == "diagonal" {
+		return drawDiagonalWatermark(canvas, text)
+	}
+
+	face, err := newLabelFace(LABEL_FONT_SIZE_PT, dpi)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	mask := renderTextMask(text, face)
+	margin := mmToPX(LABEL_MARGIN_MM, dpi)
+	width := canvas.Bounds().Dx()
+	height := canvas.Bounds().Dy()
+
+	var x, y int
+	switch position {
+	case "top-left":
+		x, y = margin, margin
+	case "top-right":
+		x, y = width-margin-mask.Bounds().Dx(), margin
+	case "bottom-left":
+		x, y = margin, height-margin-mask.Bounds().Dy()
+	default: // bottom-right
+		x, y = width-margin-mask.Bounds().Dx(), height-margin-mask.Bounds().Dy()
+	}
+
+	black := &image.Uniform{color.RGBA{0, 0, 0, 255}}
+	target := image.Rect(x, y, x+mask.Bounds().Dx(), y+mask.Bounds().Dy())
+	draw.DrawMask(canvas, target, black, image.Point{}, mask, image.Point{}, draw.Over)
+
+	logInfo("🏷️  Added label \"%s\" (%s)", text, position)
+	return canvas, nil
+}
+
+// drawDiagonalWatermark renders semi-transparent gray text rotated along the sheet diagonal
+func drawDiagonalWatermark(canvas *image.RGBA, text string) (image.Image, error) {
+	width := canvas.Bounds().Dx()
+	height := canvas.Bounds().Dy()
+	diagonal := math.Hypot(float64(width), float64(height))
+
+	// Render once at a reference size, then scale the font so the text fills the diagonal
+	face, err := newLabelFace(LABEL_FONT_SIZE_PT, DPI)
+	if err != nil {
+		return nil, err
+	}
+	referenceWidth := font.MeasureString(face, text).Ceil()
+	face.Close()
+	if referenceWidth == 0 {
+		return canvas, nil
+	}
+
+	sizePt := LABEL_FONT_SIZE_PT * diagonal * WATERMARK_DIAGONAL_FILL / float64(referenceWidth)
+	face, err = newLabelFace(sizePt, DPI)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	mask := renderTextMask(text, face)
+	maskWidth := float64(mask.Bounds().Dx())
+	maskHeight := float64(mask.Bounds().Dy())
+
+	// Rotate from bottom-left to top-right around the sheet center
+	angle := math.Atan2(float64(height), float64(width))
+	cosA := math.Cos(angle)
+	sinA := math.Sin(angle)
+	centerX := float64(width) / 2
+	centerY := float64(height) / 2
+
+	gray := 128.0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Inverse-rotate the canvas pixel into mask coordinates
+			dx := float64(x) - centerX
+			dy := float64(y) - centerY
+			mx := int(dx*cosA - dy*sinA + maskWidth/2)
+			my := int(dx*sinA + dy*cosA + maskHeight/2)
+			if mx < 0 || my < 0 || mx >= int(maskWidth) || my >= int(maskHeight) {
+				continue
+			}
+
+			alpha := float64(mask.AlphaAt(mx, my).A) / 255.0 * WATERMARK_OPACITY
+			if alpha == 0 {
+				continue
+			}
+			c := canvas.RGBAAt(x, y)
+			c.R = uint8(float64(c.R)*(1-alpha) + gray*alpha)
+			c.G = uint8(float64(c.G)*(1-alpha) + gray*alpha)
+			c.B = uint8(float64(c.B)*(1-alpha) + gray*alpha)
+			canvas.SetRGBA(x, y, c)
+		}
+	}
+
+	logInfo("🏷️  Added diagonal watermark \"%s\"", text)
+	return canvas, nil
+}
@@ -0,0 +1,243 @@
+package passport
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// The grid is laid out in the sheet's nominal millimeters, so the same sheet gets
+// the same geometry at every print resolution
+func TestGridLayoutGolden(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := []struct {
+		format                             string
+		columns, rows                      int
+		startX, startY, spacingX, spacingY float64
+	}{
+		{SHEET_10X15, 4, 2, 2, 4, 2, 2},
+		{SHEET_13X18, 3, 3, 10.5, 20.5, 2, 2},
+		{SHEET_4X6, 4, 2, 3.2, 4.8, 2, 2},
+		{SHEET_5X7, 3, 3, 9, 19.4, 2, 2},
+		{SHEET_8X10, 5, 5, 10.1, 10.5, 2, 2},
+		{SHEET_STRIP, 1, 4, 2, 2, 0, 2},
+	}
+	for _, dpi := range []int{300, 600} {
+		for _, want := range golden {
+			format, err := lookupPrintFormat(want.format, spec.WithDPI(dpi))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format.Columns != want.columns || format.Rows != want.rows {
+				t.Errorf("%s at %d DPI: %dx%d grid, want %dx%d", want.format, dpi, format.Columns, format.Rows, want.columns, want.rows)
+				continue
+			}
+			grid := calculateGridLayout(format)
+			got := []float64{grid.StartXMM, grid.StartYMM, grid.SpacingXMM, grid.SpacingYMM}
+			expected := []float64{want.startX, want.startY, want.spacingX, want.spacingY}
+			for i, name := range []string{"start x", "start y", "spacing x", "spacing y"} {
+				if math.Abs(got[i]-expected[i]) > 1e-9 {
+					t.Errorf("%s at %d DPI: %s %.4fmm, want %.4fmm", want.format, dpi, name, got[i], expected[i])
+				}
+			}
+			if grid.StartXMM < MIN_SPACING_MM || grid.StartYMM < MIN_SPACING_MM {
+				t.Errorf("%s at %d DPI: margin (%.3f,%.3f)mm below the minimum %.1fmm", want.format, dpi, grid.StartXMM, grid.StartYMM, MIN_SPACING_MM)
+			}
+		}
+	}
+}
+
+// pixelGeometry is the pixel size of the photo and sheet, and the first slot, margins
+// and gaps of the format's grid as drawn
+type pixelGeometry struct {
+	photo, sheet, slot image.Point
+	margin, spacing    image.Point
+}
+
+func measurePixelGeometry(spec PhotoSpec, format PrintFormat) pixelGeometry {
+	grid := calculateGridLayout(format)
+	first, next := grid.PhotoRect(0, 0), grid.PhotoRect(1, 1)
+	return pixelGeometry{
+		photo:   image.Pt(spec.WidthPX, spec.HeightPX),
+		sheet:   image.Pt(format.WidthPX, format.HeightPX),
+		slot:    first.Size(),
+		margin:  first.Min,
+		spacing: next.Min.Sub(first.Max),
+	}
+}
+
+// The pixel geometry at 300 and 600 DPI. The photo is exactly twice the size; the
+// sheet and margins are their millimeters at the resolution rounded once, so at most
+// a pixel off twice the 300 DPI value, and slots and gaps lie between edges rounded
+// on their own, so less than a pixel off their millimeters.
+func TestPixelGeometryGolden(t *testing.T) {
+	base, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := map[int]pixelGeometry{
+		// 10x15 holds 4x2 photos in landscape
+		300: {photo: image.Pt(413, 531), sheet: image.Pt(1772, 1181), slot: image.Pt(413, 532), margin: image.Pt(24, 47), spacing: image.Pt(24, 23)},
+		600: {photo: image.Pt(826, 1062), sheet: image.Pt(3543, 2362), slot: image.Pt(827, 1063), margin: image.Pt(47, 94), spacing: image.Pt(47, 48)},
+	}
+	for dpi, want := range golden {
+		spec := base.WithDPI(dpi)
+		format, err := lookupPrintFormat(SHEET_10X15, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := measurePixelGeometry(spec, format); got != want {
+			t.Errorf("10x15 at %d DPI: %+v, want %+v", dpi, got, want)
+		}
+	}
+
+	withinPixel := func(px int, mm float64, dpi int) bool { return math.Abs(float64(px)-mm*float64(dpi)/25.4) < 1 }
+	for _, key := range []string{SHEET_10X15, SHEET_13X18, SHEET_4X6, SHEET_5X7, SHEET_8X10, SHEET_STRIP} {
+		var at [2]pixelGeometry
+		for i, dpi := range []int{300, 600} {
+			spec := base.WithDPI(dpi)
+			format, err := lookupPrintFormat(key, spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at[i] = measurePixelGeometry(spec, format)
+			grid := calculateGridLayout(format)
+			if !withinPixel(at[i].slot.X, grid.PhotoWidthMM, dpi) || !withinPixel(at[i].slot.Y, grid.PhotoHeightMM, dpi) {
+				t.Errorf("%s at %d DPI: slot %v for a %.1fx%.1fmm photo", key, dpi, at[i].slot, grid.PhotoWidthMM, grid.PhotoHeightMM)
+			}
+			if (format.Columns > 1 && !withinPixel(at[i].spacing.X, grid.SpacingXMM, dpi)) || !withinPixel(at[i].spacing.Y, grid.SpacingYMM, dpi) {
+				t.Errorf("%s at %d DPI: gaps %v for %.1fx%.1fmm", key, dpi, at[i].spacing, grid.SpacingXMM, grid.SpacingYMM)
+			}
+		}
+		if at[1].photo != at[0].photo.Mul(2) {
+			t.Errorf("%s: photo %v at 600 DPI, %v at 300 DPI", key, at[1].photo, at[0].photo)
+		}
+		for name, pair := range map[string][2]image.Point{
+			"sheet":  {at[0].sheet, at[1].sheet},
+			"margin": {at[0].margin, at[1].margin},
+		} {
+			doubled := pair[0].Mul(2)
+			if math.Abs(float64(pair[1].X-doubled.X)) > 1 || math.Abs(float64(pair[1].Y-doubled.Y)) > 1 {
+				t.Errorf("%s: %s %v at 600 DPI, %v at 300 DPI", key, name, pair[1], pair[0])
+			}
+		}
+	}
+}
+
+// The rendered photo and sheet have the pixel size of their resolution
+func TestGenerateAtDPI(t *testing.T) {
+	for dpi, want := range map[int][2]image.Point{
+		300: {image.Pt(413, 531), image.Pt(1772, 1181)},
+		600: {image.Pt(826, 1062), image.Pt(3543, 2362)},
+	} {
+		result, err := Generate(syntheticPhoto(2400, 3200), WithStrategy(STRATEGY_CENTER), WithDPI(dpi), WithSheet(SHEET_10X15))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.Photo.Bounds().Size(); got != want[0] {
+			t.Errorf("%d DPI: photo %v, want %v", dpi, got, want[0])
+		}
+		if got := result.Sheets[0].Image.Bounds().Size(); got != want[1] {
+			t.Errorf("%d DPI: sheet %v, want %v", dpi, got, want[1])
+		}
+	}
+}
+
+// Drawing rounds every edge of the millimeter layout to the nearest pixel on its own
+func TestGridPhotoRectsRoundEachEdge(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dpi := range []int{300, 600} {
+		format, err := lookupPrintFormat(SHEET_10X15, spec.WithDPI(dpi))
+		if err != nil {
+			t.Fatal(err)
+		}
+		grid := calculateGridLayout(format)
+		pxPerMM := float64(dpi) / 25.4
+		for row := 0; row < format.Rows; row++ {
+			for col := 0; col < format.Columns; col++ {
+				rect := grid.PhotoRect(col, row)
+				left, right := grid.ColumnMM(col)
+				top, bottom := grid.RowMM(row)
+				edges := [][2]float64{
+					{float64(rect.Min.X), left * pxPerMM}, {float64(rect.Max.X), right * pxPerMM},
+					{float64(rect.Min.Y), top * pxPerMM}, {float64(rect.Max.Y), bottom * pxPerMM},
+				}
+				for _, edge := range edges {
+					if math.Abs(edge[0]-edge[1]) > 0.5 {
+						t.Errorf("%d DPI, cell (%d,%d): edge at %.0fpx, layout at %.2fpx", dpi, col, row, edge[0], edge[1])
+					}
+				}
+				if rect.Max.X > format.WidthPX || rect.Max.Y > format.HeightPX {
+					t.Errorf("%d DPI, cell (%d,%d): %v outside the %dx%d sheet", dpi, col, row, rect, format.WidthPX, format.HeightPX)
+				}
+			}
+		}
+	}
+}
+
+func TestDistributeAxis(t *testing.T) {
+	tests := []struct {
+		name                  string
+		sheet, photo          float64
+		count                 int
+		wantMargin, wantSpace float64
+	}{
+		{"single photo centered", 39, 35, 1, 2, 0},
+		{"minimum spacing, rest to the margins", 150, 35, 4, 2, 2},
+		{"tight sheet spreads the spacing", 149, 35, 4, 1.125, 2.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			margin, spacing := distributeAxis(tt.sheet, tt.photo, tt.count, MIN_SPACING_MM)
+			if math.Abs(margin-tt.wantMargin) > 1e-9 || math.Abs(spacing-tt.wantSpace) > 1e-9 {
+				t.Errorf("distributeAxis(%g, %g, %d) = %g, %g, want %g, %g", tt.sheet, tt.photo, tt.count, margin, spacing, tt.wantMargin, tt.wantSpace)
+			}
+		})
+	}
+}
+
+// Guillotine cutters cut whole rows and columns: every photo of a row must share its
+// top and bottom edge and every photo of a column its left and right edge, for every
+// spec, format and photo count, with the leftover space split evenly between the
+// outer margins
+func TestGridRowsAndColumnsAligned(t *testing.T) {
+	for _, specKey := range photoSpecKeys() {
+		spec, err := lookupPhotoSpec(specKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formats := append(getPredefinedFormats(spec), createStripFormat(spec))
+		for _, full := range formats {
+			for count := 1; count <= full.PhotosPerSheet; count++ {
+				format := withPhotoCount(full, count)
+				grid := calculateGridLayout(format)
+				slots := gridSlots(grid, format)
+				if len(slots) != count {
+					t.Errorf("%s on %s, %d photos: %d slots placed", specKey, format.Key, count, len(slots))
+					continue
+				}
+				for i, slot := range slots {
+					row, col := i/format.Columns, i%format.Columns
+					if first := slots[row*format.Columns]; slot.Min.Y != first.Min.Y || slot.Max.Y != first.Max.Y {
+						t.Errorf("%s on %s, %d photos: photo %d spans y %d-%d, its row %d-%d", specKey, format.Key, count, i+1, slot.Min.Y, slot.Max.Y, first.Min.Y, first.Max.Y)
+					}
+					if top := slots[col]; slot.Min.X != top.Min.X || slot.Max.X != top.Max.X {
+						t.Errorf("%s on %s, %d photos: photo %d spans x %d-%d, its column %d-%d", specKey, format.Key, count, i+1, slot.Min.X, slot.Max.X, top.Min.X, top.Max.X)
+					}
+				}
+				_, right := grid.ColumnMM(format.Columns - 1)
+				_, bottom := grid.RowMM(format.Rows - 1)
+				if math.Abs(format.WidthMM-right-grid.StartXMM) > 1e-9 || math.Abs(format.HeightMM-bottom-grid.StartYMM) > 1e-9 {
+					t.Errorf("%s on %s, %d photos: margins left/right %.3f/%.3fmm, top/bottom %.3f/%.3fmm differ", specKey, format.Key, count,
+						grid.StartXMM, format.WidthMM-right, grid.StartYMM, format.HeightMM-bottom)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package passport
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// -auto-levels brings the median luminance of the face (0-1) to this value
+	AUTO_LEVELS_TARGET = 0.55
+
+	// Faces whose median is this close to the target are left alone
+	AUTO_LEVELS_TOLERANCE = 0.02
+
+	// Limits of the adjustment, so a correctly exposed photo can't be wrecked: the
+	// gain may change the brightness by at most ±25%, the gamma bends midtones only
+	// within 0.8-1.25
+	AUTO_LEVELS_MAX_GAIN_CHANGE = 0.25
+	AUTO_LEVELS_MIN_GAMMA       = 0.8
+	AUTO_LEVELS_MAX_GAMMA       = 1.25
+
+	// Highlight protection: a brightening gain never pushes this percentile of the
+	// photo's luminance past white, the gamma does the rest without clipping
+	AUTO_LEVELS_HIGHLIGHT_PERCENTILE = 0.995
+)
+
+// LevelsAdjustment is the tone curve of -auto-levels, out = (in × Gain)^Gamma per channel
+type LevelsAdjustment struct {
+	FaceMedian float64 // Median face luminance before (0-1)
+	Result     float64 // Expected median face luminance after (0-1)
+	Gain       float64
+	Gamma      float64
+	Applied    bool // False when the face was already near AUTO_LEVELS_TARGET
+}
+
+// planAutoLevels computes the curve that moves the face median toward target,
+// within the gain and gamma limits. highlight is the AUTO_LEVELS_HIGHLIGHT_PERCENTILE
+// luminance of the whole photo.
+func planAutoLevels(faceMedian, highlight, target float64) LevelsAdjustment {
+	levels := LevelsAdjustment{FaceMedian: faceMedian, Result: faceMedian, Gain: 1, Gamma: 1}
+	if faceMedian <= 0 || faceMedian >= 1 || math.Abs(faceMedian-target) <= AUTO_LEVELS_TOLERANCE {
+		return levels
+	}
+
+	// Linear gain first; brightening stops where the highlights would clip
+	gain := target / faceMedian
+	if gain > 1 {
+		gain = math.Min(gain, 1+AUTO_LEVELS_MAX_GAIN_CHANGE)
+		if highlight > 0 {
+			gain = math.Max(1, math.Min(gain, 1/highlight))
+		}
+	} else {
+		gain = math.Max(gain, 1-AUTO_LEVELS_MAX_GAIN_CHANGE)
+	}
+
+	// Gamma for what the gain couldn't reach
+	gained := math.Min(1, faceMedian*gain)
+	gamma := 1.0
+	if gained > 0 && gained < 1 {
+		gamma = math.Max(AUTO_LEVELS_MIN_GAMMA, math.Min(AUTO_LEVELS_MAX_GAMMA, math.Log(target)/math.Log(gained)))
+	}
+
+	levels.Gain, levels.Gamma, levels.Applied = gain, gamma, true
+	levels.Result = math.Pow(gained, gamma)
+	return levels
+}
+
+// lookupTable returns the curve for 8-bit channel values
+func (l LevelsAdjustment) lookupTable() [256]uint8 {
+	var table [256]uint8
+	for i := range table {
+		value := math.Pow(math.Min(1, float64(i)/255*l.Gain), l.Gamma)
+		table[i] = uint8(math.Round(value * 255))
+	}
+	return table
+}
+
+// autoLevels measures the face region of the photo and applies the -auto-levels
+// curve to the whole photo, so the background gets no seam around the face. Returns
+// the photo unchanged when it is already exposed near the target.
+func autoLevels(photo image.Image, face image.Rectangle) (image.Image, LevelsAdjustment) {
+	bounds := photo.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	face = face.Intersect(image.Rect(0, 0, width, height))
+	if face.Empty() {
+		face = image.Rect(0, 0, width, height)
+	}
+
+	var faceHistogram, histogram [256]int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			lum := int(math.Round((0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257))
+			histogram[lum]++
+			if image.Pt(x, y).In(face) {
+				faceHistogram[lum]++
+			}
+		}
+	}
+	faceMedian := histogramPercentile(faceHistogram, 0.5)
+	highlight := histogramPercentile(histogram, AUTO_LEVELS_HIGHLIGHT_PERCENTILE)
+
+	levels := planAutoLevels(faceMedian, highlight, AUTO_LEVELS_TARGET)
+	if !levels.Applied {
+		logInfo("💡 Face median luminance %.2f is near the target %.2f, levels unchanged", faceMedian, AUTO_LEVELS_TARGET)
+		return photo, levels
+	}
+
+	table := levels.lookupTable()
+	adjusted := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := adjusted.PixOffset(x, y)
+			adjusted.Pix[i] = table[r>>8]
+			adjusted.Pix[i+1] = table[g>>8]
+			adjusted.Pix[i+2] = table[b>>8]
+			adjusted.Pix[i+3] = 255
+		}
+	}
+	logInfo("💡 Auto levels: face median luminance %.2f -> %.2f (target %.2f, gain %.2f, gamma %.2f, highlights at %.2f)",
+		levels.FaceMedian, levels.Result, AUTO_LEVELS_TARGET, levels.Gain, levels.Gamma, highlight)
+	return adjusted, levels
+}
+
+// histogramPercentile returns the luminance (0-1) below which the fraction p of an
+// 8-bit histogram's pixels lie
+func histogramPercentile(histogram [256]int, p float64) float64 {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	limit := int(math.Ceil(float64(total) * p))
+	seen := 0
+	for value, count := range histogram {
+		seen += count
+		if seen >= limit && seen > 0 {
+			return float64(value) / 255
+		}
+	}
+	return 1
+}
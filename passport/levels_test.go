@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestPlanAutoLevels(t *testing.T) {
+	tests := []struct {
+		name        string
+		median      float64
+		highlight   float64
+		wantApplied bool
+		wantResult  float64 // Expected median after; 0 when the limits keep it from the target
+	}{
+		{"at the target", 0.56, 0.9, false, 0.56},
+		{"slightly dark", 0.47, 0.8, true, AUTO_LEVELS_TARGET},
+		{"slightly bright", 0.65, 1, true, AUTO_LEVELS_TARGET},
+		{"highlights at white, gamma only", 0.5, 1, true, AUTO_LEVELS_TARGET},
+		{"far too dark", 0.15, 0.5, true, 0},
+		{"far too bright", 0.95, 1, true, 0},
+		{"black", 0, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := planAutoLevels(tt.median, tt.highlight, AUTO_LEVELS_TARGET)
+			if levels.Applied != tt.wantApplied {
+				t.Fatalf("applied %v, want %v", levels.Applied, tt.wantApplied)
+			}
+			if math.Abs(levels.Gain-1) > AUTO_LEVELS_MAX_GAIN_CHANGE+1e-9 || levels.Gamma < AUTO_LEVELS_MIN_GAMMA || levels.Gamma > AUTO_LEVELS_MAX_GAMMA {
+				t.Errorf("gain %.3f, gamma %.3f outside the limits", levels.Gain, levels.Gamma)
+			}
+			// Highlight protection: brightening never clips the highlights
+			if levels.Gain > 1 && tt.highlight*levels.Gain > 1+1e-9 {
+				t.Errorf("gain %.3f clips highlights at %.2f", levels.Gain, tt.highlight)
+			}
+			if tt.wantResult > 0 && math.Abs(levels.Result-tt.wantResult) > 1e-6 {
+				t.Errorf("median %.3f after, want %.3f", levels.Result, tt.wantResult)
+			}
+			if tt.wantResult == 0 && levels.Applied && math.Abs(levels.Result-AUTO_LEVELS_TARGET) >= math.Abs(tt.median-AUTO_LEVELS_TARGET) {
+				t.Errorf("median %.3f after, no closer to the target than %.3f", levels.Result, tt.median)
+			}
+		})
+	}
+}
+
+// darkenedPortrait is the hair test face scaled to darkness (0-1) of its exposure;
+// the face is 0.72 luminance at full exposure
+func darkenedPortrait(exposure float64) *image.RGBA {
+	img := hairTestPortrait(false)
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(math.Round(float64(img.Pix[i+c]) * exposure))
+		}
+	}
+	return img
+}
+
+// Inside the face oval of the hair test portrait
+var levelsTestFace = image.Rect(hairTestFaceX-40, hairTestFaceY-40, hairTestFaceX+40, hairTestFaceY+40)
+
+// faceMedianLuminance measures the median luminance of the test face
+func faceMedianLuminance(img image.Image) float64 {
+	var histogram [256]int
+	for y := levelsTestFace.Min.Y; y < levelsTestFace.Max.Y; y++ {
+		for x := levelsTestFace.Min.X; x < levelsTestFace.Max.X; x++ {
+			c := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			histogram[c.Y]++
+		}
+	}
+	return histogramPercentile(histogram, 0.5)
+}
+
+// A darkened photo is brought to the target, applied to the whole photo alike; one
+// exposed correctly is left alone
+func TestAutoLevelsOnDarkenedPortrait(t *testing.T) {
+	// At 0.53 the gain is capped and the gamma brings the face the rest of the way
+	for _, exposure := range []float64{0.53, 0.62, 0.68, 0.85} {
+		dark := darkenedPortrait(exposure)
+		adjusted, levels := autoLevels(dark, levelsTestFace)
+		if !levels.Applied {
+			t.Fatalf("exposure %.2f: levels not applied to a face median of %.2f", exposure, levels.FaceMedian)
+		}
+		if got := faceMedianLuminance(adjusted); math.Abs(got-AUTO_LEVELS_TARGET) > AUTO_LEVELS_TOLERANCE {
+			t.Errorf("exposure %.2f: face median %.3f -> %.3f, want %.2f", exposure, faceMedianLuminance(dark), got, AUTO_LEVELS_TARGET)
+		}
+
+		// The background gets the same curve as the face: no seam
+		table := levels.lookupTable()
+		for _, p := range []image.Point{{10, 10}, {hairTestFaceX, hairTestFaceY}} {
+			before, after := dark.RGBAAt(p.X, p.Y), adjusted.(*image.RGBA).RGBAAt(p.X, p.Y)
+			if want := (color.RGBA{table[before.R], table[before.G], table[before.B], 255}); after != want {
+				t.Errorf("exposure %.2f: pixel %v went %v -> %v, the curve gives %v", exposure, p, before, after, want)
+			}
+		}
+	}
+
+	exposed := darkenedPortrait(AUTO_LEVELS_TARGET / 0.72)
+	if adjusted, levels := autoLevels(exposed, levelsTestFace); levels.Applied || adjusted != image.Image(exposed) {
+		t.Errorf("correctly exposed face at %.3f was adjusted", levels.FaceMedian)
+	}
+}
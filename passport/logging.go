@@ -0,0 +1,100 @@
+package passport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats accepted by -log-format
+const (
+	LOG_FORMAT_TEXT = "text" // The console messages as they are (default)
+	LOG_FORMAT_JSON = "json" // One JSON object per message on stderr, for log collectors
+)
+
+var logFormats = []string{LOG_FORMAT_TEXT, LOG_FORMAT_JSON}
+
+// logLevels are the values accepted by -log-level
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// logger receives every diagnostic message of the pipeline; results (saved files,
+// the summary) and prompts are printed directly. Until setupLogging runs, e.g. for
+// Generate, it prints info and above to stdout like the command line tool does.
+var logger = slog.New(&consoleHandler{level: slog.LevelInfo})
+
+// logJSON is set when messages go to the JSON handler, which gets them without
+// the blank lines that separate sections on the console
+var logJSON bool
+
+// setupLogging selects the log format and level. Text logs stay on stdout at the
+// info and debug levels; at warn and error ("quiet") they move to stderr so stdout
+// carries only the results. -verbose lowers the level to debug.
+func setupLogging(format, levelName string, verbose bool) error {
+	level, ok := logLevels[strings.ToLower(levelName)]
+	if !ok {
+		return fmt.Errorf("invalid log level '%s' (available: debug, info, warn, error)", levelName)
+	}
+	if verbose && level > slog.LevelDebug {
+		level = slog.LevelDebug
+	}
+
+	switch format {
+	case LOG_FORMAT_TEXT:
+		logger = slog.New(&consoleHandler{level: level, stderr: level > slog.LevelInfo})
+	case LOG_FORMAT_JSON:
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+		logJSON = true
+	default:
+		return fmt.Errorf("invalid log format '%s' (available: %s)", format, strings.Join(logFormats, ", "))
+	}
+	return nil
+}
+
+// logDebug, logInfo, logWarn and logError format a message like fmt.Printf and log it
+func logDebug(format string, args ...any) { logAt(slog.LevelDebug, format, args...) }
+func logInfo(format string, args ...any)  { logAt(slog.LevelInfo, format, args...) }
+func logWarn(format string, args ...any)  { logAt(slog.LevelWarn, format, args...) }
+func logError(format string, args ...any) { logAt(slog.LevelError, format, args...) }
+
+func logAt(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	message := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	if logJSON {
+		message = strings.TrimSpace(message)
+	}
+	logger.Log(ctx, level, message)
+}
+
+// consoleHandler prints the bare message, keeping the console output of the tool.
+// stdout is looked up on every message so the stream mode's redirect to stderr
+// (see redirectConsoleToStderr) still applies.
+type consoleHandler struct {
+	level  slog.Level
+	stderr bool
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	out := os.Stdout
+	if h.stderr {
+		out = os.Stderr
+	}
+	_, err := fmt.Fprintln(out, record.Message)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *consoleHandler) WithGroup(string) slog.Handler      { return h }
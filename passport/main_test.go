@@ -0,0 +1,70 @@
+package passport
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// Set in the environment of a re-executed test binary to run the command line tool
+// with these arguments (separated by newlines) instead of the tests
+const cliArgsEnv = "PASSPORT_TEST_CLI_ARGS"
+
+// The sample portrait at the repository root, see TestMain
+const sampleImagePath = "sample-image.jpg"
+
+// TestMain runs the tests from the repository root, where the command line tool
+// finds the facefinder and puploc cascades, and doubles as the command line tool
+// for runCLI
+func TestMain(m *testing.M) {
+	// The child processes of runCLI start in the repository root already
+	if args, ok := os.LookupEnv(cliArgsEnv); ok {
+		os.Args = os.Args[:1]
+		if args != "" {
+			os.Args = append(os.Args, strings.Split(args, "\n")...)
+		}
+		Main()
+		os.Exit(0)
+	}
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	// Keep the pipeline's progress messages out of the test output
+	if err := setupLogging(LOG_FORMAT_TEXT, "error", false); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the command line tool with args in a child process, since it parses
+// the global flags and exits on errors. stdin nil reads from /dev/null. Returns the
+// standard output, the standard error and the exit code.
+func runCLI(t *testing.T, stdin []byte, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), cliArgsEnv+"="+strings.Join(args, "\n"))
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running the command line tool: %v", err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// requireCascade skips tests that need face detection when the facefinder cascade
+// isn't installed
+func requireCascade(t testing.TB) {
+	t.Helper()
+	if _, err := os.Stat(FACE_CASCADE_PATH); err != nil {
+		t.Skipf("face cascade not available: %v", err)
+	}
+}
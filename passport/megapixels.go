@@ -0,0 +1,35 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// -max-megapixels below this would leave too few pixels for a sharp photo
+const MIN_MAX_MEGAPIXELS = 1.0
+
+// validateMaxMegapixels checks a -max-megapixels cap; 0 means no cap
+func validateMaxMegapixels(megapixels float64) error {
+	if megapixels != 0 && megapixels < MIN_MAX_MEGAPIXELS {
+		return fmt.Errorf("invalid maximum of %g megapixels (must be 0 or at least %g)", megapixels, MIN_MAX_MEGAPIXELS)
+	}
+	return nil
+}
+
+// capMegapixels box-downsamples img once to at most maxMegapixels million pixels,
+// so no later step loops over more pixels than that. Smaller images, and a cap of
+// 0, return img itself.
+func capMegapixels(img image.Image, maxMegapixels float64) image.Image {
+	bounds := img.Bounds()
+	megapixels := float64(bounds.Dx()*bounds.Dy()) / 1e6
+	if maxMegapixels <= 0 || megapixels <= maxMegapixels {
+		return img
+	}
+	scale := math.Sqrt(maxMegapixels / megapixels)
+	width := max(1, int(float64(bounds.Dx())*scale))
+	height := max(1, int(float64(bounds.Dy())*scale))
+	logInfo("📉 Downscaled the %dx%d image (%.1f MP) to %dx%d (%.1f MP) to stay within the %g MP limit",
+		bounds.Dx(), bounds.Dy(), megapixels, width, height, float64(width*height)/1e6, maxMegapixels)
+	return boxDownsample(img, width, height)
+}
@@ -0,0 +1,136 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Metadata modes accepted by -metadata
+const (
+	METADATA_DPI  = "dpi"  // JFIF header with the print resolution only (default)
+	METADATA_NONE = "none" // No metadata segments at all
+)
+
+var metadataModes = []string{METADATA_DPI, METADATA_NONE}
+
+// Modes accepted by -strip-metadata: which outputs are sanitized
+const (
+	STRIP_METADATA_PHOTO = "photo" // The single photo, which gets uploaded to portals (default)
+	STRIP_METADATA_ALL   = "all"   // The single photo and the print sheets
+	STRIP_METADATA_NONE  = "none"  // Nothing
+)
+
+var stripMetadataModes = []string{STRIP_METADATA_PHOTO, STRIP_METADATA_ALL, STRIP_METADATA_NONE}
+
+// Signature of a Photoshop image resource block (APP13)
+const photoshopIdentifier = "Photoshop 3.0\x00"
+
+// validateMetadataMode checks a -metadata value
+func validateMetadataMode(mode string) error {
+	for _, m := range metadataModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid metadata mode '%s' (available: %s)", mode, strings.Join(metadataModes, ", "))
+}
+
+// validateStripMetadataMode checks a -strip-metadata value
+func validateStripMetadataMode(mode string) error {
+	for _, m := range stripMetadataModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid strip metadata mode '%s' (available: %s)", mode, strings.Join(stripMetadataModes, ", "))
+}
+
+// stripJPEGMetadata removes every application segment (EXIF, XMP, ICC, Photoshop,
+// maker notes, ...) and comment from an encoded JPEG, leaving only what decoding
+// needs: the Adobe APP14 segment is kept since it tells decoders the color transform.
+// The JFIF density and an ICC profile the caller wants are added back afterwards.
+func stripJPEGMetadata(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	result := make([]byte, 0, len(data))
+	result = append(result, data[:2]...)
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // start of scan / end of image: no more metadata
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		isMetadata := (marker >= 0xE0 && marker <= 0xEF) || marker == 0xFE
+		if marker == 0xEE && bytes.HasPrefix(data[pos+4:end], []byte("Adobe")) {
+			isMetadata = false
+		}
+		if !isMetadata {
+			result = append(result, data[pos:end]...)
+		}
+		pos = end
+	}
+	return append(result, data[pos:]...)
+}
+
+// addJFIFDensity inserts a JFIF APP0 segment declaring the print resolution right after
+// the SOI marker of an encoded JPEG. The stdlib encoder writes no metadata at all, so the
+// result carries nothing from the source file (no camera EXIF, no GPS).
+func addJFIFDensity(data []byte, dpi int) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xE0})
+	binary.Write(&segment, binary.BigEndian, uint16(16)) // segment length incl. these two bytes
+	segment.WriteString("JFIF\x00")
+	segment.Write([]byte{1, 1}) // version 1.01
+	segment.WriteByte(1)        // density units: dots per inch
+	binary.Write(&segment, binary.BigEndian, uint16(dpi))
+	binary.Write(&segment, binary.BigEndian, uint16(dpi))
+	segment.Write([]byte{0, 0}) // no thumbnail
+
+	result := make([]byte, 0, len(data)+segment.Len())
+	result = append(result, data[:2]...)
+	result = append(result, segment.Bytes()...)
+	return append(result, data[2:]...)
+}
+
+// addPhotoshopResolution inserts a Photoshop APP13 segment with a ResolutionInfo
+// resource right after the SOI marker. CMYK JPEGs can't carry a JFIF header, and
+// this is where prepress software reads their resolution from.
+func addPhotoshopResolution(data []byte, dpi int) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+
+	var resolution bytes.Buffer
+	for i := 0; i < 2; i++ { // horizontal, then vertical
+		binary.Write(&resolution, binary.BigEndian, uint32(dpi<<16)) // 16.16 fixed point
+		binary.Write(&resolution, binary.BigEndian, uint16(1))       // unit: pixels per inch
+		binary.Write(&resolution, binary.BigEndian, uint16(1))       // display unit: inches
+	}
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xED})
+	binary.Write(&segment, binary.BigEndian, uint16(2+len(photoshopIdentifier)+12+resolution.Len()))
+	segment.WriteString(photoshopIdentifier)
+	segment.WriteString("8BIM")
+	binary.Write(&segment, binary.BigEndian, uint16(0x03ED)) // ResolutionInfo
+	segment.Write([]byte{0, 0})                              // empty name, padded to even length
+	binary.Write(&segment, binary.BigEndian, uint32(resolution.Len()))
+	segment.Write(resolution.Bytes())
+
+	result := make([]byte, 0, len(data)+segment.Len())
+	result = append(result, data[:2]...)
+	result = append(result, segment.Bytes()...)
+	return append(result, data[2:]...)
+}
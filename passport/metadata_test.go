@@ -0,0 +1,263 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// jpegSegment is a marker segment of an encoded JPEG before the image data
+type jpegSegment struct {
+	marker  byte
+	payload []byte
+}
+
+// jpegSegments returns the marker segments of data up to the start of scan
+func jpegSegments(t *testing.T, data []byte) []jpegSegment {
+	t.Helper()
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		t.Fatal("not a JPEG")
+	}
+	var segments []jpegSegment
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] != 0xDA; {
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			t.Fatalf("segment %#x at %d runs past the end", data[pos+1], pos)
+		}
+		segments = append(segments, jpegSegment{data[pos+1], data[pos+4 : end]})
+		pos = end
+	}
+	return segments
+}
+
+// exifWithGPS returns an APP1 EXIF segment whose IFD0 points to a GPS IFD holding a
+// latitude reference, like a phone camera writes
+func exifWithGPS() []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2A")
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // IFD0 follows the header
+	// IFD0: one GPSInfo entry pointing to the GPS IFD right after it
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8825, 4}) // GPSInfo, LONG
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 26})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	// GPS IFD: GPSLatitudeRef "N"
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0001, 2}) // GPSLatitudeRef, ASCII
+	binary.Write(&tiff, binary.BigEndian, uint32(2))
+	tiff.WriteString("N\x00\x00\x00")
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xE1})
+	binary.Write(&segment, binary.BigEndian, uint16(2+6+tiff.Len()))
+	segment.WriteString("Exif\x00\x00")
+	segment.Write(tiff.Bytes())
+	return segment.Bytes()
+}
+
+// insertAfterSOI inserts segment right after the SOI marker of a JPEG
+func insertAfterSOI(data, segment []byte) []byte {
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// A camera photo with GPS EXIF goes in, and neither the photo nor the sheet carries
+// any EXIF: with the default -metadata dpi the only application segment is the JFIF
+// header with the print resolution
+func TestOutputsCarryNoSourceEXIF(t *testing.T) {
+	requireCascade(t)
+	sample, err := os.ReadFile(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "camera.jpg")
+	if err := os.WriteFile(input, insertAfterSOI(sample, exifWithGPS()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(mustReadFile(t, input), []byte("Exif\x00\x00")) {
+		t.Fatal("fixture lacks its EXIF segment")
+	}
+
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	format, err := lookupPrintFormat(SHEET_10X15, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, strip := range []string{STRIP_METADATA_PHOTO, STRIP_METADATA_NONE} {
+		outdir := filepath.Join(dir, strip)
+		_, stderr, code := runCLI(t, nil, "-strip-metadata", strip, "-save-photo", "-outdir", outdir, input, SHEET_10X15)
+		if code != 0 {
+			t.Fatalf("-strip-metadata %s: exited with %d:\n%s", strip, code, stderr)
+		}
+		for _, path := range []string{buildOutputPath(input, outdir, "", DEFAULT_SPEC_KEY, format), buildPhotoOutputPath(input, outdir)} {
+			data := mustReadFile(t, path)
+			if bytes.Contains(data, []byte("Exif")) {
+				t.Errorf("-strip-metadata %s: %s carries EXIF", strip, filepath.Base(path))
+			}
+			var app []byte
+			for _, segment := range jpegSegments(t, data) {
+				if segment.marker >= 0xE0 && segment.marker <= 0xEF {
+					app = append(app, segment.marker)
+				}
+			}
+			if !bytes.Equal(app, []byte{0xE0}) {
+				t.Errorf("-strip-metadata %s: %s has application segments %x, want only the JFIF APP0", strip, filepath.Base(path), app)
+			}
+		}
+	}
+}
+
+func TestEncodeImageMetadata(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	tests := []struct {
+		name    string
+		opts    SaveOptions
+		wantDPI int // JFIF density, 0 for no JFIF segment
+		wantCOM bool
+	}{
+		{"dpi", SaveOptions{Metadata: METADATA_DPI, DPI: 600}, 600, true},
+		{"dpi default resolution", SaveOptions{Metadata: METADATA_DPI}, DPI, true},
+		{"dpi stripped", SaveOptions{Metadata: METADATA_DPI, DPI: 300, Strip: true}, 300, false},
+		{"none", SaveOptions{Metadata: METADATA_NONE}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeImage(img, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dpi int
+			var comment bool
+			for _, segment := range jpegSegments(t, data) {
+				switch {
+				case segment.marker == 0xE0 && bytes.HasPrefix(segment.payload, []byte("JFIF\x00")):
+					if segment.payload[7] != 1 {
+						t.Errorf("JFIF density unit %d, want dots per inch", segment.payload[7])
+					}
+					dpi = int(binary.BigEndian.Uint16(segment.payload[8:]))
+				case segment.marker == 0xFE:
+					comment = true
+				case segment.marker >= 0xE1 && segment.marker <= 0xEF:
+					t.Errorf("unexpected application segment %#x", segment.marker)
+				}
+			}
+			if dpi != tt.wantDPI || comment != tt.wantCOM {
+				t.Errorf("JFIF density %d, comment %v; want %d, %v", dpi, comment, tt.wantDPI, tt.wantCOM)
+			}
+		})
+	}
+}
+
+// Stripping drops EXIF, XMP and comments but keeps the Adobe segment decoders need
+func TestStripJPEGMetadata(t *testing.T) {
+	encoded, err := encodeImage(image.NewRGBA(image.Rect(0, 0, 16, 16)), SaveOptions{Metadata: METADATA_NONE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adobe := []byte{0xFF, 0xEE, 0, 14, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 1}
+	xmp := append([]byte{0xFF, 0xE1, 0, 31}, "http://ns.adobe.com/xap/1.0/\x00"...)
+	data := addJPEGComment(insertAfterSOI(insertAfterSOI(insertAfterSOI(encoded, adobe), xmp), exifWithGPS()), "camera")
+
+	var markers []byte
+	for _, segment := range jpegSegments(t, stripJPEGMetadata(data)) {
+		if segment.marker >= 0xE0 && segment.marker <= 0xEF || segment.marker == 0xFE {
+			markers = append(markers, segment.marker)
+		}
+	}
+	if !bytes.Equal(markers, []byte{0xEE}) {
+		t.Errorf("metadata segments %x after stripping, want only the Adobe APP14", markers)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripJPEGMetadata(data))); err != nil {
+		t.Errorf("stripped JPEG doesn't decode: %v", err)
+	}
+}
+
+// Each -strip-metadata mode sanitizes exactly its outputs: a stripped file holds
+// only the JFIF header, no comment and no EXIF from the camera photo, and the crop
+// report says which outputs were stripped
+func TestStripMetadataModes(t *testing.T) {
+	requireCascade(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "camera.jpg")
+	if err := os.WriteFile(input, insertAfterSOI(mustReadFile(t, sampleImagePath), exifWithGPS()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	format, err := lookupPrintFormat(SHEET_10X15, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mode string
+		want metadataStripped
+	}{
+		{STRIP_METADATA_PHOTO, metadataStripped{Photo: true}},
+		{STRIP_METADATA_ALL, metadataStripped{Sheet: true, Photo: true}},
+		{STRIP_METADATA_NONE, metadataStripped{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			outdir := filepath.Join(dir, tt.mode)
+			_, stderr, code := runCLI(t, nil, "-strip-metadata", tt.mode, "-save-photo", "-crop-report", "-outdir", outdir, input, SHEET_10X15)
+			if code != 0 {
+				t.Fatalf("exited with %d:\n%s", code, stderr)
+			}
+			var report cropReport
+			if err := json.Unmarshal(mustReadFile(t, filepath.Join(outdir, "camera_crop.json")), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Stripped != tt.want {
+				t.Errorf("report says %+v stripped, want %+v", report.Stripped, tt.want)
+			}
+
+			outputs := map[string]bool{
+				buildOutputPath(input, outdir, "", DEFAULT_SPEC_KEY, format): tt.want.Sheet,
+				buildPhotoOutputPath(input, outdir):                          tt.want.Photo,
+			}
+			for path, stripped := range outputs {
+				var markers []byte
+				for _, segment := range jpegSegments(t, mustReadFile(t, path)) {
+					if segment.marker >= 0xE0 && segment.marker <= 0xEF || segment.marker == 0xFE {
+						markers = append(markers, segment.marker)
+					}
+				}
+				if stripped && !bytes.Equal(markers, []byte{0xE0}) {
+					t.Errorf("%s has metadata segments %x, want only the JFIF APP0", filepath.Base(path), markers)
+				}
+				if !stripped && !bytes.Contains(markers, []byte{0xFE}) {
+					t.Errorf("%s has metadata segments %x, want the resolution comment too", filepath.Base(path), markers)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateStripMetadataMode(t *testing.T) {
+	for _, mode := range stripMetadataModes {
+		if err := validateStripMetadataMode(mode); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"", "sheet", "All"} {
+		if err := validateStripMetadataMode(mode); err == nil {
+			t.Errorf("%q accepted", mode)
+		}
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,42 @@
+package passport
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// isMirroredOrientation reports whether an EXIF orientation flips the image left to
+// right (2, 4, 5 and 7), as some phones tag front camera shots
+func isMirroredOrientation(orientation int) bool {
+	return orientation == 2 || orientation == 4 || orientation == 5 || orientation == 7
+}
+
+// isFrontCamera reports whether the EXIF lens model names a front camera, e.g.
+// "iPhone 12 front camera 2.71mm f/2.2"
+func isFrontCamera(data []byte) bool {
+	exifData, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	tag, err := exifData.Get(exif.LensModel)
+	if err != nil {
+		return false
+	}
+	lens, err := tag.StringVal()
+	if err != nil {
+		return false
+	}
+	lens = strings.ToLower(lens)
+	return strings.Contains(lens, "front") || strings.Contains(lens, "selfie")
+}
+
+// warnMirroredSelfie warns when a front camera shot is stored with a mirroring
+// orientation: the decoded photo then shows the mirror view, which some online
+// forms reject
+func warnMirroredSelfie(data []byte, orientation int) {
+	if isMirroredOrientation(orientation) && isFrontCamera(data) {
+		logWarn("⚠️  Front camera photo stored mirrored (EXIF orientation %d) - use -mirror to flip it to the true view", orientation)
+	}
+}
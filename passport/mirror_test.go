@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// Flipping twice gives back the original, also for odd widths and images whose
+// bounds don't start at the origin
+func TestFlipImageHorizontalIsInvolution(t *testing.T) {
+	for _, bounds := range []image.Rectangle{image.Rect(0, 0, 7, 5), image.Rect(-3, 2, 6, 9)} {
+		img := coordinateImage(bounds)
+		flipped := toRGBA(flipImageHorizontal(img))
+		twice := toRGBA(flipImageHorizontal(flipped))
+		original := toRGBA(img)
+		if !bytes.Equal(twice.Pix, original.Pix) || twice.Bounds() != original.Bounds() {
+			t.Errorf("%v: flipping twice changed the image", bounds)
+		}
+		if bytes.Equal(flipped.Pix, original.Pix) {
+			t.Errorf("%v: flipping once left the image as it was", bounds)
+		}
+		w := bounds.Dx()
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < w; x++ {
+				if flipped.RGBAAt(x, y) != original.RGBAAt(w-1-x, y) {
+					t.Fatalf("%v: pixel (%d,%d) isn't the mirror of (%d,%d)", bounds, x, y, w-1-x, y)
+				}
+			}
+		}
+	}
+}
+
+// -mirror flips only the finished photo: the crop is the same and so is the photo,
+// mirrored
+func TestGenerateWithMirror(t *testing.T) {
+	img := syntheticPhoto(600, 800)
+	plain, err := Generate(img, WithStrategy(STRATEGY_CENTER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrored, err := Generate(img, WithStrategy(STRATEGY_CENTER), WithMirror())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mirrored.Crop.Rect != plain.Crop.Rect {
+		t.Errorf("mirrored crop %v, unmirrored %v", mirrored.Crop.Rect, plain.Crop.Rect)
+	}
+	if !bytes.Equal(toRGBA(mirrored.Photo).Pix, toRGBA(flipImageHorizontal(plain.Photo)).Pix) {
+		t.Error("mirrored photo isn't the unmirrored photo flipped")
+	}
+}
+
+// exifWithLensModel returns the EXIF data of a photo: an IFD0 pointing to an EXIF
+// IFD holding the lens model
+func exifWithLensModel(lens string) []byte {
+	model := append([]byte(lens), 0)
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2A")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	// IFD0: ExifIFDPointer to the EXIF IFD right after it
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8769, 4})
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 26})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	// EXIF IFD: LensModel, its string after the IFD
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0xA434, 2})
+	binary.Write(&tiff, binary.BigEndian, []uint32{uint32(len(model)), 44})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.Write(model)
+	return append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+}
+
+func TestIsFrontCamera(t *testing.T) {
+	tests := []struct {
+		lens string
+		want bool
+	}{
+		{"iPhone 12 front camera 2.71mm f/2.2", true},
+		{"Pixel 7 Selfie Camera", true},
+		{"iPhone 12 back dual wide camera 4.2mm f/1.6", false},
+	}
+	for _, tt := range tests {
+		if got := isFrontCamera(exifWithLensModel(tt.lens)); got != tt.want {
+			t.Errorf("isFrontCamera(%q) = %v, want %v", tt.lens, got, tt.want)
+		}
+	}
+	if isFrontCamera([]byte("not exif")) {
+		t.Error("data without EXIF counts as a front camera")
+	}
+}
+
+func TestIsMirroredOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		// Mirroring orientations have a determinant of -1
+		m := exifOrientationMatrices[orientation]
+		want := m[0]*m[3]-m[1]*m[2] < 0
+		if got := isMirroredOrientation(orientation); got != want {
+			t.Errorf("isMirroredOrientation(%d) = %v, want %v", orientation, got, want)
+		}
+	}
+}
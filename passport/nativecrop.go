@@ -0,0 +1,40 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+)
+
+// buildNativeCropOutputPath generates the filename of the full-resolution crop next to
+// the input file, or in outputDir when set
+func buildNativeCropOutputPath(inputPath, outputDir string) string {
+	dir, inputName := outputLocation(inputPath, outputDir)
+	return filepath.Join(dir, fmt.Sprintf("%s_native_crop.jpg", inputName))
+}
+
+// saveNativeCrop writes the crop of img at img's own resolution, before the downscale
+// to the photo size and without any of the photo adjustments, to archive the most
+// detail for reprocessing at other sizes later. Its stored DPI prints it at the
+// photo's size.
+func saveNativeCrop(img image.Image, crop CropGeometry, config Config) error {
+	native, err := cutCrop(img, crop, config.Pad)
+	if err != nil {
+		return fmt.Errorf("error cutting native resolution crop: %v", err)
+	}
+	if !isOpaque(native) {
+		native = compositeOver(native, config.AlphaColor)
+	}
+	size := native.Bounds().Size()
+
+	opts := config.PhotoSave
+	opts.DPI = int(math.Round(float64(size.X) * 25.4 / config.Spec.WidthMM))
+	path := availableOutputPath(buildNativeCropOutputPath(config.InputPath, config.OutputDir))
+	written, quality, err := saveImage(native, path, opts)
+	if err != nil {
+		return fmt.Errorf("error saving native resolution crop: %v", err)
+	}
+	fmt.Print(msg("summary.native_saved", path, size.X, size.Y, describeOutputFile(written, quality, opts)))
+	return nil
+}
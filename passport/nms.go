@@ -0,0 +1,52 @@
+package passport
+
+import (
+	"math"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// SuppressDuplicateFaces merges detections of the same face, e.g. when the upright,
+// equalized, and tilted passes all find it. Detections are visited from the most to
+// the least confident, and one is dropped when its box overlaps an already kept box
+// by more than iouThreshold. Returns the kept detections (highest score first) and
+// how many were merged away.
+func SuppressDuplicateFaces(faces []pigo.Detection, iouThreshold float64) ([]pigo.Detection, int) {
+	sorted := make([]pigo.Detection, len(faces))
+	copy(sorted, faces)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Q > sorted[j].Q })
+
+	var kept []pigo.Detection
+	for _, face := range sorted {
+		duplicate := false
+		for _, other := range kept {
+			if detectionIoU(face, other) > iouThreshold {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, face)
+		}
+	}
+	return kept, len(faces) - len(kept)
+}
+
+// detectionIoU returns the intersection over union of two square detection boxes
+// (Row/Col is the center, Scale the side length)
+func detectionIoU(a, b pigo.Detection) float64 {
+	halfA := float64(a.Scale) / 2
+	halfB := float64(b.Scale) / 2
+	overlapW := math.Min(float64(a.Col)+halfA, float64(b.Col)+halfB) - math.Max(float64(a.Col)-halfA, float64(b.Col)-halfB)
+	overlapH := math.Min(float64(a.Row)+halfA, float64(b.Row)+halfB) - math.Max(float64(a.Row)-halfA, float64(b.Row)-halfB)
+	if overlapW <= 0 || overlapH <= 0 {
+		return 0
+	}
+	intersection := overlapW * overlapH
+	union := float64(a.Scale)*float64(a.Scale) + float64(b.Scale)*float64(b.Scale) - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
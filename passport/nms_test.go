@@ -0,0 +1,113 @@
+package passport
+
+import (
+	"math"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+func detection(row, col, scale int, q float32) pigo.Detection {
+	return pigo.Detection{Row: row, Col: col, Scale: scale, Q: q}
+}
+
+func TestDetectionIoU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b pigo.Detection
+		want float64
+	}{
+		{"identical", detection(100, 100, 50, 1), detection(100, 100, 50, 2), 1},
+		{"half overlap", detection(100, 100, 40, 1), detection(100, 120, 40, 1), 800.0 / 2400},
+		{"disjoint", detection(100, 100, 40, 1), detection(100, 200, 40, 1), 0},
+		{"touching edges", detection(100, 100, 40, 1), detection(100, 140, 40, 1), 0},
+		{"nested", detection(100, 100, 100, 1), detection(100, 100, 50, 1), 2500.0 / 10000},
+		{"zero size", detection(100, 100, 0, 1), detection(100, 100, 0, 1), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectionIoU(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("detectionIoU = %.4f, want %.4f", got, tt.want)
+			}
+			if got := detectionIoU(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("detectionIoU reversed = %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuppressDuplicateFaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		faces      []pigo.Detection
+		threshold  float64
+		want       []pigo.Detection
+		wantMerged int
+	}{
+		{
+			name:       "overlapping keeps the most confident",
+			faces:      []pigo.Detection{detection(100, 100, 50, 3), detection(102, 101, 50, 8)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(102, 101, 50, 8)},
+			wantMerged: 1,
+		},
+		{
+			name:       "disjoint are all kept, best first",
+			faces:      []pigo.Detection{detection(100, 100, 50, 3), detection(100, 300, 50, 8)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(100, 300, 50, 8), detection(100, 100, 50, 3)},
+			wantMerged: 0,
+		},
+		{
+			name:       "nested above the threshold are merged",
+			faces:      []pigo.Detection{detection(100, 100, 100, 5), detection(100, 100, 60, 4)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(100, 100, 100, 5)},
+			wantMerged: 1,
+		},
+		{
+			name:       "nested below the threshold are kept",
+			faces:      []pigo.Detection{detection(100, 100, 100, 5), detection(100, 100, 40, 4)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(100, 100, 100, 5), detection(100, 100, 40, 4)},
+			wantMerged: 0,
+		},
+		{
+			name:       "equal scores keep the earlier detection",
+			faces:      []pigo.Detection{detection(100, 100, 50, 6), detection(101, 100, 50, 6), detection(100, 101, 50, 6)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(100, 100, 50, 6)},
+			wantMerged: 2,
+		},
+		{
+			name:       "merging doesn't chain through a dropped detection",
+			faces:      []pigo.Detection{detection(100, 100, 40, 9), detection(100, 125, 40, 5), detection(100, 150, 40, 1)},
+			threshold:  0.2,
+			want:       []pigo.Detection{detection(100, 100, 40, 9), detection(100, 150, 40, 1)},
+			wantMerged: 1,
+		},
+		{
+			name:      "no detections",
+			threshold: 0.2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]pigo.Detection(nil), tt.faces...)
+			got, merged := SuppressDuplicateFaces(tt.faces, tt.threshold)
+			if merged != tt.wantMerged || len(got) != len(tt.want) {
+				t.Fatalf("kept %v, merged %d; want %v, merged %d", got, merged, tt.want, tt.wantMerged)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("kept[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			for i := range input {
+				if tt.faces[i] != input[i] {
+					t.Errorf("input reordered: faces[%d] = %+v, was %+v", i, tt.faces[i], input[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+)
+
+const (
+	// Default -max-eye-occlusion: fraction (0-1) of an eye band that may be covered
+	// before the occlusion warning is given
+	DEFAULT_MAX_EYE_OCCLUSION = 0.3
+
+	// The eye band of each eye, in fractions of the face size: from the eyebrows
+	// above the eye level to just below the eye, and from beside the nose to the
+	// outer eye corner
+	OCCLUSION_BAND_ABOVE_EYES = 0.17
+	OCCLUSION_BAND_BELOW_EYES = 0.07
+	OCCLUSION_BAND_INNER      = 0.06
+	OCCLUSION_BAND_OUTER      = 0.38
+
+	// Each band is sampled on a grid this many pixels wide and high
+	OCCLUSION_SAMPLE_SIZE = 48
+
+	// A column of the band is covered when a single unbroken run of non-skin pixels
+	// spans at least this fraction of its height. Eyebrows, eyes and glasses frames
+	// are separated by skin and stay well below it; a fringe or a hand does not.
+	OCCLUSION_MIN_RUN = 0.5
+
+	// The check needs at least this fraction of skin on the cheeks; below it the
+	// skin classifier doesn't work for the photo (lighting, skin tone) and it is skipped
+	OCCLUSION_MIN_CHEEK_SKIN = 0.5
+)
+
+// OcclusionCheck is the result of looking for hair or objects covering the eyes
+type OcclusionCheck struct {
+	Bands     [2]image.Rectangle `json:"-"`         // Left and right eye band in image coordinates
+	Covered   [2]float64         `json:"covered"`   // Covered fraction of each band (0-1)
+	Threshold float64            `json:"threshold"` // Covered fraction that triggers the warning
+	Checked   bool               `json:"checked"`   // False when the bands are outside the image or too little skin was found
+	Occluded  bool               `json:"occluded"`  // Hair or an object seems to cover an eye
+}
+
+// MaxCovered returns the covered fraction of the more covered eye band
+func (c OcclusionCheck) MaxCovered() float64 {
+	return max(c.Covered[0], c.Covered[1])
+}
+
+// checkEyeOcclusion measures how much of the eye and eyebrow band of each eye is
+// covered by something that isn't skin: a column of the band counts as covered
+// when one unbroken run of non-skin pixels spans most of its height, which a fringe
+// hanging over an eye or a hand does, while eyebrows, eyes and glasses frames with
+// skin between them don't. A heuristic for a compliance warning only.
+func checkEyeOcclusion(img image.Image, face *FaceDetection, threshold float64) OcclusionCheck {
+	bounds := img.Bounds()
+	full := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	check := OcclusionCheck{Threshold: threshold}
+
+	size := float64(face.Size)
+	eyeY := face.Y - face.Size/2 + int(size*EYE_LEVEL_IN_FACE_RATIO)
+	top, bottom := eyeY-int(size*OCCLUSION_BAND_ABOVE_EYES), eyeY+int(size*OCCLUSION_BAND_BELOW_EYES)
+	inner, outer := int(size*OCCLUSION_BAND_INNER), int(size*OCCLUSION_BAND_OUTER)
+	check.Bands = [2]image.Rectangle{
+		image.Rect(face.X-outer, top, face.X-inner, bottom),
+		image.Rect(face.X+inner, top, face.X+outer, bottom),
+	}
+	for _, band := range check.Bands {
+		if !band.In(full) || band.Dx() < 2 || band.Dy() < 2 {
+			return check
+		}
+	}
+
+	// The cheeks below the eyes tell whether the skin classifier works for this photo
+	cheeks := image.Rect(face.X-outer, eyeY+int(size*0.12), face.X+outer, eyeY+int(size*0.3)).Intersect(full)
+	if cheeks.Empty() {
+		return check
+	}
+	_, _, cheekSkin := regionColorStats(img, cheeks)
+	if cheekSkin < OCCLUSION_MIN_CHEEK_SKIN {
+		return check
+	}
+
+	check.Checked = true
+	for i, band := range check.Bands {
+		check.Covered[i] = coveredFraction(img, band)
+	}
+	check.Occluded = check.MaxCovered() >= threshold
+	return check
+}
+
+// coveredFraction returns the fraction of columns of a band whose longest run of
+// non-skin pixels spans at least OCCLUSION_MIN_RUN of the band height
+func coveredFraction(img image.Image, band image.Rectangle) float64 {
+	bounds := img.Bounds()
+	covered := 0
+	for x := 0; x < OCCLUSION_SAMPLE_SIZE; x++ {
+		sx := band.Min.X + (2*x+1)*band.Dx()/(2*OCCLUSION_SAMPLE_SIZE)
+		run, longest := 0, 0
+		for y := 0; y < OCCLUSION_SAMPLE_SIZE; y++ {
+			sy := band.Min.Y + (2*y+1)*band.Dy()/(2*OCCLUSION_SAMPLE_SIZE)
+			r, g, b, _ := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+			if isSkin(r>>8, g>>8, b>>8) {
+				run = 0
+				continue
+			}
+			run++
+			longest = max(longest, run)
+		}
+		if float64(longest) >= OCCLUSION_MIN_RUN*OCCLUSION_SAMPLE_SIZE {
+			covered++
+		}
+	}
+	return float64(covered) / OCCLUSION_SAMPLE_SIZE
+}
+
+// printOcclusionCheck reports hair or objects over the eyes as a compliance warning
+func printOcclusionCheck(check OcclusionCheck) {
+	if !check.Checked {
+		logDebug("🔬 Eye occlusion not checked (eye bands outside the image or too little skin found)")
+		return
+	}
+	if check.Occluded {
+		logWarn("⚠️  Possible hair or object occluding the eyes (%s covered, limit %.0f%%) - eyes and eyebrows must be fully visible",
+			check.describeCovered(), check.Threshold*100)
+		return
+	}
+	logDebug("🔬 Eyes unobstructed (%s covered)", check.describeCovered())
+}
+
+func (c OcclusionCheck) describeCovered() string {
+	return fmt.Sprintf("left %.0f%%, right %.0f%%", c.Covered[0]*100, c.Covered[1]*100)
+}
+
+// validateEyeOcclusion checks a -max-eye-occlusion value
+func validateEyeOcclusion(threshold float64) error {
+	if threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("invalid eye occlusion threshold %g (must be above 0 and at most 1)", threshold)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// occlusionTestPortrait draws eyebrows and eyes, separated by skin, on the hair test
+// face, optionally behind glasses, with a dark bar across part of the left eye band:
+// the bar covers the eye region from x = 230 to 230+barWidth. The eye bands are at
+// y = 380-418, x = 239-290 and 310-361.
+func occlusionTestPortrait(barWidth int, glasses bool) *image.RGBA {
+	img := hairTestPortrait(false)
+	fill := func(r image.Rectangle, c color.RGBA) {
+		draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+	for _, x := range []int{245, 315} {
+		fill(image.Rect(x, 384, x+40, 389), hairTestHair)
+		fill(image.Rect(x+10, 402, x+30, 410), hairTestHair)
+		if glasses {
+			frame := image.Rect(x-3, 395, x+43, 416)
+			fill(frame, color.RGBA{20, 20, 20, 255})
+			fill(frame.Inset(2), hairTestSkin)
+			fill(image.Rect(x+10, 402, x+30, 410), hairTestHair)
+		}
+	}
+	fill(image.Rect(230, 375, 230+barWidth, 422), hairTestHair)
+	return img
+}
+
+func TestCheckEyeOcclusion(t *testing.T) {
+	tests := []struct {
+		name        string
+		barWidth    int
+		glasses     bool
+		threshold   float64
+		wantLeft    [2]float64 // Range of the covered fraction of the left band
+		wantWarning bool
+	}{
+		{"eyes visible", 0, false, DEFAULT_MAX_EYE_OCCLUSION, [2]float64{0, 0}, false},
+		{"glasses", 0, true, DEFAULT_MAX_EYE_OCCLUSION, [2]float64{0, 0.15}, false},
+		{"fringe over the eye", 70, false, DEFAULT_MAX_EYE_OCCLUSION, [2]float64{1, 1}, true},
+		{"fringe over half the eye", 35, false, DEFAULT_MAX_EYE_OCCLUSION, [2]float64{0.4, 0.6}, true},
+		{"half the eye, higher limit", 35, false, 0.7, [2]float64{0.4, 0.6}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkEyeOcclusion(occlusionTestPortrait(tt.barWidth, tt.glasses), hairTestFace(), tt.threshold)
+			if !check.Checked {
+				t.Fatal("eyes not checked")
+			}
+			if got := check.Covered[0]; got < tt.wantLeft[0] || got > tt.wantLeft[1] {
+				t.Errorf("left band %.2f covered, want %.2f-%.2f", got, tt.wantLeft[0], tt.wantLeft[1])
+			}
+			// Only the sides of a glasses frame can cover the right band
+			if check.Covered[1] > 0.15 {
+				t.Errorf("right band %.2f covered, want at most the frame", check.Covered[1])
+			}
+			if check.Occluded != tt.wantWarning {
+				t.Errorf("occluded %v at %s covered, limit %g", check.Occluded, check.describeCovered(), tt.threshold)
+			}
+		})
+	}
+}
+
+// Without skin on the cheeks the classifier can't tell hair from face, and bands
+// outside the image can't be measured: both skip the check rather than warn
+func TestEyeOcclusionNotChecked(t *testing.T) {
+	if check := checkEyeOcclusion(syntheticPhoto(600, 800), hairTestFace(), DEFAULT_MAX_EYE_OCCLUSION); check.Checked || check.Occluded {
+		t.Errorf("photo without skin: checked %v, occluded %v", check.Checked, check.Occluded)
+	}
+	face := &FaceDetection{X: 20, Y: hairTestFaceY, Size: hairTestFaceSize}
+	if check := checkEyeOcclusion(occlusionTestPortrait(70, false), face, DEFAULT_MAX_EYE_OCCLUSION); check.Checked {
+		t.Error("eye band outside the image was checked")
+	}
+}
+
+func TestWithEyeOcclusionThreshold(t *testing.T) {
+	for _, threshold := range []float64{0, -0.1, 1.5} {
+		if _, err := Generate(syntheticPhoto(600, 800), WithEyeOcclusionThreshold(threshold)); err == nil {
+			t.Errorf("threshold %g accepted", threshold)
+		}
+	}
+	if _, err := Generate(syntheticPhoto(600, 800), WithStrategy(STRATEGY_CENTER), WithEyeOcclusionThreshold(1)); err != nil {
+		t.Errorf("threshold 1: %v", err)
+	}
+}
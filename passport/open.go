@@ -0,0 +1,41 @@
+package passport
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// openImage shows a finished file in the platform's default image viewer. The
+// viewer is started without waiting for it, so a slow or missing desktop never
+// blocks the program.
+func openImage(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		// start is a cmd builtin; the empty argument is the window title, which
+		// start would otherwise take from a quoted path
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the viewer launcher in the background
+	go cmd.Wait()
+	return nil
+}
+
+// openOutputs opens every saved sheet, warning instead of failing when no viewer is available
+func openOutputs(result *Result) {
+	for _, sheet := range result.Sheets {
+		if sheet.Path == "" || sheet.Path == STREAM_PATH {
+			continue
+		}
+		if err := openImage(sheet.Path); err != nil {
+			logWarn("⚠️  Could not open %s: %v", sheet.Path, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package passport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// assumedOrientations maps the -assume-orientation values to EXIF orientation codes:
+// the clockwise turn that makes the stored pixels upright, optionally followed by a
+// left-right flip
+var assumedOrientations = map[string]int{
+	"0": 1, "90": 6, "180": 3, "270": 8,
+	"0-flip": 2, "90-flip": 5, "180-flip": 4, "270-flip": 7,
+}
+
+// orientationOverride replaces the EXIF orientation of every decoded input for the
+// whole process; 0 trusts the tag. Set once via setOrientationOverride.
+var orientationOverride = 0
+
+// setOrientationOverride validates -assume-orientation and -ignore-exif-orientation
+// and selects the orientation applied instead of the EXIF tag
+func setOrientationOverride(assume string, ignoreExif bool) error {
+	if assume == "" {
+		if ignoreExif {
+			orientationOverride = 1
+		}
+		return nil
+	}
+	if ignoreExif {
+		return fmt.Errorf("-assume-orientation already replaces the EXIF orientation and can't be combined with -ignore-exif-orientation")
+	}
+	code, ok := assumedOrientations[strings.ToLower(assume)]
+	if !ok {
+		names := make([]string, 0, len(assumedOrientations))
+		for name := range assumedOrientations {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return len(names[i]) < len(names[j]) || len(names[i]) == len(names[j]) && names[i] < names[j]
+		})
+		return fmt.Errorf("invalid orientation '%s' (available: %s)", assume, strings.Join(names, ", "))
+	}
+	orientationOverride = code
+	return nil
+}
+
+// describeOrientation says what an EXIF orientation does to the stored pixels
+func describeOrientation(code int) string {
+	for name, c := range assumedOrientations {
+		if c != code {
+			continue
+		}
+		degrees, flip := strings.CutSuffix(name, "-flip")
+		description := "upright"
+		if degrees != "0" {
+			description = "turned " + degrees + "° clockwise"
+		}
+		if flip {
+			description += ", mirrored"
+		}
+		return description
+	}
+	return "upright"
+}
+
+// applyOrientationOverride returns the orientation to apply to an input whose EXIF
+// tag is tagged (1 when untagged), logging both when they differ
+func applyOrientationOverride(tagged int) int {
+	if orientationOverride == 0 {
+		return tagged
+	}
+	logInfo("🧭 Orientation: EXIF %d (%s), applying %d (%s) instead",
+		tagged, describeOrientation(tagged), orientationOverride, describeOrientation(orientationOverride))
+	return orientationOverride
+}
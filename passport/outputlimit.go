@@ -0,0 +1,157 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Largest width or height a JPEG file can store
+	JPEG_MAX_DIMENSION = 65535
+
+	// Default -max-output-px: an 8x10in sheet at the maximum DPI with bleed still
+	// fits, larger sheets are refused (or tiled) instead of becoming giant files
+	DEFAULT_MAX_OUTPUT_DIMENSION = 16384
+
+	// -max-output-px below this couldn't hold a photo at the usual resolutions
+	MIN_MAX_OUTPUT_DIMENSION = 1000
+
+	// Files without chroma subsampling (4:4:4) are about this much larger
+	JPEG_444_SIZE_FACTOR = 1.25
+)
+
+// jpegBytesPerPixel is the size of typical photo sheets per pixel by JPEG quality,
+// measured with 4:2:0 chroma subsampling; 4:4:4 adds JPEG_444_SIZE_FACTOR
+var jpegBytesPerPixel = []struct {
+	quality int
+	bytes   float64
+}{
+	{1, 0.02},
+	{30, 0.04},
+	{60, 0.06},
+	{85, 0.10},
+	{95, 0.19},
+	{100, 0.41},
+}
+
+// OutputSizeError is returned for an output image wider or taller than the
+// -max-output-px limit (or than a JPEG can store), before anything is encoded
+type OutputSizeError struct {
+	Width, Height  int
+	Limit          int
+	EstimatedBytes int // Expected JPEG size at the requested quality
+}
+
+func (e *OutputSizeError) Error() string {
+	hint := "use a smaller print format or -dpi, or -tile-output to split it into several files"
+	if e.Limit < JPEG_MAX_DIMENSION {
+		hint = "use a smaller print format or -dpi, raise -max-output-px, or -tile-output to split it into several files"
+	}
+	return fmt.Sprintf("output of %dx%d pixels (about %s as JPEG) exceeds the limit of %d pixels per side - %s",
+		e.Width, e.Height, formatFileSize(e.EstimatedBytes), e.Limit, hint)
+}
+
+// validateMaxOutputDimension checks a -max-output-px value
+func validateMaxOutputDimension(px int) error {
+	if px < MIN_MAX_OUTPUT_DIMENSION || px > JPEG_MAX_DIMENSION {
+		return fmt.Errorf("invalid maximum output size of %d pixels (must be between %d and %d)", px, MIN_MAX_OUTPUT_DIMENSION, JPEG_MAX_DIMENSION)
+	}
+	return nil
+}
+
+// outputDimensionLimit returns the largest width and height opts allow
+func outputDimensionLimit(opts SaveOptions) int {
+	if opts.MaxDimension <= 0 || opts.MaxDimension > JPEG_MAX_DIMENSION {
+		return JPEG_MAX_DIMENSION
+	}
+	return opts.MaxDimension
+}
+
+// checkOutputDimensions returns an *OutputSizeError when an image of the given size
+// is wider or taller than opts allow
+func checkOutputDimensions(size image.Point, opts SaveOptions) error {
+	limit := outputDimensionLimit(opts)
+	if size.X <= limit && size.Y <= limit {
+		return nil
+	}
+	return &OutputSizeError{Width: size.X, Height: size.Y, Limit: limit, EstimatedBytes: estimateJPEGSize(size, opts)}
+}
+
+// estimateJPEGSize returns the expected file size of a photo sheet of the given
+// size with the quality and chroma subsampling of opts, interpolated between the
+// measured jpegBytesPerPixel. Real files vary with the content, e.g. more white
+// paper makes them smaller.
+func estimateJPEGSize(size image.Point, opts SaveOptions) int {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DEFAULT_JPEG_QUALITY
+	}
+	perPixel := jpegBytesPerPixel[len(jpegBytesPerPixel)-1].bytes
+	for i := 1; i < len(jpegBytesPerPixel); i++ {
+		low, high := jpegBytesPerPixel[i-1], jpegBytesPerPixel[i]
+		if quality <= high.quality {
+			t := float64(quality-low.quality) / float64(high.quality-low.quality)
+			perPixel = low.bytes + t*(high.bytes-low.bytes)
+			break
+		}
+	}
+	if opts.Chroma444 {
+		perPixel *= JPEG_444_SIZE_FACTOR
+	}
+	return int(float64(size.X) * float64(size.Y) * perPixel)
+}
+
+// tileRects splits an image of the given size into a grid of equally sized tiles
+// no wider or taller than limit, in reading order
+func tileRects(size image.Point, limit int) []image.Rectangle {
+	columns := (size.X + limit - 1) / limit
+	rows := (size.Y + limit - 1) / limit
+	var tiles []image.Rectangle
+	for row := 0; row < rows; row++ {
+		for col := 0; col < columns; col++ {
+			tiles = append(tiles, image.Rect(
+				col*size.X/columns, row*size.Y/rows,
+				(col+1)*size.X/columns, (row+1)*size.Y/rows))
+		}
+	}
+	return tiles
+}
+
+// buildTilePath returns the file name of the n-th tile (1-based) of the output at
+// path, e.g. photo_passport_photos_10x15cm_tile_2.jpg
+func buildTilePath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_tile_%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// saveTiles writes img, which is too large for one file under opts, as tiles next
+// to path for -tile-output. The tiles keep the print resolution, so printed side by
+// side they make up the whole sheet. Returns the bytes written by all tiles and the
+// lowest JPEG quality used.
+func saveTiles(img image.Image, path string, opts SaveOptions) (int, int, error) {
+	bounds := img.Bounds()
+	tiles := tileRects(bounds.Size(), outputDimensionLimit(opts))
+	logInfo("🧩 Splitting the %dx%d pixel sheet (about %s as JPEG) into %d tiles of at most %d pixels per side",
+		bounds.Dx(), bounds.Dy(), formatFileSize(estimateJPEGSize(bounds.Size(), opts)), len(tiles), outputDimensionLimit(opts))
+
+	total, lowest := 0, 0
+	for i, tile := range tiles {
+		tilePath := availableOutputPath(buildTilePath(path, i+1))
+		cropped, err := cropImage(img, tile.Add(bounds.Min))
+		if err != nil {
+			return 0, 0, err
+		}
+		written, quality, err := saveImage(cropped, tilePath, opts)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error saving tile %d: %v", i+1, err)
+		}
+		fmt.Print(msg("summary.tile_saved", i+1, len(tiles), tilePath, tile.Dx(), tile.Dy(), tile.Min.X, tile.Min.Y))
+		total += written
+		if lowest == 0 || quality < lowest {
+			lowest = quality
+		}
+	}
+	return total, lowest, nil
+}
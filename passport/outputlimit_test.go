@@ -0,0 +1,196 @@
+package passport
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimateJPEGSize(t *testing.T) {
+	size := image.Pt(1000, 2000)
+	pixels := float64(size.X * size.Y)
+	tests := []struct {
+		name string
+		opts SaveOptions
+		want float64 // Bytes per pixel
+	}{
+		{"default quality", SaveOptions{}, 0.19},
+		{"measured quality", SaveOptions{Quality: 85}, 0.10},
+		{"between measured qualities", SaveOptions{Quality: 90}, 0.145},
+		{"lowest quality", SaveOptions{Quality: 1}, 0.02},
+		{"highest quality", SaveOptions{Quality: 100}, 0.41},
+		{"4:4:4", SaveOptions{Quality: 95, Chroma444: true}, 0.19 * JPEG_444_SIZE_FACTOR},
+	}
+	for _, tt := range tests {
+		if got, want := estimateJPEGSize(size, tt.opts), int(pixels*tt.want); math.Abs(float64(got-want)) > 1 {
+			t.Errorf("%s: %d bytes, want %d", tt.name, got, want)
+		}
+	}
+	for quality := 2; quality <= 100; quality++ {
+		if estimateJPEGSize(size, SaveOptions{Quality: quality}) < estimateJPEGSize(size, SaveOptions{Quality: quality - 1}) {
+			t.Errorf("estimate shrinks from quality %d to %d", quality-1, quality)
+		}
+	}
+}
+
+// The estimate is the right order of magnitude for a real sheet
+func TestEstimateJPEGSizeOfSheet(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Generate(source.Image, WithSheet(SHEET_10X15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := result.Sheets[0].Image
+	for _, opts := range []SaveOptions{{Quality: 60}, {Quality: 85}, {Quality: 95}, {Quality: 95, Chroma444: true}} {
+		estimate, actual := estimateJPEGSize(sheet.Bounds().Size(), opts), len(mustEncode(t, sheet, opts))
+		if ratio := float64(estimate) / float64(actual); ratio < 0.5 || ratio > 2 {
+			t.Errorf("quality %d, 4:4:4 %v: estimated %s, encoded %s", opts.Quality, opts.Chroma444, formatFileSize(estimate), formatFileSize(actual))
+		}
+	}
+}
+
+// Oversized outputs are refused with their size and estimate before anything is
+// encoded or written
+func TestCheckOutputDimensions(t *testing.T) {
+	opts := SaveOptions{Quality: 95, MaxDimension: 4000}
+	for _, size := range []image.Point{{4000, 4000}, {1, 1}, {4000, 10}} {
+		if err := checkOutputDimensions(size, opts); err != nil {
+			t.Errorf("%v refused: %v", size, err)
+		}
+	}
+
+	err := checkOutputDimensions(image.Pt(3000, 4001), opts)
+	var sizeErr *OutputSizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("got %v, want an *OutputSizeError", err)
+	}
+	if sizeErr.Width != 3000 || sizeErr.Height != 4001 || sizeErr.Limit != 4000 || sizeErr.EstimatedBytes != estimateJPEGSize(image.Pt(3000, 4001), opts) {
+		t.Errorf("error %+v", sizeErr)
+	}
+	for _, want := range []string{"3000x4001", formatFileSize(sizeErr.EstimatedBytes), "4000", "-max-output-px", "-tile-output"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("message lacks %q: %v", want, err)
+		}
+	}
+
+	// Without a limit only what JPEG can't store is refused, and raising the limit
+	// isn't suggested
+	err = checkOutputDimensions(image.Pt(JPEG_MAX_DIMENSION+1, 10), SaveOptions{})
+	if err == nil || strings.Contains(err.Error(), "-max-output-px") {
+		t.Errorf("beyond the JPEG limit: %v", err)
+	}
+	if err := checkOutputDimensions(image.Pt(JPEG_MAX_DIMENSION, 10), SaveOptions{MaxDimension: JPEG_MAX_DIMENSION + 100}); err != nil {
+		t.Errorf("JPEG limit refused: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sheet.jpg")
+	if _, _, err := saveImage(image.NewRGBA(image.Rect(0, 0, 4001, 10)), path, opts); !errors.As(err, &sizeErr) {
+		t.Errorf("saveImage: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("refused output was written")
+	}
+}
+
+func TestValidateMaxOutputDimension(t *testing.T) {
+	for px, valid := range map[int]bool{
+		MIN_MAX_OUTPUT_DIMENSION - 1: false,
+		MIN_MAX_OUTPUT_DIMENSION:     true,
+		DEFAULT_MAX_OUTPUT_DIMENSION: true,
+		JPEG_MAX_DIMENSION:           true,
+		JPEG_MAX_DIMENSION + 1:       false,
+	} {
+		if err := validateMaxOutputDimension(px); (err == nil) != valid {
+			t.Errorf("%d: %v", px, err)
+		}
+	}
+}
+
+// The tiles cover the sheet exactly once and none is larger than the limit
+func TestTileRects(t *testing.T) {
+	for _, tt := range []struct {
+		size  image.Point
+		limit int
+		want  int
+	}{
+		{image.Pt(100, 100), 100, 1},
+		{image.Pt(101, 100), 100, 2},
+		{image.Pt(250, 120), 100, 6},
+		{image.Pt(20000, 16384), DEFAULT_MAX_OUTPUT_DIMENSION, 2},
+	} {
+		tiles := tileRects(tt.size, tt.limit)
+		if len(tiles) != tt.want {
+			t.Errorf("%v at %d: %d tiles, want %d", tt.size, tt.limit, len(tiles), tt.want)
+		}
+		area := 0
+		for i, tile := range tiles {
+			if tile.Dx() > tt.limit || tile.Dy() > tt.limit || !tile.In(image.Rectangle{Max: tt.size}) {
+				t.Errorf("%v at %d: tile %v", tt.size, tt.limit, tile)
+			}
+			for _, other := range tiles[:i] {
+				if tile.Overlaps(other) {
+					t.Errorf("%v at %d: tiles %v and %v overlap", tt.size, tt.limit, tile, other)
+				}
+			}
+			area += tile.Dx() * tile.Dy()
+		}
+		if area != tt.size.X*tt.size.Y {
+			t.Errorf("%v at %d: tiles cover %d pixels", tt.size, tt.limit, area)
+		}
+	}
+}
+
+// -tile-output writes the tiles numbered in reading order with their part of the sheet
+func TestSaveTiles(t *testing.T) {
+	sheet := coordinateImage(image.Rect(0, 0, 250, 120))
+	path := filepath.Join(t.TempDir(), "anna_passport_photos_10x15cm.jpg")
+	opts := SaveOptions{Quality: 100, Chroma444: true, MaxDimension: 100}
+	total, quality, err := saveTiles(sheet, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality != 100 {
+		t.Errorf("quality %d", quality)
+	}
+
+	written := 0
+	for i, tile := range tileRects(image.Pt(250, 120), 100) {
+		tilePath := buildTilePath(path, i+1)
+		data := mustReadFile(t, tilePath)
+		written += len(data)
+		file, err := os.Open(tilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := jpeg.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Bounds().Size() != tile.Size() {
+			t.Errorf("%s is %v, want %v", filepath.Base(tilePath), decoded.Bounds().Size(), tile.Size())
+		}
+		center := image.Pt(tile.Dx()/2, tile.Dy()/2)
+		if got, want := toRGBA(decoded).RGBAAt(center.X, center.Y), sheet.RGBAAt(tile.Min.X+center.X, tile.Min.Y+center.Y); rgbaDistance(got, want) > 12 {
+			t.Errorf("%s shows %v at its center, the sheet has %v there", filepath.Base(tilePath), got, want)
+		}
+	}
+	if total != written {
+		t.Errorf("reported %d bytes, tiles have %d", total, written)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the untiled sheet was written too")
+	}
+	if got := filepath.Base(buildTilePath(path, 2)); got != "anna_passport_photos_10x15cm_tile_2.jpg" {
+		t.Errorf("tile named %s", got)
+	}
+}
@@ -0,0 +1,175 @@
+package passport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Placeholders of -output-template:
+//
+//	{name}     input file name without extension ({base} is the same)
+//	{format}   print format key, e.g. 10x15cm or 4x6in ({sheet} is the same)
+//	{spec}     photo standard, e.g. austria or us-visa
+//	{ext}      extension of the input file without the dot, e.g. heic
+//	{date}     date the sheet is saved, e.g. 2024-05-31
+//	{datetime} when the photo was taken (EXIF DateTimeOriginal, else the file's
+//	           modification time), e.g. 2024-05-31_14-03-59
+//	{count}    number of photos on the sheet
+var outputTemplatePlaceholders = []string{"name", "base", "format", "sheet", "spec", "ext", "date", "datetime", "count"}
+
+// Date layouts of the {date} and {datetime} placeholders
+const (
+	OUTPUT_TEMPLATE_DATE     = "2006-01-02"
+	OUTPUT_TEMPLATE_DATETIME = "2006-01-02_15-04-05"
+)
+
+var outputTemplatePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// numberedOutputSuffix matches the _2, _3, ... availableOutputPath adds before the extension
+var numberedOutputSuffix = regexp.MustCompile(`_\d+(\.[^.]+)$`)
+
+// validateOutputTemplate checks an -output-template: only known placeholders, no
+// stray braces, and a file name rather than a path (-outdir sets the directory)
+func validateOutputTemplate(template string) error {
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("invalid output template '%s' (a file name without directory, use -outdir for the directory)", template)
+	}
+	for _, match := range outputTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		known := false
+		for _, placeholder := range outputTemplatePlaceholders {
+			known = known || match[1] == placeholder
+		}
+		if !known {
+			return fmt.Errorf("invalid output template placeholder '%s' (available: {%s})", match[0], strings.Join(outputTemplatePlaceholders, "}, {"))
+		}
+	}
+	if rest := outputTemplatePlaceholder.ReplaceAllString(template, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("invalid output template '%s' (unbalanced braces)", template)
+	}
+	return nil
+}
+
+// outputTemplateAliases are placeholders that stand for another one
+var outputTemplateAliases = map[string]string{"base": "name", "sheet": "format"}
+
+// outputTemplateUses reports whether template contains the placeholder, e.g. "format",
+// or one of its aliases
+func outputTemplateUses(template, placeholder string) bool {
+	if strings.Contains(template, "{"+placeholder+"}") {
+		return true
+	}
+	for alias, target := range outputTemplateAliases {
+		if target == placeholder && strings.Contains(template, "{"+alias+"}") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandOutputTemplate resolves the template for one sheet when it is saved;
+// ".jpg" is appended unless the template ends in a JPEG extension
+func expandOutputTemplate(template, inputPath, specKey string, format PrintFormat, now time.Time) string {
+	_, name := splitInputPath(inputPath)
+	ext := ""
+	if inputPath != STREAM_PATH {
+		ext = strings.ToLower(strings.TrimPrefix(filepath.Ext(inputPath), "."))
+	}
+	values := map[string]string{
+		"name":   name,
+		"format": format.Key,
+		"spec":   specKey,
+		"ext":    ext,
+		"date":   now.Format(OUTPUT_TEMPLATE_DATE),
+		"count":  strconv.Itoa(format.PhotosPerSheet),
+	}
+	if outputTemplateUses(template, "datetime") {
+		values["datetime"] = captureTime(inputPath, now).Format(OUTPUT_TEMPLATE_DATETIME)
+	}
+	for alias, target := range outputTemplateAliases {
+		values[alias] = values[target]
+	}
+	fileName := outputTemplatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return values[strings.Trim(placeholder, "{}")]
+	})
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext != ".jpg" && ext != ".jpeg" {
+		fileName += ".jpg"
+	}
+	return fileName
+}
+
+// captureTime returns when the photo at path was taken: the EXIF DateTimeOriginal
+// (or DateTime), else the file's modification time. Images from stdin, which have
+// neither, get now.
+func captureTime(path string, now time.Time) time.Time {
+	if path == STREAM_PATH {
+		return now
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return now
+	}
+	defer file.Close()
+	if exifData, err := exif.Decode(file); err == nil {
+		if taken, err := exifData.DateTime(); err == nil {
+			return taken
+		}
+	}
+	if info, err := file.Stat(); err == nil {
+		return info.ModTime()
+	}
+	return now
+}
+
+// overwriteOutputs lets written files replace existing ones (-overwrite). Without
+// it availableOutputPath numbers the new file instead, so several shots of the same
+// person or repeated runs never lose an earlier sheet. Set once in Main.
+var overwriteOutputs = false
+
+// reservedOutputs are the paths availableOutputPath handed out in this process, so
+// parallel -batch jobs don't pick the same free name before either file exists
+var reservedOutputs = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// availableOutputPath returns path when nothing is there yet (or with -overwrite),
+// else the first free name with _2, _3, ... before the extension, e.g.
+// photo_passport_photos_10x15cm_2.jpg. Call it right before writing a file.
+func availableOutputPath(path string) string {
+	if path == STREAM_PATH {
+		return path
+	}
+	reservedOutputs.Lock()
+	defer reservedOutputs.Unlock()
+	if overwriteOutputs {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	candidate := path
+	for n := 2; outputPathTaken(candidate); n++ {
+		candidate = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), n, ext)
+	}
+	reservedOutputs.paths[candidate] = true
+	if candidate != path {
+		logInfo("📎 %s already exists, writing %s instead (-overwrite replaces it)", path, filepath.Base(candidate))
+	}
+	return candidate
+}
+
+// outputPathTaken reports whether a file exists at path or it was handed out before
+func outputPathTaken(path string) bool {
+	if reservedOutputs.paths[path] {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
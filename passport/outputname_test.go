@@ -0,0 +1,259 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exifWithDateTimeOriginal returns an APP1 EXIF segment whose Exif IFD holds
+// DateTimeOriginal, the time a camera took the photo, as "2006:01:02 15:04:05"
+func exifWithDateTimeOriginal(taken string) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2A")
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // IFD0 follows the header
+	// IFD0: one ExifIFDPointer entry pointing to the Exif IFD right after it
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8769, 4}) // ExifIFDPointer, LONG
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 26})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	// Exif IFD: DateTimeOriginal, its 20 bytes right after the IFD
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x9003, 2}) // DateTimeOriginal, ASCII
+	binary.Write(&tiff, binary.BigEndian, []uint32{20, 44})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString(taken + "\x00")
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xE1})
+	binary.Write(&segment, binary.BigEndian, uint16(2+6+tiff.Len()))
+	segment.WriteString("Exif\x00\x00")
+	segment.Write(tiff.Bytes())
+	return segment.Bytes()
+}
+
+// writeTestJPEG writes a small JPEG to dir/name, with the EXIF segment when it
+// isn't nil, and returns its path
+func writeTestJPEG(t *testing.T, dir, name string, exifSegment []byte) string {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, syntheticPhoto(60, 80), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	if exifSegment != nil {
+		data = insertAfterSOI(data, exifSegment)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExpandOutputTemplate(t *testing.T) {
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	format, err := lookupPrintFormat(SHEET_10X15, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := writeTestJPEG(t, dir, "anna.JPG", exifWithDateTimeOriginal("2023:07:14 09:30:05"))
+	now := time.Date(2024, 5, 31, 14, 3, 59, 0, time.Local)
+
+	tests := []struct {
+		template string
+		input    string
+		want     string
+	}{
+		{"{name}_{format}", input, "anna_" + format.Key + ".jpg"},
+		{"{base}_{spec}_{sheet}_{datetime}", input, "anna_" + spec.Key + "_" + format.Key + "_2023-07-14_09-30-05.jpg"},
+		{"{name}.{ext}_{count}", input, "anna.jpg_" + strconv.Itoa(format.PhotosPerSheet) + ".jpg"},
+		{"{date}_{name}.jpeg", input, "2024-05-31_anna.jpeg"},
+		{"sheet.JPG", input, "sheet.JPG"},
+		// Images from stdin have no file to take a date from
+		{"{name}_{ext}_{datetime}", STREAM_PATH, STREAM_INPUT_NAME + "__2024-05-31_14-03-59.jpg"},
+	}
+	for _, tt := range tests {
+		if err := validateOutputTemplate(tt.template); err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+		}
+		if got := expandOutputTemplate(tt.template, tt.input, spec.Key, format, now); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.template, got, tt.want)
+		}
+	}
+}
+
+// Without an EXIF date {datetime} is the file's modification time, and without a
+// readable file it is the time of the run
+func TestCaptureTime(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 31, 14, 3, 59, 0, time.Local)
+	modified := time.Date(2022, 12, 24, 18, 0, 7, 0, time.Local)
+
+	withEXIF := writeTestJPEG(t, dir, "camera.jpg", exifWithDateTimeOriginal("2023:07:14 09:30:05"))
+	withoutEXIF := writeTestJPEG(t, dir, "scan.jpg", nil)
+	withGPSOnly := writeTestJPEG(t, dir, "phone.jpg", exifWithGPS())
+	for _, path := range []string{withEXIF, withoutEXIF, withGPSOnly} {
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want time.Time
+	}{
+		{"EXIF DateTimeOriginal", withEXIF, time.Date(2023, 7, 14, 9, 30, 5, 0, time.Local)},
+		{"no EXIF", withoutEXIF, modified},
+		{"EXIF without a date", withGPSOnly, modified},
+		{"missing file", filepath.Join(dir, "gone.jpg"), now},
+		{"stdin", STREAM_PATH, now},
+	}
+	for _, tt := range tests {
+		if got := captureTime(tt.path, now); !got.Equal(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	format, _ := lookupPrintFormat(SHEET_10X15, spec)
+	if got, want := expandOutputTemplate("{datetime}", withoutEXIF, spec.Key, format, now), "2022-12-24_18-00-07.jpg"; got != want {
+		t.Errorf("{datetime} without EXIF: %s, want %s", got, want)
+	}
+}
+
+func TestValidateOutputTemplate(t *testing.T) {
+	for _, template := range []string{
+		"{name}_{color}",
+		"{name",
+		"name}",
+		"{{name}}",
+		"out/{name}",
+		`out\{name}`,
+	} {
+		if err := validateOutputTemplate(template); err == nil {
+			t.Errorf("%s accepted", template)
+		}
+	}
+}
+
+// An existing file, or a name handed out earlier in the run, gets the next free
+// number before the extension; -overwrite keeps the name
+func TestAvailableOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "anna_passport_photos_10x15cm.jpg")
+	if got := availableOutputPath(path); got != path {
+		t.Errorf("free name changed to %s", got)
+	}
+	// Handed out but not written yet, as by a parallel -batch job
+	second := availableOutputPath(path)
+	if want := filepath.Join(dir, "anna_passport_photos_10x15cm_2.jpg"); second != want {
+		t.Errorf("reserved name: %s, want %s", second, want)
+	}
+
+	report := filepath.Join(dir, "anna_crop.json")
+	for _, name := range []string{"anna_crop.json", "anna_crop_2.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := availableOutputPath(report), filepath.Join(dir, "anna_crop_3.json"); got != want {
+		t.Errorf("existing files: %s, want %s", got, want)
+	}
+	if got := availableOutputPath(STREAM_PATH); got != STREAM_PATH {
+		t.Errorf("stdout numbered as %s", got)
+	}
+
+	defer func(overwrite bool) { overwriteOutputs = overwrite }(overwriteOutputs)
+	overwriteOutputs = true
+	if got := availableOutputPath(report); got != report {
+		t.Errorf("-overwrite: %s, want %s", got, report)
+	}
+
+	// Numbered outputs are recognized as such
+	for name, want := range map[string]string{
+		"overview_2.jpg":    "overview.jpg",
+		"anna_crop_12.json": "anna_crop.json",
+		"photo_3x4.jpg":     "photo_3x4.jpg",
+	} {
+		if got := numberedOutputSuffix.ReplaceAllString(name, "$1"); got != want {
+			t.Errorf("%s unnumbered to %s, want %s", name, got, want)
+		}
+	}
+}
+
+// A second run into the same directory keeps the first run's sheet, photo and crop
+// report and writes numbered ones next to them; -overwrite replaces them instead
+func TestCLINumbersOutputsInsteadOfOverwriting(t *testing.T) {
+	requireCascade(t)
+	dir := t.TempDir()
+	args := []string{"-save-photo", "-crop-report", "-outdir", dir, sampleImagePath, SHEET_10X15}
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	format, err := lookupPrintFormat(SHEET_10X15, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, name := splitInputPath(sampleImagePath)
+	first := []string{
+		name + "_crop.json",
+		name + "_passport_photo.jpg",
+		name + "_passport_photos_" + format.Key + ".jpg",
+	}
+	second := []string{
+		name + "_crop_2.json",
+		name + "_passport_photo_2.jpg",
+		name + "_passport_photos_" + format.Key + "_2.jpg",
+	}
+
+	for run, want := range [][]string{first, append(append([]string{}, first...), second...)} {
+		_, stderr, code := runCLI(t, nil, args...)
+		if code != 0 {
+			t.Fatalf("run %d exited with %d:\n%s", run+1, code, stderr)
+		}
+		assertDirFiles(t, dir, want)
+	}
+
+	// Mark the first run's files to see that -overwrite writes over them
+	for _, file := range first {
+		if err := os.WriteFile(filepath.Join(dir, file), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, stderr, code := runCLI(t, nil, append([]string{"-overwrite"}, args...)...)
+	if code != 0 {
+		t.Fatalf("-overwrite run exited with %d:\n%s", code, stderr)
+	}
+	assertDirFiles(t, dir, append(append([]string{}, first...), second...))
+	for _, file := range first {
+		if info, err := os.Stat(filepath.Join(dir, file)); err != nil || info.Size() == 0 {
+			t.Errorf("%s not overwritten", file)
+		}
+	}
+}
+
+// assertDirFiles checks that dir holds exactly the named files
+func assertDirFiles(t *testing.T, dir string, want []string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	want = append([]string{}, want...)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files in the output directory:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,72 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// Height of the -oval vignette as a multiple of the head height, leaving room
+	// for the hair above the crown and the neck below the chin
+	OVAL_HEAD_HEIGHT_RATIO = 1.45
+
+	// Width of the oval as a fraction of its height
+	OVAL_ASPECT = 0.78
+
+	// The oval's center sits this fraction of the head height below the head's center
+	OVAL_CENTER_OFFSET = 0.1
+
+	// Width of the feathered edge as a fraction of the oval's radii
+	OVAL_FEATHER_RATIO = 0.08
+)
+
+// ovalAroundHead returns the center and radii of the vignette for a photo of the
+// given size: vertically sized to the head at the spec's crown and chin positions,
+// horizontally centered on face (in photo pixels, see faceMask), and shrunk to fit
+// inside the photo
+func ovalAroundHead(size image.Point, face image.Rectangle, spec PhotoSpec) (cx, cy, rx, ry float64) {
+	headTop := float64(size.Y) * spec.HeadspaceRatio
+	headHeight := float64(size.Y) * spec.HeadHeightRatio
+	cx = float64(face.Min.X+face.Max.X) / 2
+	if face.Empty() {
+		cx = float64(size.X) / 2
+	}
+	cy = headTop + headHeight*(0.5+OVAL_CENTER_OFFSET)
+	ry = math.Min(headHeight*OVAL_HEAD_HEIGHT_RATIO/2, math.Min(cy, float64(size.Y)-cy))
+	rx = math.Min(ry*OVAL_ASPECT, math.Min(cx, float64(size.X)-cx))
+	return cx, cy, rx, ry
+}
+
+// ovalMask returns the coverage of the oval for every pixel: opaque inside, fading
+// to transparent over the feathered edge with a smoothstep so no ring shows
+func ovalMask(size image.Point, cx, cy, rx, ry float64) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, size.X, size.Y))
+	if rx <= 0 || ry <= 0 {
+		return mask
+	}
+	inner := 1 - OVAL_FEATHER_RATIO
+	for y := 0; y < size.Y; y++ {
+		dy := (float64(y) + 0.5 - cy) / ry
+		for x := 0; x < size.X; x++ {
+			dx := (float64(x) + 0.5 - cx) / rx
+			t := (1 - math.Sqrt(dx*dx+dy*dy)) / (1 - inner)
+			t = math.Max(0, math.Min(1, t))
+			mask.Pix[y*mask.Stride+x] = uint8(math.Round(255 * t * t * (3 - 2*t)))
+		}
+	}
+	return mask
+}
+
+// applyOvalMask fades photo into white outside an oval around the head, for the
+// ID photos that want an oval vignette. The photo keeps its size.
+func applyOvalMask(photo image.Image, face image.Rectangle, spec PhotoSpec) image.Image {
+	bounds := photo.Bounds()
+	cx, cy, rx, ry := ovalAroundHead(bounds.Size(), face, spec)
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	draw.DrawMask(canvas, canvas.Bounds(), photo, bounds.Min, ovalMask(bounds.Size(), cx, cy, rx, ry), image.Point{}, draw.Over)
+	logInfo("🥚 Oval mask of %.0fx%.0f pixels around the head, white outside", 2*rx, 2*ry)
+	return canvas
+}
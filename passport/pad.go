@@ -0,0 +1,99 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// Pad modes accepted by -pad: what happens when the ideal crop reaches past the image edge
+const (
+	PAD_SNAP      = "snap"      // Move the crop back inside the image (default); the face ends up off-center
+	PAD_WHITE     = "white"     // Keep the crop and fill the missing area with white
+	PAD_REPLICATE = "replicate" // Keep the crop and repeat the edge pixels
+	PAD_MIRROR    = "mirror"    // Keep the crop and mirror the image at its edges
+)
+
+var padModes = []string{PAD_SNAP, PAD_WHITE, PAD_REPLICATE, PAD_MIRROR}
+
+// validatePadMode checks a -pad value
+func validatePadMode(mode string) error {
+	for _, m := range padModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid pad mode '%s' (available: %s)", mode, strings.Join(padModes, ", "))
+}
+
+// cropImage copies r of img into a new image with its top-left corner at the origin.
+// r is in img's own coordinates, which start at img.Bounds().Min (not necessarily
+// (0,0), e.g. for a SubImage), and must be a non-empty rectangle inside img.
+func cropImage(img image.Image, r image.Rectangle) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	if r.Empty() {
+		return nil, &ImageSizeError{What: "crop", Width: r.Dx(), Height: r.Dy(), Problem: "is empty"}
+	}
+	if !r.In(bounds) {
+		return nil, &ImageSizeError{What: "crop", Width: r.Dx(), Height: r.Dy(),
+			Problem: fmt.Sprintf("at (%d,%d) reaches outside the image bounds %v", r.Min.X, r.Min.Y, bounds)}
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, r.Min, draw.Src)
+	return cropped, nil
+}
+
+// paddedCrop is cropImage for crops that may reach past the edges of img: the
+// parts of srcRect outside img are filled according to mode. PAD_SNAP crops must
+// lie inside img like for cropImage.
+func paddedCrop(img image.Image, srcRect image.Rectangle, mode string) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	if srcRect.In(bounds) || srcRect.Empty() || mode == PAD_SNAP {
+		return cropImage(img, srcRect)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, srcRect.Dx(), srcRect.Dy()))
+	if mode == PAD_WHITE {
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		inside := srcRect.Intersect(bounds)
+		draw.Draw(dst, inside.Sub(srcRect.Min), img, inside.Min, draw.Src)
+		return dst, nil
+	}
+
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		sy := padCoordinate(srcRect.Min.Y+y, bounds.Min.Y, bounds.Max.Y, mode)
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			sx := padCoordinate(srcRect.Min.X+x, bounds.Min.X, bounds.Max.X, mode)
+			dst.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return dst, nil
+}
+
+// padCoordinate maps a coordinate outside [lo, hi) back into the image, by
+// clamping (PAD_REPLICATE) or reflecting at the edge (PAD_MIRROR)
+func padCoordinate(v, lo, hi int, mode string) int {
+	if mode == PAD_MIRROR {
+		size := hi - lo
+		period := 2 * size
+		offset := ((v-lo)%period + period) % period
+		if offset >= size {
+			offset = period - 1 - offset
+		}
+		return lo + offset
+	}
+	return max(lo, min(v, hi-1))
+}
+
+// printPadding reports how far a crop reaches past each image edge
+func printPadding(crop image.Rectangle, size image.Point, mode string) {
+	left, top := max(0, -crop.Min.X), max(0, -crop.Min.Y)
+	right, bottom := max(0, crop.Max.X-size.X), max(0, crop.Max.Y-size.Y)
+	if mode == PAD_SNAP || left+top+right+bottom == 0 {
+		return
+	}
+	logInfo("🧩 Crop reaches past the image edge, padded with %s: left %d, top %d, right %d, bottom %d pixels",
+		mode, left, top, right, bottom)
+}
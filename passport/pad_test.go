@@ -0,0 +1,111 @@
+package passport
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// coordinateImage returns an image whose pixel at (x,y) encodes its coordinates, so
+// a crop shows where each of its pixels came from
+func coordinateImage(bounds image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetRGBA(x, y, coordinateColor(x, y))
+		}
+	}
+	return img
+}
+
+func coordinateColor(x, y int) color.RGBA {
+	return color.RGBA{uint8(x + 128), uint8(y + 128), 0, 255}
+}
+
+func TestCropImage(t *testing.T) {
+	zeroOrigin := coordinateImage(image.Rect(0, 0, 20, 10))
+	tests := []struct {
+		name    string
+		img     image.Image
+		r       image.Rectangle
+		wantErr bool
+	}{
+		{"inside", zeroOrigin, image.Rect(2, 3, 8, 9), false},
+		{"whole image", zeroOrigin, zeroOrigin.Bounds(), false},
+		{"sub-image with offset bounds", zeroOrigin.SubImage(image.Rect(5, 2, 15, 9)), image.Rect(6, 4, 10, 8), false},
+		{"negative bounds", coordinateImage(image.Rect(-10, -5, 10, 5)), image.Rect(-8, -4, -2, 3), false},
+		{"negative origin", zeroOrigin, image.Rect(-1, 2, 5, 6), true},
+		{"negative origin above", zeroOrigin, image.Rect(2, -3, 5, 6), true},
+		{"past the right edge", zeroOrigin, image.Rect(15, 2, 21, 6), true},
+		{"past the bottom edge", zeroOrigin, image.Rect(2, 5, 6, 11), true},
+		{"outside the sub-image", zeroOrigin.SubImage(image.Rect(5, 2, 15, 9)), image.Rect(2, 2, 8, 8), true},
+		{"completely outside", zeroOrigin, image.Rect(30, 30, 40, 40), true},
+		{"empty width", zeroOrigin, image.Rect(4, 2, 4, 6), true},
+		{"empty height", zeroOrigin, image.Rect(2, 5, 6, 5), true},
+		{"zero rectangle", zeroOrigin, image.Rectangle{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cropped, err := cropImage(tt.img, tt.r)
+			if tt.wantErr {
+				var sizeErr *ImageSizeError
+				if !errors.As(err, &sizeErr) {
+					t.Fatalf("error %v, want an *ImageSizeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cropped.Bounds() != image.Rect(0, 0, tt.r.Dx(), tt.r.Dy()) {
+				t.Fatalf("bounds %v, want %dx%d at the origin", cropped.Bounds(), tt.r.Dx(), tt.r.Dy())
+			}
+			for y := 0; y < tt.r.Dy(); y++ {
+				for x := 0; x < tt.r.Dx(); x++ {
+					if got, want := cropped.RGBAAt(x, y), coordinateColor(tt.r.Min.X+x, tt.r.Min.Y+y); got != want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v from (%d,%d)", x, y, got, want, tt.r.Min.X+x, tt.r.Min.Y+y)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Crops past the edge are padded by every mode but snap, which must stay inside
+func TestPaddedCropPastTheEdge(t *testing.T) {
+	img := coordinateImage(image.Rect(0, 0, 10, 10))
+	r := image.Rect(-2, 7, 3, 12)
+	tests := []struct {
+		mode string
+		// Pixel of the crop at (0,0), i.e. image (-2,7), and at (4,4), i.e. image (2,11)
+		wantTopLeft, wantBottomRight color.RGBA
+	}{
+		{PAD_WHITE, color.RGBA{255, 255, 255, 255}, color.RGBA{255, 255, 255, 255}},
+		{PAD_REPLICATE, coordinateColor(0, 7), coordinateColor(2, 9)},
+		{PAD_MIRROR, coordinateColor(1, 7), coordinateColor(2, 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cropped, err := paddedCrop(img, r, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cropped.Bounds() != image.Rect(0, 0, 5, 5) {
+				t.Fatalf("bounds %v, want 5x5 at the origin", cropped.Bounds())
+			}
+			if got := cropped.RGBAAt(0, 0); got != tt.wantTopLeft {
+				t.Errorf("top left %v, want %v", got, tt.wantTopLeft)
+			}
+			if got := cropped.RGBAAt(4, 4); got != tt.wantBottomRight {
+				t.Errorf("bottom right %v, want %v", got, tt.wantBottomRight)
+			}
+			if got, want := cropped.RGBAAt(2, 1), coordinateColor(0, 8); got != want {
+				t.Errorf("pixel inside the image %v, want %v", got, want)
+			}
+		})
+	}
+	if _, err := paddedCrop(img, r, PAD_SNAP); err == nil {
+		t.Error("snap crop past the edge succeeded")
+	}
+}
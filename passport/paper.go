@@ -0,0 +1,63 @@
+package passport
+
+import (
+	"fmt"
+	"math"
+)
+
+// paperSize is a sheet of paper in millimeters and in pixels at a print resolution.
+// The millimeters are the exact nominal size (4x6in is 152.4x101.6mm); metric sizes
+// are rounded to whole pixels, inch sizes are exact in pixels (4x6in is 1800x1200 at
+// 300 DPI).
+type paperSize struct {
+	WidthMM, HeightMM float64
+	WidthPX, HeightPX int
+	Unit              string // "cm" or "in", for the name of the size
+}
+
+// mmToPX converts a length in millimeters to the nearest whole pixel at dpi
+func mmToPX(mm float64, dpi int) int {
+	return int(math.Round(mm * float64(dpi) / 25.4))
+}
+
+// pxToMM converts a length in pixels at dpi to millimeters
+func pxToMM(px, dpi int) float64 {
+	return float64(px) * 25.4 / float64(dpi)
+}
+
+// metricPaper returns a sheet measured in millimeters, in pixels at dpi
+func metricPaper(widthMM, heightMM, dpi int) paperSize {
+	return paperSize{
+		WidthMM:  float64(widthMM),
+		HeightMM: float64(heightMM),
+		WidthPX:  mmToPX(float64(widthMM), dpi),
+		HeightPX: mmToPX(float64(heightMM), dpi),
+		Unit:     "cm",
+	}
+}
+
+// inchPaper returns a sheet measured in whole inches, in pixels at dpi
+func inchPaper(widthIn, heightIn, dpi int) paperSize {
+	return paperSize{
+		WidthMM:  float64(widthIn) * 25.4,
+		HeightMM: float64(heightIn) * 25.4,
+		WidthPX:  widthIn * dpi,
+		HeightPX: heightIn * dpi,
+		Unit:     "in",
+	}
+}
+
+// rotated returns the same sheet turned by 90°
+func (p paperSize) rotated() paperSize {
+	p.WidthMM, p.HeightMM = p.HeightMM, p.WidthMM
+	p.WidthPX, p.HeightPX = p.HeightPX, p.WidthPX
+	return p
+}
+
+// String names the size in its own unit, e.g. "15x10cm" or "6x4in"
+func (p paperSize) String() string {
+	if p.Unit == "in" {
+		return fmt.Sprintf("%.0fx%.0fin", p.WidthMM/25.4, p.HeightMM/25.4)
+	}
+	return fmt.Sprintf("%.0fx%.0fcm", p.WidthMM/10, p.HeightMM/10)
+}
@@ -0,0 +1,2305 @@
+// Package passport generates passport and visa photos and their print sheets.
+// Generate runs the whole pipeline on an image, AnalyzeFaces checks the faces in a
+// photo without cropping it, and Main is the command line tool built on both.
+package passport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"passport-photo-generator/internal/jpeg444"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// =============================================================================
+	// PASSPORT PHOTO CONFIGURATION - Modify these for different countries
+	// =============================================================================
+	
+	// Photo dimensions (default: Austrian/EU standard 35×45mm)
+	// Common alternatives:
+	// - US: 51×51mm (2×2 inches)
+	// - UK: 45×35mm (landscape orientation)
+	// - Canada: 50×70mm
+	// - India: 35×45mm
+	PHOTO_WIDTH_MM  = 35   // Photo width in millimeters
+	PHOTO_HEIGHT_MM = 45   // Photo height in millimeters
+	
+	// Print quality (300 DPI is standard for professional printing); -dpi changes it
+	// at runtime and recomputes all pixel sizes from the millimeters
+	DPI = 300
+	
+	// Pixel dimensions (calculated from mm and DPI: mm * 300 / 25.4)
+	// For 35×45mm at 300 DPI: 413×531 pixels
+	// To change: recalculate using: new_mm * 300 / 25.4
+	PHOTO_WIDTH_PX  = 413  // 35mm * 300 DPI / 25.4 = 413px
+	PHOTO_HEIGHT_PX = 531  // 45mm * 300 DPI / 25.4 = 531px
+	
+	// =============================================================================
+	// FACE POSITIONING CONFIGURATION
+	// =============================================================================
+	
+	// Head size as fraction of photo height (default: 3/4 for Austrian standard)
+	// Common alternatives:
+	// - US: 50-69% (0.5 to 0.69)
+	// - UK: 70-80% (0.7 to 0.8)
+	// - Canada: 31-36mm for 50×70mm photo (≈ 0.5)
+	HEAD_HEIGHT_RATIO = 0.75  // Head height (chin to skull) as fraction of photo height
+	
+	// Allowed head height band in millimeters; the crop is re-measured and adjusted
+	// until the head is within it (Austria: 32-36mm)
+	HEAD_HEIGHT_MIN_MM = 32.0
+	HEAD_HEIGHT_MAX_MM = 36.0
+	
+	// Eye position from top as fraction of photo height (default: 48% for Austrian)
+	// This determines where the eyes should be positioned vertically
+	EYE_POSITION_FROM_TOP_RATIO = 0.48  // Eyes at 48% from top of photo
+	
+	// Headspace above head as fraction of photo height (default: 10% for Austrian)
+	HEADSPACE_RATIO = 0.1  // Space above head as fraction of photo height
+	
+	// Eye level within detected face (where eyes are relative to face detection box)
+	EYE_LEVEL_IN_FACE_RATIO = 0.42  // Eyes at 42% down from top of face detection
+	
+	// Forehead estimation (how much above face detection is the skull top)
+	FOREHEAD_EXTENSION_RATIO = 0.15  // Skull extends 15% above face detection
+	
+	// Chin estimation (how much below the face detection bottom the chin likely is)
+	// This compensates for detectors that stop around the mouth and miss the chin.
+	CHIN_EXTENSION_RATIO = 0.10  // Chin extends ~10% of face box below detection
+	
+	// =============================================================================
+	// LAYOUT CONFIGURATION
+	// =============================================================================
+	
+	// Minimum spacing between photos in millimeters
+	MIN_SPACING_MM = 2.0  // Minimum space between photos for cutting
+	
+	// =============================================================================
+	// OUTPUT CONFIGURATION
+	// =============================================================================
+	
+	// JPEG quality used for the sheet and the single photo unless overridden
+	DEFAULT_JPEG_QUALITY = 95
+	
+	// =============================================================================
+	// FACE DETECTION CONFIGURATION
+	// =============================================================================
+	
+	// Minimum detection score (pigo Q value) for a face to be accepted.
+	// 0 keeps every detection; raise it (e.g. 5.0) to reject false positives
+	// in patterned backgrounds.
+	DEFAULT_MIN_CONFIDENCE = 0.0
+	
+	// IoU threshold used when clustering overlapping detections into one face
+	DEFAULT_CLUSTER_IOU = 0.2
+	
+	// Face sizes searched for, as fractions of the detection buffer's short side, so
+	// the range scales with the input resolution. Faces in passport source photos are
+	// large; tiny windows only add false positives.
+	DEFAULT_MIN_FACE_RATIO = 0.05
+	DEFAULT_MAX_FACE_RATIO = 0.8
+	
+	// Smallest detection window in pixels; the cascade can't tell faces apart below it
+	DETECTION_MIN_WINDOW_PX = 20
+)
+
+type PrintFormat struct {
+	Key            string // Short identifier used in output filenames, e.g. "10x15cm" or "4x6in"
+	Name           string
+	WidthMM        float64 // Exact nominal sheet size; the grid is laid out in it, independent of DPI
+	HeightMM       float64
+	WidthPX        int
+	HeightPX       int
+	DPI            int // Print resolution the pixel sizes are computed for
+	PhotosPerSheet int
+	Columns        int
+	Rows           int
+	PhotoWidthPX   int
+	PhotoHeightPX  int
+	PhotoWidthMM   float64 // Exact photo size; the grid is placed in millimeters and rounded per edge
+	PhotoHeightMM  float64
+	CutMarks       bool // Draw cut lines in the gaps between photos
+	Ruler          bool // Draw a millimeter reference ruler in the sheet margin
+	BleedMM        float64 // White margin per side beyond the nominal size, for borderless printing
+	BleedPX        int     // BleedMM at DPI; the sheet image is SheetSize(), the layout is in TrimBox()
+}
+
+// calculateOptimalLayout calculates the optimal grid layout for 35x45mm passport photos
+// It considers both orientations of the paper and chooses the one that fits more photos
+func calculateOptimalLayout(paper paperSize, spec PhotoSpec) (cols, rows, totalPhotos int, final paperSize) {
+	// Try both orientations and pick the one that fits more photos
+	
+	// Option 1: Original orientation
+	cols1, rows1, total1 := calculateLayoutForOrientation(paper.WidthPX, paper.HeightPX, spec)
+	
+	// Option 2: Rotated orientation (swap width and height)
+	cols2, rows2, total2 := calculateLayoutForOrientation(paper.HeightPX, paper.WidthPX, spec)
+	
+	// Choose the orientation that fits more photos
+	if total1 >= total2 {
+		return cols1, rows1, total1, paper
+	} else {
+		return cols2, rows2, total2, paper.rotated()
+	}
+}
+
+// calculateLayoutForOrientation calculates layout for a specific paper orientation
+// Maximizes photo count by calculating optimal spacing
+func calculateLayoutForOrientation(widthPX, heightPX int, spec PhotoSpec) (cols, rows, totalPhotos int) {
+	// Use configurable minimum spacing
+	minSpacingPX := mmToPX(MIN_SPACING_MM, spec.DPI)
+	minMarginPX := minSpacingPX
+	
+	// Calculate maximum photos that can fit with minimum spacing
+	// Formula: (paperSize - 2*margin) >= cols*photoSize + (cols-1)*spacing
+	// Rearranged: cols <= (paperSize - 2*margin + spacing) / (photoSize + spacing)
+	
+	maxCols := (widthPX - 2*minMarginPX + minSpacingPX) / (spec.WidthPX + minSpacingPX)
+	maxRows := (heightPX - 2*minMarginPX + minSpacingPX) / (spec.HeightPX + minSpacingPX)
+	
+	cols = maxCols
+	rows = maxRows
+	totalPhotos = cols * rows
+	
+	// Ensure at least 1 photo can fit
+	if cols < 1 || rows < 1 {
+		cols, rows, totalPhotos = 1, 1, 1
+	}
+	
+	return cols, rows, totalPhotos
+}
+
+// createDynamicPrintFormat creates a PrintFormat with optimal layout calculation
+func createDynamicPrintFormat(name string, widthMM, heightMM int, spec PhotoSpec) PrintFormat {
+	return createPrintFormat(name, metricPaper(widthMM, heightMM, spec.DPI), spec)
+}
+
+// createPrintFormat lays out the photos on the given paper; name doubles as the key
+// in output filenames, so it must not contain spaces or parentheses
+func createPrintFormat(name string, paper paperSize, spec PhotoSpec) PrintFormat {
+	cols, rows, totalPhotos, final := calculateOptimalLayout(paper, spec)
+	
+	// Add orientation info to name if paper was rotated
+	orientationInfo := ""
+	if final != paper {
+		orientationInfo = fmt.Sprintf(" [rotated to %s]", final)
+	}
+	
+	return PrintFormat{
+		Key:            name,
+		Name:           fmt.Sprintf("%s%s (%d photos)", name, orientationInfo, totalPhotos),
+		WidthMM:        final.WidthMM,
+		HeightMM:       final.HeightMM,
+		WidthPX:        final.WidthPX,
+		HeightPX:       final.HeightPX,
+		DPI:            spec.DPI,
+		PhotosPerSheet: totalPhotos,
+		Columns:        cols,
+		Rows:           rows,
+		PhotoWidthPX:   spec.WidthPX,
+		PhotoHeightPX:  spec.HeightPX,
+		PhotoWidthMM:   spec.WidthMM,
+		PhotoHeightMM:  spec.HeightMM,
+	}
+}
+
+// getPredefinedFormats returns the standard print formats with dynamic calculation for the given photo spec.
+// The metric sizes are the usual European photo prints, the inch sizes those of US print services.
+func getPredefinedFormats(spec PhotoSpec) []PrintFormat {
+	return []PrintFormat{
+		createDynamicPrintFormat("10x15cm", 150, 100, spec), // Landscape: 15x10cm
+		createDynamicPrintFormat("13x18cm", 180, 130, spec), // Landscape: 18x13cm
+		createPrintFormat("4x6in", inchPaper(6, 4, spec.DPI), spec),   // 1800x1200 pixels at 300 DPI
+		createPrintFormat("5x7in", inchPaper(5, 7, spec.DPI), spec),   // 1500x2100 pixels at 300 DPI
+		createPrintFormat("8x10in", inchPaper(8, 10, spec.DPI), spec), // 2400x3000 pixels at 300 DPI
+	}
+}
+
+type Config struct {
+	InputPath     string // File path, or STREAM_PATH for stdin
+	BatchDir      string // Process every image in this directory instead of InputPath
+	WatchDir      string // Process every image dropped into this directory (watch subcommand)
+	Jobs          int    // Images -batch, the watch subcommand and the server process at the same time
+	OutputPath    string // Sheet output overriding the generated name, or STREAM_PATH for stdout
+	Spec          PhotoSpec
+	PrintFormats  []PrintFormat
+	Detection     DetectionOptions
+	Detector      *FaceDetector // Loaded face cascade shared by every image; nil loads it on demand
+	LabelText     string // Optional proof label / customer name drawn on the sheet
+	LabelPosition string
+	Save          SaveOptions // Encoding of the print sheet
+	TileOutput    bool        // Split sheets larger than Save.MaxDimension into tiles instead of failing
+	SavePhoto     bool        // Also write the single passport photo
+	PhotoSave     SaveOptions // Encoding of the single passport photo
+	NativeCrop    bool        // Also write the crop at the input's full resolution, before the downscale
+	Debug         bool // Write an annotated debug image of the detection
+	KeepArtifacts bool // Keep the -preview images and name the debug images after the input
+	Sharpen       SharpenOptions
+	ColorProfile  string // COLOR_PROFILE_SRGB or COLOR_PROFILE_KEEP
+	OpenResult    bool   // Show the saved sheets in the default image viewer
+	CropReport    bool   // Write <input>_crop.json with the crop in source pixels
+	XMPSidecar    bool   // Write <input>.xmp with the crop as Lightroom settings
+	Strategy      string        // Crop strategy, STRATEGY_AUTO tries them all in order
+	Prompt        Prompter // Asks for the manual crop and the preview; nil when nobody can answer
+	Preview       bool          // Show a preview of the layouts and ask before saving
+	PreviewScale  float64       // Preview size as multiple of PREVIEW_BASE_SIZE; 0 lists the layouts without images
+	PreviewGuides bool          // Draw the spec's reference lines over the photos of the preview
+	Calibration   Calibration   // Detector offset from the calibrate subcommand
+	Pad           string        // PAD_SNAP, or how to fill a face-centered crop past the image edge
+	CenterWeight  string        // CENTER_WEIGHT_SALIENCY or CENTER_WEIGHT_FIXED placement of the center-weighted crop
+	EyeOcclusion  float64       // Covered fraction of an eye band (0-1) that triggers the occlusion warning
+	MinCropScale  float64       // Crop pixels per photo pixel below which the crop is refused
+	MaxMegapixels float64       // Larger inputs are downscaled to this size right after decoding; 0 keeps them
+	SafeMargin    float64       // Margin along the cut edges in mm the head must stay clear of; 0 checks nothing
+	AppendPath    string        // Existing sheet whose free slots receive the photo instead of a new sheet
+	PhotoCount    int           // Photos per sheet below the format's capacity; 0 fills the sheet
+	Flatten       bool          // Divide out a lighting gradient on the background of the photo
+	Neutralize    bool          // Shift a color cast of the background toward neutral gray
+	AutoLevels    bool          // Bring the face's median luminance toward AUTO_LEVELS_TARGET
+	WhiteBalance  bool          // Correct the color of the light, for LightKelvin or by gray world
+	LightKelvin   int           // Color temperature of the light source hint, e.g. the EXIF light source; 0 when none
+	Mirror        bool          // Flip the finished photo horizontally; analysis and debug output use the unflipped image
+	Oval          bool          // Fade the finished photo into white outside an oval around the head
+	GridOnly      bool          // The input is a finished photo: skip detection and cropping, only tile it
+	Force         bool          // With GridOnly, center-crop inputs of the wrong aspect ratio instead of failing
+	AlphaColor    color.RGBA    // Transparent areas of the input are filled with this color
+	Grayscale     bool          // Set by processPhoto for black-and-white inputs; skin color checks are skipped
+	CompareEyes   []float64     // Also crop at these eye lines and pick one of the candidates
+	ComparePath   string        // Where the comparison image is written; empty writes none
+	ComparePick   int           // Candidate to use (1 = automatic crop); 0 asks with Prompt
+	SizeMode      string        // SIZE_MODE_IPD or SIZE_MODE_FACEBOX head sizing
+	OutputDir     string        // Directory for the sheets, photos and crop report; empty writes them next to the input
+	OutputName    string        // -output-template for the sheet file names; empty uses <input>_passport_photos_<format>.jpg
+	Separate      int           // Also write the photo as this many numbered files (0 = off)
+	NoSheet       bool          // Write no print sheet, only the photo files
+	Candidates    []string      // -pick-best inputs; the best one becomes InputPath
+	Ranking       []CandidateScore // Scores of the Candidates, best first, for the crop report
+	Context       context.Context  // Generate gives up between pipeline stages once it is done; nil never gives up
+}
+
+// DetectionOptions tunes the face detector
+type DetectionOptions struct {
+	MinConfidence float64 // Minimum detection score to accept a face
+	ClusterIoU    float64 // IoU threshold for clustering overlapping detections
+	RotateSearch  bool    // Retry on copies tilted by ±ROTATE_SEARCH_ANGLE when nothing is found
+	MinFaceRatio  float64 // Smallest face as fraction of the short side (0 = DEFAULT_MIN_FACE_RATIO)
+	MaxFaceRatio  float64 // Largest face as fraction of the short side (0 = DEFAULT_MAX_FACE_RATIO)
+}
+
+// faceSizeRange returns the face size range with the defaults filled in
+func (o DetectionOptions) faceSizeRange() (float64, float64) {
+	minRatio, maxRatio := o.MinFaceRatio, o.MaxFaceRatio
+	if minRatio == 0 {
+		minRatio = DEFAULT_MIN_FACE_RATIO
+	}
+	if maxRatio == 0 {
+		maxRatio = DEFAULT_MAX_FACE_RATIO
+	}
+	return minRatio, maxRatio
+}
+
+// cliFlags holds the command line flags in a set of their own, so importing the
+// package doesn't add them to the flag.CommandLine of other programs
+var cliFlags = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+// Command line flags (must be given before the input path)
+var (
+	inputFlag         = cliFlags.String("input", "", "Input image path, or - to read the image from stdin (disables prompts)")
+	pickBestFlag      = cliFlags.Bool("pick-best", false, "Take every path argument as a shot of the same person, rank them by face confidence, sharpness, open eyes and exposure, and continue with the best (use -format for the print format)")
+	batchFlag         = cliFlags.String("batch", "", "Process every image in this directory and write "+OVERVIEW_IMAGE_NAME+" there")
+	jobsFlag          = cliFlags.Int("jobs", runtime.NumCPU(), "Images -batch, the watch subcommand and the server process at the same time")
+	outputFlag        = cliFlags.String("output", "", "Sheet output path, or - to write it to stdout (single format only)")
+	templateFlag      = cliFlags.String("output-template", "", "Sheet file name with placeholders {name}, {format}, {spec}, {ext}, {date}, {datetime} (when the photo was taken) and {count}, e.g. {name}_{spec}_{format}_{datetime}.jpg")
+	overwriteFlag     = cliFlags.Bool("overwrite", false, "Replace existing output files; by default a new file gets a free name with _2, _3, ... instead")
+	formatFlag        = cliFlags.String("format", "", "Comma-separated print formats to generate, e.g. 1,2 or 10x15,13x18 or 4x6in (also 5x7in, 8x10in)")
+	specFlag          = cliFlags.String("spec", DEFAULT_SPEC_KEY, "Photo standard to generate: "+strings.Join(photoSpecKeys(), ", "))
+	eyeLineFlag       = cliFlags.Float64("eye-line", 0, "Eye height above the bottom edge as fraction of the photo height (0-1, default: from -spec)")
+	headMarginFlag    = cliFlags.Float64("head-margin", 0, "Space above the crown as fraction of the photo height, e.g. 0.08; places the head by its crown instead of the eye line (default: from -spec)")
+	dpiFlag           = cliFlags.Int("dpi", DPI, "Print resolution of the photo and sheets, e.g. 600 for high-resolution printers (72-1200)")
+	photoWidthFlag    = cliFlags.Float64("photo-w-mm", 0, "Photo width in millimeters, overriding the spec's size (use with -photo-h-mm, e.g. 40 and 50)")
+	photoHeightFlag   = cliFlags.Float64("photo-h-mm", 0, "Photo height in millimeters, overriding the spec's size (use with -photo-w-mm)")
+	minConfidenceFlag = cliFlags.Float64("min-confidence", DEFAULT_MIN_CONFIDENCE, "Minimum face detection score; raise (e.g. 5) to reject false positives")
+	minFaceFlag       = cliFlags.Float64("min-face", DEFAULT_MIN_FACE_RATIO, "Smallest face searched for, as fraction of the image's shorter side")
+	maxFaceFlag       = cliFlags.Float64("max-face", DEFAULT_MAX_FACE_RATIO, "Largest face searched for, as fraction of the image's shorter side")
+	clusterIoUFlag    = cliFlags.Float64("cluster-iou", DEFAULT_CLUSTER_IOU, "IoU threshold (0-1) for merging overlapping face detections")
+	rotateSearchFlag  = cliFlags.Bool("rotate-search", false, "Retry face detection on copies tilted by ±20° when the upright search finds nothing (slower)")
+	verboseFlag       = cliFlags.Bool("verbose", false, "Log each face detection pass and its result (same as -log-level debug)")
+	logFormatFlag     = cliFlags.String("log-format", LOG_FORMAT_TEXT, "Log format: text (console messages) or json (one object per line on stderr)")
+	logLevelFlag      = cliFlags.String("log-level", "info", "Log level: debug, info, warn or error (warn and error keep stdout for the results only)")
+	langFlag          = cliFlags.String("lang", "", "Language of the prompts and the result summary: en or de (default: from LC_ALL, LC_MESSAGES or LANG)")
+	unitsFlag         = cliFlags.String("units", "", "Unit of the reported lengths (head height, margins, photo and sheet sizes, compliance report): mm or in (default: in for the us-* specs, else mm)")
+	labelFlag         = cliFlags.String("label", "", "Text label drawn on the sheet, e.g. PROOF or a customer name (off by default)")
+	labelPositionFlag = cliFlags.String("label-position", "bottom-right", "Label position: "+strings.Join(labelPositions, ", "))
+	layoutFlag        = cliFlags.String("layout", LAYOUT_SHEET, "Layout: sheet (print formats) or strip (photo booth strip of four, no format prompt)")
+	cutMarksFlag      = cliFlags.Bool("cut-marks", false, "Draw cut lines between the photos")
+	bleedFlag         = cliFlags.Float64("bleed", 0, "White bleed margin in millimeters added on every side of the sheets for borderless printing, e.g. 3 (0-10); the photos stay placed on the nominal format")
+	rulerFlag         = cliFlags.Bool("ruler", false, "Draw a 50mm reference ruler with 10mm ticks in the sheet margin to check the print scale")
+	photosFlag        = cliFlags.Int("photos", 0, "Number of photos needed; picks the print format that fits them with the least wasted paper")
+	flattenFlag       = cliFlags.Bool("flatten-background", false, "Even out a lighting gradient on the background (the subject is left untouched; -debug writes the fitted field to "+DEBUG_FIELD_IMAGE_PATH+")")
+	whiteBalanceFlag  = cliFlags.Bool("white-balance", false, "Correct the color of the light toward daylight: for the light source in the EXIF data when the camera recorded one, else by gray world")
+	autoLevelsFlag    = cliFlags.Bool("auto-levels", false, "Brighten or darken the photo so the face's median luminance approaches 0.55 (gain ±25%, gamma 0.8-1.25, highlights protected)")
+	neutralizeFlag    = cliFlags.Bool("neutralize-background", false, "Shift a color cast of the background (e.g. a tinted wall) toward neutral gray; the face box masks the subject")
+	mirrorFlag        = cliFlags.Bool("mirror", false, "Flip the passport photo horizontally before the layout, e.g. to undo a mirrored front camera selfie")
+	ovalFlag          = cliFlags.Bool("oval", false, "Fade the passport photo into white outside a feathered oval sized to the head, for ID photos that want an oval vignette (default: rectangular)")
+	countFlag         = cliFlags.Int("count", 0, "Photos per sheet, fewer than the format holds and centered (0 = as many as fit; with -append, at most this many are added)")
+	deviceFlag        = cliFlags.String("device", defaultCaptureDevice(), "Camera device for the capture subcommand")
+	calibrationFlag   = cliFlags.String("calibration", defaultCalibrationPath(), "Calibration file written by the calibrate subcommand and applied to face detection")
+	pupilsFlag        = cliFlags.String("pupils", "", "True pupil centers for the calibrate subcommand as leftX,leftY,rightX,rightY (asked for when empty)")
+	apiFlag           = cliFlags.Bool("api", false, "Serve the JSON REST API with /healthz and /metrics (server subcommand)")
+	listenFlag        = cliFlags.String("listen", DEFAULT_SERVER_ADDRESS, "Address the server subcommand listens on")
+	timeoutFlag       = cliFlags.Duration("request-timeout", DEFAULT_REQUEST_TIMEOUT, "Time limit of one API request including the wait for a free worker, e.g. 30s")
+	metadataFlag      = cliFlags.String("metadata", METADATA_DPI, "Output metadata: dpi (JFIF resolution only) or none")
+	stripFlag         = cliFlags.String("strip-metadata", STRIP_METADATA_PHOTO, "Outputs guaranteed to hold nothing but pixels, JFIF density and a kept ICC profile: photo (the single photo for uploads), all or none")
+	assumeOrientFlag  = cliFlags.String("assume-orientation", "", "Orientation to apply instead of the EXIF tag, for mis-tagged files: clockwise turn 0, 90, 180 or 270, optionally with -flip (e.g. 90-flip) to also mirror")
+	ignoreExifFlag    = cliFlags.Bool("ignore-exif-orientation", false, "Ignore the EXIF orientation tag and use the stored pixels as they are")
+	colorProfileFlag  = cliFlags.String("color-profile", COLOR_PROFILE_SRGB, "Non-sRGB source profiles (e.g. Adobe RGB): srgb converts the colors, keep embeds the profile")
+	appendFlag        = cliFlags.String("append", "", "Place the photo into the free slots of this existing sheet and save it back, instead of creating a new sheet")
+	gridOnlyFlag      = cliFlags.Bool("grid-only", false, "The input already is a passport photo: skip face detection and cropping, only tile it onto the sheets")
+	validateOnlyFlag  = cliFlags.Bool("validate-only", false, "Check an existing passport photo against the spec and print a pass/fail report without writing any image (exit status 1 on failure)")
+	compareFlag       = cliFlags.String("compare", "", "Compare the automatic crop with crops at these eye lines (e.g. 0.55,0.57,0.6) in <input>_compare.jpg and pick one")
+	pickFlag          = cliFlags.Int("pick", 0, "With -compare, use this candidate (1 = automatic crop) instead of asking")
+	forceFlag         = cliFlags.Bool("force", false, "With -grid-only, cut the center of inputs whose aspect ratio doesn't match the photo spec instead of failing")
+	alphaColorFlag    = cliFlags.String("alpha-background", DEFAULT_ALPHA_BACKGROUND, "Color for transparent areas of the input (e.g. cut-out PNGs): white, gray, black or #RRGGBB")
+	previewFlag       = cliFlags.Bool("preview", false, "Show a downscaled preview of each print layout and ask before saving anything")
+	previewGuidesFlag = cliFlags.Bool("preview-guides", false, "Draw the target eye line, the crown and chin band and the center line over the -preview photos, never on the saved sheets (default on in interactive mode)")
+	previewScaleFlag  = cliFlags.Float64("preview-scale", DEFAULT_PREVIEW_SCALE, "Size of the -preview images for high-DPI screens (3 = 1200 pixels, at most 4000); 0 lists the layouts without writing images")
+	noOpenFlag        = cliFlags.Bool("no-open", false, "Don't open the finished sheet in the image viewer after interactive runs (for servers/CI)")
+	cropReportFlag    = cliFlags.Bool("crop-report", false, "Write <input>_crop.json with the crop rectangle in the source file's pixels")
+	safeMarginFlag    = cliFlags.Float64("safe-margin", 0, "Warn when the head comes closer than this many millimeters to a cut edge of the photo, e.g. for cutters that round the corners (0 = off)")
+	maxMegapixelsFlag = cliFlags.Float64("max-megapixels", 0, "Downscale larger inputs to this many megapixels right after decoding, to bound memory and time (0 = full resolution); the server refuses larger uploads instead (0 = 100)")
+	minCropScaleFlag  = cliFlags.Float64("min-crop-scale", DEFAULT_MIN_CROP_SCALE, "Refuse crops with fewer pixels than this fraction (0-1) of the photo's, e.g. a small face in a group photo; below 1 a warning is given")
+	eyeOcclusionFlag  = cliFlags.Float64("max-eye-occlusion", DEFAULT_MAX_EYE_OCCLUSION, "Warn when hair or an object covers more than this fraction (0-1) of the eye and eyebrow band")
+	sizeModeFlag      = cliFlags.String("size-mode", SIZE_MODE_IPD, "Head sizing: ipd (from the interpupillary distance when the pupils are located, else the face box) or facebox")
+	centerWeightFlag  = cliFlags.String("center-weight", CENTER_WEIGHT_SALIENCY, "Placement of the center-weighted fallback crop: saliency (visual center of mass) or fixed (upper middle)")
+	padFlag           = cliFlags.String("pad", PAD_SNAP, "When the crop reaches past the image edge: snap (move it inside), or keep the face centered and pad with white, replicate or mirror")
+	strategyFlag      = cliFlags.String("strategy", STRATEGY_AUTO, "Crop strategy: auto (face, then saliency, center and manual as fallbacks), or force face, saliency, center or manual")
+	xmpFlag           = cliFlags.Bool("xmp", false, "Write an <input>.xmp sidecar with the crop as Lightroom/Camera Raw settings")
+	debugFlag         = cliFlags.Bool("debug", false, "Write "+DEBUG_IMAGE_PATH+" showing the detected face, head and crop boxes")
+	keepArtifactsFlag = cliFlags.Bool("keep-artifacts", false, "Keep the -preview images as <input>_preview_<format>.jpg and write the -debug images as <input>_debug_*.jpg next to the outputs")
+	jpegQualityFlag   = cliFlags.Int("jpeg-quality", DEFAULT_JPEG_QUALITY, "JPEG quality (1-100) of the print sheet")
+	jpeg444Flag       = cliFlags.Bool("jpeg-444", false, "Write the print sheet without chroma subsampling (4:4:4, larger file)")
+	cmykFlag          = cliFlags.Bool("cmyk", false, "Write the print sheet as a CMYK JPEG for print shops (basic conversion, no ICC profile)")
+	separateFlag      = cliFlags.Bool("separate", false, "Also write the passport photo as numbered files <input>_passport_photo_1.jpg ... _N.jpg, N from -photos or -count, else as many as the sheet holds")
+	noSheetFlag       = cliFlags.Bool("no-sheet", false, "Write no print sheet, only the photo files (-separate or -save-photo)")
+	outDirFlag        = cliFlags.String("outdir", "", "Directory for the written sheets, photos and crop reports, created when missing (default: next to the input)")
+	savePhotoFlag     = cliFlags.Bool("save-photo", false, "Also save the single passport photo next to the sheet")
+	nativeCropFlag    = cliFlags.Bool("native-crop", false, "Also save the crop at the source image's full resolution as <input>_native_crop.jpg, for archiving")
+	photoQualityFlag  = cliFlags.Int("photo-jpeg-quality", DEFAULT_JPEG_QUALITY, "JPEG quality (1-100) of the single passport photo")
+	photo444Flag      = cliFlags.Bool("photo-jpeg-444", false, "Write the single passport photo without chroma subsampling (4:4:4)")
+	maxFileSizeFlag   = cliFlags.String("max-file-size", "", "Maximum size of each written sheet and photo, e.g. 3MB or 500KB; lowers the JPEG quality until it fits")
+	maxOutputFlag     = cliFlags.Int("max-output-px", DEFAULT_MAX_OUTPUT_DIMENSION, "Largest width and height in pixels of a written sheet or photo; larger ones are refused with their estimated file size (1000-65535)")
+	tileOutputFlag    = cliFlags.Bool("tile-output", false, "Split sheets larger than -max-output-px into numbered tiles <sheet>_tile_1.jpg ... instead of refusing them")
+	resizeFlag        = cliFlags.String("resize", RESIZE_HIGH_QUALITY, "Resize implementation: high-quality, or deterministic (integer-only, for reproducible test images)")
+	sharpenFlag       = cliFlags.Bool("sharpen", false, "Apply an unsharp mask after downscaling to restore crispness")
+	sharpenAmountFlag = cliFlags.Float64("sharpen-amount", DEFAULT_SHARPEN_AMOUNT, "Unsharp mask strength (0-2)")
+	sharpenRadiusFlag = cliFlags.Float64("sharpen-radius", DEFAULT_SHARPEN_RADIUS, "Unsharp mask blur radius in pixels (0.3-5)")
+)
+
+type FaceDetection struct {
+	X, Y, Size int
+	Score      float32
+	Pupils     *Pupils // Located pupil centers; nil without the pupil cascade or when they weren't found
+}
+
+// Main runs the command line tool on os.Args: the subcommands, the interactive
+// prompts, and the batch and single-photo modes
+func Main() {
+	// Subcommands are given before any flags, e.g. "capture -device /dev/video1"
+	captureMode := false
+	calibrateMode := false
+	watchMode := false
+	serverMode := false
+	selfTestMode := false
+	if len(os.Args) > 1 && (os.Args[1] == "capture" || os.Args[1] == "calibrate" || os.Args[1] == "watch" || os.Args[1] == "server" || os.Args[1] == "selftest") {
+		captureMode = os.Args[1] == "capture"
+		calibrateMode = os.Args[1] == "calibrate"
+		watchMode = os.Args[1] == "watch"
+		serverMode = os.Args[1] == "server"
+		selfTestMode = os.Args[1] == "selftest"
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	cliFlags.Parse(os.Args[1:])
+
+	// The self-test only prints its stages, and the pipeline's details with -verbose
+	logLevel := *logLevelFlag
+	if selfTestMode && !*verboseFlag {
+		logLevel = "warn"
+	}
+	if err := setupLogging(*logFormatFlag, logLevel, *verboseFlag); err != nil {
+		log.Fatal(err)
+	}
+	language = detectLanguage()
+	if *langFlag != "" {
+		if err := validateLanguage(*langFlag); err != nil {
+			log.Fatal(err)
+		}
+		language = *langFlag
+	}
+	overwriteOutputs = *overwriteFlag
+	units = defaultUnits(*specFlag)
+	if *unitsFlag != "" {
+		if err := setUnits(*unitsFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Calibration only measures the detector against known pupil positions
+	if calibrateMode {
+		if cliFlags.NArg() != 1 {
+			log.Fatal(msg("usage.calibrate"))
+		}
+		err := runCalibration(cleanInputPath(cliFlags.Arg(0)), *pupilsFlag, *calibrationFlag, DetectionOptions{
+			MinConfidence: *minConfidenceFlag,
+			ClusterIoU:    *clusterIoUFlag,
+			MinFaceRatio:  *minFaceFlag,
+			MaxFaceRatio:  *maxFaceFlag,
+		}, NewTerminalPrompter(os.Stdin))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The self-test checks the installation on the bundled sample and writes no files
+	if selfTestMode {
+		if cliFlags.NArg() != 0 {
+			log.Fatal(msg("usage.selftest"))
+		}
+		config := defaultConfig()
+		config.Detection = DetectionOptions{
+			MinConfidence: *minConfidenceFlag,
+			ClusterIoU:    *clusterIoUFlag,
+			MinFaceRatio:  *minFaceFlag,
+			MaxFaceRatio:  *maxFaceFlag,
+		}
+		if !runSelfTest(config) {
+			fmt.Print(msg("selftest.failed"))
+			os.Exit(1)
+		}
+		fmt.Print(msg("selftest.passed"))
+		return
+	}
+
+	// The API server takes its settings per request and never prompts
+	if serverMode {
+		if !*apiFlag || cliFlags.NArg() != 0 {
+			log.Fatal(msg("usage.server"))
+		}
+		err := runServer(ServerOptions{
+			Address: *listenFlag,
+			Jobs:    *jobsFlag,
+			Timeout: *timeoutFlag,
+			Detection: DetectionOptions{
+				MinConfidence: *minConfidenceFlag,
+				ClusterIoU:    *clusterIoUFlag,
+				MinFaceRatio:  *minFaceFlag,
+				MaxFaceRatio:  *maxFaceFlag,
+			},
+			MaxMegapixels: *maxMegapixelsFlag,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The hot folder takes its incoming and outgoing directories as arguments
+	watchDir := ""
+	if watchMode {
+		if cliFlags.NArg() != 2 {
+			log.Fatal(msg("usage.watch"))
+		}
+		watchDir = cliFlags.Arg(0)
+	}
+
+	// Streaming the sheet to stdout: keep console output off the image data
+	if *outputFlag == STREAM_PATH {
+		redirectConsoleToStderr()
+	}
+
+	// Capture a photo from the camera first; it then enters the normal pipeline
+	capturedPath := ""
+	if captureMode {
+		var err error
+		capturedPath, err = captureFromCamera(*deviceFlag, ".", DetectionOptions{
+			MinConfidence: *minConfidenceFlag,
+			ClusterIoU:    *clusterIoUFlag,
+			MinFaceRatio:  *minFaceFlag,
+			MaxFaceRatio:  *maxFaceFlag,
+		})
+		if err != nil {
+			log.Fatal(msg("error.camera", err))
+		}
+	}
+
+	// A single prompter is shared by every prompt so buffered piped input is never lost
+	prompter := NewTerminalPrompter(os.Stdin)
+	config := getConfig(prompter, capturedPath, watchDir)
+
+	// Load the face cascade once for every image of the run. Without it the face
+	// strategy reports the missing model and the fallbacks take over.
+	if !config.GridOnly {
+		if detector, err := NewFaceDetector(FACE_CASCADE_PATH, config.Detection); err == nil {
+			config.Detector = detector
+		}
+	}
+
+	logInfo("Passport Photo Generator - %s %s Standard", formatPhysicalSize(config.Spec.WidthMM, config.Spec.HeightMM, -1), config.Spec.Name)
+	logInfo("================================================")
+
+	// Several shots of the same person: continue with the best one
+	if len(config.Candidates) > 0 {
+		detector := config.Detector
+		if detector == nil {
+			var err error
+			if detector, err = NewFaceDetector(FACE_CASCADE_PATH, config.Detection); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var prompt Prompter
+		if canPrompt(prompter) {
+			prompt = prompter
+		}
+		var err error
+		if config.InputPath, config.Ranking, err = pickBest(config.Candidates, detector, prompt); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Validation only checks an existing photo and never writes an image
+	if *validateOnlyFlag {
+		compliance, err := validateInput(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printComplianceResult(compliance)
+		if !compliance.Passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Watch mode: every image dropped into a directory, until stopped
+	if config.WatchDir != "" {
+		if err := runWatch(config); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Batch mode: every image of a directory with the same settings
+	if config.BatchDir != "" {
+		if !runBatch(config) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	result, err := generateOutputs(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !result.Background.Passed {
+		logError(msg("summary.background"))
+		os.Exit(1)
+	}
+	fmt.Print(msg("summary.ready"))
+
+	if config.OpenResult {
+		openOutputs(result)
+	}
+}
+
+// generateOutputs processes config.InputPath and writes the sheets (and optionally the
+// single photo) next to it
+func generateOutputs(config Config) (*Result, error) {
+	// Load and process the image (EXIF orientation is applied while decoding)
+	source, err := loadImage(config.InputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading image: %v", err)
+	}
+
+	// Huge inputs are downscaled once before any per-pixel step and the full image is
+	// let go; the crop is still reported in the pixels of the file
+	sourceSize := source.Image.Bounds().Size()
+	img := capMegapixels(source.Image, config.MaxMegapixels)
+	source.Image = nil
+
+	// Convert wide-gamut sources to sRGB, or carry their profile over to the output
+	img, profile := applyColorProfile(img, source.ICCProfile, config.ColorProfile)
+	config.Save.ICCProfile = profile
+	config.PhotoSave.ICCProfile = profile
+
+	// The light the camera recorded seeds the white balance
+	if config.WhiteBalance && source.LightKelvin > 0 {
+		logInfo("🌡️  EXIF light source: %s (%dK)", source.LightSource, source.LightKelvin)
+		config.LightKelvin = source.LightKelvin
+	}
+
+	// Align the face, check the background, and lay out every requested sheet
+	result, err := processPhoto(img, config)
+	if err != nil {
+		return nil, err
+	}
+	loadedCrop := result.Crop
+	result.Crop = scaleCropGeometry(result.Crop, img.Bounds().Size(), sourceSize)
+
+	// Relate the crop to the resolution a scanner declared in the file
+	result.Resolution = checkInputResolution(source.DPI, source.DPISource, result.Crop.Rect, config.Spec, config.GridOnly)
+	printResolutionCheck(result.Resolution, config.Spec)
+
+	// Fill the free slots of an existing sheet instead of starting a new one
+	if config.AppendPath != "" {
+		sheet, err := appendToSheet(config.AppendPath, result.Photo, config.PrintFormats, config.Spec, config.PhotoCount)
+		if err != nil {
+			return nil, err
+		}
+		result.Sheets = []Sheet{sheet}
+	}
+
+	// Confirm crop and layout in one step before anything is written
+	if config.Preview {
+		accepted, err := confirmLayout(result, config)
+		if err != nil {
+			return nil, err
+		}
+		if !accepted {
+			return nil, fmt.Errorf("layout not accepted, nothing was saved")
+		}
+	}
+
+	// Report the crop in the file's own pixels for external editors
+	sourceCrop := result.Crop.InSource(source.Orientation, sourceSize)
+	printSourceCrop(sourceCrop)
+	if err := writeCropReports(config, sourceCrop, result); err != nil {
+		return nil, err
+	}
+
+	// Optionally save the single passport photo as well
+	if config.SavePhoto {
+		photoPath := availableOutputPath(buildPhotoOutputPath(config.InputPath, config.OutputDir))
+		size, quality, err := saveImage(result.Photo, photoPath, config.PhotoSave)
+		if err != nil {
+			return nil, fmt.Errorf("error saving passport photo: %v", err)
+		}
+		fmt.Print(msg("summary.photo_saved", photoPath, describeOutputFile(size, quality, config.PhotoSave)))
+	}
+
+	// Optionally archive the crop at the full resolution of the input
+	if config.NativeCrop {
+		if err := saveNativeCrop(img, loadedCrop, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Individual numbered copies for print services that don't take sheets
+	if config.Separate > 0 {
+		if _, err := saveSeparatePhotos(result.Photo, config, config.Separate); err != nil {
+			return nil, err
+		}
+	}
+	if config.NoSheet {
+		result.Sheets = nil
+	}
+
+	for i, sheet := range result.Sheets {
+		format := sheet.Format
+
+		// Save the result; an appended sheet is written back to its own file, any
+		// other one gets a free name unless -overwrite is given
+		outputPath := config.OutputPath
+		if outputPath == "" {
+			outputPath = sheet.Path
+		}
+		if outputPath == "" {
+			outputPath = buildOutputPath(config.InputPath, config.OutputDir, config.OutputName, config.Spec.Key, format)
+		}
+		var size, quality int
+		tiled := config.TileOutput && checkOutputDimensions(sheet.Image.Bounds().Size(), config.Save) != nil
+		if !tiled && outputPath != sheet.Path {
+			outputPath = availableOutputPath(outputPath)
+		}
+		if tiled {
+			size, quality, err = saveTiles(sheet.Image, outputPath, config.Save)
+		} else {
+			size, quality, err = saveImage(sheet.Image, outputPath, config.Save)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving image: %v", err)
+		}
+		result.Sheets[i].Path = outputPath
+
+		switch {
+		case tiled:
+			fmt.Print(msg("summary.tiles", outputPath))
+		case outputPath == STREAM_PATH:
+			fmt.Print(msg("summary.stdout"))
+		default:
+			fmt.Print(msg("summary.saved", outputPath))
+		}
+		fmt.Print(msg("summary.file", describeOutputFile(size, quality, config.Save)))
+		fmt.Print(msg("summary.format", format.Name, format.PhotosPerSheet, format.Columns, format.Rows))
+		if format.BleedPX > 0 {
+			size := format.SheetSize()
+			fmt.Print(msg("summary.bleed", localizeDecimals(formatLength(format.BleedMM, -1)), size.X, size.Y,
+				localizeDecimals(formatPhysicalSize(format.WidthMM, format.HeightMM, -1)), format.WidthPX, format.HeightPX))
+		}
+		fmt.Print(msg("summary.strategy", result.Strategy))
+	}
+	return result, nil
+}
+
+// presetInputPath, when set (e.g. a captured camera frame), replaces the input path argument
+func getConfig(prompter Prompter, presetInputPath, watchDir string) Config {
+	var inputPath string
+	var selectedFormats []PrintFormat
+	
+	spec, err := lookupPhotoSpec(*specFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	// -photo-w-mm and -photo-h-mm replace the spec's photo size; the pixel size,
+	// crop and layout all follow from it
+	if *photoWidthFlag != 0 || *photoHeightFlag != 0 {
+		if err := validatePhotoSize(*photoWidthFlag, *photoHeightFlag); err != nil {
+			log.Fatal(msg("config.photo_size", err))
+		}
+		spec = spec.WithSize(*photoWidthFlag, *photoHeightFlag)
+	}
+	
+	// -eye-line overrides the eye position of the selected spec
+	if *eyeLineFlag != 0 {
+		if err := validateEyeLine(*eyeLineFlag); err != nil {
+			log.Fatal(err)
+		}
+		spec = spec.WithEyeLine(*eyeLineFlag)
+	}
+	
+	// -head-margin places the crown instead, so the two can't be combined
+	if *headMarginFlag != 0 {
+		if *eyeLineFlag != 0 {
+			log.Fatal(msg("config.eye_line"))
+		}
+		if err := validateHeadMargin(*headMarginFlag, spec); err != nil {
+			log.Fatal(err)
+		}
+		spec = spec.WithHeadMargin(*headMarginFlag)
+	}
+	
+	// -dpi recomputes the photo size in pixels; the sheets follow from the spec
+	if err := validateDPI(*dpiFlag); err != nil {
+		log.Fatal(err)
+	}
+	spec = spec.WithDPI(*dpiFlag)
+	
+	// -safe-margin is checked against the final photo size
+	if err := validateSafeMargin(*safeMarginFlag, spec); err != nil {
+		log.Fatal(err)
+	}
+	
+	detection := DetectionOptions{
+		MinConfidence: *minConfidenceFlag,
+		ClusterIoU:    *clusterIoUFlag,
+		RotateSearch:  *rotateSearchFlag,
+		MinFaceRatio:  *minFaceFlag,
+		MaxFaceRatio:  *maxFaceFlag,
+	}
+	if err := validateDetectionOptions(detection); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateLabelPosition(*labelPositionFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateMetadataMode(*metadataFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateStripMetadataMode(*stripFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateLayoutMode(*layoutFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := setOrientationOverride(*assumeOrientFlag, *ignoreExifFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := setResizeMode(*resizeFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateStrategy(*strategyFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateCenterWeight(*centerWeightFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateSizeMode(*sizeModeFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateEyeOcclusion(*eyeOcclusionFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateMaxMegapixels(*maxMegapixelsFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateMinCropScale(*minCropScaleFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validatePreviewScale(*previewScaleFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := validatePadMode(*padFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if *gridOnlyFlag && *strategyFlag != STRATEGY_AUTO {
+		log.Fatal(msg("config.grid_strategy"))
+	}
+	if *appendFlag != "" && *batchFlag != "" {
+		log.Fatal(msg("config.append_batch"))
+	}
+	if *forceFlag && !*gridOnlyFlag {
+		log.Fatal(msg("config.force"))
+	}
+	if *nativeCropFlag && *gridOnlyFlag {
+		log.Fatal(msg("config.grid_native"))
+	}
+	
+	var compareEyes []float64
+	if *compareFlag != "" {
+		if compareEyes, err = parseEyeLines(*compareFlag); err != nil {
+			log.Fatal(err)
+		}
+		if *batchFlag != "" || *gridOnlyFlag || *validateOnlyFlag {
+			log.Fatal(msg("config.compare"))
+		}
+	}
+	if *pickFlag < 0 || (*pickFlag > 0 && *compareFlag == "") {
+		log.Fatal(msg("config.pick"))
+	}
+	if *pickBestFlag && (*batchFlag != "" || *inputFlag != "" || presetInputPath != "" || *gridOnlyFlag || *validateOnlyFlag || *compareFlag != "") {
+		log.Fatal(msg("config.pick_best"))
+	}
+	if *validateOnlyFlag && (*batchFlag != "" || *appendFlag != "" || *gridOnlyFlag || *outputFlag != "" || *previewFlag) {
+		log.Fatal(msg("config.validate_only"))
+	}
+	
+	alphaColor, err := parseColor(*alphaColorFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	calibration, err := loadCalibration(*calibrationFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := validateColorProfileMode(*colorProfileFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	if *jpegQualityFlag < 1 || *jpegQualityFlag > 100 || *photoQualityFlag < 1 || *photoQualityFlag > 100 {
+		log.Fatal(msg("config.quality"))
+	}
+	
+	if err := validateSharpenOptions(*sharpenAmountFlag, *sharpenRadiusFlag); err != nil {
+		log.Fatal(err)
+	}
+	
+	maxFileSize := 0
+	if *maxFileSizeFlag != "" {
+		if maxFileSize, err = parseFileSize(*maxFileSizeFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	if *photosFlag < 0 {
+		log.Fatal(msg("config.photos"))
+	}
+	if *photosFlag > 0 && *formatFlag != "" {
+		log.Fatal(msg("config.photos_format"))
+	}
+	if *countFlag < 0 {
+		log.Fatal(msg("config.count"))
+	}
+	
+	// An explicit -input replaces the positional path argument
+	if *inputFlag != "" && presetInputPath == "" {
+		presetInputPath = *inputFlag
+	}
+	
+	outputDir := *outDirFlag
+	if watchDir != "" {
+		if *batchFlag != "" || *inputFlag != "" || *outputFlag != "" || *appendFlag != "" || *outDirFlag != "" || *pickBestFlag ||
+			*validateOnlyFlag || *compareFlag != "" || *previewFlag || *strategyFlag == STRATEGY_MANUAL {
+			log.Fatal(msg("config.watch"))
+		}
+		if info, err := os.Stat(watchDir); err != nil || !info.IsDir() {
+			log.Fatal(msg("config.watch_dir", watchDir))
+		}
+		if *jobsFlag < 1 {
+			log.Fatal(msg("config.jobs"))
+		}
+		outputDir = cliFlags.Arg(1)
+	}
+	
+	if *batchFlag != "" {
+		if presetInputPath != "" || *outputFlag != "" {
+			log.Fatal(msg("config.batch"))
+		}
+		if info, err := os.Stat(*batchFlag); err != nil || !info.IsDir() {
+			log.Fatal(msg("config.batch_dir", *batchFlag))
+		}
+		if *jobsFlag < 1 {
+			log.Fatal(msg("config.jobs"))
+		}
+	}
+	
+	// Check for command line argument first; streaming never prompts since
+	// stdin may carry the image and stdout the result
+	var formatArg string
+	commandLineMode := cliFlags.NArg() > 0 || presetInputPath != "" || *outputFlag == STREAM_PATH || *batchFlag != "" || watchDir != ""
+	
+	// Without a terminal or piped answers every prompt would read EOF; name the
+	// options that would have been asked for instead
+	if !commandLineMode && !canPrompt(prompter) {
+		missing := []string{"the input image (path argument or -input)"}
+		if *formatFlag == "" && *photosFlag == 0 && *layoutFlag != LAYOUT_STRIP && !*validateOnlyFlag {
+			missing = append(missing, "the print format (-format)")
+		}
+		log.Fatal(missingOptionsMessage(missing))
+	}
+	var candidates []string
+	if watchDir != "" {
+		// The positional arguments are the watched directories; formats come from -format
+	} else if *batchFlag != "" {
+		// Positional arguments are print formats in batch mode
+		formatArg = cliFlags.Arg(0)
+	} else if *pickBestFlag {
+		// Every positional argument is a candidate; the best replaces the input path
+		candidates = cliFlags.Args()
+		if len(candidates) < 2 {
+			log.Fatal(msg("config.pick_best_count"))
+		}
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); err != nil {
+				log.Fatal(msg("config.input_missing", candidate))
+			}
+		}
+		inputPath = candidates[0]
+	} else if presetInputPath != "" {
+		inputPath = presetInputPath
+		if cliFlags.NArg() > 0 {
+			formatArg = cliFlags.Arg(0)
+		}
+	} else if cliFlags.NArg() > 0 {
+		inputPath, formatArg = parseCommandLineArgs()
+	} else {
+		// Interactive mode
+		inputPath, err = getInteractiveInputPath(prompter)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	// The -format flag takes precedence over the positional format argument
+	if *formatFlag != "" {
+		formatArg = *formatFlag
+	}
+	
+	switch {
+	case *validateOnlyFlag:
+		// Nothing is laid out, so no print format is needed
+	case *layoutFlag == LAYOUT_STRIP:
+		if formatArg != "" || *photosFlag > 0 {
+			log.Fatal(msg("config.strip"))
+		}
+		selectedFormats = []PrintFormat{createStripFormat(spec)}
+	case *photosFlag > 0:
+		selectedFormats = []PrintFormat{selectFormatForPhotoCount(*photosFlag, spec)}
+	case formatArg != "":
+		selectedFormats = parseFormatList(formatArg, spec)
+	case commandLineMode:
+		// Default to 10x15cm format for command line usage
+		selectedFormats = []PrintFormat{getPredefinedFormats(spec)[0]}
+		logInfo("Using default format: %s", selectedFormats[0].Name)
+	default:
+		selectedFormats, err = getInteractiveFormats(prompter, spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if inputPath == "" && *batchFlag == "" && watchDir == "" {
+		log.Fatal(msg("config.no_input"))
+	}
+	
+	// Check if file exists
+	if inputPath != STREAM_PATH && *batchFlag == "" && watchDir == "" {
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			log.Fatal(msg("config.input_missing", inputPath))
+		}
+	}
+	
+	if *cutMarksFlag {
+		for i := range selectedFormats {
+			selectedFormats[i].CutMarks = true
+		}
+	}
+	if *rulerFlag {
+		for i := range selectedFormats {
+			selectedFormats[i].Ruler = true
+		}
+	}
+	if err := validateBleed(*bleedFlag); err != nil {
+		log.Fatal(err)
+	}
+	for i := range selectedFormats {
+		selectedFormats[i] = selectedFormats[i].withBleed(*bleedFlag)
+	}
+	
+	// Oversized sheets are refused before anything is rendered, unless they are tiled
+	if err := validateMaxOutputDimension(*maxOutputFlag); err != nil {
+		log.Fatal(err)
+	}
+	if *tileOutputFlag && *outputFlag == STREAM_PATH {
+		log.Fatal(msg("config.tile_stdout"))
+	}
+	if !*tileOutputFlag {
+		sheetSave := SaveOptions{Quality: *jpegQualityFlag, Chroma444: *jpeg444Flag, MaxDimension: *maxOutputFlag}
+		for _, format := range selectedFormats {
+			if err := checkOutputDimensions(format.SheetSize(), sheetSave); err != nil {
+				log.Fatal(format.Name, ": ", err)
+			}
+		}
+	}
+	
+	if *outputFlag != "" && len(selectedFormats) > 1 {
+		log.Fatal(msg("config.output_formats"))
+	}
+	
+	// -output-template names the sheets; names that would overwrite each other are refused
+	if *templateFlag != "" {
+		if err := validateOutputTemplate(*templateFlag); err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case *outputFlag != "":
+			log.Fatal(msg("config.template_output"))
+		case len(selectedFormats) > 1 && !outputTemplateUses(*templateFlag, "format"):
+			log.Fatal(msg("config.template_format"))
+		case (*batchFlag != "" || watchDir != "") && !outputTemplateUses(*templateFlag, "name"):
+			log.Fatal(msg("config.template_name"))
+		}
+	}
+	
+	// -separate writes as many photos as were asked for, or as the sheet holds
+	separate := 0
+	if *separateFlag {
+		switch {
+		case *photosFlag > 0:
+			separate = *photosFlag
+		case *countFlag > 0:
+			separate = *countFlag
+		case len(selectedFormats) > 0:
+			separate = selectedFormats[0].PhotosPerSheet
+		}
+	}
+	if *noSheetFlag && (!*separateFlag && !*savePhotoFlag && !*nativeCropFlag || *outputFlag != "" || *appendFlag != "") {
+		log.Fatal(msg("config.no_sheet"))
+	}
+	if (*separateFlag || *noSheetFlag) && *validateOnlyFlag {
+		log.Fatal(msg("config.validate_files"))
+	}
+	if outputDir != "" {
+		if err := validateOutputDir(outputDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	// The manual crop asks on the console: always in interactive runs, and in
+	// scripted runs only when forced, stdin doesn't carry the image and someone
+	// can answer
+	var prompt Prompter
+	if !commandLineMode || (*strategyFlag == STRATEGY_MANUAL && inputPath != STREAM_PATH && canPrompt(prompter)) {
+		prompt = prompter
+	}
+	
+	// The comparison asks which crop to use unless -pick answers it
+	comparePath := ""
+	if *compareFlag != "" {
+		if *pickFlag == 0 {
+			if inputPath == STREAM_PATH || !canPrompt(prompter) {
+				log.Fatal(msg("config.compare_pick"))
+			}
+			prompt = prompter
+		}
+		comparePath = buildComparisonPath(inputPath)
+	}
+	
+	// The layout preview always asks for confirmation
+	if *previewFlag {
+		if *batchFlag != "" {
+			log.Fatal(msg("config.preview_batch"))
+		}
+		if inputPath == STREAM_PATH || !canPrompt(prompter) {
+			log.Fatal(msg("config.preview_terminal"))
+		}
+		prompt = prompter
+	}
+
+	// Reference lines help judge the crop on screen; interactive runs show them
+	// unless -preview-guides=false
+	previewGuides := !commandLineMode
+	cliFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "preview-guides" {
+			previewGuides = *previewGuidesFlag
+		}
+	})
+
+	return Config{
+		InputPath:    inputPath,
+		BatchDir:     *batchFlag,
+		WatchDir:     watchDir,
+		Jobs:         *jobsFlag,
+		OutputPath:   *outputFlag,
+		Spec:         spec,
+		PrintFormats: selectedFormats,
+		Detection:    detection,
+		LabelText:     *labelFlag,
+		LabelPosition: *labelPositionFlag,
+		Save: SaveOptions{
+			Metadata:     *metadataFlag,
+			Quality:      *jpegQualityFlag,
+			Chroma444:    *jpeg444Flag,
+			CMYK:         *cmykFlag,
+			MaxBytes:     maxFileSize,
+			DPI:          spec.DPI,
+			Strip:        *stripFlag == STRIP_METADATA_ALL,
+			MaxDimension: *maxOutputFlag,
+		},
+		TileOutput:   *tileOutputFlag,
+		SavePhoto:    *savePhotoFlag,
+		PhotoSave: SaveOptions{
+			Metadata:     *metadataFlag,
+			Quality:      *photoQualityFlag,
+			Chroma444:    *photo444Flag,
+			MaxBytes:     maxFileSize,
+			DPI:          spec.DPI,
+			Strip:        *stripFlag != STRIP_METADATA_NONE,
+			MaxDimension: *maxOutputFlag,
+		},
+		NativeCrop:   *nativeCropFlag,
+		Debug:        *debugFlag,
+		KeepArtifacts: *keepArtifactsFlag,
+		ColorProfile: *colorProfileFlag,
+		// Only interactive runs open the result; scripts, streams and batches never do
+		OpenResult:   !commandLineMode && !*noOpenFlag,
+		CropReport:   *cropReportFlag || watchDir != "",
+		XMPSidecar:   *xmpFlag,
+		Strategy:     *strategyFlag,
+		Prompt:       prompt,
+		Preview:      *previewFlag,
+		PreviewScale: *previewScaleFlag,
+		PreviewGuides: previewGuides,
+		Calibration:  calibration,
+		Pad:          *padFlag,
+		CenterWeight: *centerWeightFlag,
+		SizeMode:     *sizeModeFlag,
+		EyeOcclusion: *eyeOcclusionFlag,
+		MinCropScale: *minCropScaleFlag,
+		MaxMegapixels: *maxMegapixelsFlag,
+		SafeMargin:   *safeMarginFlag,
+		AppendPath:   *appendFlag,
+		PhotoCount:   *countFlag,
+		Mirror:       *mirrorFlag,
+		Oval:         *ovalFlag,
+		Flatten:      *flattenFlag,
+		Neutralize:   *neutralizeFlag,
+		AutoLevels:   *autoLevelsFlag,
+		WhiteBalance: *whiteBalanceFlag,
+		GridOnly:     *gridOnlyFlag,
+		Force:        *forceFlag,
+		AlphaColor:   alphaColor,
+		CompareEyes:  compareEyes,
+		ComparePath:  comparePath,
+		ComparePick:  *pickFlag,
+		OutputDir:    outputDir,
+		OutputName:   *templateFlag,
+		Separate:     separate,
+		NoSheet:      *noSheetFlag,
+		Candidates:   candidates,
+		Sharpen: SharpenOptions{
+			Enabled: *sharpenFlag,
+			Amount:  *sharpenAmountFlag,
+			Radius:  *sharpenRadiusFlag,
+		},
+	}
+}
+
+// getInteractiveFormats shows the available print formats and reads one or more
+// comma-separated choices from the user
+func getInteractiveFormats(prompter Prompter, spec PhotoSpec) ([]PrintFormat, error) {
+	// Get predefined formats with dynamic calculation
+	predefinedFormats := getPredefinedFormats(spec)
+
+	// Show available print formats
+	fmt.Print(msg("formats.available"))
+	for i, format := range predefinedFormats {
+		fmt.Print(msg("formats.item", i+1, format.Name, format.PhotosPerSheet, format.Columns, format.Rows))
+	}
+	fmt.Print(msg("formats.custom", len(predefinedFormats)+1))
+
+	formatChoice, err := prompter.Ask(msg("prompt.format", len(predefinedFormats)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	var selectedFormats []PrintFormat
+	for _, part := range strings.Split(formatChoice, ",") {
+		choice, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || choice < 1 || choice > len(predefinedFormats)+1 {
+			return nil, errors.New(msg("error.format_choice", strings.TrimSpace(part)))
+		}
+
+		if choice <= len(predefinedFormats) {
+			// Predefined format selected
+			selectedFormats = append(selectedFormats, predefinedFormats[choice-1])
+		} else {
+			// Custom format selected
+			customFormat, err := getInteractiveCustomFormat(prompter, spec)
+			if err != nil {
+				return nil, err
+			}
+			selectedFormats = append(selectedFormats, customFormat)
+		}
+	}
+
+	return selectedFormats, nil
+}
+
+// getInteractiveCustomFormat asks for custom paper dimensions in cm
+func getInteractiveCustomFormat(prompter Prompter, spec PhotoSpec) (PrintFormat, error) {
+	widthStr, err := prompter.Ask(msg("prompt.width_cm"))
+	if err != nil {
+		return PrintFormat{}, err
+	}
+	heightStr, err := prompter.Ask(msg("prompt.height_cm"))
+	if err != nil {
+		return PrintFormat{}, err
+	}
+	
+	widthCM, err1 := strconv.Atoi(widthStr)
+	heightCM, err2 := strconv.Atoi(heightStr)
+	
+	if err1 != nil || err2 != nil || widthCM <= 0 || heightCM <= 0 {
+		return PrintFormat{}, errors.New(msg("error.custom_dimensions"))
+	}
+	
+	// Convert cm to mm for internal calculation
+	widthMM := widthCM * 10
+	heightMM := heightCM * 10
+	
+	customFormat := createDynamicPrintFormat(fmt.Sprintf("%dx%dcm", widthCM, heightCM), widthMM, heightMM, spec)
+	
+	logInfo("📐 Custom format: %s", customFormat.Name)
+	return customFormat, nil
+}
+
+// buildOutputPath generates the output filename for a given print format next to the input file,
+// or in outputDir when set; a non-empty template (-output-template) replaces the fixed pattern
+func buildOutputPath(inputPath, outputDir, template, specKey string, format PrintFormat) string {
+	dir, inputName := outputLocation(inputPath, outputDir)
+	if template != "" {
+		return filepath.Join(dir, expandOutputTemplate(template, inputPath, specKey, format, time.Now()))
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s_passport_photos_%s.jpg", inputName, format.Key))
+}
+
+// buildPhotoOutputPath generates the filename of the single passport photo next to the input file,
+// or in outputDir when set
+func buildPhotoOutputPath(inputPath, outputDir string) string {
+	dir, inputName := outputLocation(inputPath, outputDir)
+	return filepath.Join(dir, fmt.Sprintf("%s_passport_photo.jpg", inputName))
+}
+
+// splitInputPath returns the directory and extension-less name that output files
+// are derived from; images read from stdin use the working directory
+func splitInputPath(inputPath string) (dir, name string) {
+	if inputPath == STREAM_PATH {
+		return ".", STREAM_INPUT_NAME
+	}
+	return filepath.Dir(inputPath), strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+}
+
+// describeOutputFile summarizes the size and encoding of a written JPEG,
+// e.g. "1.2 MB, quality 95, 4:2:0"; quality is the one actually used, which is
+// below opts.Quality when the file was shrunk to fit opts.MaxBytes
+func describeOutputFile(sizeBytes, quality int, opts SaveOptions) string {
+	subsampling := "4:2:0"
+	if opts.CMYK {
+		subsampling = "CMYK"
+	} else if opts.Chroma444 {
+		subsampling = "4:4:4"
+	}
+	qualityText := msg("file.quality", quality)
+	if opts.MaxBytes > 0 && sizeBytes > opts.MaxBytes {
+		qualityText += msg("file.still_over", formatFileSize(opts.MaxBytes))
+	} else if opts.MaxBytes > 0 && quality < opts.Quality {
+		qualityText += msg("file.lowered", opts.Quality, formatFileSize(opts.MaxBytes))
+	}
+	description := fmt.Sprintf("%s, %s, %s", formatFileSize(sizeBytes), qualityText, subsampling)
+	if opts.Strip {
+		description += msg("file.stripped")
+	}
+	return description
+}
+
+// parseCommandLineArgs handles command line argument parsing with support for file paths containing spaces
+// It returns the input path and the (optional) positional format argument
+func parseCommandLineArgs() (string, string) {
+	args := cliFlags.Args()
+	
+	// Strategy 1: Try to reconstruct file path from multiple arguments
+	// Look for a valid file by combining arguments until we find an existing file
+	var inputPath string
+	var formatArg string
+	
+	// Try different combinations of arguments to find the actual file path
+	for i := 0; i < len(args); i++ {
+		// Build potential file path from args[0] to args[i]
+		potentialPath := strings.Join(args[:i+1], " ")
+		
+		// Check if this path exists
+		if _, err := os.Stat(potentialPath); err == nil {
+			inputPath = potentialPath
+			// Remaining arguments after the file path could be format
+			if i+1 < len(args) {
+				formatArg = args[i+1]
+			}
+			break
+		}
+	}
+	
+	// If no valid file found by reconstruction, use the first argument as-is
+	// (this maintains backward compatibility for properly quoted paths)
+	if inputPath == "" {
+		inputPath = args[0]
+		if len(args) > 1 {
+			formatArg = args[1]
+		}
+	}
+	
+	return inputPath, formatArg
+}
+
+// selectFormatForPhotoCount picks the predefined format that fits the requested number of
+// photos with the least wasted paper. If no format is large enough, the one holding the most
+// photos is used and a warning is printed.
+func selectFormatForPhotoCount(count int, spec PhotoSpec) PrintFormat {
+	predefinedFormats := getPredefinedFormats(spec)
+	
+	var best PrintFormat
+	found := false
+	for _, format := range predefinedFormats {
+		if format.PhotosPerSheet < count {
+			continue
+		}
+		if !found || format.WidthMM*format.HeightMM < best.WidthMM*best.HeightMM {
+			best = format
+			found = true
+		}
+	}
+	
+	if !found {
+		best = predefinedFormats[0]
+		for _, format := range predefinedFormats {
+			if format.PhotosPerSheet > best.PhotosPerSheet {
+				best = format
+			}
+		}
+		logWarn("⚠️  No format fits %d photos, using the largest: %s", count, best.Name)
+	}
+	
+	// Efficiency: share of the sheet covered by the photos actually needed
+	photoAreaMM := spec.WidthMM * spec.HeightMM
+	usedPhotos := count
+	if usedPhotos > best.PhotosPerSheet {
+		usedPhotos = best.PhotosPerSheet
+	}
+	efficiency := float64(usedPhotos) * photoAreaMM / (best.WidthMM * best.HeightMM)
+	
+	logInfo("📐 Selected format for %d photos: %s (%.0f%% paper efficiency)", count, best.Name, efficiency*100)
+	return best
+}
+
+// parseFormatList parses a comma-separated list of format names or numbers (e.g. "1,2" or "10x15,13x18")
+// Invalid entries are skipped with a warning; if nothing valid remains the default 10x15cm format is used
+func parseFormatList(formatArg string, spec PhotoSpec) []PrintFormat {
+	var selectedFormats []PrintFormat
+	for _, part := range strings.Split(formatArg, ",") {
+		format, err := lookupPrintFormat(part, spec)
+		if err != nil {
+			logWarn("Invalid format '%s', skipping.", strings.TrimSpace(part))
+			continue
+		}
+		selectedFormats = append(selectedFormats, format)
+	}
+	
+	if len(selectedFormats) == 0 {
+		logWarn("No valid format given. Using default 10x15cm format.")
+		selectedFormats = []PrintFormat{getPredefinedFormats(spec)[0]}
+	}
+	
+	return selectedFormats
+}
+
+// getInteractiveInputPath handles interactive path input with enhanced error handling and path cleaning
+func getInteractiveInputPath(prompter Prompter) (string, error) {
+	for {
+		inputPath, err := prompter.Ask(msg("prompt.input_path"))
+		if err != nil {
+			return "", err
+		}
+		
+		// Handle common issues with interactive input
+		inputPath = cleanInputPath(inputPath)
+		
+		// Check if file exists
+		if _, err := os.Stat(inputPath); err == nil {
+			return inputPath, nil
+		}
+		
+		// File doesn't exist - provide helpful error message
+		fmt.Print(msg("input.not_found", inputPath))
+		fmt.Print(msg("input.tips"))
+	}
+}
+
+// cleanInputPath cleans up common issues with user-entered paths
+func cleanInputPath(path string) string {
+	// Remove surrounding quotes if present
+	if len(path) >= 2 {
+		if (path[0] == '"' && path[len(path)-1] == '"') ||
+		   (path[0] == '\'' && path[len(path)-1] == '\'') {
+			path = path[1 : len(path)-1]
+		}
+	}
+	
+	// Handle escaped spaces (convert "\ " back to " ")
+	path = strings.ReplaceAll(path, "\\ ", " ")
+	
+	// Expand tilde to home directory if needed
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(homeDir, path[2:])
+		}
+	}
+	
+	return path
+}
+
+// loadImage reads the input file (or stdin for STREAM_PATH) once and decodes it.
+// Also returns the embedded ICC profile, if any.
+func loadImage(path string) (*SourceImage, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	img, orientation, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	warnMirroredSelfie(data, orientation)
+	dpi, dpiSource := readInputResolution(data)
+	light, kelvin := exifLightSource(data)
+	return &SourceImage{Image: img, ICCProfile: extractICCProfile(data), Orientation: orientation, DPI: dpi, DPISource: dpiSource, LightSource: light, LightKelvin: kelvin}, nil
+}
+
+// SourceImage is a decoded input file
+type SourceImage struct {
+	Image       image.Image // Pixels with the EXIF orientation applied
+	ICCProfile  []byte      // Embedded color profile, nil if none
+	Orientation int         // Orientation applied to the stored pixels: the EXIF tag (1 when untagged) or the override
+	DPI         float64     // Resolution declared by the file, e.g. by a scanner; 0 when unknown
+	DPISource   string      // Where DPI was read: jfif, exif or png
+	LightSource string      // Light source the camera recorded in EXIF, e.g. "tungsten"; empty when none
+	LightKelvin int         // Color temperature of LightSource
+}
+
+// decodeImage decodes pixels and EXIF orientation from the same buffer, so inputs
+// that can only be read once (e.g. a stream) are handled like regular files.
+// Also returns the orientation that was applied: the EXIF tag, or the override of
+// -assume-orientation or -ignore-exif-orientation.
+func decodeImage(data []byte) (image.Image, int, error) {
+	if isGIF(data) {
+		img, err := decodeGIF(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		orientation := applyOrientationOverride(1)
+		return correctOrientation(img, orientation), orientation, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	orientation := applyOrientationOverride(exifOrientation(data))
+	return correctOrientation(img, orientation), orientation, nil
+}
+
+// exifOrientation returns the EXIF orientation tag found in data, or 1 (upright) if there is none
+func exifOrientation(data []byte) int {
+	exifData, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+
+	orientationTag, err := exifData.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	orientation, err := orientationTag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+
+	logInfo("EXIF Orientation: %d", orientation)
+	return orientation
+}
+
+// correctOrientation turns the stored pixels upright according to an EXIF orientation
+func correctOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2: // mirrored
+		return flipImageHorizontal(img)
+	case 3:
+		return rotateImage(img, 180)
+	case 4: // mirrored and upside down
+		return flipImageHorizontal(rotateImage(img, 180))
+	case 5: // transposed
+		return flipImageHorizontal(rotateImage(img, 90))
+	case 6:
+		return rotateImage(img, 90)
+	case 7: // transversed
+		return flipImageHorizontal(rotateImage(img, 270))
+	case 8:
+		return rotateImage(img, 270)
+	default:
+		return img
+	}
+}
+
+// cropWithFaceDetection detects and aligns the face. It fails when no face is found or
+// the aligned head is far outside the spec's size band. The geometry records where the
+// photo was cut from img.
+func (d *FaceDetector) cropWithFaceDetection(img image.Image, config Config) (image.Image, CropGeometry, error) {
+	spec := config.Spec
+	var crop CropGeometry
+
+	logInfo("🔍 Detecting face...")
+	
+	// Try face detection first
+	crop.DetectionPass = DETECTION_PASS_UPRIGHT
+	face, err := d.detectBest(img)
+	if err := stopped(config); err != nil {
+		return nil, crop, err
+	}
+	if err != nil || face.Score < AUTO_ROTATE_MIN_CONFIDENCE {
+		// The photo may be stored sideways without an EXIF orientation tag; an upright
+		// search then finds nothing or only a weak false positive (e.g. a single eye)
+		degrees, rotatedFace, rotErr := d.detectRotatedFace(img)
+		if rotErr == nil && (face == nil || rotatedFace.Score > face.Score) {
+			logInfo("🔄 No confident upright face - photo appears rotated, turning it %d° clockwise", degrees)
+			img = rotateImage(img, degrees)
+			crop.Rotation = degrees
+			crop.DetectionPass = DETECTION_PASS_ROTATED
+			face, err = rotatedFace, nil
+		}
+	}
+	if err != nil {
+		if err := stopped(config); err != nil {
+			return nil, crop, err
+		}
+		// A last, aggressive search before the fallback strategies take over
+		logInfo("🔍 No face found, retrying with relaxed detection parameters (best effort)...")
+		if face, err = d.detectRelaxed(img); err != nil {
+			return nil, crop, err
+		}
+		crop.DetectionPass = DETECTION_PASS_RELAXED
+		logWarn("⚠️  Face found only by the relaxed best-effort pass - check the crop carefully")
+	}
+
+	logInfo("✅ Face detected at (%d,%d) with size %d (score %.1f, %s pass)", face.X, face.Y, face.Size, face.Score, crop.DetectionPass)
+	
+	// Correct the systematic detector offset measured by the calibrate subcommand;
+	// located pupils are the true eye positions and need no correction
+	face = face.forSizeMode(config.SizeMode)
+	if face.Pupils == nil {
+		face, crop.Correction = config.Calibration.Apply(face)
+	}
+	crop.Face = image.Rect(face.X-face.Size/2, face.Y-face.Size/2, face.X+face.Size/2, face.Y+face.Size/2)
+	
+	var debug *DebugOverlay
+	if config.Debug {
+		debug = NewDebugOverlay(img)
+	}
+	
+	// The head turn, head covering and eye occlusion checks rely on skin color,
+	// which a black-and-white photo doesn't have
+	if !config.Grayscale {
+		crop = runFaceChecks(img, face, crop, config, debug)
+	}
+	
+	// Create passport photo aligned to the selected spec
+	result, rect, headSize, shoulders, err := alignFaceForPassport(img, face, spec, config.Pad, debug)
+	if err != nil {
+		return nil, crop, err
+	}
+	crop.Shoulders = shoulders
+	crop.Rect = rect.Sub(img.Bounds().Min)
+	crop.Face = crop.Face.Sub(img.Bounds().Min)
+	
+	if config.SafeMargin > 0 {
+		margin := int(math.Round(float64(mmToPX(config.SafeMargin, spec.DPI)) * float64(crop.Rect.Dx()) / float64(spec.WidthPX)))
+		debug.DrawRect(crop.Rect.Inset(margin), DebugColorSafeArea)
+	}
+	if err := debug.Save(availableOutputPath(debugImagePath(DEBUG_IMAGE_PATH, config))); err != nil {
+		logWarn("⚠️  Could not save debug image: %v", err)
+	}
+	
+	// A face that can't be brought near the required size is no better than a fallback
+	if headSize.Checked && !headSize.Converged {
+		offBy := math.Max(headSize.MinMM-headSize.HeightMM, headSize.HeightMM-headSize.MaxMM)
+		if offBy > STRATEGY_HEAD_SIZE_TOLERANCE_MM {
+			return nil, crop, fmt.Errorf("head height %s is far outside the allowed %s", formatLength(headSize.HeightMM, 1), formatLengthRange(headSize.MinMM, headSize.MaxMM, -1))
+		}
+	}
+
+	logInfo("✅ Face aligned")
+	return result, crop, nil
+}
+
+// runFaceChecks runs the compliance checks on the detected face that only warn:
+// head turn, head covering, hair or objects over the eyes, and uneven lighting.
+// Their results are recorded in crop and marked on the debug overlay.
+func runFaceChecks(img image.Image, face *FaceDetection, crop CropGeometry, config Config, debug *DebugOverlay) CropGeometry {
+	// A head turned sideways makes the face asymmetric; warn, but keep going
+	yaw := checkYaw(img, face)
+	printYawCheck(yaw)
+	if yaw.Turned {
+		length := face.Size / 2
+		if yaw.Direction() == "left" {
+			length = -length
+		}
+		debug.DrawArrow(image.Pt(face.X, face.Y), length, DebugColorYaw)
+	}
+
+	// Hats are only allowed for religious reasons; warn and let the user decide
+	crop.HeadCovering = checkHeadCovering(img, face)
+	printHeadCoveringCheck(crop.HeadCovering)
+	if crop.HeadCovering.Suspected {
+		debug.DrawRect(crop.HeadCovering.Region, DebugColorHat)
+	}
+
+	// Eyes and eyebrows must be visible; a fringe or a hand over them is a rejection reason
+	crop.Occlusion = checkEyeOcclusion(img, face, config.EyeOcclusion)
+	printOcclusionCheck(crop.Occlusion)
+	if crop.Occlusion.Checked {
+		for i, band := range crop.Occlusion.Bands {
+			debug.DrawRect(band, DebugColorEyes)
+			debug.DrawText(image.Pt(band.Min.X, band.Max.Y), fmt.Sprintf("%.0f%%", crop.Occlusion.Covered[i]*100), DebugColorEyes)
+		}
+	}
+
+	// Side light shadowing half the face, or a dark chin or forehead, gets photos rejected
+	crop.Lighting = checkLighting(img, face)
+	printLightingCheck(crop.Lighting)
+	if crop.Lighting.Checked {
+		luminance := [2]float64{crop.Lighting.Left, crop.Lighting.Right}
+		for i, half := range crop.Lighting.Halves {
+			debug.DrawRect(half.Inset(2), DebugColorLighting)
+			debug.DrawText(image.Pt(half.Min.X+half.Dx()/4, half.Max.Y-half.Dy()/8), fmt.Sprintf("%.2f", luminance[i]), DebugColorLighting)
+		}
+	}
+	return crop
+}
+
+// estimateHeadLandmarks returns the horizontal face center, eye level, skull top and
+// chin. With located pupils they follow from the pupil midpoint and interpupillary
+// distance, otherwise from the face box with the tunable ratios above; hair reaching
+// higher isn't included.
+func estimateHeadLandmarks(face *FaceDetection) (centerX, eyeY, skullTop, chin int) {
+	if face.Pupils != nil {
+		mid, distance := face.Pupils.Midpoint(), face.Pupils.Distance()
+		skullTop = mid.Y - int(distance*SKULL_TOP_ABOVE_PUPILS_IPD)
+		chin = mid.Y + int(distance*CHIN_BELOW_PUPILS_IPD)
+		return mid.X, mid.Y, skullTop, chin
+	}
+	faceTop := face.Y - face.Size/2
+	faceBottom := face.Y + face.Size/2
+	eyeY = faceTop + int(float64(face.Size)*EYE_LEVEL_IN_FACE_RATIO)
+	skullTop = faceTop - int(float64(face.Size)*FOREHEAD_EXTENSION_RATIO)
+	chin = faceBottom + int(float64(face.Size)*CHIN_EXTENSION_RATIO)
+	return face.X, eyeY, skullTop, chin
+}
+
+// alignFaceForPassport crops and scales img around the face. Also returns the crop
+// rectangle in img, the measured head size and the shoulder framing, or an
+// *ImageSizeError when the crop came out degenerate.
+func alignFaceForPassport(img image.Image, face *FaceDetection, spec PhotoSpec, pad string, debug *DebugOverlay) (image.Image, image.Rectangle, HeadSizeCheck, ShoulderCheck, error) {
+	bounds := img.Bounds()
+	imgWidth := bounds.Dx()
+	imgHeight := bounds.Dy()
+
+	// Passport photo specifications from the selected spec
+	// Calculate exact measurements based on configuration
+	targetHeadHeightChinToSkull := int(math.Round(float64(spec.HeightPX) * spec.HeadHeightRatio))
+	eyePositionFromTop := int(math.Round(float64(spec.HeightPX) * spec.EyePositionFromTopRatio))
+	headspaceAboveHead := int(math.Round(float64(spec.HeightPX) * spec.HeadspaceRatio))
+	
+	// Estimate key landmarks from the located pupils or the detected face box
+	faceTop := face.Y - face.Size/2
+	faceBottom := face.Y + face.Size/2
+	centerX, eyeY, estimatedSkullTop, estimatedChin := estimateHeadLandmarks(face)
+	printPupils(face.Pupils, face.Size)
+	if face.Pupils != nil {
+		marker := max(2, int(face.Pupils.Distance()/8))
+		for _, pupil := range []image.Point{face.Pupils.Left, face.Pupils.Right} {
+			debug.DrawRect(image.Rect(pupil.X-marker, pupil.Y-marker, pupil.X+marker, pupil.Y+marker), DebugColorPupils)
+		}
+	}
+	
+	// Voluminous hair can reach well above the estimated skull; use the expanded
+	// head box for sizing and headspace so the hair isn't clipped at the top edge
+	hairTop := estimateHairTop(img, face, estimatedSkullTop)
+	if hairTop < estimatedSkullTop {
+		logInfo("💇 Hair extends %d pixels above the estimated skull top", estimatedSkullTop-hairTop)
+		estimatedSkullTop = hairTop
+	}
+	
+	debug.DrawRect(image.Rect(face.X-face.Size/2, faceTop, face.X+face.Size/2, faceBottom), DebugColorFace)
+	debug.DrawRect(image.Rect(face.X-face.Size/2, estimatedSkullTop, face.X+face.Size/2, estimatedChin), DebugColorHead)
+	if estimatedChin <= estimatedSkullTop {
+		// Safety guard to avoid division by zero or negative height
+		estimatedChin = estimatedSkullTop + 1
+	}
+
+	// Adaptive head height estimate in the original image
+	estimatedHeadHeight := estimatedChin - estimatedSkullTop
+	
+	// Scale factor to make the estimated head height match the target
+	scaleFactor := float64(targetHeadHeightChinToSkull) / float64(estimatedHeadHeight)
+	
+	logInfo("📏 Passport photo specifications:")
+	logInfo("   - Photo size: %s (%dx%d pixels at %d DPI)", formatPhysicalSize(spec.WidthMM, spec.HeightMM, -1), spec.WidthPX, spec.HeightPX, spec.DPI)
+	logInfo("   - Head height (chin-to-skull): %d pixels (%.1f%% of %d)", targetHeadHeightChinToSkull, spec.HeadHeightRatio*100, spec.HeightPX)
+	logInfo("   - Eyes position: %d pixels from top (%.1f%% of %d)", eyePositionFromTop, spec.EyePositionFromTopRatio*100, spec.HeightPX)
+	logInfo("   - Headspace above head: %d pixels (%.1f%% of %d)", headspaceAboveHead, spec.HeadspaceRatio*100, spec.HeightPX)
+	if spec.CrownAligned {
+		logInfo("   - Crown placed at the head margin, the eye position follows")
+	}
+	logInfo("   - Adaptive estimate: skullTop=%d, chin=%d, headHeight=%d, scale=%.3f", estimatedSkullTop, estimatedChin, estimatedHeadHeight, scaleFactor)
+	
+	// placeCrop sizes the crop for a scale factor and positions it by eye level and
+	// headspace, kept inside the image
+	headspaceAdjusted := false
+	placeCrop := func(scaleFactor float64) image.Rectangle {
+		// Calculate crop dimensions maintaining passport aspect ratio
+		cropWidth := int(float64(spec.WidthPX) / scaleFactor)
+		cropHeight := int(float64(spec.HeightPX) / scaleFactor)
+		
+		// Position eyes to the configured position in the output
+		eyePositionInPhoto := int(float64(cropHeight) * spec.EyePositionFromTopRatio)
+		
+		// Center face horizontally and align vertically by eye level
+		cropX := centerX - cropWidth/2
+		cropY := eyeY - eyePositionInPhoto
+		
+		// Ensure configured headspace above head by adjusting crop if needed
+		headTopPositionInPhoto := int(float64(cropHeight) * spec.HeadspaceRatio)
+		minCropYForHeadspace := estimatedSkullTop - headTopPositionInPhoto
+		headspaceAdjusted = cropY > minCropYForHeadspace
+		if headspaceAdjusted {
+			cropY = minCropYForHeadspace
+		}
+		
+		// -head-margin places the crown exactly, the eyes end up wherever they are
+		if spec.CrownAligned {
+			cropY = minCropYForHeadspace
+			headspaceAdjusted = false
+		}
+		
+		// Padding fills whatever lies outside the image, so the face stays centered
+		if pad != PAD_SNAP {
+			return image.Rect(cropX, cropY, cropX+cropWidth, cropY+cropHeight)
+		}
+		
+		// A crop larger than the image is shrunk, keeping the aspect ratio and the
+		// configured eye position, before it is moved inside
+		if cropWidth > imgWidth || cropHeight > imgHeight {
+			scaleX := float64(imgWidth) / float64(cropWidth)
+			scaleY := float64(imgHeight) / float64(cropHeight)
+			scale := math.Min(scaleX, scaleY) * 0.95
+			
+			cropWidth = max(1, int(float64(cropWidth) * scale))
+			cropHeight = max(1, int(float64(cropHeight) * scale))
+			cropX = centerX - cropWidth/2
+			cropY = eyeY - int(float64(cropHeight)*spec.EyePositionFromTopRatio)
+			if spec.CrownAligned {
+				cropY = estimatedSkullTop - int(float64(cropHeight)*spec.HeadspaceRatio)
+			}
+		}
+		
+		// Boundary adjustments; the crop fits, so neither corner can end up outside
+		cropX = max(0, min(cropX, imgWidth-cropWidth))
+		cropY = max(0, min(cropY, imgHeight-cropHeight))
+		return image.Rect(cropX, cropY, cropX+cropWidth, cropY+cropHeight)
+	}
+	
+	// Measure the head in the crop and re-crop until it is within the spec's mm band
+	crop, headSize := fitHeadSize(spec, placeCrop, scaleFactor, estimatedSkullTop, estimatedChin)
+	if headspaceAdjusted {
+		logInfo("🔧 Adjusted crop position for headspace requirement")
+	}
+	printHeadSizeCheck(headSize)
+	if spec.CrownAligned {
+		if margin := float64(estimatedSkullTop-crop.Min.Y) / float64(crop.Dy()); margin < spec.HeadspaceRatio-0.005 {
+			logWarn("⚠️  The image leaves only %.1f%% of the photo height above the crown instead of the %.1f%% head margin - use -pad white or a photo with more space above the head",
+				margin*100, spec.HeadspaceRatio*100)
+		}
+	}
+	
+	// A face near the bottom of the crop leaves no room for the shoulders; move the
+	// crop down into the image where it has content below, unless -head-margin fixes
+	// the space above the crown
+	shift := 0
+	if pad == PAD_SNAP && !spec.CrownAligned {
+		crop, shift = makeShoulderRoom(crop, imgHeight, estimatedSkullTop, estimatedChin, spec)
+		if shift > 0 {
+			logInfo("🔧 Moved crop down %d pixels to show the shoulders", shift)
+		}
+	}
+	if err := checkCropRect("face crop", crop, image.Rect(0, 0, imgWidth, imgHeight), pad); err != nil {
+		return nil, crop, headSize, ShoulderCheck{}, err
+	}
+	cropX, cropY, cropWidth, cropHeight := crop.Min.X, crop.Min.Y, crop.Dx(), crop.Dy()
+	scaleFactor = headSize.Scale
+
+	logInfo("📐 Face alignment: crop %dx%d at (%d,%d), scale %.2f", 
+		cropWidth, cropHeight, cropX, cropY, scaleFactor)
+	debug.DrawRect(image.Rect(cropX, cropY, cropX+cropWidth, cropY+cropHeight), DebugColorCrop)
+
+	// A passport photo must show the top of the shoulders, not a floating head
+	shoulders := checkShoulders(img, image.Rect(cropX, cropY, cropX+cropWidth, cropY+cropHeight), estimatedChin)
+	shoulders.ShiftedPX = shift
+	debug.DrawRect(shoulders.Band, DebugColorShoulder)
+	printShoulderCheck(shoulders)
+	printPadding(crop, bounds.Size(), pad)
+
+	// Create cropped image
+	srcRect := image.Rect(cropX, cropY, cropX+cropWidth, cropY+cropHeight).Add(bounds.Min)
+	cropped, err := paddedCrop(img, srcRect, pad)
+	if err != nil {
+		return nil, crop, headSize, shoulders, err
+	}
+
+	// Resize to exact passport dimensions
+	return resizeImage(cropped, spec.WidthPX, spec.HeightPX), srcRect, headSize, shoulders, nil
+}
+
+// createPassportPhotoFallback crops the largest area with the spec's aspect ratio;
+// horizontalPosition and verticalPosition place it between the left/top (0) and the
+// right/bottom (1) of img. Also returns the crop rectangle.
+func createPassportPhotoFallback(img image.Image, spec PhotoSpec, horizontalPosition, verticalPosition float64) (image.Image, image.Rectangle, error) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	cropWidth, cropHeight := largestCropSize(width, height, spec)
+
+	// Place the crop at the requested position within the leftover space
+	x := int(float64(width-cropWidth) * horizontalPosition)
+	y := int(float64(height-cropHeight) * verticalPosition)
+	if err := checkCropRect("crop", image.Rect(x, y, x+cropWidth, y+cropHeight), image.Rect(0, 0, width, height), PAD_SNAP); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	srcRect := image.Rect(x, y, x+cropWidth, y+cropHeight).Add(bounds.Min)
+	cropped, err := cropImage(img, srcRect)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	return resizeImage(cropped, spec.WidthPX, spec.HeightPX), srcRect, nil
+}
+
+// largestCropSize returns the largest width and height with the spec's aspect ratio
+// that fit into an image of the given size
+func largestCropSize(width, height int, spec PhotoSpec) (int, int) {
+	targetRatio := float64(spec.WidthPX) / float64(spec.HeightPX)
+	currentRatio := float64(width) / float64(height)
+
+	// Very wide or tall images would round one side down to nothing
+	if currentRatio > targetRatio {
+		return max(1, int(float64(height)*targetRatio)), height
+	}
+	return width, max(1, int(float64(width)/targetRatio))
+}
+
+func createPrintLayout(passportPhoto image.Image, format PrintFormat) image.Image {
+	logInfo("📄 Creating %s layout (%dx%d grid)",
+		format.Name, format.Columns, format.Rows)
+
+	// Create white canvas
+	canvas := image.NewRGBA(image.Rect(0, 0, format.WidthPX, format.HeightPX))
+	white := color.RGBA{255, 255, 255, 255}
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{white}, image.Point{}, draw.Src)
+
+	// Calculate optimal layout with maximum photo utilization
+	grid := calculateGridLayout(format)
+	
+	logInfo("📐 Grid layout: start=(%s,%s)%s, spacing=(%s,%s)%s",
+		formatLengthNumber(grid.StartXMM, 2), formatLengthNumber(grid.StartYMM, 2), units,
+		formatLengthNumber(grid.SpacingXMM, 2), formatLengthNumber(grid.SpacingYMM, 2), units)
+
+	// Place photos in grid with strict no-cropping policy
+	slots := gridSlots(grid, format)
+	fitted := make(map[image.Point]image.Image)
+	for _, photoRect := range slots {
+		// Place photo in the spec's orientation
+		photo := fitPhotoToSlot(passportPhoto, photoRect.Size(), fitted)
+		draw.Draw(canvas, photoRect, photo, photo.Bounds().Min, draw.Src)
+	}
+	photoCount := len(slots)
+
+	if format.CutMarks {
+		drawCutMarks(canvas, grid, format)
+	}
+	if format.Ruler {
+		drawRuler(canvas, slots, format)
+	}
+
+	logInfo("✅ Placed %d photos successfully", photoCount)
+	printCutLines(grid, format)
+	printPlacementAudit(auditGridLayout(grid, format))
+	return canvas
+}
+
+// gridSlots returns the photo rectangles of the grid, row by row, skipping any
+// position where the photo wouldn't fit completely within the canvas
+func gridSlots(grid GridLayout, format PrintFormat) []image.Rectangle {
+	var slots []image.Rectangle
+	for row := 0; row < format.Rows && len(slots) < format.PhotosPerSheet; row++ {
+		for col := 0; col < format.Columns && len(slots) < format.PhotosPerSheet; col++ {
+			rect := grid.PhotoRect(col, row)
+
+			// Strict boundary check: photo must fit completely within canvas
+			if rect.In(image.Rect(0, 0, format.WidthPX, format.HeightPX)) {
+				slots = append(slots, rect)
+			} else {
+				logWarn("⚠️  Photo at position (%d,%d) would be cropped, skipping", col+1, row+1)
+			}
+		}
+	}
+	return slots
+}
+
+// GridLayout holds the placement of the photo grid on a sheet in millimeters. Pixels
+// are only rounded from it when drawing, every edge on its own, so rounding never
+// accumulates across the grid. Every photo in a column shares the same X and every
+// photo in a row the same Y.
+type GridLayout struct {
+	StartXMM, StartYMM     float64 // Top-left corner of the first photo (left/top margin)
+	SpacingXMM, SpacingYMM float64 // Gap between neighbouring photos
+	PhotoWidthMM           float64
+	PhotoHeightMM          float64
+	DPI                    int // Resolution the edges are rounded for
+}
+
+// ColumnMM returns the left and right edge of the photos in a column. The right edge
+// is computed as the next column's left edge minus the gap, so photos without a gap
+// share exactly the same cut line.
+func (g GridLayout) ColumnMM(col int) (left, right float64) {
+	left = g.StartXMM + float64(col)*(g.PhotoWidthMM+g.SpacingXMM)
+	return left, g.StartXMM + float64(col+1)*(g.PhotoWidthMM+g.SpacingXMM) - g.SpacingXMM
+}
+
+// RowMM returns the top and bottom edge of the photos in a row, like ColumnMM
+func (g GridLayout) RowMM(row int) (top, bottom float64) {
+	top = g.StartYMM + float64(row)*(g.PhotoHeightMM+g.SpacingYMM)
+	return top, g.StartYMM + float64(row+1)*(g.PhotoHeightMM+g.SpacingYMM) - g.SpacingYMM
+}
+
+// PhotoRect returns the photo at the given grid cell with each edge rounded to the
+// nearest pixel; neighbouring slots may differ in size by a pixel
+func (g GridLayout) PhotoRect(col, row int) image.Rectangle {
+	left, right := g.ColumnMM(col)
+	top, bottom := g.RowMM(row)
+	return image.Rect(mmToPX(left, g.DPI), mmToPX(top, g.DPI), mmToPX(right, g.DPI), mmToPX(bottom, g.DPI))
+}
+
+// calculateGridLayout distributes the space left over by the photos into spacing and margins.
+// All gaps share the same spacing and the outer margins are equal, in exact millimeters of
+// the nominal sheet, so rows and columns stay aligned for guillotine cutters and the layout
+// is the same at every DPI; only drawing rounds it to the pixels of the sheet.
+func calculateGridLayout(format PrintFormat) GridLayout {
+	startX, spacingX := distributeAxis(format.WidthMM, format.PhotoWidthMM, format.Columns, MIN_SPACING_MM)
+	startY, spacingY := distributeAxis(format.HeightMM, format.PhotoHeightMM, format.Rows, MIN_SPACING_MM)
+	
+	return GridLayout{
+		StartXMM:      startX,
+		StartYMM:      startY,
+		SpacingXMM:    spacingX,
+		SpacingYMM:    spacingY,
+		PhotoWidthMM:  format.PhotoWidthMM,
+		PhotoHeightMM: format.PhotoHeightMM,
+		DPI:           format.DPI,
+	}
+}
+
+// distributeAxis computes the leading margin and the spacing for one axis of the grid
+func distributeAxis(sheetMM, photoMM float64, count int, minSpacingMM float64) (margin, spacing float64) {
+	// Calculate available space for spacing and margins
+	remaining := sheetMM - float64(count)*photoMM
+	
+	if count > 1 {
+		// Use configurable minimum spacing, distribute rest as margins
+		spacing = minSpacingMM
+		margin = (remaining - float64(count-1)*spacing) / 2
+		
+		// If margins would be too small, increase spacing
+		if margin < minSpacingMM {
+			spacing = remaining / float64(count)
+		}
+	}
+	
+	// Whatever the gaps don't use goes to the outer margins
+	margin = (remaining - float64(count-1)*spacing) / 2
+	return margin, spacing
+}
+
+// printCutLines reports the exact cut line coordinates of the grid in the -units unit
+func printCutLines(grid GridLayout, format PrintFormat) {
+	var columns, rows []string
+	for col := 0; col < format.Columns; col++ {
+		left, right := grid.ColumnMM(col)
+		columns = append(columns, formatLengthNumber(left, 2)+"-"+formatLengthNumber(right, 2))
+	}
+	for row := 0; row < format.Rows; row++ {
+		top, bottom := grid.RowMM(row)
+		rows = append(rows, formatLengthNumber(top, 2)+"-"+formatLengthNumber(bottom, 2))
+	}
+	
+	if format.BleedPX > 0 {
+		logInfo("✂️  Cut lines (%s from the top-left corner of the nominal format, %s inside the bleed edge):", units, formatLength(format.BleedMM, -1))
+	} else {
+		logInfo("✂️  Cut lines (%s from top-left corner):", units)
+	}
+	logInfo("   - Columns (x): %s", strings.Join(columns, ", "))
+	logInfo("   - Rows (y):    %s", strings.Join(rows, ", "))
+}
+
+func imageToGrayscale(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+
+	return gray
+}
+
+func rotateImage(img image.Image, degrees int) image.Image {
+	bounds := img.Bounds()
+
+	switch degrees {
+	case 90:
+		rotated := image.NewRGBA(image.Rect(0, 0, bounds.Dy(), bounds.Dx()))
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				rotated.Set(bounds.Dy()-(y-bounds.Min.Y)-1, x-bounds.Min.X, img.At(x, y))
+			}
+		}
+		return rotated
+	case 180:
+		rotated := image.NewRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				rotated.Set(bounds.Max.X-(x-bounds.Min.X)-1, bounds.Max.Y-(y-bounds.Min.Y)-1, img.At(x, y))
+			}
+		}
+		return rotated
+	case 270:
+		rotated := image.NewRGBA(image.Rect(0, 0, bounds.Dy(), bounds.Dx()))
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				rotated.Set(y-bounds.Min.Y, bounds.Dx()-(x-bounds.Min.X)-1, img.At(x, y))
+			}
+		}
+		return rotated
+	default:
+		return img
+	}
+}
+
+// flipImageHorizontal mirrors an image left to right
+func flipImageHorizontal(img image.Image) image.Image {
+	bounds := img.Bounds()
+	flipped := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			flipped.Set(bounds.Max.X-x-1, y-bounds.Min.Y, img.At(x, y))
+		}
+	}
+	return flipped
+}
+
+// resizeImageHighQuality is the production resize behind resizeImage
+func resizeImageHighQuality(img image.Image, width, height int) image.Image {
+	srcBounds := img.Bounds()
+	srcWidth := srcBounds.Dx()
+	srcHeight := srcBounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	xRatio := float64(srcWidth) / float64(width)
+	yRatio := float64(srcHeight) / float64(height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			srcX := float64(x) * xRatio
+			srcY := float64(y) * yRatio
+
+			x1 := int(math.Floor(srcX))
+			y1 := int(math.Floor(srcY))
+			x2 := int(math.Min(float64(x1+1), float64(srcWidth-1)))
+			y2 := int(math.Min(float64(y1+1), float64(srcHeight-1)))
+
+			c1 := img.At(srcBounds.Min.X+x1, srcBounds.Min.Y+y1)
+			c2 := img.At(srcBounds.Min.X+x2, srcBounds.Min.Y+y1)
+			c3 := img.At(srcBounds.Min.X+x1, srcBounds.Min.Y+y2)
+			c4 := img.At(srcBounds.Min.X+x2, srcBounds.Min.Y+y2)
+
+			r1, g1, b1, a1 := c1.RGBA()
+			r2, g2, b2, a2 := c2.RGBA()
+			r3, g3, b3, a3 := c3.RGBA()
+			r4, g4, b4, a4 := c4.RGBA()
+
+			r := (r1 + r2 + r3 + r4) / 4
+			g := (g1 + g2 + g3 + g4) / 4
+			b := (b1 + b2 + b3 + b4) / 4
+			a := (a1 + a2 + a3 + a4) / 4
+
+			dst.Set(x, y, color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)})
+		}
+	}
+
+	return dst
+}
+
+// SaveOptions controls how output JPEGs are written
+type SaveOptions struct {
+	Metadata     string // METADATA_DPI or METADATA_NONE
+	Quality      int    // JPEG quality 1-100 (0 means DEFAULT_JPEG_QUALITY)
+	Chroma444    bool   // Full-resolution chroma instead of 4:2:0 subsampling
+	ICCProfile   []byte // Color profile to embed (nil for untagged sRGB)
+	CMYK         bool   // Convert to CMYK for print shops (Adobe CMYK JPEG)
+	MaxBytes     int    // Lower the quality until the file fits (0 = no limit)
+	DPI          int    // Print resolution stored in the file (0 means DPI)
+	Strip        bool   // Remove every metadata segment the encoder wrote before adding JFIF density and ICCProfile
+	MaxDimension int    // Largest width and height accepted, larger images are refused (0 = JPEG_MAX_DIMENSION)
+}
+
+// saveImage encodes img as JPEG within the size limits of opts and writes it to path
+// (stdout for STREAM_PATH). The output is always a fresh encode, so no EXIF (camera,
+// GPS) from the source survives; only the metadata opts asks for is added. Returns
+// the number of bytes written and the JPEG quality used.
+func saveImage(img image.Image, path string, opts SaveOptions) (int, int, error) {
+	if err := checkOutputDimensions(img.Bounds().Size(), opts); err != nil {
+		return 0, 0, err
+	}
+	data, quality, err := encodeWithinBudget(img, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(data), quality, writeOutput(path, data)
+}
+
+// encodeImage encodes img as JPEG with the given options
+func encodeImage(img image.Image, opts SaveOptions) ([]byte, error) {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DEFAULT_JPEG_QUALITY
+	}
+
+	dpi := opts.DPI
+	if dpi == 0 {
+		dpi = DPI
+	}
+
+	// JPEG has no alpha channel: anything still transparent (e.g. an appended PNG
+	// sheet) is written as white paper instead of black
+	if !isOpaque(img) {
+		img = compositeOver(img, color.White)
+	}
+
+	if opts.CMYK {
+		img = convertToCMYK(img)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg444.Encode(&buf, img, &jpeg444.Options{Quality: quality, Chroma444: opts.Chroma444}); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+	if opts.Strip {
+		encoded = stripJPEGMetadata(encoded)
+	}
+
+	// The generator and its version, so an output can be traced to the build that
+	// made it; sanitized outputs and -metadata none get no comment
+	if !opts.Strip && opts.Metadata != METADATA_NONE {
+		encoded = addJPEGComment(encoded, TOOL_NAME+" "+toolVersion())
+	}
+
+	// JFIF and RGB profiles only apply to RGB files; CMYK carries its resolution
+	// the way Photoshop does
+	if opts.CMYK {
+		if opts.Metadata == METADATA_DPI {
+			return addPhotoshopResolution(encoded, dpi), nil
+		}
+		return encoded, nil
+	}
+	data := addICCProfile(encoded, opts.ICCProfile)
+	if opts.Metadata == METADATA_DPI {
+		data = addJFIFDensity(data, dpi)
+	}
+	return data, nil
+}
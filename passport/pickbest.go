@@ -0,0 +1,203 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"sort"
+)
+
+// -pick-best scores every candidate from 0 to 1 as the weighted sum of four terms,
+// each clamped to 0-1:
+//
+//	score = 0.2 × confidence + 0.35 × sharpness + 0.25 × eyes open + 0.2 × exposure
+//
+//	confidence = detection score / PICK_BEST_FULL_CONFIDENCE
+//	sharpness  = Laplacian variance of the face box / PICK_BEST_FULL_SHARPNESS
+//	eyes open  = (eye contrast - PICK_BEST_EYES_CLOSED_CONTRAST) / (PICK_BEST_EYES_OPEN_CONTRAST - PICK_BEST_EYES_CLOSED_CONTRAST)
+//	exposure   = (1 - |face luminance - PICK_BEST_TARGET_LUMINANCE| / PICK_BEST_LUMINANCE_RANGE) × (1 - clipped fraction)
+//
+// Every term is measured on a copy scaled so the face box is PICK_BEST_FACE_PX wide,
+// which makes shots of different resolution comparable. A candidate without a face
+// scores 0.
+const (
+	PICK_BEST_WEIGHT_CONFIDENCE = 0.2
+	PICK_BEST_WEIGHT_SHARPNESS  = 0.35
+	PICK_BEST_WEIGHT_EYES       = 0.25
+	PICK_BEST_WEIGHT_EXPOSURE   = 0.2
+
+	PICK_BEST_FACE_PX          = 256
+	PICK_BEST_FULL_CONFIDENCE  = 250.0
+	PICK_BEST_FULL_SHARPNESS   = 1000.0
+	PICK_BEST_TARGET_LUMINANCE = 0.55
+	PICK_BEST_LUMINANCE_RANGE  = 0.45
+
+	// Luminance standard deviation of the eye regions: open eyes show dark iris
+	// against white sclera, closed eyes only the even skin of the lids
+	PICK_BEST_EYES_CLOSED_CONTRAST = 0.05
+	PICK_BEST_EYES_OPEN_CONTRAST   = 0.15
+
+	// Eye regions around each pupil (or its estimate), as fractions of the face size
+	PICK_BEST_EYE_HALF_WIDTH  = 0.09
+	PICK_BEST_EYE_HALF_HEIGHT = 0.05
+
+	// Face pixels darker or brighter than these luminances count as clipped
+	PICK_BEST_CLIP_LOW  = 0.02
+	PICK_BEST_CLIP_HIGH = 0.98
+)
+
+// CandidateScore is the measurement of one -pick-best input; the raw values make
+// the ranking reproducible from the formula above
+type CandidateScore struct {
+	Path          string  `json:"path"`
+	FaceFound     bool    `json:"face_found"`
+	Confidence    float64 `json:"confidence"`     // Detection score
+	Sharpness     float64 `json:"sharpness"`      // Laplacian variance of the face box
+	EyeContrast   float64 `json:"eye_contrast"`   // Luminance standard deviation of the eye regions
+	FaceLuminance float64 `json:"face_luminance"` // Mean luminance of the face box (0-1)
+	Clipped       float64 `json:"clipped"`        // Fraction of face pixels near black or white
+	Score         float64 `json:"score"`
+	Error         string  `json:"error,omitempty"` // Why the input couldn't be scored
+}
+
+// clamp01 limits a score term to 0-1
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// scoreCandidate loads one input and measures its face
+func scoreCandidate(path string, detector *FaceDetector) CandidateScore {
+	candidate := CandidateScore{Path: path}
+	source, err := loadImage(path)
+	if err != nil {
+		candidate.Error = err.Error()
+		return candidate
+	}
+	img, _ := applyColorProfile(source.Image, source.ICCProfile, COLOR_PROFILE_SRGB)
+	img, _ = normalizeInput(img)
+	face, err := detector.detectBest(img)
+	if err != nil {
+		candidate.Error = err.Error()
+		return candidate
+	}
+	candidate.FaceFound = true
+	candidate.Confidence = float64(face.Score)
+
+	// Measure on a copy where the face box is PICK_BEST_FACE_PX wide
+	bounds := img.Bounds()
+	scale := float64(PICK_BEST_FACE_PX) / float64(max(1, face.Size))
+	scaled := resizeImage(img, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+	at := func(x, y int) image.Point {
+		return image.Pt(int(float64(x)*scale), int(float64(y)*scale))
+	}
+	center := at(face.X, face.Y)
+	box := image.Rect(center.X-PICK_BEST_FACE_PX/2, center.Y-PICK_BEST_FACE_PX/2, center.X+PICK_BEST_FACE_PX/2, center.Y+PICK_BEST_FACE_PX/2)
+	candidate.Sharpness = laplacianVariance(scaled, box)
+	candidate.FaceLuminance, _, candidate.Clipped = luminanceStats(scaled, box)
+
+	// Both eyes: the located pupils, else the usual estimate from the face box
+	left := at(face.X-int(PUPIL_SEARCH_COL_OFFSET*float64(face.Size)), face.Y-face.Size/2+int(EYE_LEVEL_IN_FACE_RATIO*float64(face.Size)))
+	right := at(face.X+int(PUPIL_SEARCH_COL_OFFSET*float64(face.Size)), left.Y)
+	if face.Pupils != nil {
+		left, right = at(face.Pupils.Left.X, face.Pupils.Left.Y), at(face.Pupils.Right.X, face.Pupils.Right.Y)
+	}
+	halfWidth := int(math.Round(PICK_BEST_EYE_HALF_WIDTH * PICK_BEST_FACE_PX))
+	halfHeight := int(math.Round(PICK_BEST_EYE_HALF_HEIGHT * PICK_BEST_FACE_PX))
+	for _, eye := range []image.Point{left, right} {
+		_, stddev, _ := luminanceStats(scaled, image.Rect(eye.X-halfWidth, eye.Y-halfHeight, eye.X+halfWidth, eye.Y+halfHeight))
+		candidate.EyeContrast += stddev / 2
+	}
+
+	candidate.Score = PICK_BEST_WEIGHT_CONFIDENCE*clamp01(candidate.Confidence/PICK_BEST_FULL_CONFIDENCE) +
+		PICK_BEST_WEIGHT_SHARPNESS*clamp01(candidate.Sharpness/PICK_BEST_FULL_SHARPNESS) +
+		PICK_BEST_WEIGHT_EYES*clamp01((candidate.EyeContrast-PICK_BEST_EYES_CLOSED_CONTRAST)/(PICK_BEST_EYES_OPEN_CONTRAST-PICK_BEST_EYES_CLOSED_CONTRAST)) +
+		PICK_BEST_WEIGHT_EXPOSURE*clamp01(1-math.Abs(candidate.FaceLuminance-PICK_BEST_TARGET_LUMINANCE)/PICK_BEST_LUMINANCE_RANGE)*(1-candidate.Clipped)
+	return candidate
+}
+
+// luminanceStats returns the mean and standard deviation of the luminance (0-1)
+// inside rect (image-relative coordinates) and the fraction of clipped pixels
+func luminanceStats(img image.Image, rect image.Rectangle) (mean, stddev, clipped float64) {
+	bounds := img.Bounds()
+	rect = rect.Intersect(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	if rect.Empty() {
+		return 0, 0, 0
+	}
+	var sum, sumSq float64
+	clippedCount := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 65535
+			sum += lum
+			sumSq += lum * lum
+			if lum < PICK_BEST_CLIP_LOW || lum > PICK_BEST_CLIP_HIGH {
+				clippedCount++
+			}
+		}
+	}
+	count := float64(rect.Dx() * rect.Dy())
+	mean = sum / count
+	return mean, math.Sqrt(math.Max(0, sumSq/count-mean*mean)), float64(clippedCount) / count
+}
+
+// rankCandidates scores every input and sorts them best first; equal scores are
+// ordered by filename so the same inputs always give the same ranking
+func rankCandidates(paths []string, detector *FaceDetector) []CandidateScore {
+	ranking := make([]CandidateScore, len(paths))
+	for i, path := range paths {
+		logInfo("🏅 [%d/%d] Scoring %s", i+1, len(paths), filepath.Base(path))
+		ranking[i] = scoreCandidate(path, detector)
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		return filepath.Base(ranking[i].Path) < filepath.Base(ranking[j].Path)
+	})
+	return ranking
+}
+
+// printRanking lists the candidates best first on stdout
+func printRanking(ranking []CandidateScore) {
+	fmt.Print(msg("ranking.title", len(ranking)))
+	for i, candidate := range ranking {
+		if !candidate.FaceFound {
+			fmt.Print(msg("ranking.item_failed", i+1, filepath.Base(candidate.Path), formatDecimal(0, 3), candidate.Error))
+			continue
+		}
+		fmt.Print(msg("ranking.item", i+1, filepath.Base(candidate.Path), formatDecimal(candidate.Score, 3),
+			formatDecimal(candidate.Confidence, 0), formatDecimal(candidate.Sharpness, 0), formatDecimal(candidate.EyeContrast, 3),
+			formatDecimal(candidate.FaceLuminance, 2), formatDecimal(candidate.Clipped*100, 1)))
+	}
+}
+
+// pickBest ranks the -pick-best inputs and returns the path to continue with: the
+// best one, or the one chosen with prompt when someone can answer
+func pickBest(paths []string, detector *FaceDetector, prompt Prompter) (string, []CandidateScore, error) {
+	ranking := rankCandidates(paths, detector)
+	printRanking(ranking)
+	if !ranking[0].FaceFound {
+		return "", ranking, fmt.Errorf("no face found in any of the %d candidates", len(ranking))
+	}
+
+	choice := 0
+	if prompt != nil {
+		labels := make([]string, len(ranking))
+		for i, candidate := range ranking {
+			labels[i] = fmt.Sprintf("%s (score %.3f)", filepath.Base(candidate.Path), candidate.Score)
+		}
+		use, err := prompt.Confirm(msg("prompt.pick_best", filepath.Base(ranking[0].Path)))
+		if err != nil {
+			return "", ranking, err
+		}
+		if !use {
+			if choice, err = prompt.Choose(msg("prompt.pick_candidate"), labels); err != nil {
+				return "", ranking, err
+			}
+		}
+	}
+	logInfo("✅ Using %s", ranking[choice].Path)
+	return ranking[choice].Path, ranking, nil
+}
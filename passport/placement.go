@@ -0,0 +1,80 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// PlacementEdge is one photo edge of a sheet in the placement audit: where the
+// millimeter layout puts it, and the pixel it was rounded to
+type PlacementEdge struct {
+	Name       string  // e.g. "column 2 left" or "row 1 bottom"
+	MM         float64 // Intended position from the top-left corner of the nominal format
+	IntendedPX float64 // MM at the format's DPI, before rounding
+	ActualPX   int     // Pixel edge the photo was drawn at
+}
+
+// DeviationPX is how far the drawn edge is off the intended position
+func (e PlacementEdge) DeviationPX() float64 {
+	return float64(e.ActualPX) - e.IntendedPX
+}
+
+// auditGridLayout lists every photo edge of the grid with its intended and drawn
+// position. Rounding each edge on its own keeps every deviation within half a pixel.
+func auditGridLayout(grid GridLayout, format PrintFormat) []PlacementEdge {
+	var edges []PlacementEdge
+	add := func(name string, mm float64) {
+		edges = append(edges, PlacementEdge{
+			Name:       name,
+			MM:         mm,
+			IntendedPX: mm * float64(format.DPI) / 25.4,
+			ActualPX:   mmToPX(mm, format.DPI),
+		})
+	}
+	for col := 0; col < format.Columns; col++ {
+		left, right := grid.ColumnMM(col)
+		add(fmt.Sprintf("column %d left", col+1), left)
+		add(fmt.Sprintf("column %d right", col+1), right)
+	}
+	for row := 0; row < format.Rows; row++ {
+		top, bottom := grid.RowMM(row)
+		add(fmt.Sprintf("row %d top", row+1), top)
+		add(fmt.Sprintf("row %d bottom", row+1), bottom)
+	}
+	return edges
+}
+
+// maxPlacementDeviation returns the largest deviation of the audited edges in pixels
+func maxPlacementDeviation(edges []PlacementEdge) float64 {
+	worst := 0.0
+	for _, edge := range edges {
+		worst = math.Max(worst, math.Abs(edge.DeviationPX()))
+	}
+	return worst
+}
+
+// printPlacementAudit logs the worst deviation of the drawn photo edges, and the
+// table of every edge at the debug level
+func printPlacementAudit(edges []PlacementEdge) {
+	logDebug("🔬 Placement audit (intended vs drawn pixel edges):")
+	for _, edge := range edges {
+		logDebug("   - %-16s %8.3fmm %9.2fpx -> %5dpx (%+.2fpx)", edge.Name, edge.MM, edge.IntendedPX, edge.ActualPX, edge.DeviationPX())
+	}
+	logInfo("📏 Placement audit: %d photo edges, worst deviation %.2fpx", len(edges), maxPlacementDeviation(edges))
+}
+
+// fitPhotoToSlot returns the photo in the size of a grid slot. Slots rounded from the
+// millimeter layout can be a pixel larger or smaller than the photo; those get a
+// resized copy, kept in fitted for the other slots of the same size.
+func fitPhotoToSlot(photo image.Image, size image.Point, fitted map[image.Point]image.Image) image.Image {
+	if photo.Bounds().Size() == size {
+		return photo
+	}
+	if resized, ok := fitted[size]; ok {
+		return resized
+	}
+	resized := resizeImage(photo, size.X, size.Y)
+	fitted[size] = resized
+	return resized
+}
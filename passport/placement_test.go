@@ -0,0 +1,101 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+// For every spec, format, photo count and resolution the audit stays within half a
+// pixel, and its pixel edges are the ones the photos are drawn at
+func TestPlacementAuditEveryFormat(t *testing.T) {
+	for _, specKey := range photoSpecKeys() {
+		base, err := lookupPhotoSpec(specKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dpi := range []int{300, 350, 600} {
+			spec := base.WithDPI(dpi)
+			for _, full := range append(getPredefinedFormats(spec), createStripFormat(spec)) {
+				for count := 1; count <= full.PhotosPerSheet; count++ {
+					format := withPhotoCount(full, count)
+					name := fmt.Sprintf("%s on %s at %d DPI, %d photos", specKey, format.Key, dpi, count)
+					grid := calculateGridLayout(format)
+					edges := auditGridLayout(grid, format)
+					if len(edges) != 2*(format.Columns+format.Rows) {
+						t.Errorf("%s: %d edges audited for a %dx%d grid", name, len(edges), format.Columns, format.Rows)
+						continue
+					}
+					if worst := maxPlacementDeviation(edges); worst > 0.5 {
+						t.Errorf("%s: worst deviation %.3fpx", name, worst)
+					}
+
+					// Columns come first, left and right edge of each, then the rows
+					drawn := map[string]int{}
+					for i, slot := range gridSlots(grid, format) {
+						row, col := i/format.Columns+1, i%format.Columns+1
+						drawn[fmt.Sprintf("column %d left", col)] = slot.Min.X
+						drawn[fmt.Sprintf("column %d right", col)] = slot.Max.X
+						drawn[fmt.Sprintf("row %d top", row)] = slot.Min.Y
+						drawn[fmt.Sprintf("row %d bottom", row)] = slot.Max.Y
+					}
+					for _, edge := range edges {
+						if px, ok := drawn[edge.Name]; ok && px != edge.ActualPX {
+							t.Errorf("%s: %s audited at %dpx, drawn at %dpx", name, edge.Name, edge.ActualPX, px)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Photos without a gap share their cut line: the right edge of one column rounds to
+// the same pixel as the left edge of the next, however the millimeters fall
+func TestAdjacentPhotosShareCutLine(t *testing.T) {
+	for _, dpi := range []int{300, 350, 600} {
+		grid := GridLayout{StartXMM: 2.3, StartYMM: 1.7, PhotoWidthMM: 35.1, PhotoHeightMM: 44.9, DPI: dpi}
+		for i := 0; i < 5; i++ {
+			if right, next := grid.PhotoRect(i, 0).Max.X, grid.PhotoRect(i+1, 0).Min.X; right != next {
+				t.Errorf("%d DPI: column %d ends at %dpx, column %d starts at %dpx", dpi, i+1, right, i+2, next)
+			}
+			if bottom, next := grid.PhotoRect(0, i).Max.Y, grid.PhotoRect(0, i+1).Min.Y; bottom != next {
+				t.Errorf("%d DPI: row %d ends at %dpx, row %d starts at %dpx", dpi, i+1, bottom, i+2, next)
+			}
+		}
+	}
+}
+
+func TestPlacementEdgeDeviation(t *testing.T) {
+	edges := []PlacementEdge{
+		{Name: "column 1 left", MM: 2, IntendedPX: 23.62, ActualPX: 24},
+		{Name: "column 1 right", MM: 37, IntendedPX: 437.01, ActualPX: 437},
+		{Name: "row 1 top", MM: 4, IntendedPX: 47.24, ActualPX: 47},
+	}
+	if got := edges[2].DeviationPX(); math.Abs(got+0.24) > 1e-9 {
+		t.Errorf("deviation %.3fpx, want -0.24px", got)
+	}
+	if got := maxPlacementDeviation(edges); math.Abs(got-0.38) > 1e-9 {
+		t.Errorf("worst deviation %.3fpx, want 0.38px", got)
+	}
+	if got := maxPlacementDeviation(nil); got != 0 {
+		t.Errorf("worst deviation of no edges %.3fpx", got)
+	}
+}
+
+// Slots a pixel off the photo size get one resized copy per size
+func TestFitPhotoToSlot(t *testing.T) {
+	photo := image.NewRGBA(image.Rect(0, 0, 40, 50))
+	fitted := map[image.Point]image.Image{}
+	if got := fitPhotoToSlot(photo, image.Pt(40, 50), fitted); got != image.Image(photo) || len(fitted) != 0 {
+		t.Error("photo of the slot's size was copied")
+	}
+	wider := fitPhotoToSlot(photo, image.Pt(41, 50), fitted)
+	if wider.Bounds().Size() != image.Pt(41, 50) {
+		t.Errorf("fitted to %v, want 41x50", wider.Bounds().Size())
+	}
+	if again := fitPhotoToSlot(photo, image.Pt(41, 50), fitted); again != wider || len(fitted) != 1 {
+		t.Error("second slot of the same size got another copy")
+	}
+}
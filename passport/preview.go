@@ -0,0 +1,114 @@
+package passport
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Long edge of the layout preview in pixels at -preview-scale 1; the default
+	// scale of 3 suits high-DPI screens and gives 1200 pixels
+	PREVIEW_BASE_SIZE     = 400
+	DEFAULT_PREVIEW_SCALE = 3.0
+	MAX_PREVIEW_SCALE     = 10.0
+
+	// The preview never exceeds this many pixels on the long edge, whatever the scale
+	PREVIEW_MAX_SIZE = 4000
+)
+
+// validatePreviewScale checks a -preview-scale value; 0 turns the preview images off
+func validatePreviewScale(scale float64) error {
+	if scale < 0 || scale > MAX_PREVIEW_SCALE {
+		return fmt.Errorf("invalid preview scale %g (must be between 0 and %g, 0 writes no preview images)", scale, MAX_PREVIEW_SCALE)
+	}
+	return nil
+}
+
+// previewSize returns the long edge of the layout preview for a scale, clamped to
+// PREVIEW_MAX_SIZE
+func previewSize(scale float64) int {
+	return min(PREVIEW_MAX_SIZE, max(1, int(math.Round(PREVIEW_BASE_SIZE*scale))))
+}
+
+// writeSheetPreview saves a downscaled copy of the sheet to path, or to a temporary
+// file the caller removes when path is empty, and returns where it was written.
+// Sheets smaller than the preview size are written as they are. With guides, the
+// reference lines of spec are drawn over the photos of the downscaled copy.
+func writeSheetPreview(sheet Sheet, previewScale float64, guides bool, spec PhotoSpec, path string) (string, error) {
+	bounds := sheet.Image.Bounds()
+	scale := min(1, float64(previewSize(previewScale))/float64(max(bounds.Dx(), bounds.Dy())))
+	preview := sheet.Image
+	if scale < 1 {
+		preview = resizeImage(sheet.Image, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+	}
+	if guides {
+		preview = drawPreviewGuides(preview, sheet, spec)
+	}
+
+	temporary := path == ""
+	if temporary {
+		file, err := os.CreateTemp("", "passport_preview_"+sheet.Format.Key+"_*.jpg")
+		if err != nil {
+			return "", err
+		}
+		path = file.Name()
+		file.Close()
+	}
+	if _, _, err := saveImage(preview, path, SaveOptions{Metadata: METADATA_NONE}); err != nil {
+		if temporary {
+			os.Remove(path)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// buildPreviewPath names the layout preview kept with -keep-artifacts
+func buildPreviewPath(inputPath, outputDir string, format PrintFormat) string {
+	dir, name := outputLocation(inputPath, outputDir)
+	return filepath.Join(dir, fmt.Sprintf("%s_preview_%s.jpg", name, format.Key))
+}
+
+// confirmLayout shows a preview of every print layout (spacing, number of copies,
+// paper orientation) in the image viewer and asks config.Prompt whether to save
+// them. The previews are removed once answered, unless config.KeepArtifacts keeps
+// them next to the outputs. With a config.PreviewScale of 0 no preview images are
+// written, e.g. over SSH without a viewer; the layouts are only listed.
+func confirmLayout(result *Result, config Config) (bool, error) {
+	var temporary []string
+	defer func() {
+		for _, path := range temporary {
+			os.Remove(path)
+		}
+	}()
+
+	for _, sheet := range result.Sheets {
+		if config.PreviewScale == 0 {
+			fmt.Print(msg("preview.sheet_text", sheet.Format.Name, sheet.Format.Columns, sheet.Format.Rows,
+				localizeDecimals(formatPhysicalSize(sheet.Format.WidthMM, sheet.Format.HeightMM, -1))))
+			continue
+		}
+		keepPath := ""
+		if config.KeepArtifacts {
+			keepPath = availableOutputPath(buildPreviewPath(config.InputPath, config.OutputDir, sheet.Format))
+		}
+		if config.SafeMargin > 0 {
+			sheet.Image = drawSafeAreas(sheet, config.SafeMargin)
+		}
+		path, err := writeSheetPreview(sheet, config.PreviewScale, config.PreviewGuides, config.Spec, keepPath)
+		if err != nil {
+			return false, fmt.Errorf("error writing layout preview: %v", err)
+		}
+		if keepPath == "" {
+			temporary = append(temporary, path)
+		}
+		fmt.Print(msg("preview.sheet", sheet.Format.Name, path))
+		if err := openImage(path); err != nil {
+			logWarn("⚠️  Could not open %s: %v", path, err)
+		}
+	}
+
+	return config.Prompt.Confirm(msg("prompt.save_layout"))
+}
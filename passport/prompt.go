@@ -0,0 +1,151 @@
+package passport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNoInput is returned when a prompt can't be answered because the input ran
+// out, e.g. piped answers ended early
+var ErrNoInput = errors.New("no more input available")
+
+// Prompter asks the user questions. The interactive flow (input path, print
+// formats, manual crop, layout preview, calibration) goes through it, so the
+// console can be swapped for scripted answers.
+type Prompter interface {
+	// Ask returns one answer, trimmed of surrounding whitespace
+	Ask(question string) (string, error)
+	// Confirm asks a yes/no question; Enter answers yes
+	Confirm(question string) (bool, error)
+	// Choose lists the options numbered from 1 and returns the index of the chosen one
+	Choose(question string, options []string) (int, error)
+}
+
+// TerminalPrompter asks on the console. A single one is shared by every prompt so
+// buffered piped input is never lost.
+type TerminalPrompter struct {
+	reader *bufio.Reader
+}
+
+// NewTerminalPrompter reads the answers from in, usually os.Stdin
+func NewTerminalPrompter(in io.Reader) *TerminalPrompter {
+	return &TerminalPrompter{reader: bufio.NewReader(in)}
+}
+
+// Ask prints the question and consumes exactly one line of input. When the input
+// is exhausted the error wraps ErrNoInput instead of answering with an empty string.
+func (p *TerminalPrompter) Ask(question string) (string, error) {
+	fmt.Print(question)
+	line, err := p.reader.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		if err == io.EOF {
+			return "", fmt.Errorf("%w for prompt: %s", ErrNoInput, strings.TrimSpace(question))
+		}
+		return "", fmt.Errorf("error reading answer to prompt '%s': %v", strings.TrimSpace(question), err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Confirm asks a yes/no question
+func (p *TerminalPrompter) Confirm(question string) (bool, error) {
+	return confirm(p, question)
+}
+
+// Choose asks until a valid option number is given
+func (p *TerminalPrompter) Choose(question string, options []string) (int, error) {
+	return choose(p, question, options)
+}
+
+// CanAnswer reports whether prompts can be answered: stdin is a terminal, or a pipe
+// or file that still holds answers (e.g. printf 'photo.jpg\n1\n' | passport-photo-generator).
+// Without either, every prompt would read EOF.
+func (p *TerminalPrompter) CanAnswer() bool {
+	if stdinIsTerminal() {
+		return true
+	}
+	_, err := p.reader.Peek(1)
+	return err == nil
+}
+
+// ScriptedPrompter answers from a fixed list, for driving the interactive flow in
+// tests. Every question asked is recorded.
+type ScriptedPrompter struct {
+	Answers   []string // Consumed in order, one per question
+	Questions []string // The questions asked so far
+}
+
+// Ask returns the next scripted answer, or an error wrapping ErrNoInput when none is left
+func (p *ScriptedPrompter) Ask(question string) (string, error) {
+	p.Questions = append(p.Questions, question)
+	if len(p.Answers) == 0 {
+		return "", fmt.Errorf("%w for prompt: %s", ErrNoInput, strings.TrimSpace(question))
+	}
+	answer := p.Answers[0]
+	p.Answers = p.Answers[1:]
+	return strings.TrimSpace(answer), nil
+}
+
+// Confirm answers a yes/no question from the script
+func (p *ScriptedPrompter) Confirm(question string) (bool, error) {
+	return confirm(p, question)
+}
+
+// Choose answers from the script; invalid answers consume the next one, like a
+// user typing again
+func (p *ScriptedPrompter) Choose(question string, options []string) (int, error) {
+	return choose(p, question, options)
+}
+
+// CanAnswer reports whether scripted answers are left
+func (p *ScriptedPrompter) CanAnswer() bool {
+	return len(p.Answers) > 0
+}
+
+// canPrompt reports whether the prompter can answer questions right now; nil
+// means nobody can
+func canPrompt(p Prompter) bool {
+	if p == nil {
+		return false
+	}
+	if answerer, ok := p.(interface{ CanAnswer() bool }); ok {
+		return answerer.CanAnswer()
+	}
+	return true
+}
+
+// confirm implements Prompter.Confirm on top of Ask: anything but an answer
+// starting with n is a yes
+func confirm(p Prompter, question string) (bool, error) {
+	answer, err := p.Ask(question + msg("prompt.yes_no"))
+	if err != nil {
+		return false, err
+	}
+	return !strings.HasPrefix(strings.ToLower(answer), "n"), nil
+}
+
+// choose implements Prompter.Choose on top of Ask
+func choose(p Prompter, question string, options []string) (int, error) {
+	if len(options) == 0 {
+		return 0, fmt.Errorf("no options to choose from for prompt: %s", question)
+	}
+	var list strings.Builder
+	for i, option := range options {
+		fmt.Fprintf(&list, "%d. %s\n", i+1, option)
+	}
+	for {
+		answer, err := p.Ask(list.String() + msg("prompt.choose", question, len(options)))
+		if err != nil {
+			return 0, err
+		}
+		choice, err := strconv.Atoi(answer)
+		if err == nil && choice >= 1 && choice <= len(options) {
+			return choice - 1, nil
+		}
+		fmt.Print(msg("prompt.choose_retry", len(options)))
+	}
+}
@@ -0,0 +1,141 @@
+package passport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"", true},
+		{"y", true},
+		{"Yes", true},
+		{"  j ", true},
+		{"n", false},
+		{"No", false},
+		{"nope", false},
+	}
+	for _, tt := range tests {
+		prompter := &ScriptedPrompter{Answers: []string{tt.answer}}
+		got, err := prompter.Confirm("Save?")
+		if err != nil || got != tt.want {
+			t.Errorf("Confirm with answer %q = %v, %v; want %v", tt.answer, got, err, tt.want)
+		}
+	}
+}
+
+// Invalid choices are asked again, each consuming one answer
+func TestChooseRetriesInvalidAnswers(t *testing.T) {
+	prompter := &ScriptedPrompter{Answers: []string{"0", "two", "4", "3", "1"}}
+	got, err := prompter.Choose("Crop", []string{"automatic", "higher", "lower"})
+	if err != nil || got != 2 {
+		t.Fatalf("Choose = %d, %v; want 2", got, err)
+	}
+	if len(prompter.Questions) != 4 || len(prompter.Answers) != 1 {
+		t.Errorf("asked %d times with %d answers left, want 4 and 1", len(prompter.Questions), len(prompter.Answers))
+	}
+	if !strings.Contains(prompter.Questions[0], "1. automatic\n2. higher\n3. lower\n") {
+		t.Errorf("question doesn't list the numbered options: %q", prompter.Questions[0])
+	}
+}
+
+func TestChooseWithoutOptions(t *testing.T) {
+	prompter := &ScriptedPrompter{Answers: []string{"1"}}
+	if _, err := prompter.Choose("Crop", nil); err == nil {
+		t.Error("Choose without options succeeded")
+	}
+	if len(prompter.Questions) != 0 {
+		t.Errorf("asked %q without options", prompter.Questions)
+	}
+}
+
+// Running out of answers is an error wrapping ErrNoInput, never an empty answer
+func TestPromptsRunOutOfAnswers(t *testing.T) {
+	prompter := &ScriptedPrompter{}
+	if _, err := prompter.Ask("Path: "); !errors.Is(err, ErrNoInput) {
+		t.Errorf("Ask error %v, want ErrNoInput", err)
+	}
+	if _, err := prompter.Confirm("Save?"); !errors.Is(err, ErrNoInput) {
+		t.Errorf("Confirm error %v, want ErrNoInput", err)
+	}
+	prompter.Answers = []string{"9"}
+	if _, err := prompter.Choose("Crop", []string{"automatic"}); !errors.Is(err, ErrNoInput) {
+		t.Errorf("Choose error %v after an invalid answer, want ErrNoInput", err)
+	}
+}
+
+// Every prompt consumes exactly one line of the shared reader, also when answers
+// arrive in one piped chunk
+func TestTerminalPrompterConsumesOneLinePerPrompt(t *testing.T) {
+	prompter := NewTerminalPrompter(strings.NewReader(" photo.jpg \n\n2\nlast"))
+	if got, err := prompter.Ask("Path: "); err != nil || got != "photo.jpg" {
+		t.Errorf("Ask = %q, %v; want photo.jpg", got, err)
+	}
+	if got, err := prompter.Confirm("Save?"); err != nil || !got {
+		t.Errorf("Confirm on an empty line = %v, %v; want yes", got, err)
+	}
+	if got, err := prompter.Choose("Format", []string{"10x15", "13x18"}); err != nil || got != 1 {
+		t.Errorf("Choose = %d, %v; want 1", got, err)
+	}
+	if got, err := prompter.Ask("Name: "); err != nil || got != "last" {
+		t.Errorf("Ask on the unterminated last line = %q, %v; want last", got, err)
+	}
+	if _, err := prompter.Ask("More: "); !errors.Is(err, ErrNoInput) {
+		t.Errorf("Ask after the input ended: %v, want ErrNoInput", err)
+	}
+}
+
+func TestCanPrompt(t *testing.T) {
+	if canPrompt(nil) {
+		t.Error("canPrompt(nil) = true")
+	}
+	if canPrompt(&ScriptedPrompter{}) {
+		t.Error("canPrompt without scripted answers = true")
+	}
+	if !canPrompt(&ScriptedPrompter{Answers: []string{"1"}}) {
+		t.Error("canPrompt with a scripted answer = false")
+	}
+	if !canPrompt(NewTerminalPrompter(strings.NewReader("photo.jpg\n"))) {
+		t.Error("canPrompt with piped answers = false")
+	}
+	if !stdinIsTerminal() && canPrompt(NewTerminalPrompter(strings.NewReader(""))) {
+		t.Error("canPrompt with empty input and no terminal = true")
+	}
+}
+
+// The interactive flow of getConfig: a wrong path is asked again, then two print
+// formats are chosen, one of them custom
+func TestInteractiveConfig(t *testing.T) {
+	prompter := &ScriptedPrompter{Answers: []string{"missing.jpg", `"` + sampleImagePath + `"`, "1,6", "12", "9"}}
+	config := getConfig(prompter, "", "")
+
+	if config.InputPath != sampleImagePath {
+		t.Errorf("input path %q, want %q", config.InputPath, sampleImagePath)
+	}
+	var keys []string
+	for _, format := range config.PrintFormats {
+		keys = append(keys, format.Key)
+	}
+	if strings.Join(keys, ",") != "10x15cm,12x9cm" {
+		t.Errorf("formats %v, want 10x15cm and the custom 12x9cm", keys)
+	}
+	if len(prompter.Answers) != 0 || len(prompter.Questions) != 5 {
+		t.Errorf("%d questions with %d answers left, want 5 and none", len(prompter.Questions), len(prompter.Answers))
+	}
+	if config.Prompt == nil || !config.OpenResult {
+		t.Error("interactive runs ask about the crop and open the result")
+	}
+}
+
+func TestInteractiveFormatsRejectsInvalidChoices(t *testing.T) {
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	for _, answers := range [][]string{{"7"}, {"1,x"}, {"6", "12", "zero"}, {"6", "0", "9"}} {
+		if formats, err := getInteractiveFormats(&ScriptedPrompter{Answers: answers}, spec); err == nil {
+			t.Errorf("answers %q gave %d formats, want an error", answers, len(formats))
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package passport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// PUPIL_CASCADE_NAME is the pigo pupil localization cascade, looked up next to the
+// face cascade. It is optional: without it the eyes are estimated from the face box.
+const PUPIL_CASCADE_NAME = "puploc"
+
+const (
+	// Perturbations of the pupil search window; the median of their results is taken
+	PUPIL_PERTURBATIONS = 63
+
+	// Search windows relative to the pigo face box, as in the pigo examples
+	PUPIL_SEARCH_ROW_OFFSET = 0.075 // Above the face center
+	PUPIL_SEARCH_COL_OFFSET = 0.18  // Left and right of the face center
+	PUPIL_SEARCH_SCALE      = 0.25
+
+	// Located pupils are only used when their distance (the interpupillary distance,
+	// IPD) is within this range of the face size and the eye line tilts by at most
+	// PUPIL_MAX_ROLL of it; anything else is a mislocated pupil
+	PUPIL_MIN_DISTANCE_RATIO = 0.25
+	PUPIL_MAX_DISTANCE_RATIO = 0.6
+	PUPIL_MAX_ROLL           = 0.3
+
+	// Anatomical averages for adults that -size-mode ipd sizes the head with: an
+	// interpupillary distance of 63mm (most adults 54-74mm, children from about 45mm),
+	// the skull top about 100mm above the pupils and the chin about 120mm below them,
+	// i.e. a head of about 3.5 IPDs. The IPD varies much less between people and
+	// poses than the face box the detector draws.
+	AVERAGE_IPD_MM             = 63.0
+	SKULL_TOP_ABOVE_PUPILS_MM  = 100.0
+	CHIN_BELOW_PUPILS_MM       = 120.0
+	SKULL_TOP_ABOVE_PUPILS_IPD = SKULL_TOP_ABOVE_PUPILS_MM / AVERAGE_IPD_MM
+	CHIN_BELOW_PUPILS_IPD      = CHIN_BELOW_PUPILS_MM / AVERAGE_IPD_MM
+)
+
+// Head sizing modes accepted by -size-mode
+const (
+	SIZE_MODE_IPD     = "ipd"     // From the interpupillary distance when the pupils are located, else the face box (default)
+	SIZE_MODE_FACEBOX = "facebox" // Always from the face box; located pupils are ignored
+)
+
+var sizeModes = []string{SIZE_MODE_IPD, SIZE_MODE_FACEBOX}
+
+// validateSizeMode checks a -size-mode value
+func validateSizeMode(mode string) error {
+	for _, m := range sizeModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid size mode '%s' (available: %s)", mode, strings.Join(sizeModes, ", "))
+}
+
+// forSizeMode returns the face to size the head from: with SIZE_MODE_FACEBOX a copy
+// without the located pupils, so every landmark comes from the face box
+func (f *FaceDetection) forSizeMode(mode string) *FaceDetection {
+	if mode != SIZE_MODE_FACEBOX || f.Pupils == nil {
+		return f
+	}
+	logInfo("📏 Sizing from the face box (-size-mode facebox), the located pupils are ignored")
+	withoutPupils := *f
+	withoutPupils.Pupils = nil
+	return &withoutPupils
+}
+
+// Pupils are the located pupil centers of a face, in the coordinates of the image
+// it was detected in. Left is the pupil on the left side of the image.
+type Pupils struct {
+	Left, Right image.Point
+}
+
+// Midpoint is the true center between the eyes, whatever the face box says
+func (p Pupils) Midpoint() image.Point {
+	return image.Pt((p.Left.X+p.Right.X)/2, (p.Left.Y+p.Right.Y)/2)
+}
+
+// Distance is the interpupillary distance in pixels
+func (p Pupils) Distance() float64 {
+	return math.Hypot(float64(p.Right.X-p.Left.X), float64(p.Right.Y-p.Left.Y))
+}
+
+// loadPupilCascade reads the pupil cascade next to the face cascade. It is optional:
+// when it is missing, unreadable or corrupt, nil is returned and the detector runs in
+// reduced accuracy mode, with the eyes estimated from the face box.
+func loadPupilCascade(cascadePath string) *pupilCascade {
+	path := filepath.Join(filepath.Dir(cascadePath), PUPIL_CASCADE_NAME)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logInfo("👁️  No pupil cascade at %s: reduced accuracy mode, eyes are estimated from the face box", path)
+		return nil
+	}
+	var cascade *pupilCascade
+	if err == nil {
+		cascade, err = unpackPupilCascade(data)
+	}
+	if err != nil {
+		logWarn("⚠️  Could not load the pupil cascade %s (%v): reduced accuracy mode, eyes are estimated from the face box", path, err)
+		return nil
+	}
+	return cascade
+}
+
+// pupilCascade is pigo's pupil localization cascade (puploc). It is run here rather
+// than with pigo's RunDetector, which perturbs the search window with the global
+// math/rand source: seeding that changed the random state of the whole program and
+// no longer works from Go 1.24 on.
+type pupilCascade struct {
+	stages, trees, depth int
+	scale                float32   // Search window scale from one stage to the next
+	codes                []int8    // Pixel pair offsets of each tree node, 4 per node
+	preds                []float32 // Row and column shift of each tree leaf
+}
+
+// unpackPupilCascade unpacks the cascade data in pigo's format: a header of stage
+// count, scale, trees per stage and tree depth, then for each tree the node codes and
+// a row and column shift per leaf
+func unpackPupilCascade(data []byte) (*pupilCascade, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("truncated cascade header of %d bytes", len(data))
+	}
+	cascade := &pupilCascade{
+		stages: int(binary.LittleEndian.Uint32(data[0:])),
+		scale:  math.Float32frombits(binary.LittleEndian.Uint32(data[4:])),
+		trees:  int(binary.LittleEndian.Uint32(data[8:])),
+		depth:  int(binary.LittleEndian.Uint32(data[12:])),
+	}
+	if cascade.stages == 0 || cascade.trees == 0 || cascade.depth == 0 || cascade.depth > 16 {
+		return nil, fmt.Errorf("corrupt cascade header (%d stages of %d trees of depth %d)", cascade.stages, cascade.trees, cascade.depth)
+	}
+	leaves := 1 << cascade.depth
+	codeBytes, predBytes := 4*leaves-4, 8*leaves
+	if (len(data)-16)/(codeBytes+predBytes)/cascade.trees < cascade.stages {
+		return nil, fmt.Errorf("truncated cascade: %d bytes for %d stages of %d trees", len(data), cascade.stages, cascade.trees)
+	}
+
+	pos := 16
+	for i := 0; i < cascade.stages*cascade.trees; i++ {
+		for _, code := range data[pos : pos+codeBytes] {
+			cascade.codes = append(cascade.codes, int8(code))
+		}
+		pos += codeBytes
+		for end := pos + predBytes; pos < end; pos += 4 {
+			cascade.preds = append(cascade.preds, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+		}
+	}
+	return cascade, nil
+}
+
+// classify runs the cascade on the search window at row, col of size scale and
+// returns where it moved the window, as pigo's classifyRegion does
+func (c *pupilCascade) classify(row, col, scale float32, img pigo.ImageParams) (float32, float32) {
+	leaves := 1 << c.depth
+	root := 0
+	for stage := 0; stage < c.stages; stage++ {
+		var dr, dc float32
+		size := int(math.Round(float64(scale)))
+		for tree := 0; tree < c.trees; tree++ {
+			node := 0
+			for level := 0; level < c.depth; level++ {
+				code := c.codes[root+4*node:]
+				r1 := min(img.Rows-1, max(0, (256*int(row)+int(code[0])*size)>>8))
+				c1 := min(img.Cols-1, max(0, (256*int(col)+int(code[1])*size)>>8))
+				r2 := min(img.Rows-1, max(0, (256*int(row)+int(code[2])*size)>>8))
+				c2 := min(img.Cols-1, max(0, (256*int(col)+int(code[3])*size)>>8))
+				node = 2*node + 1
+				if img.Pixels[r1*img.Dim+c1] > img.Pixels[r2*img.Dim+c2] {
+					node++
+				}
+			}
+			leaf := 2 * (c.trees*leaves*stage + leaves*tree + node - (leaves - 1))
+			dr += c.preds[leaf]
+			dc += c.preds[leaf+1]
+			root += 4*leaves - 4
+		}
+		row += dr * scale
+		col += dc * scale
+		scale *= c.scale
+	}
+	return row, col
+}
+
+// search runs the cascade on PUPIL_PERTURBATIONS windows jittered around row, col
+// with random and returns the median position, as pigo's RunDetector does
+func (cascade *pupilCascade) search(row, col int, scale float32, img pigo.ImageParams, random *rand.Rand) image.Point {
+	rows := make([]float32, PUPIL_PERTURBATIONS)
+	cols := make([]float32, PUPIL_PERTURBATIONS)
+	for i := range rows {
+		r := float32(row) + scale*0.15*(0.5-random.Float32())
+		c := float32(col) + scale*0.15*(0.5-random.Float32())
+		s := scale * (0.925 + 0.15*random.Float32())
+		rows[i], cols[i] = cascade.classify(r, c, s, img)
+	}
+	slices.Sort(rows)
+	slices.Sort(cols)
+	median := int(math.Round(float64(PUPIL_PERTURBATIONS) / 2))
+	return image.Pt(int(cols[median]), int(rows[median]))
+}
+
+// locatePupils searches each eye of a pigo face independently and returns nil when
+// the result isn't plausible for that face
+func locatePupils(cascade *pupilCascade, face pigo.Detection, img pigo.ImageParams) *Pupils {
+	if cascade == nil {
+		return nil
+	}
+	row := face.Row - int(PUPIL_SEARCH_ROW_OFFSET*float64(face.Scale))
+	offset := int(PUPIL_SEARCH_COL_OFFSET * float64(face.Scale))
+	locate := func(col int) (image.Point, bool) {
+		// A source seeded from the search position keeps the crop reproducible
+		random := rand.New(rand.NewSource(int64(face.Row*img.Cols + col)))
+		pupil := cascade.search(row, col, float32(face.Scale)*PUPIL_SEARCH_SCALE, img, random)
+		return pupil, pupil.Y > 0 && pupil.X > 0
+	}
+	left, okLeft := locate(face.Col - offset)
+	right, okRight := locate(face.Col + offset)
+	if !okLeft || !okRight {
+		return nil
+	}
+
+	pupils := &Pupils{Left: left, Right: right}
+	box := image.Rect(face.Col-face.Scale/2, face.Row-face.Scale/2, face.Col+face.Scale/2, face.Row+face.Scale/2)
+	distance := pupils.Distance()
+	switch {
+	case !left.In(box) || !right.In(box) || left.X >= right.X:
+		return nil
+	case distance < PUPIL_MIN_DISTANCE_RATIO*float64(face.Scale) || distance > PUPIL_MAX_DISTANCE_RATIO*float64(face.Scale):
+		return nil
+	case math.Abs(float64(right.Y-left.Y)) > PUPIL_MAX_ROLL*distance:
+		return nil
+	}
+	return pupils
+}
+
+// scaled returns the pupils in an image scaled by 1/factor, like the face coordinates
+// of Detect
+func (p *Pupils) scaled(factor float64) *Pupils {
+	if p == nil {
+		return nil
+	}
+	scale := func(pt image.Point) image.Point {
+		return image.Pt(int(float64(pt.X)/factor), int(float64(pt.Y)/factor))
+	}
+	return &Pupils{Left: scale(p.Left), Right: scale(p.Right)}
+}
+
+// printPupils reports the located pupils of the aligned face
+func printPupils(pupils *Pupils, faceSize int) {
+	if pupils == nil {
+		logInfo("👁️  Pupils not located, eye level and head size estimated from the face box")
+		return
+	}
+	mid := pupils.Midpoint()
+	logInfo("👁️  Pupils at (%d,%d) and (%d,%d): midpoint (%d,%d), interpupillary distance %.0f pixels (%.0f%% of the face size)",
+		pupils.Left.X, pupils.Left.Y, pupils.Right.X, pupils.Right.Y, mid.X, mid.Y, pupils.Distance(), pupils.Distance()/float64(faceSize)*100)
+}
@@ -0,0 +1,168 @@
+package passport
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cascadeDir returns a directory holding the face cascade and, when puploc isn't
+// nil, a pupil cascade with that content
+func cascadeDir(t *testing.T, puploc []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FACE_CASCADE_PATH), mustReadFile(t, FACE_CASCADE_PATH), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if puploc != nil {
+		if err := os.WriteFile(filepath.Join(dir, PUPIL_CASCADE_NAME), puploc, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// A missing, truncated or empty pupil cascade leaves the detector without one and
+// says so in the log, instead of failing or panicking
+func TestLoadPupilCascade(t *testing.T) {
+	requireCascade(t)
+	puploc, err := os.ReadFile(PUPIL_CASCADE_NAME)
+	if err != nil {
+		t.Skipf("pupil cascade not available: %v", err)
+	}
+	tests := []struct {
+		name    string
+		puploc  []byte
+		wantNil bool
+	}{
+		{"present", puploc, false},
+		{"missing", nil, true},
+		{"truncated", puploc[:len(puploc)/3], true},
+		{"empty", []byte{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := cascadeDir(t, tt.puploc)
+			var detector *FaceDetector
+			var err error
+			log := captureDebugLog(t, func() {
+				detector, err = NewFaceDetector(filepath.Join(dir, FACE_CASCADE_PATH), DefaultDetectionOptions())
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (detector.pupils == nil) != tt.wantNil {
+				t.Errorf("pupil cascade loaded: %v, want %v", detector.pupils != nil, !tt.wantNil)
+			}
+			if reduced := strings.Contains(log, "reduced accuracy mode"); reduced != tt.wantNil {
+				t.Errorf("reduced accuracy mode logged: %v, want %v:\n%s", reduced, tt.wantNil, log)
+			}
+		})
+	}
+}
+
+// Without the pupil cascade faces are still found and the photo is aligned from the
+// face box alone
+func TestGenerateWithoutPupilCascade(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := NewFaceDetector(filepath.Join(cascadeDir(t, nil), FACE_CASCADE_PATH), DefaultDetectionOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces, err := detector.Detect(source.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faces[0].Pupils != nil {
+		t.Errorf("pupils %+v located without a pupil cascade", faces[0].Pupils)
+	}
+
+	result, err := Generate(source.Image, WithFaceDetector(detector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.FaceFound {
+		t.Errorf("no face alignment, strategy %q", result.Strategy)
+	}
+}
+
+func TestUnpackPupilCascade(t *testing.T) {
+	header := func(stages, trees, depth uint32) []byte {
+		data := binary.LittleEndian.AppendUint32(nil, stages)
+		data = binary.LittleEndian.AppendUint32(data, 0x3f800000) // Scale 1.0
+		data = binary.LittleEndian.AppendUint32(data, trees)
+		return binary.LittleEndian.AppendUint32(data, depth)
+	}
+	// One stage of one tree of depth 1: 4 code bytes and 2 leaves of 2 shifts
+	tree := append([]byte{1, 2, 3, 4}, make([]byte, 16)...)
+	binary.LittleEndian.PutUint32(tree[8:], 0x40000000) // Column shift 2.0 of the first leaf
+	cascade, err := unpackPupilCascade(append(header(1, 1, 1), tree...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cascade.stages != 1 || cascade.trees != 1 || cascade.depth != 1 || cascade.scale != 1 ||
+		len(cascade.codes) != 4 || cascade.codes[3] != 4 || len(cascade.preds) != 4 || cascade.preds[1] != 2 {
+		t.Errorf("unpacked %+v", cascade)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":           nil,
+		"short header":    header(1, 1, 1)[:10],
+		"no trees":        header(1, 0, 1),
+		"no depth":        header(1, 1, 0),
+		"huge counts":     append(header(1<<31, 1<<31, 16), tree...),
+		"truncated trees": append(header(2, 1, 1), tree...),
+	} {
+		if _, err := unpackPupilCascade(data); err == nil {
+			t.Errorf("%s cascade unpacked", name)
+		}
+	}
+}
+
+// Pupil searches draw from their own seeded source: detections running at the same
+// time, as -batch workers do, locate the same pupils
+func TestLocatePupilsConcurrently(t *testing.T) {
+	requireCascade(t)
+	if _, err := os.Stat(PUPIL_CASCADE_NAME); err != nil {
+		t.Skipf("pupil cascade not available: %v", err)
+	}
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := NewFaceDetector(FACE_CASCADE_PATH, DefaultDetectionOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := detector.Detect(source.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want[0].Pupils == nil {
+		t.Fatal("no pupils located in the sample")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			faces, err := detector.Detect(source.Image)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if *faces[0].Pupils != *want[0].Pupils {
+				t.Errorf("pupils %+v, want %+v", *faces[0].Pupils, *want[0].Pupils)
+			}
+		}()
+	}
+	wg.Wait()
+}
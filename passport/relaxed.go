@@ -0,0 +1,60 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Face detection passes of the face strategy, recorded in the crop geometry
+const (
+	DETECTION_PASS_UPRIGHT = "upright"
+	DETECTION_PASS_ROTATED = "rotated"
+	DETECTION_PASS_RELAXED = "relaxed" // Best effort, see detectRelaxed
+)
+
+const (
+	// The relaxed pass accepts any detection the cascade returns and searches for
+	// faces down to this fraction of the short side
+	RELAXED_MIN_CONFIDENCE = 0.0
+	RELAXED_MIN_FACE_RATIO = 0.02
+
+	// Small images are enlarged up to this factor, at most to DETECTION_MAX_DIMENSION
+	// on the long side, so small faces still cover the cascade's smallest window
+	RELAXED_MAX_UPSCALE = 3.0
+)
+
+// detectRelaxed is the last, best-effort face search when the upright and rotated
+// passes found nothing: a very low confidence threshold, smaller faces, the tilted
+// passes, and an enlarged copy of small images. What it finds is more often wrong,
+// so the face strategy's head size check and the fallbacks after it still apply.
+func (d *FaceDetector) detectRelaxed(img image.Image) (*FaceDetection, error) {
+	bounds := img.Bounds()
+	scale := math.Min(RELAXED_MAX_UPSCALE, float64(DETECTION_MAX_DIMENSION)/float64(max(bounds.Dx(), bounds.Dy())))
+	large := img
+	if scale > 1 {
+		large = resizeImage(img, int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale))
+		logDebug("🔬 Relaxed pass on a copy enlarged %.1fx to %dx%d", scale, large.Bounds().Dx(), large.Bounds().Dy())
+	} else {
+		scale = 1
+	}
+
+	relaxedOpts := d.Options
+	relaxedOpts.MinConfidence = math.Min(relaxedOpts.MinConfidence, RELAXED_MIN_CONFIDENCE)
+	minRatio, _ := relaxedOpts.faceSizeRange()
+	relaxedOpts.MinFaceRatio = math.Min(minRatio, RELAXED_MIN_FACE_RATIO)
+	relaxedOpts.RotateSearch = true
+	face, err := d.withOptions(relaxedOpts).detectBest(large)
+	if err != nil {
+		return nil, fmt.Errorf("no faces detected, not even by the relaxed pass")
+	}
+
+	// Map the face from the enlarged copy back to img
+	return &FaceDetection{
+		X:      int(float64(face.X) / scale),
+		Y:      int(float64(face.Y) / scale),
+		Size:   int(float64(face.Size) / scale),
+		Score:  face.Score,
+		Pupils: face.Pupils.scaled(scale),
+	}, nil
+}
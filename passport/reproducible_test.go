@@ -0,0 +1,79 @@
+package passport
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fileHashes returns the SHA-256 of every file in dir by name
+func fileHashes(t *testing.T, dir string) map[string][sha256.Size]byte {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make(map[string][sha256.Size]byte)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[entry.Name()] = sha256.Sum256(data)
+	}
+	return hashes
+}
+
+// Two runs of the command line tool on the same input with the same options write
+// byte-identical files, including the version stamp of the crop report
+func TestCLIOutputIsReproducible(t *testing.T) {
+	requireCascade(t)
+	var runs []map[string][sha256.Size]byte
+	for run := 0; run < 2; run++ {
+		dir := t.TempDir()
+		_, stderr, code := runCLI(t, nil, "-save-photo", "-crop-report", "-outdir", dir, sampleImagePath, SHEET_10X15)
+		if code != 0 {
+			t.Fatalf("run %d exited with %d:\n%s", run+1, code, stderr)
+		}
+		runs = append(runs, fileHashes(t, dir))
+	}
+	if len(runs[0]) != 3 {
+		t.Fatalf("wrote %d files, want the sheet, the photo and the crop report", len(runs[0]))
+	}
+	for name, hash := range runs[0] {
+		if runs[1][name] != hash {
+			t.Errorf("%s differs between two runs", name)
+		}
+	}
+}
+
+// Generate gives the same pixels however many threads the runtime uses
+func TestGenerateIsReproducibleAcrossGOMAXPROCS(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	config := defaultConfig()
+	var hashes [][2][sha256.Size]byte
+	for _, procs := range []int{1, max(2, runtime.NumCPU()), 1} {
+		runtime.GOMAXPROCS(procs)
+		result, err := Generate(source.Image, WithSheet(SHEET_10X15))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, [2][sha256.Size]byte{
+			sha256.Sum256(mustEncode(t, result.Photo, config.PhotoSave)),
+			sha256.Sum256(mustEncode(t, result.Sheets[0].Image, config.Save)),
+		})
+	}
+	for i := 1; i < len(hashes); i++ {
+		if hashes[i] != hashes[0] {
+			t.Errorf("run %d differs from run 1", i+1)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Resize modes accepted by -resize
+const (
+	RESIZE_HIGH_QUALITY  = "high-quality"  // Production path, see resizeImageHighQuality (default)
+	RESIZE_DETERMINISTIC = "deterministic" // Integer-only bilinear for golden image tests
+)
+
+var resizeModes = []string{RESIZE_HIGH_QUALITY, RESIZE_DETERMINISTIC}
+
+// resizeMode selects the implementation behind resizeImage for the whole process.
+// Golden image tests switch it to RESIZE_DETERMINISTIC once via setResizeMode.
+var resizeMode = RESIZE_HIGH_QUALITY
+
+// setResizeMode validates and selects the resize implementation
+func setResizeMode(mode string) error {
+	for _, m := range resizeModes {
+		if m == mode {
+			resizeMode = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid resize mode '%s' (available: %s)", mode, strings.Join(resizeModes, ", "))
+}
+
+// resizeImage scales img to width×height with the selected resize mode. Every
+// resize in the pipeline (detection copies, the passport photo, thumbnails) goes
+// through here so a single switch makes the whole output reproducible.
+func resizeImage(img image.Image, width, height int) image.Image {
+	if resizeMode == RESIZE_DETERMINISTIC {
+		return resizeImageDeterministic(img, width, height)
+	}
+	return resizeImageHighQuality(img, width, height)
+}
+
+// resizeImageDeterministic is a bilinear resize that uses only integer arithmetic,
+// so its output is bit-identical on every platform and compiler version:
+//   - destination pixel centers map to source positions in 8-bit fixed point,
+//     (x+0.5)*srcWidth/width - 0.5, clamped to the image,
+//   - the four neighbours are weighted by the 0-256 fractional parts,
+//   - each channel is rounded half up to 8 bits once at the end.
+//
+// Other pipeline changes can't alter its result as long as the input pixels stay the same.
+func resizeImageDeterministic(img image.Image, width, height int) image.Image {
+	srcBounds := img.Bounds()
+	srcWidth := srcBounds.Dx()
+	srcHeight := srcBounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// sourcePosition returns the left/top neighbour and the 0-256 weight of the other one
+	sourcePosition := func(dstPos, dstSize, srcSize int) (int, int, int64) {
+		fixed := ((2*dstPos+1)*srcSize*256)/(2*dstSize) - 128
+		fixed = max(0, min(fixed, (srcSize-1)*256))
+		lower := fixed >> 8
+		return lower, min(lower+1, srcSize-1), int64(fixed & 0xFF)
+	}
+
+	for y := 0; y < height; y++ {
+		y1, y2, wy := sourcePosition(y, height, srcHeight)
+		for x := 0; x < width; x++ {
+			x1, x2, wx := sourcePosition(x, width, srcWidth)
+
+			var sum [4]int64
+			for _, n := range [4]struct {
+				x, y   int
+				weight int64
+			}{
+				{x1, y1, (256 - wx) * (256 - wy)},
+				{x2, y1, wx * (256 - wy)},
+				{x1, y2, (256 - wx) * wy},
+				{x2, y2, wx * wy},
+			} {
+				r, g, b, a := img.At(srcBounds.Min.X+n.x, srcBounds.Min.Y+n.y).RGBA()
+				sum[0] += int64(r) * n.weight
+				sum[1] += int64(g) * n.weight
+				sum[2] += int64(b) * n.weight
+				sum[3] += int64(a) * n.weight
+			}
+
+			// 16-bit channel sums back to 8 bits (65535 = 255*257)
+			const total = 256 * 256 * 257
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((sum[0] + total/2) / total),
+				G: uint8((sum[1] + total/2) / total),
+				B: uint8((sum[2] + total/2) / total),
+				A: uint8((sum[3] + total/2) / total),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,168 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// Declared resolutions below this are screen and camera defaults (72, 96 DPI)
+	// rather than a scan resolution, and are ignored
+	INPUT_MIN_DECLARED_DPI = 100
+
+	// The crop's physical size on the original, or its resolution at print size,
+	// may be off by this fraction before a warning is given
+	INPUT_RESOLUTION_TOLERANCE = 0.1
+)
+
+// ResolutionCheck relates the resolution declared by the input file (e.g. by a
+// scanner) to the printed photo
+type ResolutionCheck struct {
+	InputDPI     float64 `json:"input_dpi"`            // Declared by the file; 0 when unknown
+	Source       string  `json:"source"`               // Where it was read: jfif, exif or png
+	CropWidthMM  float64 `json:"crop_width_mm"`        // Width of the cropped area on the original
+	CropHeightMM float64 `json:"crop_height_mm"`       // Height of the cropped area on the original
+	Scale        float64 `json:"scale"`                // Printed size relative to the original
+	EffectiveDPI float64 `json:"effective_dpi"`        // Crop pixels per printed inch
+	SizeMismatch bool    `json:"size_mismatch"`        // A finished photo (-grid-only) isn't the spec's size on the original
+	Upscaled     bool    `json:"upscaled"`             // The crop has fewer pixels than the printed photo
+	RescanDPI    int     `json:"rescan_dpi,omitempty"` // Scan resolution that avoids upscaling
+}
+
+// readInputResolution returns the print resolution declared by a JPEG (JFIF
+// density, else EXIF XResolution) or PNG (pHYs), and where it was found. It
+// returns 0 when the file declares none or only a screen default.
+func readInputResolution(data []byte) (float64, string) {
+	var dpi float64
+	source := ""
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		dpi, source = jfifDensity(data), "jfif"
+		if dpi < INPUT_MIN_DECLARED_DPI {
+			dpi, source = exifResolution(data), "exif"
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		dpi, source = pngDensity(data), "png"
+	}
+	if dpi < INPUT_MIN_DECLARED_DPI {
+		return 0, ""
+	}
+	return dpi, source
+}
+
+// jfifDensity reads the horizontal density of the JFIF APP0 segment in DPI
+func jfifDensity(data []byte) float64 {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // start of scan / end of image: no more metadata
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE0 && len(segment) >= 12 && string(segment[:5]) == "JFIF\x00" {
+			density := float64(binary.BigEndian.Uint16(segment[8:]))
+			switch segment[7] {
+			case 1: // dots per inch
+				return density
+			case 2: // dots per centimeter
+				return density * 2.54
+			}
+			return 0 // aspect ratio only
+		}
+		pos = end
+	}
+	return 0
+}
+
+// exifResolution reads the EXIF XResolution in DPI
+func exifResolution(data []byte) float64 {
+	exifData, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	tag, err := exifData.Get(exif.XResolution)
+	if err != nil {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	dpi := float64(num) / float64(den)
+	if unitTag, err := exifData.Get(exif.ResolutionUnit); err == nil {
+		if unit, err := unitTag.Int(0); err == nil && unit == 3 {
+			dpi *= 2.54 // centimeters
+		}
+	}
+	return dpi
+}
+
+// pngDensity reads the horizontal density of the pHYs chunk in DPI
+func pngDensity(data []byte) float64 {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if chunkType == "IDAT" || length < 0 || pos+12+length > len(data) {
+			break
+		}
+		if chunkType == "pHYs" && length >= 9 {
+			chunk := data[pos+8 : pos+8+length]
+			if chunk[8] == 1 { // pixels per meter
+				return float64(binary.BigEndian.Uint32(chunk)) * 0.0254
+			}
+			return 0
+		}
+		pos += 12 + length
+	}
+	return 0
+}
+
+// checkInputResolution measures the crop against the resolution the input declares.
+// A finished photo (-grid-only) should measure the spec's size on the original; any
+// crop should have at least the print resolution, and with a known scan resolution
+// the check says which one would have been enough.
+func checkInputResolution(dpi float64, source string, crop image.Rectangle, spec PhotoSpec, finished bool) ResolutionCheck {
+	check := ResolutionCheck{InputDPI: dpi, Source: source}
+	check.EffectiveDPI = float64(crop.Dx()) * 25.4 / spec.WidthMM
+	check.Upscaled = check.EffectiveDPI < float64(spec.DPI)*(1-INPUT_RESOLUTION_TOLERANCE)
+	if dpi <= 0 || crop.Empty() {
+		return check
+	}
+	check.CropWidthMM = float64(crop.Dx()) * 25.4 / dpi
+	check.CropHeightMM = float64(crop.Dy()) * 25.4 / dpi
+	check.Scale = spec.WidthMM / check.CropWidthMM
+	check.SizeMismatch = finished && math.Abs(check.Scale-1) > INPUT_RESOLUTION_TOLERANCE
+	if check.Upscaled {
+		check.RescanDPI = int(math.Ceil(dpi * float64(spec.DPI) / check.EffectiveDPI))
+	}
+	return check
+}
+
+// printResolutionCheck reports the declared input resolution; files without one
+// are not mentioned
+func printResolutionCheck(check ResolutionCheck, spec PhotoSpec) {
+	if check.InputDPI <= 0 {
+		return
+	}
+	logInfo("📠 Input declares %g DPI (%s): the crop covers %s of the original, printed at %s (%.0f%%)",
+		check.InputDPI, check.Source, formatPhysicalSize(check.CropWidthMM, check.CropHeightMM, 1),
+		formatPhysicalSize(spec.WidthMM, spec.HeightMM, -1), check.Scale*100)
+	if check.SizeMismatch {
+		logWarn("⚠️  At its declared %g DPI the input measures %s instead of %s - check that it is the finished photo and the scanner resolution",
+			check.InputDPI, formatPhysicalSize(check.CropWidthMM, check.CropHeightMM, 1), formatPhysicalSize(spec.WidthMM, spec.HeightMM, -1))
+	}
+	if check.Upscaled {
+		logWarn("⚠️  Scanned at %g DPI the crop only has %.0f DPI at print size (%d DPI needed) - rescan at %d DPI or more for a sharp print",
+			check.InputDPI, check.EffectiveDPI, spec.DPI, check.RescanDPI)
+	}
+}
@@ -0,0 +1,149 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+)
+
+const (
+	// Reference ruler (-ruler): total length and tick interval in millimeters
+	RULER_LENGTH_MM   = 50
+	RULER_INTERVAL_MM = 10
+
+	// Tick length, line width and distance of the ruler from the photos in millimeters
+	RULER_TICK_MM    = 2.0
+	RULER_LINE_MM    = 0.15
+	RULER_PADDING_MM = 0.5
+
+	// Tick label font size in points (rendered at the sheet DPI)
+	RULER_LABEL_SIZE_PT = 4.0
+)
+
+var rulerColor = color.RGBA{0, 0, 0, 255}
+
+// rulerBand is a margin of the sheet the ruler can be drawn in
+type rulerBand struct {
+	Name       string
+	Rect       image.Rectangle
+	Horizontal bool // The ruler runs along the x axis
+	Inward     int  // Direction from the paper edge toward the photos across the band: +1 or -1
+}
+
+// rulerTicks returns the pixel positions of the ruler ticks along the sheet edge,
+// starting originMM from it: round(mm × dpi / 25.4) for every RULER_INTERVAL_MM
+func rulerTicks(originMM, dpi int) []int {
+	var ticks []int
+	for mm := 0; mm <= RULER_LENGTH_MM; mm += RULER_INTERVAL_MM {
+		ticks = append(ticks, mmToPX(float64(originMM+mm), dpi))
+	}
+	return ticks
+}
+
+// rulerBands returns the margins around the placed photos, bottom and top first
+// since the ruler is horizontal there and easiest to measure
+func rulerBands(slots []image.Rectangle, format PrintFormat) []rulerBand {
+	var photos image.Rectangle
+	for _, slot := range slots {
+		photos = photos.Union(slot)
+	}
+	return []rulerBand{
+		{"bottom", image.Rect(0, photos.Max.Y, format.WidthPX, format.HeightPX), true, -1},
+		{"top", image.Rect(0, 0, format.WidthPX, photos.Min.Y), true, 1},
+		{"left", image.Rect(0, 0, photos.Min.X, format.HeightPX), false, 1},
+		{"right", image.Rect(photos.Max.X, 0, format.WidthPX, format.HeightPX), false, -1},
+	}
+}
+
+// drawRuler draws a RULER_LENGTH_MM reference ruler with a tick and a label every
+// RULER_INTERVAL_MM into the first margin of the sheet wide enough for it, centered
+// along the edge at a whole millimeter, so a physical ruler shows whether the print
+// was scaled. Nothing is drawn over the photos; without a wide enough margin the
+// ruler is skipped with a warning.
+func drawRuler(canvas *image.RGBA, slots []image.Rectangle, format PrintFormat) {
+	dpi := format.DPI
+	thickness := mmToPX(RULER_PADDING_MM+RULER_TICK_MM, dpi)
+	line := max(1, mmToPX(RULER_LINE_MM, dpi))
+
+	for _, band := range rulerBands(slots, format) {
+		across, along := band.Rect.Dy(), band.Rect.Dx()
+		if !band.Horizontal {
+			across, along = band.Rect.Dx(), band.Rect.Dy()
+		}
+		edgeMM := int(pxToMM(along, dpi))
+		if across < thickness || edgeMM < RULER_LENGTH_MM+RULER_INTERVAL_MM {
+			continue
+		}
+		originMM := (edgeMM - RULER_LENGTH_MM) / 2
+		ticks := rulerTicks(originMM, dpi)
+
+		// Baseline on the photo side of the band, ticks reaching toward the paper edge
+		padding := mmToPX(RULER_PADDING_MM, dpi)
+		tickLength := mmToPX(RULER_TICK_MM, dpi)
+		var baseline int
+		if band.Horizontal {
+			baseline = band.Rect.Min.Y + padding
+			if band.Inward > 0 {
+				baseline = band.Rect.Max.Y - padding - line
+			}
+		} else {
+			baseline = band.Rect.Min.X + padding
+			if band.Inward > 0 {
+				baseline = band.Rect.Max.X - padding - line
+			}
+		}
+		tickStart, tickEnd := baseline, baseline+tickLength
+		if band.Inward > 0 {
+			tickStart, tickEnd = baseline+line-tickLength, baseline+line
+		}
+
+		// rect maps along/across pixel ranges to the sheet
+		rect := func(along0, along1, across0, across1 int) image.Rectangle {
+			if band.Horizontal {
+				return image.Rect(along0, across0, along1, across1)
+			}
+			return image.Rect(across0, along0, across1, along1)
+		}
+		fill := &image.Uniform{rulerColor}
+		draw.Draw(canvas, rect(ticks[0]-line/2, ticks[len(ticks)-1]-line/2+line, baseline, baseline+line), fill, image.Point{}, draw.Src)
+		for _, tick := range ticks {
+			draw.Draw(canvas, rect(tick-line/2, tick-line/2+line, tickStart, tickEnd), fill, image.Point{}, draw.Src)
+		}
+		drawRulerLabels(canvas, band, ticks, tickStart, tickEnd, line, dpi)
+
+		logInfo("📏 Reference ruler: %dmm with %dmm ticks in the %s margin, starting %dmm from the edge",
+			RULER_LENGTH_MM, RULER_INTERVAL_MM, band.Name, originMM)
+		return
+	}
+	logWarn("⚠️  No margin is wide enough for the %dmm reference ruler (needs %.1fmm), skipped",
+		RULER_LENGTH_MM, RULER_PADDING_MM+RULER_TICK_MM)
+}
+
+// drawRulerLabels writes the millimeter value next to every tick, inside the tick zone
+func drawRulerLabels(canvas *image.RGBA, band rulerBand, ticks []int, tickStart, tickEnd, line, dpi int) {
+	face, err := newLabelFace(RULER_LABEL_SIZE_PT, dpi)
+	if err != nil {
+		logWarn("⚠️  Could not draw ruler labels: %v", err)
+		return
+	}
+	defer face.Close()
+
+	gap := max(1, line)
+	for i, tick := range ticks {
+		mask := renderTextMask(strconv.Itoa(i*RULER_INTERVAL_MM), face)
+		size := mask.Bounds().Size()
+		var x, y int
+		if band.Horizontal {
+			// Right of the tick, centered in the tick zone
+			x = tick + line + gap
+			y = (tickStart+tickEnd)/2 - size.Y/2
+		} else {
+			// Below the tick, centered in the tick zone
+			x = (tickStart+tickEnd)/2 - size.X/2
+			y = tick + line + gap
+		}
+		target := image.Rect(x, y, x+size.X, y+size.Y).Intersect(canvas.Bounds())
+		draw.DrawMask(canvas, target, &image.Uniform{rulerColor}, image.Point{}, mask, image.Point{}, draw.Over)
+	}
+}
@@ -0,0 +1,77 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestRulerTicks(t *testing.T) {
+	for _, dpi := range []int{300, 350, 600} {
+		for _, originMM := range []int{0, 47} {
+			ticks := rulerTicks(originMM, dpi)
+			if len(ticks) != RULER_LENGTH_MM/RULER_INTERVAL_MM+1 {
+				t.Fatalf("%d ticks, want one every %dmm over %dmm", len(ticks), RULER_INTERVAL_MM, RULER_LENGTH_MM)
+			}
+			for i, tick := range ticks {
+				mm := originMM + i*RULER_INTERVAL_MM
+				if want := int(math.Round(float64(mm) * float64(dpi) / 25.4)); tick != want {
+					t.Errorf("%d DPI: tick at %dmm on pixel %d, want %d", dpi, mm, tick, want)
+				}
+			}
+		}
+	}
+}
+
+// The ruler is drawn in the bottom margin of a 10x15cm sheet with every tick on its
+// exact pixel, and leaves the photos alone
+func TestDrawRulerOnSheet(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := color.RGBA{128, 128, 128, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	for _, dpi := range []int{300, 600} {
+		t.Run(fmt.Sprintf("%d DPI", dpi), func(t *testing.T) {
+			dpiSpec := spec.WithDPI(dpi)
+			format, err := lookupPrintFormat(SHEET_10X15, dpiSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format.Ruler, format.CutMarks = true, true
+			photo := image.NewRGBA(image.Rect(0, 0, dpiSpec.WidthPX, dpiSpec.HeightPX))
+			draw.Draw(photo, photo.Bounds(), &image.Uniform{gray}, image.Point{}, draw.Src)
+			sheet := createPrintLayout(photo, format).(*image.RGBA)
+
+			slots := gridSlots(calculateGridLayout(format), format)
+			for _, slot := range slots {
+				for y := slot.Min.Y; y < slot.Max.Y; y++ {
+					for x := slot.Min.X; x < slot.Max.X; x++ {
+						if sheet.RGBAAt(x, y) != gray {
+							t.Fatalf("photo pixel (%d,%d) drawn over with %v", x, y, sheet.RGBAAt(x, y))
+						}
+					}
+				}
+			}
+
+			// Ticks hang from the baseline toward the bottom edge
+			band := rulerBands(slots, format)[0]
+			line := max(1, mmToPX(RULER_LINE_MM, dpi))
+			tickY := band.Rect.Min.Y + mmToPX(RULER_PADDING_MM, dpi) + mmToPX(RULER_TICK_MM, dpi)*3/4
+			originMM := (int(pxToMM(band.Rect.Dx(), dpi)) - RULER_LENGTH_MM) / 2
+			for i, tick := range rulerTicks(originMM, dpi) {
+				left, right := tick-line/2, tick-line/2+line
+				if sheet.RGBAAt(tick, tickY) != rulerColor || sheet.RGBAAt(left, tickY) != rulerColor || sheet.RGBAAt(right-1, tickY) != rulerColor {
+					t.Errorf("tick %d (%dmm) not drawn at pixels %d-%d", i, originMM+i*RULER_INTERVAL_MM, left, right-1)
+				}
+				if sheet.RGBAAt(left-1, tickY) != white || sheet.RGBAAt(right, tickY) != white {
+					t.Errorf("tick %d (%dmm) is wider than pixels %d-%d", i, originMM+i*RULER_INTERVAL_MM, left, right-1)
+				}
+			}
+		})
+	}
+}
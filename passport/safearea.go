@@ -0,0 +1,192 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+const (
+	// The background is grown from the border through neighboring pixels closer than
+	// SAFE_AREA_STEP_DISTANCE to each other (euclidean RGB, 0-255), so lighting
+	// gradients are followed while the sharp outline of hair and skin stops it, and
+	// never further than SAFE_AREA_BACKGROUND_DISTANCE from the sampled corner color
+	SAFE_AREA_STEP_DISTANCE       = 10.0
+	SAFE_AREA_BACKGROUND_DISTANCE = 60.0
+
+	// A row or column of the head zone reaches into the margin only with at least
+	// this fraction of subject pixels, so noise and JPEG ringing don't count
+	SAFE_AREA_MIN_SUBJECT_RATIO = 0.02
+
+	// -safe-margin may take at most this fraction of the photo's shorter side per edge
+	SAFE_AREA_MAX_MARGIN_RATIO = 0.25
+
+	// Opacity of the safe area outline in the -preview images
+	SAFE_AREA_OVERLAY_ALPHA = 96
+)
+
+// Outline of the safe area in the debug and preview images
+var DebugColorSafeArea = color.RGBA{0, 160, 255, 255}
+
+// SafeAreaCheck measures how far the subject reaches into the -safe-margin along
+// the cut edges of the photo. The head zone, from the top edge down to the chin,
+// is checked against the top, left and right edges; the shoulders below it run
+// off the sides and bottom edge by design and aren't.
+type SafeAreaCheck struct {
+	MarginMM   float64  `json:"margin_mm"`
+	Checked    bool     `json:"checked"`              // False when the background was too uneven to tell the subject apart
+	TopMM      float64  `json:"top_intrusion_mm"`     // How far the subject reaches into the top margin; 0 when clear
+	LeftMM     float64  `json:"left_intrusion_mm"`    // Into the left margin, as the photo is printed
+	RightMM    float64  `json:"right_intrusion_mm"`   // Into the right margin
+	SubjectTop int      `json:"subject_top_px"`       // Topmost subject row of the photo
+	Violations []string `json:"violations,omitempty"` // Edges the subject reaches into, e.g. "top"
+}
+
+// validateSafeMargin checks a -safe-margin value against the photo size
+func validateSafeMargin(marginMM float64, spec PhotoSpec) error {
+	limit := math.Min(spec.WidthMM, spec.HeightMM) * SAFE_AREA_MAX_MARGIN_RATIO
+	if marginMM < 0 || marginMM > limit {
+		return fmt.Errorf("invalid safe margin %gmm (must be between 0 and %gmm for a %gx%gmm photo)", marginMM, limit, spec.WidthMM, spec.HeightMM)
+	}
+	return nil
+}
+
+// safeAreaRect returns the photo minus the margin on every side, in photo pixels
+func safeAreaRect(size image.Point, marginMM float64, dpi int) image.Rectangle {
+	margin := mmToPX(marginMM, dpi)
+	return image.Rect(margin, margin, size.X-margin, size.Y-margin)
+}
+
+// checkSafeArea measures the subject of the finished photo against the safe margin.
+// face is the face box in the photo, see faceMask; the chin is estimated below it.
+func checkSafeArea(photo image.Image, face image.Rectangle, spec PhotoSpec, marginMM float64) SafeAreaCheck {
+	check := SafeAreaCheck{MarginMM: marginMM}
+	backgroundColor, ok := sampleBackgroundColor(photo)
+	if !ok {
+		return check
+	}
+	check.Checked = true
+
+	bounds := photo.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	chin := max(0, min(height, face.Max.Y+int(float64(face.Dy())*CHIN_EXTENSION_RATIO)))
+	pixels := make([][3]float64, width*chin)
+	for y := 0; y < chin; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*width+x] = [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+		}
+	}
+
+	// Background: grown from the top and side edges of the head zone
+	background := make([]bool, len(pixels))
+	var queue []int
+	for i, pixel := range pixels {
+		x, y := i%width, i/width
+		if (y == 0 || x == 0 || x == width-1) && colorDistance(pixel, backgroundColor) < SHOULDER_COLOR_DISTANCE {
+			background[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%width, i/width
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= width || n[1] >= chin {
+				continue
+			}
+			j := n[1]*width + n[0]
+			if !background[j] && colorDistance(pixels[j], pixels[i]) < SAFE_AREA_STEP_DISTANCE &&
+				colorDistance(pixels[j], backgroundColor) < SAFE_AREA_BACKGROUND_DISTANCE {
+				background[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	// Subject pixels per row and per column of the head zone
+	rows := make([]int, chin)
+	columns := make([]int, width)
+	for i := range pixels {
+		if !background[i] {
+			rows[i/width]++
+			columns[i%width]++
+		}
+	}
+	first := func(counts []int, total int, reverse bool) int {
+		minimum := max(2, int(float64(total)*SAFE_AREA_MIN_SUBJECT_RATIO))
+		for i := range counts {
+			j := i
+			if reverse {
+				j = len(counts) - 1 - i
+			}
+			if counts[j] >= minimum {
+				return i
+			}
+		}
+		return len(counts)
+	}
+	check.SubjectTop = first(rows, width, false)
+	left := first(columns, chin, false)
+	right := first(columns, chin, true)
+
+	margin := float64(mmToPX(marginMM, spec.DPI))
+	intrusion := func(edge string, distance int) float64 {
+		if float64(distance) >= margin {
+			return 0
+		}
+		check.Violations = append(check.Violations, edge)
+		return pxToMM(int(margin)-distance, spec.DPI)
+	}
+	check.TopMM = intrusion("top", check.SubjectTop)
+	check.LeftMM = intrusion("left", left)
+	check.RightMM = intrusion("right", right)
+	return check
+}
+
+// printSafeAreaCheck warns about every edge the subject reaches into the margin
+func printSafeAreaCheck(check SafeAreaCheck) {
+	if !check.Checked {
+		logInfo("ℹ️  Safe area not checked (background too uneven)")
+		return
+	}
+	if len(check.Violations) == 0 {
+		logInfo("🔲 Subject stays within the %s safe margin", formatLength(check.MarginMM, -1))
+		return
+	}
+	intrusions := map[string]float64{"top": check.TopMM, "left": check.LeftMM, "right": check.RightMM}
+	var parts []string
+	for _, edge := range check.Violations {
+		parts = append(parts, fmt.Sprintf("%s edge by %s", edge, formatLength(intrusions[edge], 1)))
+	}
+	logWarn("⚠️  The subject reaches into the %s safe margin at the %s - the cutter may clip it", formatLength(check.MarginMM, -1), strings.Join(parts, ", "))
+}
+
+// drawSafeAreas outlines the safe area of every photo slot of a sheet, faintly so
+// the preview still shows the photos
+func drawSafeAreas(sheet Sheet, marginMM float64) image.Image {
+	bounds := sheet.Image.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), sheet.Image, bounds.Min, draw.Src)
+
+	format := sheet.Format
+	line := max(1, mmToPX(0.2, format.DPI))
+	outline := &image.Uniform{color.NRGBA{DebugColorSafeArea.R, DebugColorSafeArea.G, DebugColorSafeArea.B, SAFE_AREA_OVERLAY_ALPHA}}
+	offset := format.TrimBox().Min
+	for _, slot := range gridSlots(calculateGridLayout(format), format) {
+		safe := safeAreaRect(slot.Size(), marginMM, format.DPI).Add(slot.Min).Add(offset)
+		for _, edge := range []image.Rectangle{
+			image.Rect(safe.Min.X, safe.Min.Y, safe.Max.X, safe.Min.Y+line),
+			image.Rect(safe.Min.X, safe.Max.Y-line, safe.Max.X, safe.Max.Y),
+			image.Rect(safe.Min.X, safe.Min.Y, safe.Min.X+line, safe.Max.Y),
+			image.Rect(safe.Max.X-line, safe.Min.Y, safe.Max.X, safe.Max.Y),
+		} {
+			draw.Draw(canvas, edge, outline, image.Point{}, draw.Over)
+		}
+	}
+	return canvas
+}
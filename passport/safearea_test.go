@@ -0,0 +1,126 @@
+package passport
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"testing"
+)
+
+// safeAreaTestPhoto is a photo of spec's size on a light background with a dark
+// head block at head
+func safeAreaTestPhoto(spec PhotoSpec, head image.Rectangle) *image.RGBA {
+	photo := image.NewRGBA(image.Rect(0, 0, spec.WidthPX, spec.HeightPX))
+	draw.Draw(photo, photo.Bounds(), &image.Uniform{color.RGBA{232, 232, 228, 255}}, image.Point{}, draw.Src)
+	draw.Draw(photo, head, &image.Uniform{color.RGBA{90, 60, 45, 255}}, image.Point{}, draw.Src)
+	return photo
+}
+
+// A head a few pixels from a cut edge reaches into the margin by the rest of it
+func TestCheckSafeArea(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const marginMM = 2
+	margin := mmToPX(marginMM, spec.DPI) // 24px at 300 DPI
+	intrusion := func(distance int) float64 { return pxToMM(margin-distance, spec.DPI) }
+	tests := []struct {
+		name             string
+		head             image.Rectangle
+		top, left, right float64
+		violations       string
+		warning          string
+	}{
+		{"centered", image.Rect(120, 60, 290, 330), 0, 0, 0, "", ""},
+		{"near the left edge", image.Rect(10, 80, 180, 330), 0, intrusion(10), 0, "left", "left edge by 1.2mm"},
+		{"near the top edge", image.Rect(120, 10, 290, 330), intrusion(10), 0, 0, "top", "top edge by 1.2mm"},
+		{"near the top and right edges", image.Rect(140, 20, spec.WidthPX-13, 330), intrusion(20), 0, intrusion(13), "top,right", "top edge by 0.3mm, right edge by 0.9mm"},
+		{"at the margin", image.Rect(margin, margin, spec.WidthPX-margin, 330), 0, 0, 0, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkSafeArea(safeAreaTestPhoto(spec, tt.head), tt.head, spec, marginMM)
+			if !check.Checked {
+				t.Fatal("safe area not checked")
+			}
+			got := []float64{check.TopMM, check.LeftMM, check.RightMM}
+			for i, want := range []float64{tt.top, tt.left, tt.right} {
+				if math.Abs(got[i]-want) > 1e-9 {
+					t.Errorf("intrusions top, left, right %.3v, want %.3v", got, []float64{tt.top, tt.left, tt.right})
+					break
+				}
+			}
+			if violations := strings.Join(check.Violations, ","); violations != tt.violations {
+				t.Errorf("violations %q, want %q", violations, tt.violations)
+			}
+
+			log := captureDebugLog(t, func() { printSafeAreaCheck(check) })
+			if tt.warning == "" && strings.Contains(log, "level=WARN") {
+				t.Errorf("warning for a head clear of the margin:\n%s", log)
+			}
+			if tt.warning != "" && !strings.Contains(log, tt.warning) {
+				t.Errorf("warning lacks %q:\n%s", tt.warning, log)
+			}
+		})
+	}
+}
+
+func TestCheckSafeAreaUnevenBackground(t *testing.T) {
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	head := image.Rect(120, 60, 290, 330)
+	photo := safeAreaTestPhoto(spec, head)
+	draw.Draw(photo, image.Rect(0, 0, 40, 40), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{}, draw.Src)
+	if check := checkSafeArea(photo, head, spec, 2); check.Checked || len(check.Violations) > 0 {
+		t.Errorf("checked %v with violations %v on an uneven background", check.Checked, check.Violations)
+	}
+}
+
+func TestValidateSafeMargin(t *testing.T) {
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	limit := math.Min(spec.WidthMM, spec.HeightMM) * SAFE_AREA_MAX_MARGIN_RATIO
+	for margin, valid := range map[float64]bool{-1: false, 0: true, 2: true, limit: true, limit + 0.1: false} {
+		if err := validateSafeMargin(margin, spec); (err == nil) != valid {
+			t.Errorf("%gmm: %v", margin, err)
+		}
+	}
+}
+
+// The default margin of 0 checks nothing and warns about nothing, and a margin only
+// checks: the photo is the same with and without it
+func TestSafeMarginOffByDefault(t *testing.T) {
+	img := syntheticPhoto(600, 800)
+	var photos [][]byte
+	for _, tt := range []struct {
+		name    string
+		opts    []Option
+		checked bool
+	}{
+		{"default", nil, false},
+		{"margin 0", []Option{WithSafeMargin(0)}, false},
+		{"margin 2mm", []Option{WithSafeMargin(2)}, true},
+	} {
+		var result *Result
+		log := captureDebugLog(t, func() {
+			var err error
+			if result, err = Generate(img, append([]Option{WithStrategy(STRATEGY_CENTER)}, tt.opts...)...); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if logged := strings.Contains(log, "safe margin"); result.SafeArea.Checked != tt.checked || logged != tt.checked {
+			t.Errorf("%s: safe area checked %v, logged %v", tt.name, result.SafeArea.Checked, logged)
+		}
+		if !tt.checked && (result.SafeArea.MarginMM != 0 || len(result.SafeArea.Violations) > 0) {
+			t.Errorf("%s: safe area %+v without a margin", tt.name, result.SafeArea)
+		}
+		photos = append(photos, toRGBA(result.Photo).Pix)
+	}
+	for i := 1; i < len(photos); i++ {
+		if !bytes.Equal(photos[i], photos[0]) {
+			t.Errorf("photo %d differs from the default one", i+1)
+		}
+	}
+}
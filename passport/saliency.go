@@ -0,0 +1,130 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// The subject mask is computed on a copy downscaled to this many pixels on the long side
+	SALIENCY_ANALYSIS_SIZE = 400
+
+	// A row belongs to the subject when at least this fraction of it differs from the background
+	SALIENCY_ROW_COVERAGE = 0.02
+
+	// The head is taken to fill this fraction of the image height below the top of the subject
+	SALIENCY_HEAD_BAND_RATIO = 0.25
+
+	// Rows of the head band sorted by width: this percentile is the head width, which
+	// skips narrow rows of a hair bun at the top and stray hair strands at the sides
+	SALIENCY_HEAD_WIDTH_PERCENTILE = 0.75
+
+	// Head height (crown to chin) relative to the head width including the hair. Errs
+	// on the large side (updos, long faces) so the chin stays inside the crop.
+	SALIENCY_HEAD_ASPECT = 1.7
+)
+
+// cropBySaliency separates the subject from a plain background by color, like the
+// hair estimate does, and places the crop around the subject's silhouette: the top of
+// the subject is the crown, the head band below it gives the head width and the
+// horizontal center, and the head height is estimated from the width.
+// Fails when the background isn't plain or no subject stands out.
+func cropBySaliency(img image.Image, config Config) (image.Image, CropGeometry, error) {
+	spec := config.Spec
+	if err := checkCroppable(img, spec); err != nil {
+		return nil, CropGeometry{}, err
+	}
+
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(SALIENCY_ANALYSIS_SIZE)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := img
+	if scale < 1 {
+		small = resizeImage(img, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+	}
+	width := small.Bounds().Dx()
+	height := small.Bounds().Dy()
+
+	background, ok := sampleBackgroundColor(small)
+	if !ok {
+		return nil, CropGeometry{}, fmt.Errorf("background is not plain enough to separate the subject")
+	}
+
+	// Per row: extent and horizontal centroid of the pixels that differ from the
+	// background; rows with too few of them count as empty (width 0)
+	rowWidths := make([]int, height)
+	rowCentroids := make([]float64, height)
+	crown := -1
+	for y := 0; y < height; y++ {
+		left, right, count, sum := -1, -1, 0, 0
+		for x := 0; x < width; x++ {
+			r, g, b, _ := small.At(small.Bounds().Min.X+x, small.Bounds().Min.Y+y).RGBA()
+			pixel := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+			if colorDistance(pixel, background) <= HAIR_COLOR_DISTANCE {
+				continue
+			}
+			if left < 0 {
+				left = x
+			}
+			right = x
+			count++
+			sum += x
+		}
+		if float64(count) < float64(width)*SALIENCY_ROW_COVERAGE {
+			continue
+		}
+		if crown < 0 {
+			crown = y
+		}
+		rowWidths[y] = right - left + 1
+		rowCentroids[y] = float64(sum) / float64(count)
+	}
+	if crown < 0 {
+		return nil, CropGeometry{}, fmt.Errorf("no subject stands out from the background")
+	}
+
+	// Head width and center from the band below the crown
+	headBand := max(2, int(float64(height)*SALIENCY_HEAD_BAND_RATIO))
+	var headWidths []int
+	var centerX float64
+	for y := crown; y < min(height, crown+headBand); y++ {
+		if rowWidths[y] > 0 {
+			headWidths = append(headWidths, rowWidths[y])
+			centerX += rowCentroids[y]
+		}
+	}
+	if len(headWidths) < 2 {
+		return nil, CropGeometry{}, fmt.Errorf("no subject stands out from the background")
+	}
+	centerX /= float64(len(headWidths))
+	sort.Ints(headWidths)
+	headWidth := headWidths[int(float64(len(headWidths)-1)*SALIENCY_HEAD_WIDTH_PERCENTILE)]
+
+	headHeight := float64(headWidth) * SALIENCY_HEAD_ASPECT
+	logInfo("🎯 Subject found: crown at %.0f%%, head about %.0f%% of the image height",
+		float64(crown)/float64(height)*100, headHeight/float64(height)*100)
+
+	// Size the crop so the head matches the spec, then put the crown below the headspace.
+	// Work in full-resolution pixels from here on.
+	cropHeight := headHeight / spec.HeadHeightRatio / scale
+	cropWidth := cropHeight * float64(spec.WidthPX) / float64(spec.HeightPX)
+	if fit := math.Min(float64(bounds.Dx())/cropWidth, float64(bounds.Dy())/cropHeight); fit < 1 {
+		cropWidth *= fit
+		cropHeight *= fit
+	}
+	cropX := centerX/scale - cropWidth/2
+	cropY := float64(crown)/scale - cropHeight*spec.HeadspaceRatio
+	cropX = math.Max(0, math.Min(cropX, float64(bounds.Dx())-cropWidth))
+	cropY = math.Max(0, math.Min(cropY, float64(bounds.Dy())-cropHeight))
+
+	rect := image.Rect(int(cropX), int(cropY), int(cropX+cropWidth), int(cropY+cropHeight))
+	if err := checkCropRect("saliency crop", rect, image.Rect(0, 0, bounds.Dx(), bounds.Dy()), PAD_SNAP); err != nil {
+		return nil, CropGeometry{}, err
+	}
+	cropped, err := cropImage(img, rect.Add(bounds.Min))
+	if err != nil {
+		return nil, CropGeometry{}, err
+	}
+	return resizeImage(cropped, spec.WidthPX, spec.HeightPX), CropGeometry{Rect: rect}, nil
+}
@@ -0,0 +1,171 @@
+package passport
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// selfTestSample is a small upright portrait on a light background that every
+// working installation turns into a compliant photo
+//
+//go:embed selftest.jpg
+var selfTestSample []byte
+
+const (
+	// Largest difference of a channel mean (0-255) between a photo slot of the
+	// sheet and the photo, and between the saved and the decoded sheet
+	SELF_TEST_MAX_SLOT_DIFFERENCE       = 10.0
+	SELF_TEST_MAX_ROUND_TRIP_DIFFERENCE = 3.0
+)
+
+// selfTestStage is one step of the selftest subcommand; run returns what was
+// measured, or an error when the stage fails
+type selfTestStage struct {
+	name string
+	run  func() (string, error)
+}
+
+// runSelfTest runs the whole pipeline on the embedded sample: the cascades, the
+// decoders, face detection, the compliance checks, the layout and the JPEG encoder.
+// It prints PASS or FAIL per stage and reports whether every stage passed. Stages
+// whose input a failed stage should have produced are skipped. Nothing is written
+// outside a temporary directory, which is removed again.
+func runSelfTest(config Config) bool {
+	tempDir, err := os.MkdirTemp("", "passport-selftest-")
+	if err != nil {
+		fmt.Print(msg("selftest.fail", msg("selftest.setup"), err))
+		return false
+	}
+	defer os.RemoveAll(tempDir)
+
+	format, err := lookupPrintFormat(SHEET_10X15, config.Spec)
+	if err != nil {
+		fmt.Print(msg("selftest.fail", msg("selftest.setup"), err))
+		return false
+	}
+	config.PrintFormats = []PrintFormat{format}
+
+	var img image.Image
+	var result *Result
+	stages := []selfTestStage{
+		{msg("selftest.cascade"), func() (string, error) {
+			if config.Detector, err = NewFaceDetector(FACE_CASCADE_PATH, config.Detection); err != nil {
+				return "", err
+			}
+			if config.Detector.pupils == nil {
+				return msg("selftest.no_pupils"), nil
+			}
+			return msg("selftest.cascades"), nil
+		}},
+		{msg("selftest.decode"), func() (string, error) {
+			if img, _, err = decodeImage(selfTestSample); err != nil {
+				return "", err
+			}
+			return msg("selftest.decoded", img.Bounds().Dx(), img.Bounds().Dy()), nil
+		}},
+		{msg("selftest.face"), func() (string, error) {
+			if result, err = processPhoto(img, config); err != nil {
+				return "", err
+			}
+			if !result.FaceFound {
+				return "", fmt.Errorf("no face found, cropped with the %s strategy", result.Strategy)
+			}
+			return msg("selftest.face_found", result.Crop.Face.Dx(), result.Crop.Rect.Dx(), result.Crop.Rect.Dy()), nil
+		}},
+		{msg("selftest.compliance"), func() (string, error) {
+			return checkSelfTestCompliance(result.Photo, config)
+		}},
+		{msg("selftest.layout"), func() (string, error) {
+			return checkSelfTestLayout(result.Sheets[0], result.Photo)
+		}},
+		{msg("selftest.encode"), func() (string, error) {
+			return checkSelfTestRoundTrip(result.Sheets[0], filepath.Join(tempDir, "selftest_sheet.jpg"), config.Save)
+		}},
+	}
+
+	passed := true
+	for _, stage := range stages {
+		if !passed {
+			fmt.Print(msg("selftest.skip", stage.name))
+			continue
+		}
+		measured, err := stage.run()
+		if err != nil {
+			fmt.Print(msg("selftest.fail", stage.name, err))
+			passed = false
+			continue
+		}
+		fmt.Print(msg("selftest.pass", stage.name, measured))
+	}
+	return passed
+}
+
+// checkSelfTestCompliance validates the finished photo like -validate-only does
+func checkSelfTestCompliance(photo image.Image, config Config) (string, error) {
+	compliance, err := validatePhoto(photo, config)
+	if err != nil {
+		return "", err
+	}
+	for _, check := range compliance.Checks {
+		if !check.Passed && !check.Skipped {
+			return "", fmt.Errorf("%s %s (allowed: %s)", check.Name, check.Measured, check.Allowed)
+		}
+	}
+	return msg("selftest.compliant", len(compliance.Checks), config.Spec.Name), nil
+}
+
+// checkSelfTestLayout checks that the sheet has the format's number of photo slots
+// and that every slot shows the photo
+func checkSelfTestLayout(sheet Sheet, photo image.Image) (string, error) {
+	slots := gridSlots(calculateGridLayout(sheet.Format), sheet.Format)
+	if len(slots) != sheet.Format.PhotosPerSheet {
+		return "", fmt.Errorf("%d photo slots, expected %d", len(slots), sheet.Format.PhotosPerSheet)
+	}
+	want := averageColor(photo, photo.Bounds())
+	for i, slot := range slots {
+		if difference := maxChannelDifference(averageColor(sheet.Image, slot), want); difference > SELF_TEST_MAX_SLOT_DIFFERENCE {
+			return "", fmt.Errorf("slot %d doesn't show the photo (mean color off by %.0f)", i+1, difference)
+		}
+	}
+	return msg("selftest.photos", len(slots), sheet.Format.Name), nil
+}
+
+// checkSelfTestRoundTrip saves the sheet as JPEG to path, decodes it again and
+// compares size, colors and the stored print resolution
+func checkSelfTestRoundTrip(sheet Sheet, path string, opts SaveOptions) (string, error) {
+	written, _, err := saveImage(sheet.Image, path, opts)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	decoded, _, err := decodeImage(data)
+	if err != nil {
+		return "", fmt.Errorf("the saved sheet can't be decoded: %v", err)
+	}
+	if decoded.Bounds().Size() != sheet.Image.Bounds().Size() {
+		return "", fmt.Errorf("decoded %v pixels, saved %v", decoded.Bounds().Size(), sheet.Image.Bounds().Size())
+	}
+	if difference := maxChannelDifference(averageColor(decoded, decoded.Bounds()), averageColor(sheet.Image, sheet.Image.Bounds())); difference > SELF_TEST_MAX_ROUND_TRIP_DIFFERENCE {
+		return "", fmt.Errorf("decoded colors are off by %.1f", difference)
+	}
+	if dpi, _ := readInputResolution(data); int(math.Round(dpi)) != sheet.Format.DPI {
+		return "", fmt.Errorf("stored resolution %.0f DPI, expected %d", dpi, sheet.Format.DPI)
+	}
+	return msg("selftest.round_trip", formatFileSize(written), sheet.Format.DPI), nil
+}
+
+// maxChannelDifference returns the largest difference between two mean colors
+func maxChannelDifference(a, b [3]float64) float64 {
+	difference := 0.0
+	for c := range a {
+		difference = math.Max(difference, math.Abs(a[c]-b[c]))
+	}
+	return difference
+}
@@ -0,0 +1,54 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+// outputLocation returns the directory and base name of the files written for an
+// input: next to it, or in outputDir (-outdir) when set
+func outputLocation(inputPath, outputDir string) (dir, name string) {
+	dir, name = splitInputPath(inputPath)
+	if outputDir != "" {
+		dir = outputDir
+	}
+	return dir, name
+}
+
+// validateOutputDir creates the -outdir directory when it doesn't exist yet
+func validateOutputDir(dir string) error {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return fmt.Errorf("-outdir %s is a file, not a directory", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+	return nil
+}
+
+// buildSeparatePhotoPath names the nth (from 1) separate copy of the passport photo
+func buildSeparatePhotoPath(inputPath, outputDir string, n int) string {
+	dir, name := outputLocation(inputPath, outputDir)
+	return filepath.Join(dir, fmt.Sprintf("%s_passport_photo_%d.jpg", name, n))
+}
+
+// saveSeparatePhotos writes the passport photo as count numbered files for print
+// services that want individual photos instead of a sheet. The photo is encoded
+// once with the single photo's settings and written count times.
+func saveSeparatePhotos(photo image.Image, config Config, count int) ([]string, error) {
+	data, quality, err := encodeWithinBudget(photo, config.PhotoSave)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding separate photos: %v", err)
+	}
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = availableOutputPath(buildSeparatePhotoPath(config.InputPath, config.OutputDir, i+1))
+		if err := writeOutput(paths[i], data); err != nil {
+			return nil, fmt.Errorf("error saving separate photo: %v", err)
+		}
+	}
+	fmt.Print(msg("summary.separate_saved", count, paths[0], filepath.Base(paths[count-1]), describeOutputFile(len(data), quality, config.PhotoSave)))
+	return paths, nil
+}
@@ -0,0 +1,582 @@
+package passport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Address the server subcommand listens on unless -listen is given
+	DEFAULT_SERVER_ADDRESS = ":8080"
+
+	// Default -request-timeout: a request that isn't answered within this time,
+	// including the wait for a free worker, fails with the "timeout" code
+	DEFAULT_REQUEST_TIMEOUT = 60 * time.Second
+
+	// Largest accepted upload; larger request bodies fail with "too_large"
+	SERVER_MAX_UPLOAD_MB = 32
+
+	// Largest image decoded unless -max-megapixels is given; larger ones fail with
+	// "too_large" before decoding, since a few compressed megabytes can declare far
+	// more pixels than fit in memory
+	DEFAULT_SERVER_MAX_MEGAPIXELS = 100
+
+	// Seconds it may take to finish the running requests after SIGTERM
+	SERVER_SHUTDOWN_TIMEOUT = 30 * time.Second
+)
+
+// Error codes of failed API requests, in the JSON error body and the
+// passport_failures_total metric
+const (
+	API_ERROR_INVALID_REQUEST   = "invalid_request"
+	API_ERROR_TOO_LARGE         = "too_large"
+	API_ERROR_INVALID_OPTION    = "invalid_option"
+	API_ERROR_UNSUPPORTED_IMAGE = "unsupported_image"
+	API_ERROR_IMAGE_TOO_SMALL   = "image_too_small"
+	API_ERROR_PROCESSING_FAILED = "processing_failed"
+	API_ERROR_ENCODING_FAILED   = "encoding_failed"
+	API_ERROR_BUSY              = "busy"
+	API_ERROR_TIMEOUT           = "timeout"
+)
+
+// Pipeline stages whose latency /metrics reports: waiting for a free worker,
+// decoding the upload, Generate, and encoding the JPEGs
+var serverStages = []string{"queue", "decode", "generate", "encode"}
+
+// Upper bounds in seconds of the latency histogram buckets
+var serverLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// ServerOptions configures the server subcommand
+type ServerOptions struct {
+	Address   string           // Listen address, e.g. ":8080"
+	Jobs      int              // Requests processed at the same time; more wait for a free worker
+	Timeout   time.Duration    // Per-request limit, see DEFAULT_REQUEST_TIMEOUT
+	Detection DetectionOptions // Face detection settings of every request
+
+	// Uploads with more pixels are refused before decoding (0 = DEFAULT_SERVER_MAX_MEGAPIXELS)
+	MaxMegapixels float64
+}
+
+// apiServer handles the REST API. Every request runs the library API (Generate)
+// with the shared face detector; slots bounds how many decode and process at once.
+type apiServer struct {
+	detector      *FaceDetector // nil when the face cascade couldn't be loaded
+	slots         chan struct{}
+	timeout       time.Duration
+	maxMegapixels float64
+	metrics       *serverMetrics
+}
+
+// apiResponse is the JSON body of a successful POST /v1/passport-photo. Images
+// are base64-encoded JPEGs.
+type apiResponse struct {
+	Photo  string     `json:"photo"`
+	Sheets []apiSheet `json:"sheets"`
+	Report apiReport  `json:"report"`
+}
+
+// apiSheet is one print sheet of an apiResponse
+type apiSheet struct {
+	Format string `json:"format"`
+	Image  string `json:"image"`
+}
+
+// apiReport describes the crop and checks of an API result, like the -crop-report
+// of the command line tool but relative to the uploaded image
+type apiReport struct {
+	Version          string             `json:"tool_version"`
+	FaceFound        bool               `json:"face_found"`
+	DetectionPass    string             `json:"detection_pass,omitempty"`
+	Strategy         string             `json:"strategy"`
+	Attempts         []StrategyAttempt  `json:"attempts"`
+	Crop             cropRect           `json:"crop"`
+	Rotation         int                `json:"rotation"`
+	CropScale        float64            `json:"crop_scale,omitempty"`
+	BackgroundPassed bool               `json:"background_passed"`
+	HeadCovering     *HeadCoveringCheck `json:"head_covering,omitempty"`
+	Occlusion        *OcclusionCheck    `json:"eye_occlusion,omitempty"`
+	Shoulders        *ShoulderCheck     `json:"shoulders,omitempty"`
+	Lighting         *LightingCheck     `json:"lighting,omitempty"`
+	SafeArea         *SafeAreaCheck     `json:"safe_area,omitempty"`
+}
+
+// apiError is the JSON body of a failed request
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// runServer serves the API on options.Address until SIGINT or SIGTERM, then
+// lets the running requests finish
+func runServer(options ServerOptions) error {
+	if options.Jobs < 1 {
+		return fmt.Errorf("invalid jobs %d (must be at least 1)", options.Jobs)
+	}
+	if options.Timeout <= 0 {
+		return fmt.Errorf("invalid request timeout %v (must be positive)", options.Timeout)
+	}
+	if err := validateDetectionOptions(options.Detection); err != nil {
+		return err
+	}
+	if err := validateMaxMegapixels(options.MaxMegapixels); err != nil {
+		return err
+	}
+
+	server := newAPIServer(options)
+	if server.detector == nil {
+		logWarn("⚠️  Face cascade not loaded - every request uses the fallback crop strategies")
+	}
+	httpServer := &http.Server{Addr: options.Address, Handler: server.routes()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	failed := make(chan error, 1)
+	go func() {
+		failed <- httpServer.ListenAndServe()
+	}()
+	logInfo("🌐 Serving the API on %s (%d at a time, %v and %g MP per request) - stop with Ctrl+C",
+		options.Address, options.Jobs, options.Timeout, server.maxMegapixels)
+
+	select {
+	case err := <-failed:
+		return fmt.Errorf("error starting server: %v", err)
+	case <-ctx.Done():
+	}
+	logInfo("🛑 Shutting down, waiting for running requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SERVER_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// newAPIServer loads the face cascade once for every request
+func newAPIServer(options ServerOptions) *apiServer {
+	server := &apiServer{
+		slots:         make(chan struct{}, options.Jobs),
+		timeout:       options.Timeout,
+		maxMegapixels: options.MaxMegapixels,
+		metrics:       newServerMetrics(),
+	}
+	if server.maxMegapixels <= 0 {
+		server.maxMegapixels = DEFAULT_SERVER_MAX_MEGAPIXELS
+	}
+	if detector, err := NewFaceDetector(FACE_CASCADE_PATH, options.Detection); err == nil {
+		server.detector = detector
+	}
+	return server
+}
+
+// routes returns the handler of every endpoint
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/passport-photo", s.handlePassportPhoto)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return mux
+}
+
+// handleHealth answers liveness and readiness probes
+func (s *apiServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "ok",
+		"version":        toolVersion(),
+		"face_detection": s.detector != nil,
+	})
+}
+
+// handleMetrics writes the counters and histograms in the Prometheus text format
+func (s *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w)
+}
+
+// handlePassportPhoto processes one multipart upload: the image in the "image"
+// field, options in the other fields (see apiOptions)
+func (s *apiServer) handlePassportPhoto(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Code: API_ERROR_INVALID_REQUEST, Message: "use POST with a multipart/form-data body"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, SERVER_MAX_UPLOAD_MB<<20)
+	if err := r.ParseMultipartForm(SERVER_MAX_UPLOAD_MB << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.fail(w, http.StatusRequestEntityTooLarge, API_ERROR_TOO_LARGE, fmt.Errorf("upload larger than %dMB", SERVER_MAX_UPLOAD_MB))
+		} else {
+			s.fail(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, fmt.Errorf("error reading multipart form: %v", err))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, fmt.Errorf("missing image field: %v", err))
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, fmt.Errorf("error reading image: %v", err))
+		return
+	}
+	opts, err := apiOptions(r.MultipartForm.Value)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, API_ERROR_INVALID_OPTION, err)
+		return
+	}
+	if s.detector != nil {
+		opts = append(opts, WithFaceDetector(s.detector))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	// Wait for a free worker; the slot is held until processing ends, so memory
+	// stays bounded by -jobs. A timed out request stops at the next stage.
+	queued := time.Now()
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		s.fail(w, http.StatusServiceUnavailable, API_ERROR_BUSY, fmt.Errorf("no free worker within %v", s.timeout))
+		return
+	}
+	s.metrics.observe("queue", time.Since(queued))
+
+	type outcome struct {
+		response *apiResponse
+		status   int
+		code     string
+		err      error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() { <-s.slots }()
+		response, status, code, err := s.process(ctx, data, opts)
+		done <- outcome{response, status, code, err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			s.fail(w, result.status, result.code, result.err)
+			return
+		}
+		s.metrics.succeeded()
+		writeJSON(w, http.StatusOK, result.response)
+	case <-ctx.Done():
+		s.fail(w, http.StatusGatewayTimeout, API_ERROR_TIMEOUT, fmt.Errorf("not finished within %v", s.timeout))
+	}
+}
+
+// process decodes, generates and encodes one upload, giving up between the stages
+// once ctx is done. On failure it returns the HTTP status and error code to answer with.
+func (s *apiServer) process(ctx context.Context, data []byte, opts []Option) (*apiResponse, int, string, error) {
+	start := time.Now()
+	// The header gives the size without decoding; MaxBytesReader only bounds the
+	// compressed upload, not the memory its pixels take
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, API_ERROR_UNSUPPORTED_IMAGE, fmt.Errorf("error decoding image: %v", err)
+	}
+	if megapixels := float64(header.Width) * float64(header.Height) / 1e6; megapixels > s.maxMegapixels {
+		return nil, http.StatusRequestEntityTooLarge, API_ERROR_TOO_LARGE,
+			fmt.Errorf("image of %dx%d pixels (%.1f MP) exceeds the limit of %g MP", header.Width, header.Height, megapixels, s.maxMegapixels)
+	}
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, API_ERROR_UNSUPPORTED_IMAGE, fmt.Errorf("error decoding image: %v", err)
+	}
+	s.metrics.observe("decode", time.Since(start))
+	if err := ctx.Err(); err != nil {
+		return nil, http.StatusGatewayTimeout, API_ERROR_TIMEOUT, err
+	}
+
+	start = time.Now()
+	result, err := Generate(img, append(opts, WithContext(ctx))...)
+	if err != nil {
+		var sizeErr *ImageSizeError
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, http.StatusGatewayTimeout, API_ERROR_TIMEOUT, err
+		}
+		if errors.As(err, &sizeErr) {
+			return nil, http.StatusUnprocessableEntity, API_ERROR_IMAGE_TOO_SMALL, err
+		}
+		return nil, http.StatusUnprocessableEntity, API_ERROR_PROCESSING_FAILED, err
+	}
+	s.metrics.observe("generate", time.Since(start))
+	if err := ctx.Err(); err != nil {
+		return nil, http.StatusGatewayTimeout, API_ERROR_TIMEOUT, err
+	}
+
+	start = time.Now()
+	response, err := newAPIResponse(result)
+	if err != nil {
+		return nil, http.StatusInternalServerError, API_ERROR_ENCODING_FAILED, err
+	}
+	s.metrics.observe("encode", time.Since(start))
+	return response, http.StatusOK, "", nil
+}
+
+// fail answers with an apiError and counts the failure
+func (s *apiServer) fail(w http.ResponseWriter, status int, code string, err error) {
+	s.metrics.failed(code)
+	logWarn("⚠️  API request failed (%s): %v", code, err)
+	writeJSON(w, status, apiError{Code: code, Message: err.Error()})
+}
+
+// apiOptions turns the form fields of a request into Generate options. The fields
+// are named like the command line flags: spec, dpi, format (repeatable), count,
+// bleed, sharpen, strategy, pad, safe-margin, head-margin, and the switches flatten,
+// neutralize-background, auto-levels and mirror ("true" or "1").
+func apiOptions(values map[string][]string) ([]Option, error) {
+	var opts []Option
+	value := func(name string) string {
+		if len(values[name]) == 0 {
+			return ""
+		}
+		return strings.TrimSpace(values[name][0])
+	}
+	number := func(name string) (float64, bool, error) {
+		text := value(name)
+		if text == "" {
+			return 0, false, nil
+		}
+		parsed, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return 0, false, fmt.Errorf("invalid %s '%s' (must be a number)", name, text)
+		}
+		return parsed, true, nil
+	}
+
+	// The spec and DPI first, the sheet layouts depend on them
+	if spec := value("spec"); spec != "" {
+		opts = append(opts, WithSpec(spec))
+	}
+	if dpi, ok, err := number("dpi"); err != nil {
+		return nil, err
+	} else if ok {
+		opts = append(opts, WithDPI(int(dpi)))
+	}
+	for _, formats := range values["format"] {
+		for _, key := range strings.Split(formats, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				opts = append(opts, WithSheet(key))
+			}
+		}
+	}
+
+	for name, option := range map[string]func(float64) Option{
+		"count":       func(v float64) Option { return WithPhotoCount(int(v)) },
+		"bleed":       WithBleed,
+		"sharpen":     WithSharpening,
+		"safe-margin": WithSafeMargin,
+		"head-margin": WithHeadMargin,
+	} {
+		if v, ok, err := number(name); err != nil {
+			return nil, err
+		} else if ok {
+			opts = append(opts, option(v))
+		}
+	}
+	if strategy := value("strategy"); strategy != "" {
+		opts = append(opts, WithStrategy(strategy))
+	}
+	if pad := value("pad"); pad != "" {
+		opts = append(opts, WithPadding(pad))
+	}
+	for name, option := range map[string]func() Option{
+		"flatten":               WithFlattenBackground,
+		"neutralize-background": WithNeutralizeBackground,
+		"auto-levels":           WithAutoLevels,
+		"mirror":                WithMirror,
+	} {
+		if text := value(name); text != "" {
+			enabled, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s '%s' (must be true or false)", name, text)
+			}
+			if enabled {
+				opts = append(opts, option())
+			}
+		}
+	}
+
+	// Validate now, so a bad option is reported as such and not as a processing failure
+	check := generateOptions{config: defaultConfig()}
+	for _, opt := range opts {
+		if err := opt(&check); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// newAPIResponse encodes the photo and sheets of result as base64 JPEGs
+func newAPIResponse(result *Result) (*apiResponse, error) {
+	encode := func(img image.Image, dpi int) (string, error) {
+		data, err := encodeImage(img, SaveOptions{Metadata: METADATA_DPI, Quality: DEFAULT_JPEG_QUALITY, DPI: dpi})
+		if err != nil {
+			return "", fmt.Errorf("error encoding image: %v", err)
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	response := &apiResponse{Sheets: []apiSheet{}, Report: newAPIReport(result)}
+	dpi := DPI
+	if len(result.Sheets) > 0 {
+		dpi = result.Sheets[0].Format.DPI
+	}
+	var err error
+	if response.Photo, err = encode(result.Photo, dpi); err != nil {
+		return nil, err
+	}
+	for _, sheet := range result.Sheets {
+		encoded, err := encode(sheet.Image, sheet.Format.DPI)
+		if err != nil {
+			return nil, err
+		}
+		response.Sheets = append(response.Sheets, apiSheet{Format: sheet.Format.Key, Image: encoded})
+	}
+	return response, nil
+}
+
+// newAPIReport collects the crop and check results of a Generate result
+func newAPIReport(result *Result) apiReport {
+	report := apiReport{
+		Version:          toolVersion(),
+		FaceFound:        result.FaceFound,
+		DetectionPass:    result.Crop.DetectionPass,
+		Strategy:         result.Strategy,
+		Attempts:         result.Attempts,
+		Crop:             newCropRect(result.Crop.Rect),
+		Rotation:         result.Crop.Rotation,
+		CropScale:        result.CropScale,
+		BackgroundPassed: result.Background.Passed,
+	}
+	if result.Crop.HeadCovering.Checked {
+		report.HeadCovering = &result.Crop.HeadCovering
+	}
+	if result.Crop.Occlusion.Checked {
+		report.Occlusion = &result.Crop.Occlusion
+	}
+	if result.Crop.Shoulders.Checked {
+		report.Shoulders = &result.Crop.Shoulders
+	}
+	if result.Crop.Lighting.Checked {
+		report.Lighting = &result.Crop.Lighting
+	}
+	if result.SafeArea.MarginMM > 0 {
+		report.SafeArea = &result.SafeArea
+	}
+	return report
+}
+
+// writeJSON answers with value as JSON
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logDebug("Error writing response: %v", err)
+	}
+}
+
+// serverMetrics counts processed images and failures and keeps a latency
+// histogram per stage
+type serverMetrics struct {
+	mu        sync.Mutex
+	processed int
+	failures  map[string]int
+	stages    map[string]*latencyHistogram
+}
+
+// latencyHistogram counts observations per bucket of serverLatencyBuckets; the
+// last count is the +Inf bucket
+type latencyHistogram struct {
+	counts []int
+	sum    float64
+	total  int
+}
+
+func newServerMetrics() *serverMetrics {
+	metrics := &serverMetrics{failures: make(map[string]int), stages: make(map[string]*latencyHistogram)}
+	for _, stage := range serverStages {
+		metrics.stages[stage] = &latencyHistogram{counts: make([]int, len(serverLatencyBuckets)+1)}
+	}
+	return metrics
+}
+
+func (m *serverMetrics) succeeded() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processed++
+}
+
+func (m *serverMetrics) failed(code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[code]++
+}
+
+func (m *serverMetrics) observe(stage string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	histogram := m.stages[stage]
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(serverLatencyBuckets, seconds)
+	histogram.counts[bucket]++
+	histogram.sum += seconds
+	histogram.total++
+}
+
+// write prints the metrics in the Prometheus text exposition format; histogram
+// buckets are cumulative
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP passport_images_processed_total Images processed successfully by the API.")
+	fmt.Fprintln(w, "# TYPE passport_images_processed_total counter")
+	fmt.Fprintf(w, "passport_images_processed_total %d\n", m.processed)
+
+	fmt.Fprintln(w, "# HELP passport_failures_total Failed API requests by error code.")
+	fmt.Fprintln(w, "# TYPE passport_failures_total counter")
+	codes := make([]string, 0, len(m.failures))
+	for code := range m.failures {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "passport_failures_total{code=%q} %d\n", code, m.failures[code])
+	}
+
+	fmt.Fprintln(w, "# HELP passport_stage_duration_seconds Latency of the processing stages of API requests.")
+	fmt.Fprintln(w, "# TYPE passport_stage_duration_seconds histogram")
+	for _, stage := range serverStages {
+		histogram := m.stages[stage]
+		cumulative := 0
+		for i, bound := range serverLatencyBuckets {
+			cumulative += histogram.counts[i]
+			fmt.Fprintf(w, "passport_stage_duration_seconds_bucket{stage=%q,le=\"%g\"} %d\n", stage, bound, cumulative)
+		}
+		fmt.Fprintf(w, "passport_stage_duration_seconds_bucket{stage=%q,le=\"+Inf\"} %d\n", stage, histogram.total)
+		fmt.Fprintf(w, "passport_stage_duration_seconds_sum{stage=%q} %g\n", stage, histogram.sum)
+		fmt.Fprintf(w, "passport_stage_duration_seconds_count{stage=%q} %d\n", stage, histogram.total)
+	}
+}
@@ -0,0 +1,256 @@
+package passport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the API of a server with one worker
+func newTestServer(t *testing.T, timeout time.Duration, maxMegapixels float64) (*apiServer, *httptest.Server) {
+	t.Helper()
+	server := newAPIServer(ServerOptions{Jobs: 1, Timeout: timeout, Detection: DefaultDetectionOptions(), MaxMegapixels: maxMegapixels})
+	httpServer := httptest.NewServer(server.routes())
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+// postImage uploads image data with the given form fields to /v1/passport-photo and
+// returns the status and the body
+func postImage(t *testing.T, url string, data []byte, fields map[string]string) (int, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("image", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	response, err := http.Post(url+"/v1/passport-photo", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	answer, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, answer
+}
+
+// errorCode returns the code of an apiError body
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		t.Fatalf("error body %q: %v", body, err)
+	}
+	return apiErr.Code
+}
+
+// pngOfSize encodes a gray image of the given size, which compresses to almost nothing
+func pngOfSize(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServerPassportPhoto(t *testing.T) {
+	requireCascade(t)
+	data, err := os.ReadFile(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, httpServer := newTestServer(t, time.Minute, 0)
+
+	status, body := postImage(t, httpServer.URL, data, map[string]string{"format": SHEET_10X15})
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Report.FaceFound || response.Report.Strategy != STRATEGY_FACE {
+		t.Errorf("report %+v, want a face crop", response.Report)
+	}
+
+	spec, _ := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	photo := decodeBase64JPEG(t, response.Photo)
+	if size := photo.Bounds().Size(); size != image.Pt(spec.WidthPX, spec.HeightPX) {
+		t.Errorf("photo of %v pixels, want %dx%d", size, spec.WidthPX, spec.HeightPX)
+	}
+	if len(response.Sheets) != 1 || response.Sheets[0].Format != SHEET_10X15+"cm" {
+		t.Fatalf("sheets %v, want one 10x15cm sheet", response.Sheets)
+	}
+	format, _ := lookupPrintFormat(SHEET_10X15, spec)
+	if size := decodeBase64JPEG(t, response.Sheets[0].Image).Bounds().Size(); size != format.SheetSize() {
+		t.Errorf("sheet of %v pixels, want %v", size, format.SheetSize())
+	}
+}
+
+func decodeBase64JPEG(t *testing.T, encoded string) image.Image {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestServerRejectsBadUploads(t *testing.T) {
+	_, httpServer := newTestServer(t, time.Minute, 1)
+	tests := []struct {
+		name       string
+		data       []byte
+		fields     map[string]string
+		wantStatus int
+		wantCode   string
+	}{
+		{"more pixels than -max-megapixels", pngOfSize(t, 2000, 1000), nil, http.StatusRequestEntityTooLarge, API_ERROR_TOO_LARGE},
+		{"not an image", []byte("not an image"), nil, http.StatusUnsupportedMediaType, API_ERROR_UNSUPPORTED_IMAGE},
+		{"unknown spec", pngOfSize(t, 10, 10), map[string]string{"spec": "atlantis"}, http.StatusBadRequest, API_ERROR_INVALID_OPTION},
+		{"non-numeric dpi", pngOfSize(t, 10, 10), map[string]string{"dpi": "high"}, http.StatusBadRequest, API_ERROR_INVALID_OPTION},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postImage(t, httpServer.URL, tt.data, tt.fields)
+			if status != tt.wantStatus || errorCode(t, body) != tt.wantCode {
+				t.Errorf("status %d, body %s; want %d with code %s", status, body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServerRejectsGet(t *testing.T) {
+	_, httpServer := newTestServer(t, time.Minute, 0)
+	response, err := http.Get(httpServer.URL + "/v1/passport-photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed || response.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("status %d, Allow %q; want 405 with Allow POST", response.StatusCode, response.Header.Get("Allow"))
+	}
+}
+
+// Every worker is taken for longer than the timeout: the request gives up waiting
+func TestServerBusy(t *testing.T) {
+	server, httpServer := newTestServer(t, 50*time.Millisecond, 0)
+	server.slots <- struct{}{}
+	defer func() { <-server.slots }()
+
+	status, body := postImage(t, httpServer.URL, pngOfSize(t, 10, 10), nil)
+	if status != http.StatusServiceUnavailable || errorCode(t, body) != API_ERROR_BUSY {
+		t.Errorf("status %d, body %s; want 503 busy", status, body)
+	}
+}
+
+// A worker was free but processing the photo takes longer than the timeout. The
+// abandoned request stops at its next stage, so the worker is free again long
+// before the photo would have been done.
+func TestServerTimeout(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, syntheticPhoto(1000, 1250), nil); err != nil {
+		t.Fatal(err)
+	}
+	server, httpServer := newTestServer(t, 20*time.Millisecond, 0)
+	var opts []Option
+	if server.detector != nil {
+		opts = append(opts, WithFaceDetector(server.detector))
+	}
+	start := time.Now()
+	if _, _, _, err := server.process(context.Background(), encoded.Bytes(), opts); err != nil {
+		t.Fatal(err)
+	}
+	full := time.Since(start)
+
+	status, body := postImage(t, httpServer.URL, encoded.Bytes(), nil)
+	if status != http.StatusGatewayTimeout || errorCode(t, body) != API_ERROR_TIMEOUT {
+		t.Errorf("status %d, body %s; want 504 timeout", status, body)
+	}
+	select {
+	case server.slots <- struct{}{}:
+		<-server.slots
+	case <-time.After(full / 2):
+		t.Errorf("worker still busy %v after the timeout; the whole photo takes %v", full/2, full)
+	}
+}
+
+func TestServerHealthz(t *testing.T) {
+	server, httpServer := newTestServer(t, time.Minute, 0)
+	response, err := http.Get(httpServer.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var health struct {
+		Status        string `json:"status"`
+		Version       string `json:"version"`
+		FaceDetection bool   `json:"face_detection"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || health.Status != "ok" || health.Version == "" {
+		t.Errorf("status %d, body %+v; want 200 ok with a version", response.StatusCode, health)
+	}
+	if health.FaceDetection != (server.detector != nil) {
+		t.Errorf("face_detection %v, but the detector is loaded: %v", health.FaceDetection, server.detector != nil)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	_, httpServer := newTestServer(t, time.Minute, 0)
+	for i := 0; i < 2; i++ {
+		postImage(t, httpServer.URL, []byte("not an image"), nil)
+	}
+
+	response, err := http.Get(httpServer.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := string(body)
+	for _, want := range []string{
+		"passport_images_processed_total 0\n",
+		`passport_failures_total{code="unsupported_image"} 2` + "\n",
+		`passport_stage_duration_seconds_bucket{stage="queue",le="+Inf"} 2` + "\n",
+		`passport_stage_duration_seconds_count{stage="generate"} 0` + "\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics lack %q:\n%s", want, metrics)
+		}
+	}
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type %q, want the Prometheus text format", response.Header.Get("Content-Type"))
+	}
+}
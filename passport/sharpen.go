@@ -0,0 +1,128 @@
+package passport
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+const (
+	// Default unsharp mask strength (fraction of the detail added back)
+	DEFAULT_SHARPEN_AMOUNT = 0.6
+
+	// Default Gaussian blur radius (sigma in pixels)
+	DEFAULT_SHARPEN_RADIUS = 1.0
+
+	// Maximum change per channel (0-255); limits halos on high-contrast
+	// edges such as glasses frames
+	SHARPEN_MAX_DELTA = 24.0
+)
+
+// SharpenOptions configures the optional unsharp mask applied after downscaling
+type SharpenOptions struct {
+	Enabled bool
+	Amount  float64
+	Radius  float64
+}
+
+// unsharpMask sharpens an image by adding back the difference between the image
+// and a Gaussian-blurred copy. The per-channel change is clamped to avoid halos.
+func unsharpMask(img image.Image, amount, radius float64) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	blurred := gaussianBlur(src, radius)
+	dst := image.NewRGBA(src.Bounds())
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			original := float64(src.Pix[i+c])
+			delta := (original - float64(blurred.Pix[i+c])) * amount
+			delta = math.Max(-SHARPEN_MAX_DELTA, math.Min(SHARPEN_MAX_DELTA, delta))
+			dst.Pix[i+c] = uint8(math.Max(0, math.Min(255, math.Round(original+delta))))
+		}
+		dst.Pix[i+3] = src.Pix[i+3]
+	}
+
+	logInfo("✨ Sharpened (amount %.2f, radius %.1f)", amount, radius)
+	return dst
+}
+
+// gaussianBlur applies a separable Gaussian blur with the given sigma
+func gaussianBlur(src *image.RGBA, sigma float64) *image.RGBA {
+	kernel := gaussianKernel(sigma)
+	half := len(kernel) / 2
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+
+	// Horizontal pass
+	tmp := image.NewRGBA(src.Bounds())
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for k, weight := range kernel {
+				sx := clampInt(x+k-half, 0, width-1)
+				offset := src.PixOffset(sx, y)
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(src.Pix[offset+c]) * weight
+				}
+			}
+			offset := tmp.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				tmp.Pix[offset+c] = uint8(math.Round(sum[c]))
+			}
+		}
+	}
+
+	// Vertical pass
+	dst := image.NewRGBA(src.Bounds())
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for k, weight := range kernel {
+				sy := clampInt(y+k-half, 0, height-1)
+				offset := tmp.PixOffset(x, sy)
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(tmp.Pix[offset+c]) * weight
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(math.Round(sum[c]))
+			}
+		}
+	}
+
+	return dst
+}
+
+// gaussianKernel returns a normalized 1D Gaussian kernel covering ±3 sigma
+func gaussianKernel(sigma float64) []float64 {
+	half := int(math.Ceil(sigma * 3))
+	if half < 1 {
+		half = 1
+	}
+	kernel := make([]float64, 2*half+1)
+	sum := 0.0
+	for i := range kernel {
+		x := float64(i - half)
+		kernel[i] = math.Exp(-x * x / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// clampInt limits v to the range [lo, hi]
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
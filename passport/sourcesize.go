@@ -0,0 +1,100 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+)
+
+const (
+	// The largest spec-shaped crop of the input must have at least this many times
+	// the photo's pixel width; below it every photo made from it is upscaled
+	SOURCE_MIN_RESOLUTION = 1.0
+
+	// Below this the face crop, a part of the input, will most likely be upscaled
+	// and look soft, and a warning is given
+	SOURCE_WARN_RESOLUTION = 2.0
+
+	// Default -min-crop-scale: crops with fewer pixels per photo pixel are refused,
+	// e.g. a face taking up a few percent of a group photo
+	DEFAULT_MIN_CROP_SCALE = 0.6
+)
+
+// ImageSizeError is returned when an input image, or a crop computed from it, has
+// too few pixels to make the photo from. The pipeline stops with it instead of
+// cropping or resizing a degenerate area.
+type ImageSizeError struct {
+	What          string // "image", or the crop that came out degenerate, e.g. "face crop"
+	Width, Height int
+	Problem       string // What is wrong, e.g. "is too small to crop"
+}
+
+func (e *ImageSizeError) Error() string {
+	return fmt.Sprintf("%s of %dx%d pixels %s", e.What, e.Width, e.Height, e.Problem)
+}
+
+// checkSourceResolution compares the largest spec-shaped crop of img with the
+// photo's pixel size: fewer pixels than the photo is an error, fewer than
+// SOURCE_WARN_RESOLUTION times a warning when the photo is cropped from a part of img
+func checkSourceResolution(img image.Image, spec PhotoSpec, cropping bool) error {
+	if err := checkCroppable(img, spec); err != nil {
+		return err
+	}
+	bounds := img.Bounds()
+	cropWidth, cropHeight := largestCropSize(bounds.Dx(), bounds.Dy(), spec)
+	ratio := float64(cropWidth) / float64(spec.WidthPX)
+	if ratio < SOURCE_MIN_RESOLUTION {
+		return &ImageSizeError{
+			What:  "image",
+			Width: bounds.Dx(), Height: bounds.Dy(),
+			Problem: fmt.Sprintf("leaves at most a %dx%d crop, smaller than the %dx%d pixel photo at %d DPI - use a larger original or a lower -dpi",
+				cropWidth, cropHeight, spec.WidthPX, spec.HeightPX, spec.DPI),
+		}
+	}
+	if cropping && ratio < SOURCE_WARN_RESOLUTION {
+		logWarn("⚠️  Image of %dx%d pixels has only %.1fx the photo's %dx%d pixels - the face crop will be enlarged and may look soft",
+			bounds.Dx(), bounds.Dy(), ratio, spec.WidthPX, spec.HeightPX)
+	}
+	return nil
+}
+
+// validateMinCropScale checks a -min-crop-scale value
+func validateMinCropScale(scale float64) error {
+	if scale <= 0 || scale > 1 {
+		return fmt.Errorf("invalid minimum crop scale %g (must be above 0 and at most 1)", scale)
+	}
+	return nil
+}
+
+// checkCropScale returns the crop's pixels per photo pixel. Below 1 the photo is
+// upscaled from the crop and a warning gives the factor; below minScale the crop
+// is refused, since the result would be a blurry enlargement.
+func checkCropScale(crop image.Rectangle, spec PhotoSpec, faceFound bool, minScale float64) (float64, error) {
+	scale := float64(crop.Dx()) / float64(spec.WidthPX)
+	if scale >= 1 {
+		return scale, nil
+	}
+	what := "crop"
+	if faceFound {
+		what = "face"
+	}
+	if scale < minScale {
+		return scale, fmt.Errorf("%s too small: the crop would be %dx%dpx but %dx%d is required (%.2f crop pixels per photo pixel, at least %g allowed with -min-crop-scale) - use a closer photo, a larger original or a lower -dpi",
+			what, crop.Dx(), crop.Dy(), spec.WidthPX, spec.HeightPX, scale, minScale)
+	}
+	logWarn("⚠️  The %s crop of %dx%d pixels is enlarged %.2fx to the %dx%d photo (%.2f crop pixels per photo pixel) - it will look soft, a closer photo gives a sharper result",
+		what, crop.Dx(), crop.Dy(), 1/scale, spec.WidthPX, spec.HeightPX, scale)
+	return scale, nil
+}
+
+// checkCropRect guards a computed crop before pixels are copied: it must have a
+// positive size and, unless padding fills what lies outside, be inside the image
+func checkCropRect(what string, crop, bounds image.Rectangle, pad string) error {
+	if crop.Dx() <= 0 || crop.Dy() <= 0 {
+		return &ImageSizeError{What: what, Width: crop.Dx(), Height: crop.Dy(), Problem: "is empty"}
+	}
+	if pad == PAD_SNAP && !crop.In(bounds) {
+		return &ImageSizeError{What: what, Width: crop.Dx(), Height: crop.Dy(),
+			Problem: fmt.Sprintf("at (%d,%d) reaches outside the %dx%d image", crop.Min.X, crop.Min.Y, bounds.Dx(), bounds.Dy())}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package passport
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestCheckSourceResolution(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h := spec.WidthPX, spec.HeightPX
+	tests := []struct {
+		name          string
+		width, height int
+		wantErr       bool
+		wantWarning   bool
+	}{
+		{"thumbnail", 120, 160, true, false},
+		{"panorama", 10000, 500, true, false},
+		{"just below the photo", w - 1, h - 1, true, false},
+		{"the photo's size", w, h, false, true},
+		{"1.5x the photo", w * 3 / 2, h * 3 / 2, false, true},
+		{"2x the photo", w * 2, h * 2, false, false},
+		{"wide, 2x tall enough", w * 10, h * 2, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			log := captureDebugLog(t, func() {
+				err = checkSourceResolution(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), spec, true)
+			})
+			var sizeErr *ImageSizeError
+			if tt.wantErr != errors.As(err, &sizeErr) {
+				t.Fatalf("error %v, want an *ImageSizeError: %v", err, tt.wantErr)
+			}
+			if warned := strings.Contains(log, "may look soft"); warned != tt.wantWarning {
+				t.Errorf("warned %v, want %v:\n%s", warned, tt.wantWarning, log)
+			}
+		})
+	}
+
+	// Without cropping the whole image is scaled down to the photo, and 1.5x is plenty
+	log := captureDebugLog(t, func() {
+		if err := checkSourceResolution(image.NewRGBA(image.Rect(0, 0, w*3/2, h*3/2)), spec, false); err != nil {
+			t.Error(err)
+		}
+	})
+	if strings.Contains(log, "may look soft") {
+		t.Errorf("warned without cropping:\n%s", log)
+	}
+}
+
+func TestCheckCropRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 80)
+	tests := []struct {
+		name    string
+		crop    image.Rectangle
+		pad     string
+		wantErr bool
+	}{
+		{"inside", image.Rect(10, 10, 50, 60), PAD_SNAP, false},
+		{"whole image", bounds, PAD_SNAP, false},
+		{"empty", image.Rect(10, 10, 10, 60), PAD_SNAP, true},
+		{"inverted", image.Rectangle{image.Pt(50, 10), image.Pt(10, 60)}, PAD_WHITE, true},
+		{"past the edge", image.Rect(60, 10, 120, 60), PAD_SNAP, true},
+		{"past the edge, padded", image.Rect(60, 10, 120, 60), PAD_WHITE, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCropRect("face crop", tt.crop, bounds, tt.pad)
+			var sizeErr *ImageSizeError
+			if tt.wantErr != errors.As(err, &sizeErr) {
+				t.Errorf("error %v, want an *ImageSizeError: %v", err, tt.wantErr)
+			}
+			if err != nil && sizeErr.What != "face crop" {
+				t.Errorf("error names %q, want the face crop", sizeErr.What)
+			}
+		})
+	}
+}
+
+// Every input shape from a single pixel to a 20:1 strip, through each strategy that
+// needs no face: no panic, and either a photo of the spec's size cut from inside
+// the image or an error; inputs without room for the photo fail with *ImageSizeError
+func TestGenerateSweepsInputSizes(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sides := []int{1, 2, 17, 120, 160, spec.WidthPX, spec.HeightPX, 1000, 4000, 10000}
+	for _, strategy := range []string{STRATEGY_CENTER, STRATEGY_SALIENCY} {
+		for _, width := range sides {
+			for _, height := range sides {
+				if width*height > 10000*1000 {
+					continue // Large images only slow the sweep down
+				}
+				t.Run(fmt.Sprintf("%s %dx%d", strategy, width, height), func(t *testing.T) {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatalf("panic: %v", r)
+						}
+					}()
+					result, err := Generate(syntheticPhoto(width, height), WithStrategy(strategy))
+					cropWidth, _ := largestCropSize(width, height, spec)
+					if cropWidth < spec.WidthPX {
+						var sizeErr *ImageSizeError
+						if !errors.As(err, &sizeErr) {
+							t.Fatalf("error %v, want an *ImageSizeError", err)
+						}
+						return
+					}
+					if err != nil {
+						return
+					}
+					if size := result.Photo.Bounds().Size(); size != image.Pt(spec.WidthPX, spec.HeightPX) {
+						t.Errorf("photo of %v, want %dx%d", size, spec.WidthPX, spec.HeightPX)
+					}
+					if crop := result.Crop.Rect; crop.Empty() || !crop.In(image.Rect(0, 0, width, height)) {
+						t.Errorf("crop %v of a %dx%d input", crop, width, height)
+					}
+				})
+			}
+		}
+	}
+}
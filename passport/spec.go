@@ -0,0 +1,211 @@
+package passport
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// PhotoSpec describes the geometry and background requirements of one
+// passport or visa photo standard. The Austrian preset is built from the
+// configuration constants in passport.go so editing those still works as before.
+type PhotoSpec struct {
+	Key      string
+	Name     string
+	WidthMM  float64
+	HeightMM float64
+	WidthPX  int
+	HeightPX int
+	DPI      int // Print resolution of the pixel size, see WithDPI
+
+	// Face positioning as fractions of the photo height
+	HeadHeightRatio         float64
+	EyePositionFromTopRatio float64
+	HeadspaceRatio          float64
+	CrownAligned            bool // Place the crown at HeadspaceRatio instead of the eyes at the eye line, see WithHeadMargin
+
+	// Allowed head height (chin to crown) in the printed photo; 0 means no band
+	HeadHeightMinMM float64
+	HeadHeightMaxMM float64
+
+	// Background requirements checked after the crop
+	RequireWhiteBackground bool
+}
+
+const DEFAULT_SPEC_KEY = "austria"
+
+// Print resolutions accepted by -dpi
+const (
+	MIN_DPI = 72
+	MAX_DPI = 1200
+)
+
+// Photo sizes accepted by -photo-w-mm and -photo-h-mm, per side
+const (
+	MIN_PHOTO_SIZE_MM = 10
+	MAX_PHOTO_SIZE_MM = 150
+)
+
+// photoSpecs is the registry of selectable photo standards (see -spec)
+var photoSpecs = map[string]PhotoSpec{
+	"austria": {
+		Key:                     "austria",
+		Name:                    "Austrian/EU passport",
+		WidthMM:                 PHOTO_WIDTH_MM,
+		HeightMM:                PHOTO_HEIGHT_MM,
+		WidthPX:                 PHOTO_WIDTH_PX,
+		HeightPX:                PHOTO_HEIGHT_PX,
+		DPI:                     DPI,
+		HeadHeightRatio:         HEAD_HEIGHT_RATIO,
+		EyePositionFromTopRatio: EYE_POSITION_FROM_TOP_RATIO,
+		HeadspaceRatio:          HEADSPACE_RATIO,
+		HeadHeightMinMM:         HEAD_HEIGHT_MIN_MM,
+		HeadHeightMaxMM:         HEAD_HEIGHT_MAX_MM,
+	},
+	// US visa: 2x2in square, 600x600px, head 50-69% of height (1 to 1 3/8in),
+	// eyes 56-69% from the bottom, plain white background mandatory
+	"us-visa": {
+		Key:                     "us-visa",
+		Name:                    "US visa",
+		WidthMM:                 50.8,
+		HeightMM:                50.8,
+		WidthPX:                 600,
+		HeightPX:                600,
+		DPI:                     DPI,
+		HeadHeightRatio:         0.60,
+		EyePositionFromTopRatio: 0.38,
+		HeadspaceRatio:          0.08,
+		HeadHeightMinMM:         25.4,
+		HeadHeightMaxMM:         34.9,
+		RequireWhiteBackground:  true,
+	},
+	// Schengen visa: 35x45mm, head 32-36mm (70-80% of height), light plain background
+	"schengen-visa": {
+		Key:                     "schengen-visa",
+		Name:                    "Schengen visa",
+		WidthMM:                 35,
+		HeightMM:                45,
+		WidthPX:                 413,
+		HeightPX:                531,
+		DPI:                     DPI,
+		HeadHeightRatio:         0.75,
+		EyePositionFromTopRatio: 0.48,
+		HeadspaceRatio:          0.1,
+		HeadHeightMinMM:         32,
+		HeadHeightMaxMM:         36,
+		RequireWhiteBackground:  true,
+	},
+}
+
+// lookupPhotoSpec returns the registered spec for key (case-insensitive)
+func lookupPhotoSpec(key string) (PhotoSpec, error) {
+	spec, ok := photoSpecs[strings.ToLower(strings.TrimSpace(key))]
+	if !ok {
+		return PhotoSpec{}, fmt.Errorf("unknown photo spec '%s' (available: %s)", key, strings.Join(photoSpecKeys(), ", "))
+	}
+	return spec, nil
+}
+
+// photoSpecKeys returns the registered spec keys in sorted order
+func photoSpecKeys() []string {
+	keys := make([]string, 0, len(photoSpecs))
+	for key := range photoSpecs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The eye line given with -eye-line is the height of the eyes above the bottom
+// edge of the photo as a fraction of the photo height (0 = bottom edge, 1 = top
+// edge), matching how most embassy templates state it. Specs store the same
+// line measured from the top (EyePositionFromTopRatio = 1 - eye line).
+
+// EyeLine returns the spec's eye line measured from the bottom edge
+func (s PhotoSpec) EyeLine() float64 {
+	return 1 - s.EyePositionFromTopRatio
+}
+
+// WithEyeLine returns a copy of the spec with the eye line (from the bottom edge) replaced
+func (s PhotoSpec) WithEyeLine(eyeLine float64) PhotoSpec {
+	s.EyePositionFromTopRatio = 1 - eyeLine
+	s.CrownAligned = false
+	return s
+}
+
+// validateEyeLine checks an eye line fraction
+func validateEyeLine(eyeLine float64) error {
+	if eyeLine <= 0 || eyeLine >= 1 {
+		return fmt.Errorf("invalid eye line %g (must be between 0 and 1, measured from the bottom edge)", eyeLine)
+	}
+	return nil
+}
+
+// WithHeadMargin returns a copy of the spec that places the crown margin (fraction
+// of the photo height) below the top edge. The crop is positioned by the crown
+// rather than the eye line, so the eyes end up where the head size puts them.
+func (s PhotoSpec) WithHeadMargin(margin float64) PhotoSpec {
+	s.HeadspaceRatio = margin
+	s.CrownAligned = true
+	return s
+}
+
+// validateHeadMargin checks a head margin against the spec's head height: below
+// the head there must still be room for the chin
+func validateHeadMargin(margin float64, spec PhotoSpec) error {
+	if margin <= 0 || margin+spec.HeadHeightRatio >= 1 {
+		return fmt.Errorf("invalid head margin %g (must be above 0 and leave room for the chin: with the head taking %.0f%% of the photo height, below %g)",
+			margin, spec.HeadHeightRatio*100, math.Round((1-spec.HeadHeightRatio)*1000)/1000)
+	}
+	return nil
+}
+
+// WithDPI returns a copy of the spec at another print resolution. The pixel size is
+// recomputed from the millimeters, rounded down like the 300 DPI presets, e.g.
+// 35x45mm is 413x531 pixels at 300 DPI and 826x1062 at 600 DPI.
+func (s PhotoSpec) WithDPI(dpi int) PhotoSpec {
+	if dpi == s.DPI {
+		return s
+	}
+	s.DPI = dpi
+	return s.withPixelSize()
+}
+
+// WithSize returns a copy of the spec for another physical photo size, e.g. 40x50mm.
+// The pixel size is recomputed at the spec's DPI and the head height band scales with
+// the photo height (to 0.1mm), so the face keeps its proportions; the ratios stay as
+// they are.
+func (s PhotoSpec) WithSize(widthMM, heightMM float64) PhotoSpec {
+	if s.HeightMM > 0 {
+		scale := heightMM / s.HeightMM
+		s.HeadHeightMinMM = math.Round(s.HeadHeightMinMM*scale*10) / 10
+		s.HeadHeightMaxMM = math.Round(s.HeadHeightMaxMM*scale*10) / 10
+	}
+	s.WidthMM = widthMM
+	s.HeightMM = heightMM
+	return s.withPixelSize()
+}
+
+// withPixelSize recomputes the pixel size from the millimeters at the spec's DPI
+func (s PhotoSpec) withPixelSize() PhotoSpec {
+	s.WidthPX = int(s.WidthMM*float64(s.DPI)/25.4 + 1e-9)
+	s.HeightPX = int(s.HeightMM*float64(s.DPI)/25.4 + 1e-9)
+	return s
+}
+
+// validatePhotoSize checks a physical photo size
+func validatePhotoSize(widthMM, heightMM float64) error {
+	if widthMM < MIN_PHOTO_SIZE_MM || widthMM > MAX_PHOTO_SIZE_MM || heightMM < MIN_PHOTO_SIZE_MM || heightMM > MAX_PHOTO_SIZE_MM {
+		return fmt.Errorf("invalid photo size %gx%gmm (each side must be between %d and %dmm)", widthMM, heightMM, MIN_PHOTO_SIZE_MM, MAX_PHOTO_SIZE_MM)
+	}
+	return nil
+}
+
+// validateDPI checks a print resolution
+func validateDPI(dpi int) error {
+	if dpi < MIN_DPI || dpi > MAX_DPI {
+		return fmt.Errorf("invalid DPI %d (must be between %d and %d)", dpi, MIN_DPI, MAX_DPI)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package passport
+
+import (
+	"os"
+	"strings"
+)
+
+// stdinIsTerminal reports whether stdin is an interactive console. /dev/null, which
+// services and detached processes get as stdin, is a character device too and is
+// ruled out explicitly.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// missingOptionsMessage explains which options to pass when nobody can answer the prompts
+func missingOptionsMessage(missing []string) string {
+	return "No terminal attached to answer prompts (started by double-click, as a service, or with empty stdin). " +
+		"Please provide: " + strings.Join(missing, ", ")
+}
@@ -0,0 +1,169 @@
+package passport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingOptionsMessage(t *testing.T) {
+	message := missingOptionsMessage([]string{"the input image (path argument or -input)", "the print format (-format)"})
+	for _, want := range []string{"No terminal attached", "the input image (path argument or -input), the print format (-format)"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message %q lacks %q", message, want)
+		}
+	}
+}
+
+// Started without arguments, a terminal or piped answers (stdin is /dev/null), the
+// tool names the options it would have asked for and fails instead of prompting
+func TestNonInteractiveRunNamesMissingOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantMissing []string
+		notMissing  []string
+	}{
+		{"nothing given", nil, []string{"the input image", "the print format (-format)"}, nil},
+		{"format given", []string{"-format", SHEET_10X15}, []string{"the input image"}, []string{"-format"}},
+		{"strip layout needs no format", []string{"-layout", LAYOUT_STRIP}, []string{"the input image"}, []string{"-format"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCLI(t, nil, tt.args...)
+			if code == 0 {
+				t.Fatalf("exited with 0, want a failure; stdout:\n%s", stdout)
+			}
+			if !strings.Contains(stderr, "No terminal attached") {
+				t.Fatalf("stderr lacks the explanation:\n%s", stderr)
+			}
+			for _, want := range tt.wantMissing {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr doesn't name %q:\n%s", want, stderr)
+				}
+			}
+			for _, unwanted := range tt.notMissing {
+				if strings.Contains(stderr, unwanted) {
+					t.Errorf("stderr names %q although it was given:\n%s", unwanted, stderr)
+				}
+			}
+			for _, lang := range languages {
+				if prompt := messages[lang]["prompt.input_path"]; strings.Contains(stdout, prompt) {
+					t.Errorf("prompted %q although nobody can answer", prompt)
+				}
+			}
+		})
+	}
+}
+
+// Answers piped into stdin drive the prompts, one line each
+func TestPipedAnswersDriveThePrompts(t *testing.T) {
+	requireCascade(t)
+	dir := t.TempDir()
+	_, stderr, code := runCLI(t, []byte(sampleImagePath+"\n1\n"), "-no-open", "-outdir", dir)
+	if code != 0 {
+		t.Fatalf("exited with %d:\n%s", code, stderr)
+	}
+	sheet := filepath.Join(dir, "sample-image_passport_photos_10x15cm.jpg")
+	if _, err := os.Stat(sheet); err != nil {
+		t.Errorf("the sheet chosen with the piped answers wasn't written: %v", err)
+	}
+}
+
+// withStdin runs fn with os.Stdin replaced by file
+func withStdin(t *testing.T, file *os.File, fn func()) {
+	t.Helper()
+	saved := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = saved }()
+	fn()
+}
+
+// Pipes, /dev/null and files are not terminals, whatever they hold
+func TestStdinIsTerminal(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	writer.Close()
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	file, err := os.Open(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for name, stdin := range map[string]*os.File{"pipe": reader, "/dev/null": null, "file": file} {
+		withStdin(t, stdin, func() {
+			if stdinIsTerminal() {
+				t.Errorf("%s counts as a terminal", name)
+			}
+		})
+	}
+}
+
+// A pipe-backed prompter can answer while the pipe holds lines, and reports that
+// it can't once they are used up instead of answering with empty strings
+func TestTerminalPrompterOnPipe(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		answers []string
+	}{
+		{"answers piped", "photo.jpg\n1\n", []string{"photo.jpg", "1"}},
+		{"last line without newline", "photo.jpg", []string{"photo.jpg"}},
+		{"empty pipe", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, writer, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			writer.WriteString(tt.input)
+			writer.Close()
+
+			withStdin(t, reader, func() {
+				prompter := NewTerminalPrompter(os.Stdin)
+				for _, want := range tt.answers {
+					if !canPrompt(prompter) {
+						t.Fatalf("can't answer with %q still in the pipe", want)
+					}
+					if got, err := prompter.Ask(""); err != nil || got != want {
+						t.Fatalf("answer %q, %v; want %q", got, err, want)
+					}
+				}
+				if canPrompt(prompter) {
+					t.Error("can answer with the pipe drained")
+				}
+				if _, err := prompter.Ask(""); !errors.Is(err, ErrNoInput) {
+					t.Errorf("error %v past the last answer, want ErrNoInput", err)
+				}
+			})
+		})
+	}
+}
+
+// A forced manual crop in a scripted run without a terminal doesn't prompt into
+// the void: the strategy fails instead of taking defaults for unread answers
+func TestNonInteractiveManualStrategyFails(t *testing.T) {
+	dir := t.TempDir()
+	stdout, stderr, code := runCLI(t, nil, "-strategy", STRATEGY_MANUAL, "-outdir", dir, sampleImagePath, SHEET_10X15)
+	if code == 0 {
+		t.Fatalf("exited with 0, want a failure; stdout:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "crop position in %") {
+		t.Errorf("prompted for the crop position:\n%s", stdout)
+	}
+	if !strings.Contains(stderr+stdout, "'manual' failed") {
+		t.Errorf("output doesn't name the failed strategy:\n%s\n%s", stdout, stderr)
+	}
+}
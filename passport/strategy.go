@@ -0,0 +1,212 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Crop strategies accepted by -strategy. STRATEGY_AUTO tries the others in the
+// order of cropStrategies until one succeeds.
+const (
+	STRATEGY_AUTO     = "auto"
+	STRATEGY_FACE     = "face"
+	STRATEGY_SALIENCY = "saliency"
+	STRATEGY_CENTER   = "center"
+	STRATEGY_MANUAL   = "manual"
+)
+
+const (
+	// Face detection counts as failed when the aligned head misses the spec's head
+	// height band by more than this, e.g. a tiny face in a wide shot
+	STRATEGY_HEAD_SIZE_TOLERANCE_MM = 3.0
+
+	// Position of the center-weighted crop (0 = left/top, 1 = right/bottom); slightly
+	// high because portraits usually have the head in the upper part
+	CENTER_CROP_HORIZONTAL_POSITION = 0.5
+	CENTER_CROP_VERTICAL_POSITION   = 0.2
+
+	// The largest spec-shaped crop of the input must be at least this many pixels
+	// on its short side; a thin strip (e.g. a 3000x20 panorama) would otherwise be
+	// blown up from a crop a few pixels wide
+	MIN_CROP_SIDE_PX = 32
+
+	// Inputs whose long side exceeds the short side by more than this get guidance
+	// to cut out the person first when they can't be cropped
+	EXTREME_ASPECT_RATIO = 5.0
+)
+
+// cropStrategy produces the passport photo from the input image in one way
+type cropStrategy struct {
+	Name  string // -strategy value
+	Label string // Shown in the console summary
+	Run   func(img image.Image, config Config) (image.Image, CropGeometry, error)
+}
+
+// cropStrategies is the fallback chain, from the most to the least automatic
+var cropStrategies = []cropStrategy{
+	{STRATEGY_FACE, "face detection", cropWithDetector},
+	{STRATEGY_SALIENCY, "saliency crop", cropBySaliency},
+	{STRATEGY_CENTER, "center-weighted crop", cropCenterWeighted},
+	{STRATEGY_MANUAL, "manual crop", cropManually},
+}
+
+// StrategyAttempt records the outcome of one strategy of the chain
+type StrategyAttempt struct {
+	Strategy string `json:"strategy"`
+	Success  bool   `json:"success"`
+	Reason   string `json:"reason,omitempty"` // Why the strategy failed
+}
+
+// PassportCrop is the photo produced by the strategy chain
+type PassportCrop struct {
+	Photo    image.Image
+	Crop     CropGeometry
+	Strategy string // Name of the strategy that produced Photo
+	Attempts []StrategyAttempt
+}
+
+// validateStrategy checks a -strategy value
+func validateStrategy(name string) error {
+	if name == STRATEGY_AUTO {
+		return nil
+	}
+	names := []string{STRATEGY_AUTO}
+	for _, strategy := range cropStrategies {
+		if strategy.Name == name {
+			return nil
+		}
+		names = append(names, strategy.Name)
+	}
+	return fmt.Errorf("invalid crop strategy '%s' (available: %s)", name, strings.Join(names, ", "))
+}
+
+// createPassportPhoto runs the strategy chain, or only the strategy forced by
+// config.Strategy, and returns the photo of the first one that succeeds
+func createPassportPhoto(img image.Image, config Config) (*PassportCrop, error) {
+	// No strategy can do anything useful with a degenerate crop
+	if err := checkCroppable(img, config.Spec); err != nil {
+		return nil, err
+	}
+
+	result := &PassportCrop{}
+	for _, strategy := range cropStrategies {
+		if config.Strategy != "" && config.Strategy != STRATEGY_AUTO && config.Strategy != strategy.Name {
+			continue
+		}
+		if err := stopped(config); err != nil {
+			return nil, err
+		}
+
+		photo, crop, err := strategy.Run(img, config)
+		attempt := StrategyAttempt{Strategy: strategy.Name, Success: err == nil}
+		if err != nil {
+			attempt.Reason = err.Error()
+			result.Attempts = append(result.Attempts, attempt)
+			logWarn("⚠️  Strategy '%s' failed: %v", strategy.Label, err)
+			continue
+		}
+
+		result.Attempts = append(result.Attempts, attempt)
+		result.Photo, result.Crop, result.Strategy = photo, crop, strategy.Name
+		logInfo("✅ Cropped with %s", strategy.Label)
+		return result, nil
+	}
+
+	if config.Strategy != "" && config.Strategy != STRATEGY_AUTO {
+		return nil, fmt.Errorf("crop strategy '%s' failed", config.Strategy)
+	}
+	return nil, fmt.Errorf("every crop strategy failed")
+}
+
+// cropCenterWeighted cuts the largest spec-shaped area around the visual center of
+// mass of img, or from its upper middle (see config.CenterWeight)
+func cropCenterWeighted(img image.Image, config Config) (image.Image, CropGeometry, error) {
+	if err := checkCroppable(img, config.Spec); err != nil {
+		return nil, CropGeometry{}, err
+	}
+	horizontal, vertical := centerWeightedPosition(img, config.Spec, config.CenterWeight)
+	photo, rect, err := createPassportPhotoFallback(img, config.Spec, horizontal, vertical)
+	if err != nil {
+		return nil, CropGeometry{}, err
+	}
+	return photo, CropGeometry{Rect: rect.Sub(img.Bounds().Min)}, nil
+}
+
+// cropManually asks where to place the crop. Only the directions the crop can move
+// in are asked for: left/right for landscape photos, up/down for portrait ones.
+func cropManually(img image.Image, config Config) (image.Image, CropGeometry, error) {
+	if config.Prompt == nil {
+		return nil, CropGeometry{}, fmt.Errorf("needs an interactive session")
+	}
+	if err := checkCroppable(img, config.Spec); err != nil {
+		return nil, CropGeometry{}, err
+	}
+
+	bounds := img.Bounds()
+	cropWidth, cropHeight := largestCropSize(bounds.Dx(), bounds.Dy(), config.Spec)
+	horizontal := CENTER_CROP_HORIZONTAL_POSITION
+	if cropWidth < bounds.Dx() {
+		position, err := readCropPosition(config.Prompt, "prompt.crop_horizontal", horizontal)
+		if err != nil {
+			return nil, CropGeometry{}, err
+		}
+		horizontal = position
+	}
+	vertical := CENTER_CROP_VERTICAL_POSITION
+	if cropHeight < bounds.Dy() {
+		position, err := readCropPosition(config.Prompt, "prompt.crop_vertical", vertical)
+		if err != nil {
+			return nil, CropGeometry{}, err
+		}
+		vertical = position
+	}
+
+	photo, rect, err := createPassportPhotoFallback(img, config.Spec, horizontal, vertical)
+	if err != nil {
+		return nil, CropGeometry{}, err
+	}
+	return photo, CropGeometry{Rect: rect.Sub(bounds.Min)}, nil
+}
+
+// readCropPosition prompts with the message promptKey for a crop position in percent
+// until the answer is valid. The prompt shows the default, which Enter accepts.
+func readCropPosition(prompter Prompter, promptKey string, defaultPosition float64) (float64, error) {
+	for {
+		answer, err := prompter.Ask(msg(promptKey, formatDecimal(defaultPosition*100, -1)))
+		if err != nil {
+			return 0, err
+		}
+		if answer == "" {
+			return defaultPosition, nil
+		}
+		percent, err := strconv.ParseFloat(strings.Replace(strings.TrimSuffix(answer, "%"), ",", ".", 1), 64)
+		if err == nil && percent >= 0 && percent <= 100 {
+			return percent / 100, nil
+		}
+		fmt.Print(msg("prompt.percent_retry"))
+	}
+}
+
+// checkCroppable fails with an *ImageSizeError for images too small to hold a crop
+// with the spec's aspect ratio, e.g. very wide panoramas or very tall strips with
+// only a few pixels on the short side
+func checkCroppable(img image.Image, spec PhotoSpec) error {
+	bounds := img.Bounds()
+	tooSmall := &ImageSizeError{What: "image", Width: bounds.Dx(), Height: bounds.Dy(), Problem: "is too small to crop"}
+	if bounds.Empty() {
+		return tooSmall
+	}
+	cropWidth, cropHeight := largestCropSize(bounds.Dx(), bounds.Dy(), spec)
+	if min(cropWidth, cropHeight) >= MIN_CROP_SIDE_PX {
+		return nil
+	}
+
+	aspect := float64(max(bounds.Dx(), bounds.Dy())) / float64(min(bounds.Dx(), bounds.Dy()))
+	if aspect > EXTREME_ASPECT_RATIO {
+		tooSmall.Problem = fmt.Sprintf("has an extreme aspect ratio (%.0f:1) and leaves only a %dx%d crop - cut out the person first (the crop needs at least %d pixels on its short side)",
+			aspect, cropWidth, cropHeight, MIN_CROP_SIDE_PX)
+	}
+	return tooSmall
+}
@@ -0,0 +1,142 @@
+package passport
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Each strategy can be forced, and the result names it as the only attempt
+func TestForcedStrategyNamedInResult(t *testing.T) {
+	requireCascade(t)
+	source, err := loadImage(sampleImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{STRATEGY_FACE, STRATEGY_SALIENCY, STRATEGY_CENTER} {
+		t.Run(name, func(t *testing.T) {
+			result, err := Generate(source.Image, WithStrategy(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Strategy != name || result.FaceFound != (name == STRATEGY_FACE) {
+				t.Errorf("strategy %q, face found %v", result.Strategy, result.FaceFound)
+			}
+			if len(result.Attempts) != 1 || result.Attempts[0] != (StrategyAttempt{Strategy: name, Success: true}) {
+				t.Errorf("attempts %+v, want only the forced strategy", result.Attempts)
+			}
+		})
+	}
+}
+
+func TestForcedManualStrategy(t *testing.T) {
+	img := syntheticPhoto(800, 600)
+	if _, err := Generate(img, WithStrategy(STRATEGY_MANUAL)); err == nil || !strings.Contains(err.Error(), "'manual' failed") {
+		t.Errorf("manual crop without a prompter: error %v", err)
+	}
+
+	// A landscape photo only leaves the crop room to move sideways
+	prompter := &ScriptedPrompter{Answers: []string{"0"}}
+	result, err := Generate(img, WithStrategy(STRATEGY_MANUAL), WithPrompter(prompter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Strategy != STRATEGY_MANUAL || len(result.Attempts) != 1 {
+		t.Errorf("strategy %q, attempts %+v", result.Strategy, result.Attempts)
+	}
+	if len(prompter.Questions) != 1 || result.Crop.Rect.Min.X != 0 || result.Crop.Rect.Dy() != 600 {
+		t.Errorf("asked %q, crop %v; want one question and a full-height crop at the left edge", prompter.Questions, result.Crop.Rect)
+	}
+}
+
+// Without a face the chain moves on, and the report keeps why detection failed
+func TestAutoStrategyFallsBack(t *testing.T) {
+	requireCascade(t)
+	result, err := Generate(syntheticPhoto(600, 800))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Attempts) < 2 {
+		t.Fatalf("attempts %+v, want face detection to fail first", result.Attempts)
+	}
+	if face := result.Attempts[0]; face.Strategy != STRATEGY_FACE || face.Success || face.Reason == "" {
+		t.Errorf("first attempt %+v, want failed face detection with a reason", face)
+	}
+	last := result.Attempts[len(result.Attempts)-1]
+	if !last.Success || last.Strategy != result.Strategy || result.FaceFound {
+		t.Errorf("strategy %q, last attempt %+v", result.Strategy, last)
+	}
+}
+
+// The command line tool names the strategy in the summary and the crop report
+func TestStrategyInSummaryAndReport(t *testing.T) {
+	dir := t.TempDir()
+	stdout, stderr, code := runCLI(t, nil, "-strategy", STRATEGY_CENTER, "-crop-report", "-outdir", dir, sampleImagePath, SHEET_10X15)
+	if code != 0 {
+		t.Fatalf("exited with %d:\n%s", code, stderr)
+	}
+	if !strings.Contains(stdout, msg("summary.strategy", STRATEGY_CENTER)) {
+		t.Errorf("summary lacks the strategy:\n%s", stdout)
+	}
+
+	var report cropReport
+	if err := json.Unmarshal(mustReadFile(t, filepath.Join(dir, "sample-image_crop.json")), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Strategy != STRATEGY_CENTER || len(report.Attempts) != 1 || !report.Attempts[0].Success {
+		t.Errorf("report strategy %q, attempts %+v", report.Strategy, report.Attempts)
+	}
+}
+
+// Panoramas and tall strips: a 10:1 or 1:10 input large enough is cropped with the
+// spec's aspect ratio along its full short side, one too thin fails with guidance
+// instead of producing a crop a few pixels wide
+func TestExtremeAspectRatios(t *testing.T) {
+	spec, err := lookupPhotoSpec(DEFAULT_SPEC_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		width, height int
+		wantErr       bool
+	}{
+		{"10:1", 6000, 600, false},
+		{"1:10", 600, 6000, false},
+		{"thin 10:1", 300, 30, true},
+		{"thin 1:10", 30, 300, true},
+		{"single row", 1000, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Generate(syntheticPhoto(tt.width, tt.height), WithStrategy(STRATEGY_CENTER))
+			if tt.wantErr {
+				var sizeErr *ImageSizeError
+				if !errors.As(err, &sizeErr) {
+					t.Fatalf("error %v, want an *ImageSizeError", err)
+				}
+				if aspect := max(tt.width, tt.height) / min(tt.width, tt.height); aspect > EXTREME_ASPECT_RATIO && !strings.Contains(err.Error(), "cut out the person first") {
+					t.Errorf("error %q gives no guidance for a %d:1 input", err, aspect)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			crop := result.Crop.Rect
+			if tt.width > tt.height && crop.Dy() != tt.height || tt.width < tt.height && crop.Dx() != tt.width {
+				t.Errorf("crop %v of a %dx%d input doesn't use its short side", crop, tt.width, tt.height)
+			}
+			if want := float64(spec.WidthPX) / float64(spec.HeightPX); math.Abs(float64(crop.Dx())/float64(crop.Dy())-want) > 0.01 {
+				t.Errorf("crop %v has aspect %.3f, want %.3f", crop, float64(crop.Dx())/float64(crop.Dy()), want)
+			}
+			if !crop.In(image.Rect(0, 0, tt.width, tt.height)) {
+				t.Errorf("crop %v outside the %dx%d input", crop, tt.width, tt.height)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package passport
+
+import (
+	"io"
+	"os"
+)
+
+const (
+	// Path value of -input / -output that means stdin / stdout
+	STREAM_PATH = "-"
+
+	// Base name for files written next to an image read from stdin (e.g. -save-photo)
+	STREAM_INPUT_NAME = "stdin"
+)
+
+// streamStdout is the real stdout while the sheet is streamed to it. Console
+// messages are redirected to stderr in that mode so they don't corrupt the image.
+var streamStdout *os.File
+
+// redirectConsoleToStderr reserves stdout for the encoded image. Everything printed
+// via fmt.Print* or logged to the console afterwards goes to stderr instead.
+func redirectConsoleToStderr() {
+	streamStdout = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// readInput reads the whole input image, from stdin when path is STREAM_PATH
+func readInput(path string) ([]byte, error) {
+	if path == STREAM_PATH {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes an encoded image, to stdout when path is STREAM_PATH
+func writeOutput(path string, data []byte) error {
+	if path == STREAM_PATH {
+		out := streamStdout
+		if out == nil {
+			out = os.Stdout
+		}
+		_, err := out.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
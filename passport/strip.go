@@ -0,0 +1,80 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+const (
+	// Photos in a photo booth strip, stacked vertically
+	STRIP_PHOTO_COUNT = 4
+
+	// Cut marks are thin gray lines centered in the gaps between photos; the width
+	// is at DPI and scales with the sheet resolution
+	CUT_MARK_WIDTH_PX = 2
+)
+
+// Layouts accepted by -layout
+const (
+	LAYOUT_SHEET = "sheet" // Photos on a standard print format (default)
+	LAYOUT_STRIP = "strip" // Photo booth strip of four, canvas sized to the strip
+)
+
+var layoutModes = []string{LAYOUT_SHEET, LAYOUT_STRIP}
+
+var cutMarkColor = color.RGBA{160, 160, 160, 255}
+
+// validateLayoutMode checks a -layout value
+func validateLayoutMode(mode string) error {
+	for _, m := range layoutModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid layout '%s' (available: %s)", mode, strings.Join(layoutModes, ", "))
+}
+
+// createStripFormat returns a single column of STRIP_PHOTO_COUNT photos whose canvas is
+// exactly as large as the strip: the minimum spacing between the photos and as border
+// around them. Width and height follow the spec, e.g. 39×190mm for 35×45mm photos.
+func createStripFormat(spec PhotoSpec) PrintFormat {
+	widthMM := spec.WidthMM + 2*MIN_SPACING_MM
+	heightMM := STRIP_PHOTO_COUNT*spec.HeightMM + (STRIP_PHOTO_COUNT+1)*MIN_SPACING_MM
+
+	return PrintFormat{
+		Key:            SHEET_STRIP,
+		Name:           fmt.Sprintf("strip %.0fx%.0fmm (%d photos)", widthMM, heightMM, STRIP_PHOTO_COUNT),
+		WidthMM:        widthMM,
+		HeightMM:       heightMM,
+		WidthPX:        mmToPX(widthMM, spec.DPI),
+		HeightPX:       mmToPX(heightMM, spec.DPI),
+		DPI:            spec.DPI,
+		PhotosPerSheet: STRIP_PHOTO_COUNT,
+		Columns:        1,
+		Rows:           STRIP_PHOTO_COUNT,
+		PhotoWidthPX:   spec.WidthPX,
+		PhotoHeightPX:  spec.HeightPX,
+		PhotoWidthMM:   spec.WidthMM,
+		PhotoHeightMM:  spec.HeightMM,
+	}
+}
+
+// drawCutMarks draws a line through the middle of every gap between neighbouring
+// photos, across the whole canvas
+func drawCutMarks(canvas *image.RGBA, grid GridLayout, format PrintFormat) {
+	fill := &image.Uniform{cutMarkColor}
+	width := max(1, CUT_MARK_WIDTH_PX*format.DPI/DPI)
+	for col := 1; col < format.Columns; col++ {
+		left, _ := grid.ColumnMM(col)
+		center := mmToPX(left-grid.SpacingXMM/2, format.DPI)
+		draw.Draw(canvas, image.Rect(center-width/2, 0, center+(width+1)/2, format.HeightPX), fill, image.Point{}, draw.Src)
+	}
+	for row := 1; row < format.Rows; row++ {
+		top, _ := grid.RowMM(row)
+		center := mmToPX(top-grid.SpacingYMM/2, format.DPI)
+		draw.Draw(canvas, image.Rect(0, center-width/2, format.WidthPX, center+(width+1)/2), fill, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,78 @@
+package passport
+
+import (
+	"math"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+const (
+	// Tilt (degrees, both directions) of the extra detection passes enabled by -rotate-search
+	ROTATE_SEARCH_ANGLE = 20.0
+
+	// Gray level filling the corners that a rotated copy leaves uncovered
+	ROTATE_SEARCH_FILL = 128
+)
+
+// searchTiltedFaces reruns the cascade on copies of the grayscale pixels rotated by
+// ±ROTATE_SEARCH_ANGLE around the image center and maps the detections back to the
+// unrotated coordinates. The face box stays axis-aligned; only its center moves.
+func searchTiltedFaces(pixels []uint8, width, height int, runCascade func([]uint8) []pigo.Detection) []pigo.Detection {
+	var faces []pigo.Detection
+	for _, degrees := range []float64{-ROTATE_SEARCH_ANGLE, ROTATE_SEARCH_ANGLE} {
+		rotated := rotateGrayPixels(pixels, width, height, degrees)
+		for _, face := range runCascade(rotated) {
+			x, y := rotatePoint(float64(face.Col), float64(face.Row), width, height, degrees)
+			face.Col = int(math.Round(x))
+			face.Row = int(math.Round(y))
+			faces = append(faces, face)
+		}
+		if len(faces) > 0 {
+			logInfo("📐 Face found on a copy tilted by %+.0f°", degrees)
+			break
+		}
+	}
+	return faces
+}
+
+// hasConfidentFace reports whether any detection scores at least AUTO_ROTATE_MIN_CONFIDENCE
+func hasConfidentFace(faces []pigo.Detection) bool {
+	for _, face := range faces {
+		if float64(face.Q) >= AUTO_ROTATE_MIN_CONFIDENCE {
+			return true
+		}
+	}
+	return false
+}
+
+// rotateGrayPixels rotates a row-major grayscale buffer by degrees (clockwise on
+// screen) around its center, keeping the size. Uncovered pixels are filled with
+// ROTATE_SEARCH_FILL.
+func rotateGrayPixels(pixels []uint8, width, height int, degrees float64) []uint8 {
+	rotated := make([]uint8, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Each output pixel samples the source at the inverse rotation
+			sx, sy := rotatePoint(float64(x), float64(y), width, height, degrees)
+			ix := int(math.Round(sx))
+			iy := int(math.Round(sy))
+			if ix < 0 || iy < 0 || ix >= width || iy >= height {
+				rotated[y*width+x] = ROTATE_SEARCH_FILL
+				continue
+			}
+			rotated[y*width+x] = pixels[iy*width+ix]
+		}
+	}
+	return rotated
+}
+
+// rotatePoint maps a point of an image rotated by degrees back to the unrotated
+// image (rotation by -degrees around the center)
+func rotatePoint(x, y float64, width, height int, degrees float64) (float64, float64) {
+	rad := -degrees * math.Pi / 180
+	cx := float64(width) / 2
+	cy := float64(height) / 2
+	dx := x - cx
+	dy := y - cy
+	return cx + dx*math.Cos(rad) - dy*math.Sin(rad), cy + dx*math.Sin(rad) + dy*math.Cos(rad)
+}
@@ -0,0 +1,89 @@
+package passport
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Units accepted by -units for the reported lengths; the computation always
+// works in millimeters and pixels
+const (
+	UNITS_MM = "mm"
+	UNITS_IN = "in"
+
+	MM_PER_INCH = 25.4
+)
+
+var unitNames = []string{UNITS_MM, UNITS_IN}
+
+// units is the unit every length in the logs, summaries and compliance report is
+// shown in. It doubles as the unit symbol, e.g. 35x45mm or 2x2in.
+var units = UNITS_MM
+
+// setUnits validates and selects the unit of the reported lengths
+func setUnits(unit string) error {
+	for _, u := range unitNames {
+		if u == unit {
+			units = unit
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid units '%s' (available: %s)", unit, strings.Join(unitNames, ", "))
+}
+
+// defaultUnits returns the unit a photo standard is specified in: inches for the
+// US standards, millimeters for everything else
+func defaultUnits(specKey string) string {
+	if strings.HasPrefix(specKey, "us-") {
+		return UNITS_IN
+	}
+	return UNITS_MM
+}
+
+// formatLengthNumber converts a length in millimeters to the selected unit, without
+// the symbol. prec is the number of decimals of a millimeter, and inches get one
+// more; -1 gives the fewest decimals that represent the length (to 1/1000in).
+func formatLengthNumber(mm float64, prec int) string {
+	if units != UNITS_IN {
+		return strconv.FormatFloat(mm, 'f', prec, 64)
+	}
+	inches := mm / MM_PER_INCH
+	if prec < 0 {
+		return strconv.FormatFloat(math.Round(inches*1000)/1000, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(inches, 'f', prec+1, 64)
+}
+
+// formatLength formats a length in millimeters in the selected unit, e.g. 33.7mm or 1.33in
+func formatLength(mm float64, prec int) string {
+	return formatLengthNumber(mm, prec) + units
+}
+
+// formatSignedLength formats an offset with its sign, e.g. +1.2mm or -0.05in
+func formatSignedLength(mm float64, prec int) string {
+	if mm >= 0 {
+		return "+" + formatLength(mm, prec)
+	}
+	return formatLength(mm, prec)
+}
+
+// formatLengthRange formats an allowed band of lengths, e.g. 32-36mm or 1-1.374in
+func formatLengthRange(minMM, maxMM float64, prec int) string {
+	return formatLengthNumber(minMM, prec) + "-" + formatLengthNumber(maxMM, prec) + units
+}
+
+// formatPhysicalSize formats a width and height in millimeters, e.g. 35x45mm or 2x2in
+func formatPhysicalSize(widthMM, heightMM float64, prec int) string {
+	return formatLengthNumber(widthMM, prec) + "x" + formatLengthNumber(heightMM, prec) + units
+}
+
+// localizeDecimals switches the decimal points of a formatted length to the
+// separator of the current language, for the translated summaries
+func localizeDecimals(text string) string {
+	if language == LANG_DE {
+		return strings.ReplaceAll(text, ".", ",")
+	}
+	return text
+}
@@ -0,0 +1,225 @@
+package passport
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// A finished photo's eye line may be off the spec by this fraction of the photo
+	// height; it is a soft target that gives way to the head height and headspace
+	VALIDATE_EYE_LINE_TOLERANCE = 0.1
+
+	// The face center may be off the photo's vertical middle by this fraction of its width
+	VALIDATE_CENTER_TOLERANCE = 0.05
+
+	// Without a head height band in the spec, the head may be off its head height
+	// ratio by this fraction of the photo height
+	VALIDATE_HEAD_HEIGHT_TOLERANCE = 0.05
+
+	// Minimum Laplacian variance of the face box scaled to the spec's pixel size;
+	// below it the photo is too blurry or out of focus
+	VALIDATE_MIN_SHARPNESS = 30.0
+)
+
+// ComplianceCheck is one line of the compliance report
+type ComplianceCheck struct {
+	Name     string `json:"name"`
+	Measured string `json:"measured"`
+	Allowed  string `json:"allowed"`
+	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"` // Couldn't be measured, e.g. skin-based checks on grayscale photos; doesn't fail the photo
+}
+
+// ComplianceResult is the outcome of checking an existing passport photo
+// against a spec without producing a new image (see -validate-only)
+type ComplianceResult struct {
+	Spec   PhotoSpec
+	Face   *FaceDetection // Nil when no face was found
+	Checks []ComplianceCheck
+	Passed bool // Every check that could be measured passed
+}
+
+// ValidatePhoto checks an already finished passport photo against the spec of the
+// options: aspect ratio, head height, eye line, horizontal centering, background
+// and sharpness. Options that only affect the output (sheets, labels) are ignored.
+func ValidatePhoto(img image.Image, opts ...Option) (*ComplianceResult, error) {
+	o := generateOptions{config: defaultConfig()}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	return validatePhoto(img, o.config)
+}
+
+// validatePhoto runs the checks of ValidatePhoto. Not finding a face fails the
+// photo and skips the checks that need it instead of returning an error.
+func validatePhoto(img image.Image, config Config) (*ComplianceResult, error) {
+	img, grayscale := normalizeInput(img)
+	img = flattenAlpha(img, config.AlphaColor)
+	spec := config.Spec
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	result := &ComplianceResult{Spec: spec}
+
+	// A photo of the wrong shape can't be printed at the spec's size
+	aspect := float64(width) / float64(height)
+	specAspect := spec.WidthMM / spec.HeightMM
+	result.add(ComplianceCheck{
+		Name:     "Aspect ratio",
+		Measured: fmt.Sprintf("%.3f (%dx%d pixels)", aspect, width, height),
+		Allowed:  fmt.Sprintf("%.3f ±%.0f%%", specAspect, GRID_ONLY_ASPECT_TOLERANCE*100),
+		Passed:   math.Abs(aspect/specAspect-1) <= GRID_ONLY_ASPECT_TOLERANCE,
+	})
+
+	// The background is measured along the border and needs no face
+	background := checkBackground(img, spec)
+	allowed := "plain white"
+	if !background.Required {
+		allowed = "uniform"
+	}
+	result.add(ComplianceCheck{
+		Name:     "Background",
+		Measured: fmt.Sprintf("luminance %.2f, stddev %.3f, %s", background.MeanLuminance, background.StdDev, background.Cast),
+		Allowed:  allowed,
+		Passed:   background.Passed && background.Uniform,
+	})
+
+	detector := config.Detector
+	if detector == nil {
+		var err error
+		if detector, err = NewFaceDetector(FACE_CASCADE_PATH, config.Detection); err != nil {
+			return nil, err
+		}
+	} else {
+		detector = detector.withOptions(config.Detection)
+	}
+	face, err := detector.detectBest(img)
+	if err != nil {
+		result.add(ComplianceCheck{Name: "Face", Measured: "none found", Allowed: "one face looking at the camera"})
+		return result, nil
+	}
+	face = face.forSizeMode(config.SizeMode)
+	result.Face = face
+
+	centerX, eyeY, crown, chin := estimateHeadLandmarks(face)
+	crown = min(crown, estimateHairTop(img, face, crown))
+	headHeight := measureHeadHeightMM(image.Rect(0, 0, width, height), crown, chin, spec)
+	if spec.HeadHeightMaxMM > 0 {
+		result.add(ComplianceCheck{
+			Name:     "Head height",
+			Measured: formatLength(headHeight, 1),
+			Allowed:  formatLengthRange(spec.HeadHeightMinMM, spec.HeadHeightMaxMM, -1),
+			Passed:   headHeight >= spec.HeadHeightMinMM && headHeight <= spec.HeadHeightMaxMM,
+		})
+	} else {
+		target := spec.HeadHeightRatio * spec.HeightMM
+		tolerance := VALIDATE_HEAD_HEIGHT_TOLERANCE * spec.HeightMM
+		result.add(ComplianceCheck{
+			Name:     "Head height",
+			Measured: formatLength(headHeight, 1),
+			Allowed:  formatLengthRange(target-tolerance, target+tolerance, 1),
+			Passed:   math.Abs(headHeight-target) <= tolerance,
+		})
+	}
+
+	// The eye line is given from the bottom edge, like -eye-line
+	eyeLine := 1 - float64(eyeY)/float64(height)
+	specEyeLine := 1 - spec.EyePositionFromTopRatio
+	result.add(ComplianceCheck{
+		Name:     "Eye line",
+		Measured: fmt.Sprintf("%s above the bottom (%.0f%%)", formatLength(eyeLine*spec.HeightMM, 1), eyeLine*100),
+		Allowed: formatLengthRange((specEyeLine-VALIDATE_EYE_LINE_TOLERANCE)*spec.HeightMM,
+			(specEyeLine+VALIDATE_EYE_LINE_TOLERANCE)*spec.HeightMM, 1),
+		Passed: math.Abs(eyeLine-specEyeLine) <= VALIDATE_EYE_LINE_TOLERANCE,
+	})
+
+	offset := float64(centerX) - float64(width)/2
+	result.add(ComplianceCheck{
+		Name:     "Centering",
+		Measured: fmt.Sprintf("%s from the middle", formatSignedLength(offset*spec.WidthMM/float64(width), 1)),
+		Allowed:  "±" + formatLength(VALIDATE_CENTER_TOLERANCE*spec.WidthMM, 1),
+		Passed:   math.Abs(offset)/float64(width) <= VALIDATE_CENTER_TOLERANCE,
+	})
+
+	// Sharpness depends on the pixel size, so the face is compared at the spec's
+	// resolution whatever size the file has
+	scaleX := float64(spec.WidthPX) / float64(width)
+	scaleY := float64(spec.HeightPX) / float64(height)
+	scaledBox := image.Rect(
+		int(float64(face.X-face.Size/2)*scaleX), int(float64(face.Y-face.Size/2)*scaleY),
+		int(float64(face.X+face.Size/2)*scaleX), int(float64(face.Y+face.Size/2)*scaleY),
+	)
+	scaled := resizeImage(img, spec.WidthPX, spec.HeightPX)
+	sharpness := laplacianVariance(scaled, scaledBox)
+	result.add(ComplianceCheck{
+		Name:     "Sharpness",
+		Measured: fmt.Sprintf("%.0f", sharpness),
+		Allowed:  fmt.Sprintf("at least %.0f", VALIDATE_MIN_SHARPNESS),
+		Passed:   sharpness >= VALIDATE_MIN_SHARPNESS,
+	})
+
+	// The skin-based checks don't work without color
+	yaw := checkYaw(img, face)
+	result.add(ComplianceCheck{
+		Name:     "Facing the camera",
+		Measured: fmt.Sprintf("asymmetry %.2f, skin balance %+.0f%%", yaw.Asymmetry, yaw.SkinBalance*100),
+		Allowed:  fmt.Sprintf("asymmetry up to %.2f, skin balance up to ±%.0f%%", YAW_MAX_ASYMMETRY, YAW_MAX_SKIN_BALANCE*100),
+		Passed:   !yaw.Turned,
+		Skipped:  grayscale || !yaw.Checked,
+	})
+	occlusion := checkEyeOcclusion(img, face, config.EyeOcclusion)
+	result.add(ComplianceCheck{
+		Name:     "Eyes visible",
+		Measured: occlusion.describeCovered() + " covered",
+		Allowed:  fmt.Sprintf("below %.0f%%", occlusion.Threshold*100),
+		Passed:   !occlusion.Occluded,
+		Skipped:  grayscale || !occlusion.Checked,
+	})
+	return result, nil
+}
+
+// add appends a check and keeps Passed up to date; skipped checks don't fail the photo
+func (r *ComplianceResult) add(check ComplianceCheck) {
+	if len(r.Checks) == 0 {
+		r.Passed = true
+	}
+	if check.Skipped {
+		check.Measured = "not checked"
+	} else if !check.Passed {
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// printComplianceResult prints the pass/fail report of -validate-only on stdout
+func printComplianceResult(result *ComplianceResult) {
+	fmt.Print(msg("validate.title", result.Spec.Name, formatPhysicalSize(result.Spec.WidthMM, result.Spec.HeightMM, -1)))
+	for _, check := range result.Checks {
+		mark := "✅"
+		switch {
+		case check.Skipped:
+			mark = "➖"
+		case !check.Passed:
+			mark = "❌"
+		}
+		fmt.Print(msg("validate.check", mark, check.Name, check.Measured, check.Allowed))
+	}
+	if result.Passed {
+		fmt.Print(msg("validate.passed"))
+	} else {
+		fmt.Print(msg("validate.failed"))
+	}
+}
+
+// validateInput loads config.InputPath and checks it with validatePhoto
+func validateInput(config Config) (*ComplianceResult, error) {
+	source, err := loadImage(config.InputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading image: %v", err)
+	}
+	img, _ := applyColorProfile(source.Image, source.ICCProfile, COLOR_PROFILE_SRGB)
+	return validatePhoto(img, config)
+}
@@ -0,0 +1,65 @@
+package passport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime/debug"
+)
+
+// TOOL_NAME identifies the generator in the JPEG comment of its outputs
+const TOOL_NAME = "passport-image-generator"
+
+// version is set for release builds with -ldflags "-X passport-photo-generator/passport.version=1.0.3"
+var version = ""
+
+// toolVersion returns the version stamped into reports and outputs: the ldflags
+// version, else the module version or VCS revision of the build, else "dev"
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "dev-" + revision
+}
+
+// addJPEGComment inserts a COM segment with text right after the SOI marker of an
+// encoded JPEG. Call it before addJFIFDensity, which must stay the first segment.
+func addJPEGComment(data []byte, text string) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 || len(text) > 0xFFFF-2 {
+		return data
+	}
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xFE})
+	binary.Write(&segment, binary.BigEndian, uint16(2+len(text)))
+	segment.WriteString(text)
+
+	result := make([]byte, 0, len(data)+segment.Len())
+	result = append(result, data[:2]...)
+	result = append(result, segment.Bytes()...)
+	return append(result, data[2:]...)
+}
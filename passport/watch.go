@@ -0,0 +1,224 @@
+package passport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// The watch subcommand lists the incoming directory this often
+	WATCH_POLL_INTERVAL = 2 * time.Second
+
+	// A new file is picked up once its size and modification time haven't changed
+	// for this long, so files still being copied are left alone
+	WATCH_STABLE_PERIOD = 3 * time.Second
+
+	// Subdirectories of the incoming directory that receive the handled sources
+	WATCH_PROCESSED_DIR = "processed"
+	WATCH_FAILED_DIR    = "failed"
+
+	// Log of handled files in the outgoing directory, one tab-separated line per file:
+	// time, status, name, size, modification time (Unix nanoseconds), details
+	WATCH_LOG_NAME = "watch.log"
+)
+
+// watchFile is the state of a file the poller has seen but not handed out yet
+type watchFile struct {
+	size    int64
+	modTime time.Time
+	stable  time.Time // When size and modTime were first seen unchanged
+}
+
+// watchLog is the persistent record of handled files. A file that shows up again
+// with the same name, size and modification time, e.g. because it couldn't be moved
+// away, is not processed a second time after a restart.
+type watchLog struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]bool
+}
+
+// watchLogKey identifies a file version in the watch log
+func watchLogKey(name string, size int64, modTime time.Time) string {
+	return name + "\t" + strconv.FormatInt(size, 10) + "\t" + strconv.FormatInt(modTime.UnixNano(), 10)
+}
+
+// openWatchLog reads the handled files from the log at path and opens it for appending
+func openWatchLog(path string) (*watchLog, error) {
+	history := &watchLog{done: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading watch log: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Split(line, "\t"); len(fields) >= 5 {
+			history.done[strings.Join(fields[2:5], "\t")] = true
+		}
+	}
+	if history.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return nil, fmt.Errorf("error opening watch log: %v", err)
+	}
+	return history, nil
+}
+
+// handled reports whether the file version identified by key was processed before
+func (l *watchLog) handled(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.done[key]
+}
+
+// record appends the outcome for a file version to the log
+func (l *watchLog) record(key, status, details string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done[key] = true
+	details = strings.NewReplacer("\t", " ", "\n", " ").Replace(details)
+	if _, err := fmt.Fprintf(l.file, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), status, key, details); err != nil {
+		logWarn("⚠️  Could not write the watch log: %v", err)
+	}
+}
+
+// runWatch is the hot folder of the watch subcommand: images dropped into
+// config.WatchDir are processed with the same settings by config.Jobs workers, the
+// sheets and crop reports are written to config.OutputDir, and each source is moved
+// to the processed or failed subdirectory. SIGINT or SIGTERM stops picking up new
+// files; the images in progress are finished first.
+func runWatch(config Config) error {
+	for _, dir := range []string{WATCH_PROCESSED_DIR, WATCH_FAILED_DIR} {
+		if err := os.MkdirAll(filepath.Join(config.WatchDir, dir), 0755); err != nil {
+			return fmt.Errorf("error creating %s directory: %v", dir, err)
+		}
+	}
+	history, err := openWatchLog(filepath.Join(config.OutputDir, WATCH_LOG_NAME))
+	if err != nil {
+		return err
+	}
+	defer history.file.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	type watchItem struct {
+		path string
+		key  string
+	}
+	queue := make(chan watchItem)
+	var inFlight sync.Map
+	var workers sync.WaitGroup
+	for i := 0; i < config.Jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for item := range queue {
+				processWatchItem(item.path, item.key, config, history)
+				inFlight.Delete(item.path)
+			}
+		}()
+	}
+
+	logInfo("👀 Watching %s for new images (%d at a time), writing to %s - stop with Ctrl+C", config.WatchDir, config.Jobs, config.OutputDir)
+	pending := make(map[string]*watchFile)
+	ticker := time.NewTicker(WATCH_POLL_INTERVAL)
+	defer ticker.Stop()
+poll:
+	for {
+		paths, err := listBatchInputs(config.WatchDir)
+		if err != nil {
+			logWarn("⚠️  Error reading watch directory: %v", err)
+		}
+		seen := make(map[string]bool, len(paths))
+		for _, path := range paths {
+			seen[path] = true
+			if _, busy := inFlight.Load(path); busy {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			key := watchLogKey(filepath.Base(path), info.Size(), info.ModTime())
+			if history.handled(key) {
+				continue
+			}
+
+			// Wait until the file stopped changing
+			now := time.Now()
+			file := pending[path]
+			if file == nil || file.size != info.Size() || !file.modTime.Equal(info.ModTime()) {
+				pending[path] = &watchFile{size: info.Size(), modTime: info.ModTime(), stable: now}
+				continue
+			}
+			if now.Sub(file.stable) < WATCH_STABLE_PERIOD {
+				continue
+			}
+
+			delete(pending, path)
+			inFlight.Store(path, true)
+			select {
+			case queue <- watchItem{path: path, key: key}:
+			case <-ctx.Done():
+				inFlight.Delete(path)
+				break poll
+			}
+		}
+		for path := range pending {
+			if !seen[path] {
+				delete(pending, path)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break poll
+		}
+	}
+
+	logInfo("\n🛑 Stopping, finishing the images in progress...")
+	close(queue)
+	workers.Wait()
+	logInfo("👋 Watch stopped")
+	return nil
+}
+
+// processWatchItem runs the pipeline on one file of the hot folder, records the
+// outcome and moves the source out of the incoming directory
+func processWatchItem(path, key string, config Config, history *watchLog) {
+	name := filepath.Base(path)
+	logInfo("\n📥 %s", name)
+
+	fileConfig := config
+	fileConfig.InputPath = path
+	result, err := generateOutputs(fileConfig)
+	status, details := WATCH_PROCESSED_DIR, ""
+	switch {
+	case err != nil:
+		status, details = WATCH_FAILED_DIR, err.Error()
+		logError("❌ %s: %v", name, err)
+	case !result.FaceFound && result.Strategy != STRATEGY_GRID_ONLY:
+		status, details = WATCH_FAILED_DIR, "no face found, cropped with the "+result.Strategy+" strategy"
+	case !result.Background.Passed:
+		status, details = WATCH_FAILED_DIR, "background does not meet the spec"
+	}
+
+	target := filepath.Join(config.WatchDir, status, name)
+	if _, err := os.Stat(target); err == nil {
+		// Don't overwrite an earlier file of the same name
+		ext := filepath.Ext(name)
+		target = filepath.Join(config.WatchDir, status, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102-150405"), ext))
+	}
+	if err := os.Rename(path, target); err != nil {
+		logWarn("⚠️  Could not move %s to %s: %v", name, status, err)
+	}
+	history.record(key, status, details)
+	logInfo("📤 %s: %s", name, status)
+}
@@ -0,0 +1,210 @@
+package passport
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// -white-balance corrects the light toward this color temperature (D65 daylight)
+	WHITE_BALANCE_REFERENCE_KELVIN = 6500
+
+	// Color temperatures accepted by WithWhiteBalance and searched for the gray world
+	// estimate
+	MIN_WHITE_BALANCE_KELVIN = 1500
+	MAX_WHITE_BALANCE_KELVIN = 15000
+
+	// Channel gains are kept within 1/2-2 of the green channel, so a wrong hint or a
+	// photo filled by one strong color can't turn it into a different one
+	WHITE_BALANCE_MAX_GAIN = 2.0
+
+	// The gray world mean skips clipped highlights and near-black pixels (0-255),
+	// which carry no color information
+	WHITE_BALANCE_MIN_LEVEL = 10
+	WHITE_BALANCE_MAX_LEVEL = 250
+)
+
+// Color temperature of the EXIF LightSource values (EXIF 2.3, tag 0x9208); 0
+// (unknown) and 255 (other) name no light
+var exifLightSources = map[int]struct {
+	name   string
+	kelvin int
+}{
+	1:  {"daylight", 5500},
+	2:  {"fluorescent", 4200},
+	3:  {"tungsten", 3200},
+	4:  {"flash", 5500},
+	9:  {"fine weather", 5500},
+	10: {"cloudy", 6500},
+	11: {"shade", 7500},
+	12: {"daylight fluorescent", 6400},
+	13: {"day white fluorescent", 5000},
+	14: {"cool white fluorescent", 4200},
+	15: {"white fluorescent", 3500},
+	16: {"warm white fluorescent", 3000},
+	17: {"standard light A", 2856},
+	18: {"standard light B", 4874},
+	19: {"standard light C", 6774},
+	20: {"D55", 5500},
+	21: {"D65", 6500},
+	22: {"D75", 7500},
+	23: {"D50", 5000},
+	24: {"ISO studio tungsten", 3200},
+}
+
+// exifLightSource returns the name and color temperature of the light source the
+// camera recorded in data, or 0 when there is none
+func exifLightSource(data []byte) (string, int) {
+	exifData, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", 0
+	}
+	tag, err := exifData.Get(exif.LightSource)
+	if err != nil {
+		return "", 0
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return "", 0
+	}
+	light, ok := exifLightSources[value]
+	if !ok {
+		return "", 0
+	}
+	return light.name, light.kelvin
+}
+
+// validateWhiteBalanceKelvin checks a light source color temperature; 0 means none
+func validateWhiteBalanceKelvin(kelvin int) error {
+	if kelvin != 0 && (kelvin < MIN_WHITE_BALANCE_KELVIN || kelvin > MAX_WHITE_BALANCE_KELVIN) {
+		return fmt.Errorf("invalid color temperature %dK (must be 0 or between %d and %dK)", kelvin, MIN_WHITE_BALANCE_KELVIN, MAX_WHITE_BALANCE_KELVIN)
+	}
+	return nil
+}
+
+// kelvinToRGB approximates the color of a black body at the given temperature
+// (0-1 per channel), after Tanner Helland's fit of the CIE data
+func kelvinToRGB(kelvin float64) [3]float64 {
+	t := kelvin / 100
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(255, v)) / 255 }
+	return [3]float64{clamp(r), clamp(g), clamp(b)}
+}
+
+// kelvinGains returns the channel gains that turn light of the given temperature
+// into WHITE_BALANCE_REFERENCE_KELVIN, relative to green
+func kelvinGains(kelvin float64) [3]float64 {
+	light := kelvinToRGB(kelvin)
+	reference := kelvinToRGB(WHITE_BALANCE_REFERENCE_KELVIN)
+	var gains [3]float64
+	for c := range gains {
+		gains[c] = reference[c] / math.Max(light[c], 1.0/255)
+	}
+	return normalizeGains(gains)
+}
+
+// normalizeGains scales gains to a green gain of 1 and limits them to WHITE_BALANCE_MAX_GAIN
+func normalizeGains(gains [3]float64) [3]float64 {
+	green := gains[1]
+	for c := range gains {
+		gains[c] = math.Max(1/WHITE_BALANCE_MAX_GAIN, math.Min(WHITE_BALANCE_MAX_GAIN, gains[c]/green))
+	}
+	return gains
+}
+
+// grayWorldGains returns the gains that make the mean color of the photo neutral,
+// or false when too few pixels carry color information
+func grayWorldGains(photo image.Image) ([3]float64, bool) {
+	bounds := photo.Bounds()
+	var sum [3]float64
+	count := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := photo.At(x, y).RGBA()
+			pixel := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+			lo := math.Min(pixel[0], math.Min(pixel[1], pixel[2]))
+			hi := math.Max(pixel[0], math.Max(pixel[1], pixel[2]))
+			if lo < WHITE_BALANCE_MIN_LEVEL || hi > WHITE_BALANCE_MAX_LEVEL {
+				continue
+			}
+			for c := range sum {
+				sum[c] += pixel[c]
+			}
+			count++
+		}
+	}
+	if count < bounds.Dx()*bounds.Dy()/10 {
+		return [3]float64{1, 1, 1}, false
+	}
+	return normalizeGains([3]float64{sum[1] / sum[0], 1, sum[1] / sum[2]}), true
+}
+
+// estimateKelvin returns the light temperature whose correction comes closest to
+// gains in the red to blue balance
+func estimateKelvin(gains [3]float64) int {
+	best, bestError := WHITE_BALANCE_REFERENCE_KELVIN, math.Inf(1)
+	for kelvin := MIN_WHITE_BALANCE_KELVIN; kelvin <= MAX_WHITE_BALANCE_KELVIN; kelvin += 100 {
+		candidate := kelvinGains(float64(kelvin))
+		if err := math.Abs(math.Log(candidate[0]/candidate[2]) - math.Log(gains[0]/gains[2])); err < bestError {
+			best, bestError = kelvin, err
+		}
+	}
+	return best
+}
+
+// whiteBalance corrects the color of the light in the photo: for the temperature of
+// the light source hint when there is one (kelvin, e.g. from the EXIF light source),
+// else for the gray world estimate of the photo's mean color
+func whiteBalance(photo image.Image, kelvin int) image.Image {
+	var gains [3]float64
+	if kelvin > 0 {
+		gains = kelvinGains(float64(kelvin))
+		logInfo("🌡️  White balance for %dK light from the light source hint (gains R %.2f, B %.2f)", kelvin, gains[0], gains[2])
+	} else {
+		var ok bool
+		if gains, ok = grayWorldGains(photo); !ok {
+			logInfo("🌡️  White balance skipped (too few pixels between black and clipped white)")
+			return photo
+		}
+		logInfo("🌡️  White balance for about %dK light estimated by gray world (gains R %.2f, B %.2f)", estimateKelvin(gains), gains[0], gains[2])
+	}
+
+	var tables [3][256]uint8
+	for c := range tables {
+		for i := range tables[c] {
+			tables[c][i] = uint8(math.Round(math.Min(255, float64(i)*gains[c])))
+		}
+	}
+	bounds := photo.Bounds()
+	balanced := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := balanced.PixOffset(x, y)
+			balanced.Pix[i] = tables[0][r>>8]
+			balanced.Pix[i+1] = tables[1][g>>8]
+			balanced.Pix[i+2] = tables[2][b>>8]
+			balanced.Pix[i+3] = 255
+		}
+	}
+	return balanced
+}
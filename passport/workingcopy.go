@@ -0,0 +1,179 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+)
+
+// Face detection, the crop strategies and the compliance checks run on a copy of
+// the input whose long side is at most this many pixels: four times the pixels of
+// the detection copy, so a head filling the frame still spans more pixels than the
+// photo and the crop lands within a fraction of a photo pixel
+const WORKING_MAX_DIMENSION = 2 * DETECTION_MAX_DIMENSION
+
+// workingCopy returns img box-downsampled so its long side fits WORKING_MAX_DIMENSION,
+// and the scale of the copy relative to img. Smaller images are returned as they are
+// with a scale of 1.
+func workingCopy(img image.Image) (image.Image, float64) {
+	bounds := img.Bounds()
+	longSide := max(bounds.Dx(), bounds.Dy())
+	if longSide <= WORKING_MAX_DIMENSION {
+		return img, 1
+	}
+	scale := float64(WORKING_MAX_DIMENSION) / float64(longSide)
+	width := max(1, int(float64(bounds.Dx())*scale+0.5))
+	height := max(1, int(float64(bounds.Dy())*scale+0.5))
+	return boxDownsample(img, width, height), scale
+}
+
+// boxDownsample averages the source pixels covered by each pixel of a width×height
+// copy of img, one source row at a time. JPEG (YCbCr) and RGBA images are read
+// straight from their pixel buffers, since every source pixel is visited once.
+func boxDownsample(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Destination column of every source column, and the source pixels per column
+	columns := make([]int, bounds.Dx())
+	counts := make([]int, width)
+	for x := range columns {
+		columns[x] = x * width / bounds.Dx()
+		counts[columns[x]]++
+	}
+
+	// readRow adds source row y into sums (4 channels per destination column)
+	var readRow func(y int, sums []int)
+	switch src := img.(type) {
+	case *image.YCbCr:
+		// Averaging Y, Cb and Cr gives the same result as averaging RGB, up to
+		// rounding, because the conversion is affine. The chroma offset grows with
+		// x the same way on every row.
+		chroma := make([]int, bounds.Dx())
+		for x := range chroma {
+			chroma[x] = src.COffset(bounds.Min.X+x, bounds.Min.Y) - src.COffset(bounds.Min.X, bounds.Min.Y)
+		}
+		readRow = func(y int, sums []int) {
+			luma := src.Y[src.YOffset(bounds.Min.X, y):]
+			cb := src.Cb[src.COffset(bounds.Min.X, y):]
+			cr := src.Cr[src.COffset(bounds.Min.X, y):]
+			for x, column := range columns {
+				sum := sums[4*column : 4*column+3]
+				sum[0] += int(luma[x])
+				sum[1] += int(cb[chroma[x]])
+				sum[2] += int(cr[chroma[x]])
+			}
+		}
+	case *image.RGBA:
+		readRow = func(y int, sums []int) {
+			pix := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			for x, column := range columns {
+				sum, p := sums[4*column:4*column+4], pix[4*x:4*x+4]
+				sum[0] += int(p[0])
+				sum[1] += int(p[1])
+				sum[2] += int(p[2])
+				sum[3] += int(p[3])
+			}
+		}
+	default:
+		readRow = func(y int, sums []int) {
+			for x, column := range columns {
+				r, g, b, a := img.At(bounds.Min.X+x, y).RGBA()
+				sum := sums[4*column : 4*column+4]
+				sum[0] += int(r >> 8)
+				sum[1] += int(g >> 8)
+				sum[2] += int(b >> 8)
+				sum[3] += int(a >> 8)
+			}
+		}
+	}
+	_, isYCbCr := img.(*image.YCbCr)
+
+	sums := make([]int, 4*width)
+	y := bounds.Min.Y
+	for row := 0; row < height; row++ {
+		clear(sums)
+		rows := 0
+		for ; y < bounds.Min.Y+(row+1)*bounds.Dy()/height; y++ {
+			readRow(y, sums)
+			rows++
+		}
+		pix := dst.Pix[dst.PixOffset(0, row):]
+		for column := 0; column < width; column++ {
+			n := max(1, counts[column]*rows)
+			var mean [4]uint8
+			for c := range mean {
+				mean[c] = uint8((sums[4*column+c] + n/2) / n)
+			}
+			if isYCbCr {
+				mean[0], mean[1], mean[2] = color.YCbCrToRGB(mean[0], mean[1], mean[2])
+				mean[3] = 255
+			}
+			copy(pix[4*column:], mean[:])
+		}
+	}
+	return dst
+}
+
+// scaleCropGeometry maps a crop found on a working copy of size from back to the
+// image of size to it was made from. Both sides of the copy were rounded, so each
+// axis has its own scale and the copy's edges map exactly onto the image's edges.
+func scaleCropGeometry(crop CropGeometry, from, to image.Point) CropGeometry {
+	if from == to {
+		return crop
+	}
+	// The crop is in pixels of the turned image
+	if crop.Rotation == 90 || crop.Rotation == 270 {
+		from, to = image.Pt(from.Y, from.X), image.Pt(to.Y, to.X)
+	}
+	atX := func(v int) int { return int(float64(v)*float64(to.X)/float64(from.X) + 0.5) }
+	atY := func(v int) int { return int(float64(v)*float64(to.Y)/float64(from.Y) + 0.5) }
+	rect := func(r image.Rectangle) image.Rectangle {
+		if r.Empty() {
+			return r
+		}
+		return image.Rect(atX(r.Min.X), atY(r.Min.Y), atX(r.Max.X), atY(r.Max.Y))
+	}
+	crop.Rect = rect(crop.Rect)
+	crop.Face = rect(crop.Face)
+	crop.Correction = image.Pt(atX(crop.Correction.X), atY(crop.Correction.Y))
+	crop.Shoulders.ShiftedPX = atY(crop.Shoulders.ShiftedPX)
+	return crop
+}
+
+// renderCrop cuts crop out of the full-resolution img and scales it to the photo
+// size, the only step of the pipeline that reads the full image after the working
+// copy was made
+func renderCrop(img image.Image, crop CropGeometry, spec PhotoSpec, pad string) (image.Image, error) {
+	cropped, err := cutCrop(img, crop, pad)
+	if err != nil {
+		return nil, err
+	}
+	return resizeImage(cropped, spec.WidthPX, spec.HeightPX), nil
+}
+
+// cutCrop returns the pixels of crop in img at img's resolution, copied through
+// cropImage. A crop reaching past the edges is padded as the strategy would have
+// done, and an auto-rotated crop is cut from the upright image and turned
+// afterwards, so img is never rotated whole.
+func cutCrop(img image.Image, crop CropGeometry, pad string) (image.Image, error) {
+	bounds := img.Bounds()
+	rotation := exifOrientationMatrices[rotationOrientations[crop.Rotation]]
+	rect := rotation.mapBack(crop.Rect, bounds.Size()).Add(bounds.Min)
+	if pad == PAD_SNAP && !rect.In(bounds) {
+		// Scaling the crop up from the working copy can round it a pixel past the
+		// edge: move it back inside at the same size, so the face isn't stretched.
+		// A crop larger than the image can't be moved inside and is refused.
+		if rect.Dx() > bounds.Dx() || rect.Dy() > bounds.Dy() {
+			return nil, checkCropRect("crop", rect, bounds, pad)
+		}
+		rect = rect.Add(image.Pt(
+			max(0, bounds.Min.X-rect.Min.X)-max(0, rect.Max.X-bounds.Max.X),
+			max(0, bounds.Min.Y-rect.Min.Y)-max(0, rect.Max.Y-bounds.Max.Y)))
+	}
+
+	cropped, err := paddedCrop(img, rect, pad)
+	if err != nil {
+		return nil, err
+	}
+	return rotateImage(cropped, crop.Rotation), nil
+}
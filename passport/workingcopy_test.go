@@ -0,0 +1,104 @@
+package passport
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+// syntheticPhoto returns a width×height YCbCr image like a decoded camera JPEG: a
+// light gradient background with a darker oval where a head would be
+func syntheticPhoto(width, height int) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	cx, cy := float64(width)/2, float64(height)*0.4
+	rx, ry := float64(width)*0.15, float64(height)*0.2
+	for y := 0; y < height; y++ {
+		dy := (float64(y) - cy) / ry
+		for x := 0; x < width; x++ {
+			dx := (float64(x) - cx) / rx
+			luma := uint8(200 + 40*y/height)
+			if dx*dx+dy*dy < 1 {
+				luma = 120
+			}
+			img.Y[y*img.YStride+x] = luma
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	return img
+}
+
+// The whole pipeline on a 40MP photo: only the bounded working copy is analyzed and
+// the full resolution is read once for the working copy and once for the crop
+func BenchmarkGenerateLarge(b *testing.B) {
+	img := syntheticPhoto(7304, 5478)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Generate(img); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Under snap padding a crop a pixel past the edge is moved back inside at its size,
+// and one larger than the image is refused instead of being shrunk to the image,
+// which changed its aspect ratio and stretched the face
+func TestCutCrop(t *testing.T) {
+	img := coordinateImage(image.Rect(10, 5, 110, 85))
+	tests := []struct {
+		name    string
+		crop    image.Rectangle
+		wantMin image.Point // Image pixel at the crop's top-left corner
+		wantErr bool
+	}{
+		{"inside", image.Rect(10, 10, 40, 50), image.Pt(20, 15), false},
+		{"a pixel past the bottom right", image.Rect(71, 41, 101, 81), image.Pt(80, 45), false},
+		{"past the top left", image.Rect(-2, -1, 28, 39), image.Pt(10, 5), false},
+		{"wider than the image", image.Rect(-5, 0, 105, 80), image.Point{}, true},
+		{"taller than the image", image.Rect(0, -10, 60, 81), image.Point{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cropped, err := cutCrop(img, CropGeometry{Rect: tt.crop}, PAD_SNAP)
+			if tt.wantErr {
+				var sizeErr *ImageSizeError
+				if !errors.As(err, &sizeErr) {
+					t.Fatalf("error %v, want an *ImageSizeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rgba, ok := cropped.(*image.RGBA)
+			if !ok || rgba.Bounds() != image.Rect(0, 0, tt.crop.Dx(), tt.crop.Dy()) {
+				t.Fatalf("got %T with bounds %v, want a %dx%d copy", cropped, cropped.Bounds(), tt.crop.Dx(), tt.crop.Dy())
+			}
+			for _, at := range []image.Point{{0, 0}, {tt.crop.Dx() - 1, tt.crop.Dy() - 1}} {
+				if got, want := rgba.RGBAAt(at.X, at.Y), coordinateColor(tt.wantMin.X+at.X, tt.wantMin.Y+at.Y); got != want {
+					t.Errorf("pixel %v is %v, want %v", at, got, want)
+				}
+			}
+
+			// A copy, not a view of the input
+			rgba.Pix[0]++
+			if img.RGBAAt(tt.wantMin.X, tt.wantMin.Y) != coordinateColor(tt.wantMin.X, tt.wantMin.Y) {
+				t.Error("writing to the crop changed the input")
+			}
+		})
+	}
+
+	// Padding keeps a crop larger than the image at its size
+	padded, err := cutCrop(img, CropGeometry{Rect: image.Rect(-5, 0, 105, 80)}, PAD_WHITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if padded.Bounds() != image.Rect(0, 0, 110, 80) {
+		t.Errorf("padded crop %v, want 110x80", padded.Bounds())
+	}
+	if got, want := toRGBA(padded).RGBAAt(5, 0), coordinateColor(10, 5); got != want {
+		t.Errorf("padded crop shows %v at the image corner, want %v", got, want)
+	}
+}
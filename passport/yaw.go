@@ -0,0 +1,114 @@
+package passport
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// The face box is compared at this resolution (pixels per side)
+	YAW_SAMPLE_SIZE = 64
+
+	// A face counts as turned when its halves differ by more than this: the mean
+	// luminance difference (0-1) between mirrored skin pixel pairs. Frontal faces
+	// measure about 0.05, heads turned by 15-20° above 0.1.
+	YAW_MAX_ASYMMETRY = 0.09
+
+	// ... or when this much more skin shows on one side of the face center than on
+	// the other (0-1); frontal faces stay below 0.08
+	YAW_MAX_SKIN_BALANCE = 0.15
+)
+
+// YawCheck is the result of comparing the left and right half of the face
+type YawCheck struct {
+	Face        image.Rectangle // Compared face box in image coordinates
+	Asymmetry   float64         // Mean luminance difference of mirrored skin pixels (0-1)
+	SkinBalance float64         // (right - left) / total skin pixels; positive means more skin on the right
+	Checked     bool            // False when too little skin was found to compare
+	Turned      bool            // The head seems turned away from the camera
+}
+
+// isSkin is a coarse RGB skin classifier (Peer et al.), good enough to keep hair
+// and background out of the comparison
+func isSkin(r, g, b uint32) bool {
+	maxC := max(r, g, b)
+	minC := min(r, g, b)
+	return r > 95 && g > 40 && b > 20 && maxC-minC > 15 && r > g && r > b && r-g > 15
+}
+
+// checkYaw compares the face with its mirror image. A face looking straight at the
+// camera is nearly symmetric; a turned head shows more of one cheek and the nose
+// and eyes shift off the center line, which raises both measures.
+func checkYaw(img image.Image, face *FaceDetection) YawCheck {
+	bounds := img.Bounds()
+	box := image.Rect(face.X-face.Size/2, face.Y-face.Size/2, face.X+face.Size/2, face.Y+face.Size/2).
+		Intersect(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	check := YawCheck{Face: box}
+	if box.Dx() < 2 || box.Dy() < 2 {
+		return check
+	}
+
+	// Luminance and skin mask of the face box on a small grid
+	var luminance [YAW_SAMPLE_SIZE][YAW_SAMPLE_SIZE]float64
+	var skin [YAW_SAMPLE_SIZE][YAW_SAMPLE_SIZE]bool
+	for y := 0; y < YAW_SAMPLE_SIZE; y++ {
+		for x := 0; x < YAW_SAMPLE_SIZE; x++ {
+			sx := box.Min.X + (2*x+1)*box.Dx()/(2*YAW_SAMPLE_SIZE)
+			sy := box.Min.Y + (2*y+1)*box.Dy()/(2*YAW_SAMPLE_SIZE)
+			r, g, b, _ := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			luminance[y][x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 255
+			skin[y][x] = isSkin(r, g, b)
+		}
+	}
+
+	var diffSum float64
+	pairs, left, right := 0, 0, 0
+	for y := 0; y < YAW_SAMPLE_SIZE; y++ {
+		for x := 0; x < YAW_SAMPLE_SIZE/2; x++ {
+			mirror := YAW_SAMPLE_SIZE - 1 - x
+			if skin[y][x] {
+				left++
+			}
+			if skin[y][mirror] {
+				right++
+			}
+			if skin[y][x] && skin[y][mirror] {
+				diffSum += math.Abs(luminance[y][x] - luminance[y][mirror])
+				pairs++
+			}
+		}
+	}
+	if pairs < YAW_SAMPLE_SIZE*YAW_SAMPLE_SIZE/10 {
+		return check
+	}
+
+	check.Checked = true
+	check.Asymmetry = diffSum / float64(pairs)
+	check.SkinBalance = float64(right-left) / float64(left+right)
+	check.Turned = check.Asymmetry > YAW_MAX_ASYMMETRY || math.Abs(check.SkinBalance) > YAW_MAX_SKIN_BALANCE
+	return check
+}
+
+// Direction returns which way the head is turned as seen in the photo: more skin on
+// the right half means the face center moved left
+func (c YawCheck) Direction() string {
+	if c.SkinBalance > 0 {
+		return "left"
+	}
+	return "right"
+}
+
+// printYawCheck reports the yaw estimate as a compliance warning
+func printYawCheck(check YawCheck) {
+	if !check.Checked {
+		logInfo("ℹ️  Head turn not checked (too little skin visible in the face box)")
+		return
+	}
+	if check.Turned {
+		logWarn("⚠️  Head seems turned to the %s (asymmetry %.2f, limit %.2f; skin balance %+.0f%%, limit %.0f%%) - look straight at the camera",
+			check.Direction(), check.Asymmetry, YAW_MAX_ASYMMETRY, check.SkinBalance*100, YAW_MAX_SKIN_BALANCE*100)
+		return
+	}
+	logInfo("🧑 Facing the camera (asymmetry %.2f, skin balance %+.0f%%)", check.Asymmetry, check.SkinBalance*100)
+}
@@ -0,0 +1,79 @@
+package passport
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// Synthetic faces for the yaw tests: a face box of yawFaceSize pixels centered in
+// the image, on a gray background that no skin classifier accepts
+const (
+	yawImageSize = 300
+	yawFaceSize  = 200
+)
+
+// skewedFace draws a skin-colored face oval whose center is shifted by shift (a
+// fraction of the face radius, positive to the right) and whose right cheek is
+// darkened by shade (0-1), like a head turned away from a window
+func skewedFace(shift, shade float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, yawImageSize, yawImageSize))
+	center := float64(yawImageSize) / 2
+	rx, ry := float64(yawFaceSize)*0.4, float64(yawFaceSize)*0.48
+	cx := center + shift*rx
+	for y := 0; y < yawImageSize; y++ {
+		for x := 0; x < yawImageSize; x++ {
+			c := color.RGBA{128, 128, 128, 255}
+			dx, dy := (float64(x)-cx)/rx, (float64(y)-center)/ry
+			if dx*dx+dy*dy < 1 {
+				light := 1.0
+				if dx > 0 {
+					light -= shade * dx
+				}
+				c = color.RGBA{uint8(220 * light), uint8(170 * light), uint8(140 * light), 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestCheckYaw(t *testing.T) {
+	face := &FaceDetection{X: yawImageSize / 2, Y: yawImageSize / 2, Size: yawFaceSize}
+	tests := []struct {
+		name          string
+		shift, shade  float64
+		wantTurned    bool
+		wantDirection string
+	}{
+		{"frontal", 0, 0, false, ""},
+		{"slightly off center", 0.05, 0, false, ""},
+		// A turned head shows more of the cheek on the side it turns away from
+		{"more cheek on the left", -0.3, 0, true, "right"},
+		{"more cheek on the right", 0.3, 0, true, "left"},
+		{"one cheek in shadow", 0, 0.4, true, ""},
+		{"soft shading", 0, 0.1, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkYaw(skewedFace(tt.shift, tt.shade), face)
+			if !check.Checked {
+				t.Fatal("face not checked")
+			}
+			if check.Turned != tt.wantTurned {
+				t.Errorf("turned %v (asymmetry %.3f, skin balance %+.3f), want %v", check.Turned, check.Asymmetry, check.SkinBalance, tt.wantTurned)
+			}
+			if tt.wantDirection != "" && check.Direction() != tt.wantDirection {
+				t.Errorf("turned to the %s, want %s", check.Direction(), tt.wantDirection)
+			}
+		})
+	}
+
+	// Without skin in the face box there is nothing to compare
+	gray := image.NewRGBA(image.Rect(0, 0, yawImageSize, yawImageSize))
+	draw.Draw(gray, gray.Bounds(), &image.Uniform{color.RGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+	if check := checkYaw(gray, face); check.Checked || check.Turned {
+		t.Errorf("gray face box checked %v, turned %v", check.Checked, check.Turned)
+	}
+}